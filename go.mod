@@ -7,7 +7,6 @@ require (
 	github.com/Masterminds/semver v1.5.0
 	github.com/ReneKroon/ttlcache/v2 v2.3.0
 	github.com/VividCortex/mysqlerr v1.0.0
-	github.com/Xeoncross/go-aesctr-with-hmac v0.0.0-20200623134604-12b17a7ff502
 	github.com/alecthomas/template v0.0.0-20190718012654-fb15b899a751
 	github.com/antonmedv/expr v1.9.0
 	github.com/breeswish/gin-jwt/v2 v2.6.4-jwt-patch
@@ -27,11 +26,11 @@ require (
 	github.com/joho/godotenv v1.3.0
 	github.com/joomcode/errorx v1.0.1
 	github.com/minio/sio v0.3.0
-	github.com/oleiade/reflections v1.0.1
 	github.com/pingcap/check v0.0.0-20191216031241-8a5a85928f12
 	github.com/pingcap/errors v0.11.5-0.20200917111840-a15ef68f753d
 	github.com/pingcap/kvproto v0.0.0-20200411081810-b85805c9476c
 	github.com/pingcap/log v0.0.0-20210906054005-afc726e70354
+	github.com/prometheus/client_golang v1.0.0
 	github.com/rs/cors v1.7.0
 	github.com/shurcooL/httpgzip v0.0.0-20190720172056-320755c1c1b0
 	github.com/spf13/pflag v1.0.1
@@ -40,6 +39,7 @@ require (
 	github.com/swaggo/swag v1.6.6-0.20200529100950-7c765ddd0476
 	github.com/thoas/go-funk v0.8.0
 	github.com/vmihailenco/msgpack/v5 v5.3.5
+	github.com/xitongsys/parquet-go v1.5.3
 	go.etcd.io/etcd v0.0.0-20191023171146-3cf2f69b5738
 	go.uber.org/atomic v1.9.0
 	go.uber.org/fx v1.12.0
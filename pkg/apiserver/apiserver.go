@@ -6,6 +6,7 @@ import (
 	"context"
 	"io"
 	"net/http"
+	"strings"
 	"sync"
 
 	"github.com/gin-contrib/gzip"
@@ -14,18 +15,22 @@ import (
 	cors "github.com/rs/cors/wrapper/gin"
 	"go.uber.org/fx"
 
+	"github.com/pingcap/tidb-dashboard/pkg/apiserver/artifact"
+	"github.com/pingcap/tidb-dashboard/pkg/apiserver/audit"
 	"github.com/pingcap/tidb-dashboard/pkg/apiserver/clusterinfo"
 	"github.com/pingcap/tidb-dashboard/pkg/apiserver/configuration"
 	"github.com/pingcap/tidb-dashboard/pkg/apiserver/conprof"
 	"github.com/pingcap/tidb-dashboard/pkg/apiserver/debugapi"
 	"github.com/pingcap/tidb-dashboard/pkg/apiserver/diagnose"
 	"github.com/pingcap/tidb-dashboard/pkg/apiserver/info"
+	"github.com/pingcap/tidb-dashboard/pkg/apiserver/job"
 	"github.com/pingcap/tidb-dashboard/pkg/apiserver/logsearch"
 	"github.com/pingcap/tidb-dashboard/pkg/apiserver/metrics"
 	"github.com/pingcap/tidb-dashboard/pkg/apiserver/profiling"
 	"github.com/pingcap/tidb-dashboard/pkg/apiserver/queryeditor"
 	"github.com/pingcap/tidb-dashboard/pkg/apiserver/user/code"
 	"github.com/pingcap/tidb-dashboard/pkg/apiserver/user/code/codeauth"
+	"github.com/pingcap/tidb-dashboard/pkg/apiserver/user/rbac"
 	"github.com/pingcap/tidb-dashboard/pkg/apiserver/user/sqlauth"
 	"github.com/pingcap/tidb-dashboard/pkg/apiserver/user/sso"
 	"github.com/pingcap/tidb-dashboard/pkg/apiserver/user/sso/ssoauth"
@@ -103,6 +108,7 @@ func (s *Service) Start(ctx context.Context) error {
 		fx.Supply(featureflag.NewRegistry(s.config.FeatureVersion)),
 		fx.Provide(
 			newAPIHandlerEngine,
+			metrics.NewSelfRegistry,
 			s.provideLocals,
 			dbstore.NewDBStore,
 			httpc.NewHTTPClient,
@@ -113,6 +119,9 @@ func (s *Service) Start(ctx context.Context) error {
 			tikv.NewTiKVClient,
 			tiflash.NewTiFlashClient,
 			utils.NewSysSchema,
+			audit.NewService,
+			artifact.NewManager,
+			job.NewManager,
 			info.NewService,
 			clusterinfo.NewService,
 			logsearch.NewService,
@@ -125,6 +134,7 @@ func (s *Service) Start(ctx context.Context) error {
 			// NOTE: Don't remove above comment line, it is a placeholder for code generator
 		),
 		user.Module,
+		rbac.Module,
 		codeauth.Module,
 		sqlauth.Module,
 		ssoauth.Module,
@@ -137,6 +147,8 @@ func (s *Service) Start(ctx context.Context) error {
 		debugapi.Module,
 		fx.Populate(&s.apiHandlerEngine),
 		fx.Invoke(
+			audit.RegisterRouter,
+			artifact.RegisterRouter,
 			info.RegisterRouter,
 			clusterinfo.RegisterRouter,
 			profiling.RegisterRouter,
@@ -148,6 +160,8 @@ func (s *Service) Start(ctx context.Context) error {
 			configuration.RegisterRouter,
 			// __APP_NAME__.RegisterRouter,
 			// NOTE: Don't remove above comment line, it is a placeholder for code generator
+			// Must be after all modules owning jobs
+			job.RegisterRecovery,
 			// Must be at the end
 			s.status.Register,
 		),
@@ -202,11 +216,13 @@ func (s *Service) provideLocals() (*config.Config, http.FileSystem, *keyvisualre
 	return s.config, s.uiAssetFS, s.customKeyVisualProvider
 }
 
-func newAPIHandlerEngine() (apiHandlerEngine *gin.Engine, endpoint *gin.RouterGroup) {
+func newAPIHandlerEngine(auditService *audit.Service) (apiHandlerEngine *gin.Engine, endpoint *gin.RouterGroup) {
 	apiHandlerEngine = gin.New()
 	apiHandlerEngine.Use(gin.Recovery())
 	apiHandlerEngine.Use(cors.AllowAll())
-	apiHandlerEngine.Use(gzip.Gzip(gzip.DefaultCompression))
+	apiHandlerEngine.Use(mwGzip())
+	apiHandlerEngine.Use(metrics.MWRecordRequest())
+	apiHandlerEngine.Use(auditService.MWRecordMutation())
 	apiHandlerEngine.Use(rest.ErrorHandlerFn())
 
 	endpoint = apiHandlerEngine.Group("/dashboard/api")
@@ -214,6 +230,17 @@ func newAPIHandlerEngine() (apiHandlerEngine *gin.Engine, endpoint *gin.RouterGr
 	return
 }
 
+func mwGzip() gin.HandlerFunc {
+	gzipHandler := gzip.Gzip(gzip.DefaultCompression)
+	return func(c *gin.Context) {
+		// Server-sent events must be flushed as they are written, which is not supported by the gzip middleware.
+		if strings.Contains(c.GetHeader("Accept"), "text/event-stream") {
+			return
+		}
+		gzipHandler(c)
+	}
+}
+
 var StoppedHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusNotFound)
 	_, _ = io.WriteString(w, "Dashboard is not started.\n")
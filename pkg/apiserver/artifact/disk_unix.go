@@ -0,0 +1,16 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+// +build !windows
+
+package artifact
+
+import "syscall"
+
+// getFreeDiskBytes returns the free space of the disk containing the path available to unprivileged users.
+func getFreeDiskBytes(path string) (uint64, bool) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return 0, false
+	}
+	return uint64(stat.Bavail) * uint64(stat.Bsize), true // #nosec
+}
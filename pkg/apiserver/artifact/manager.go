@@ -0,0 +1,310 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+// Package artifact limits the disk usage of artifacts, i.e. files produced by tasks like log searching and
+// profiling. Artifacts are tracked by the task group producing them, and are removed when they are too old or
+// when the total size exceeds the quota, least recently used first.
+package artifact
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/joomcode/errorx"
+	"github.com/pingcap/log"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+
+	"github.com/pingcap/tidb-dashboard/pkg/config"
+	"github.com/pingcap/tidb-dashboard/pkg/dbstore"
+	"github.com/pingcap/tidb-dashboard/util/rest"
+)
+
+const (
+	cleanupInterval = 10 * time.Minute
+	mb              = 1024 * 1024
+)
+
+var (
+	ErrNS               = errorx.NewNamespace("error.api.artifact")
+	ErrInUse            = ErrNS.NewType("in_use")
+	ErrInsufficientDisk = ErrNS.NewType("insufficient_disk")
+	ErrQuotaExceeded    = ErrNS.NewType("quota_exceeded")
+)
+
+// Model records the size and the last access time of artifacts of a task group.
+type Model struct {
+	ID             uint   `json:"-" gorm:"primary_key"`
+	Kind           string `json:"kind" gorm:"size:32;uniqueIndex:idx_kind_group"`
+	GroupID        uint   `json:"group_id" gorm:"uniqueIndex:idx_kind_group"`
+	Size           int64  `json:"size"`
+	CreatedAt      int64  `json:"created_at"` // Unix seconds
+	LastAccessedAt int64  `json:"last_accessed_at" gorm:"index"`
+}
+
+func (Model) TableName() string {
+	return "artifacts"
+}
+
+func autoMigrate(db *dbstore.DB) error {
+	return db.AutoMigrate(&Model{})
+}
+
+// Evictor removes artifacts and records of a task group. ErrInUse should be returned if the task group is
+// still running, so that it is kept.
+type Evictor func(groupID uint) error
+
+type ManagerParams struct {
+	fx.In
+	LocalStore    *dbstore.DB
+	ConfigManager *config.DynamicConfigManager
+}
+
+type kindInfo struct {
+	dir   string
+	evict Evictor
+}
+
+type groupKey struct {
+	kind    string
+	groupID uint
+}
+
+type Manager struct {
+	params ManagerParams
+	wg     sync.WaitGroup
+	// mu protects kinds, and serializes the cleanup.
+	mu        sync.Mutex
+	kinds     map[string]kindInfo
+	triggerCh chan struct{}
+
+	// Access times are updated in memory, and are written to the storage before the cleanup, so that reading
+	// artifacts does not write the storage.
+	touchedMu sync.Mutex
+	touched   map[groupKey]int64
+}
+
+func NewManager(lc fx.Lifecycle, p ManagerParams) (*Manager, error) {
+	if err := autoMigrate(p.LocalStore); err != nil {
+		return nil, err
+	}
+	m := &Manager{
+		params:    p,
+		kinds:     map[string]kindInfo{},
+		triggerCh: make(chan struct{}, 1),
+		touched:   map[groupKey]int64{},
+	}
+	lc.Append(fx.Hook{
+		OnStart: func(ctx context.Context) error {
+			m.wg.Add(1)
+			go func() {
+				defer m.wg.Done()
+				m.cleanupLoop(ctx)
+			}()
+			return nil
+		},
+		OnStop: func(context.Context) error {
+			m.wg.Wait()
+			m.flushTouched()
+			return nil
+		},
+	})
+	return m, nil
+}
+
+// RegisterKind registers a kind of artifacts, e.g. log search task groups, which are stored in `dir`.
+func (m *Manager) RegisterKind(kind string, dir string, evict Evictor) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.kinds[kind] = kindInfo{dir: dir, evict: evict}
+}
+
+func (m *Manager) getKindDir(kind string) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.kinds[kind].dir
+}
+
+// Record records the size of artifacts of a task group, usually when the task group is finished. The artifacts
+// are considered as just accessed.
+func (m *Manager) Record(kind string, groupID uint, size int64) {
+	now := time.Now().Unix()
+	var rec Model
+	err := m.params.LocalStore.Where(Model{Kind: kind, GroupID: groupID}).
+		Attrs(Model{CreatedAt: now}).
+		Assign(Model{Size: size, LastAccessedAt: now}).
+		FirstOrCreate(&rec).Error
+	if err != nil {
+		log.Warn("Failed to record artifact", zap.String("kind", kind), zap.Uint("group_id", groupID), zap.Error(err))
+		return
+	}
+	// The quota may be exceeded
+	m.triggerCleanup()
+}
+
+func (m *Manager) triggerCleanup() {
+	select {
+	case m.triggerCh <- struct{}{}:
+	default:
+	}
+}
+
+// Touch updates the last access time of artifacts of a task group, e.g. when they are downloaded.
+func (m *Manager) Touch(kind string, groupID uint) {
+	m.touchedMu.Lock()
+	defer m.touchedMu.Unlock()
+	m.touched[groupKey{kind: kind, groupID: groupID}] = time.Now().Unix()
+}
+
+// flushTouched writes access times updated by Touch into the storage.
+func (m *Manager) flushTouched() {
+	m.touchedMu.Lock()
+	touched := m.touched
+	m.touched = map[groupKey]int64{}
+	m.touchedMu.Unlock()
+
+	for key, accessedAt := range touched {
+		err := m.params.LocalStore.
+			Model(&Model{}).
+			Where("kind = ? AND group_id = ?", key.kind, key.groupID).
+			Update("last_accessed_at", accessedAt).Error
+		if err != nil {
+			log.Warn("Failed to update artifact access time", zap.Error(err))
+		}
+	}
+}
+
+// applyTouched fills access times updated by Touch but not yet written into the storage.
+func (m *Manager) applyTouched(records []Model) {
+	m.touchedMu.Lock()
+	defer m.touchedMu.Unlock()
+	for i := range records {
+		if accessedAt, ok := m.touched[groupKey{kind: records[i].Kind, groupID: records[i].GroupID}]; ok {
+			records[i].LastAccessedAt = accessedAt
+		}
+	}
+}
+
+// Forget stops tracking artifacts of a task group, which are already removed by the owner.
+func (m *Manager) Forget(kind string, groupID uint) {
+	m.params.LocalStore.Where("kind = ? AND group_id = ?", kind, groupID).Delete(&Model{})
+}
+
+// ForgetKind stops tracking all artifacts of a kind.
+func (m *Manager) ForgetKind(kind string) {
+	m.params.LocalStore.Where("kind = ?", kind).Delete(&Model{})
+}
+
+// CheckAvailable checks whether a new task producing artifacts of the kind can be started. Artifacts are removed
+// in background, so that the task may be started after retrying if the quota is exceeded.
+func (m *Manager) CheckAvailable(kind string) error {
+	dc, err := m.params.ConfigManager.Get()
+	if err != nil {
+		return err
+	}
+	cfg := dc.Artifact
+
+	if cfg.MinFreeDiskMB > 0 {
+		if free, ok := getFreeDiskBytes(m.getKindDir(kind)); ok && free < uint64(cfg.MinFreeDiskMB)*mb {
+			m.triggerCleanup()
+			return ErrInsufficientDisk.New("free disk space is less than %d MB", cfg.MinFreeDiskMB).
+				WithProperty(rest.HTTPCodeProperty(http.StatusConflict))
+		}
+	}
+	total, err := m.totalSize()
+	if err != nil {
+		return err
+	}
+	if total >= int64(cfg.QuotaMB)*mb {
+		m.triggerCleanup()
+		return ErrQuotaExceeded.New("artifacts exceed the quota of %d MB, retry after least recently used ones are removed", cfg.QuotaMB).
+			WithProperty(rest.HTTPCodeProperty(http.StatusConflict))
+	}
+	return nil
+}
+
+func (m *Manager) totalSize() (int64, error) {
+	var total int64
+	err := m.params.LocalStore.Model(&Model{}).Select("COALESCE(SUM(size), 0)").Row().Scan(&total)
+	return total, err
+}
+
+func (m *Manager) cleanupLoop(ctx context.Context) {
+	cfgCh := m.params.ConfigManager.NewPushChannel()
+	ticker := time.NewTicker(cleanupInterval)
+	defer ticker.Stop()
+
+	var cfg *config.ArtifactConfig
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case dc, ok := <-cfgCh:
+			if !ok {
+				return
+			}
+			cfg = &dc.Artifact
+		case <-ticker.C:
+		case <-m.triggerCh:
+		}
+		if cfg != nil {
+			m.cleanup(cfg)
+		}
+	}
+}
+
+// evict removes artifacts of a task group. It returns false if artifacts are kept.
+func (m *Manager) evict(rec *Model) bool {
+	if info, ok := m.kinds[rec.Kind]; ok {
+		if err := info.evict(rec.GroupID); err != nil {
+			if !errorx.IsOfType(err, ErrInUse) {
+				log.Warn("Failed to remove artifact",
+					zap.String("kind", rec.Kind),
+					zap.Uint("group_id", rec.GroupID),
+					zap.Error(err))
+			}
+			return false
+		}
+	}
+	// Records of unknown kinds are simply removed.
+	if err := m.params.LocalStore.Delete(rec).Error; err != nil {
+		log.Warn("Failed to remove artifact record", zap.Error(err))
+	}
+	log.Info("Artifact removed",
+		zap.String("kind", rec.Kind),
+		zap.Uint("group_id", rec.GroupID),
+		zap.Int64("size", rec.Size))
+	return true
+}
+
+// cleanup removes outdated artifacts, then removes least recently used artifacts until the total size is within
+// the quota.
+func (m *Manager) cleanup(cfg *config.ArtifactConfig) {
+	m.flushTouched()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var records []*Model
+	if err := m.params.LocalStore.Order("last_accessed_at ASC").Find(&records).Error; err != nil {
+		log.Warn("Failed to load artifact records", zap.Error(err))
+		return
+	}
+	var total int64
+	for _, rec := range records {
+		total += rec.Size
+	}
+
+	deadline := time.Now().Add(-time.Duration(cfg.MaxAgeDays) * 24 * time.Hour).Unix()
+	quota := int64(cfg.QuotaMB) * mb
+	for _, rec := range records {
+		if rec.LastAccessedAt >= deadline && total <= quota {
+			// Records are ordered by the last access time, thus remaining records are newer.
+			break
+		}
+		if m.evict(rec) {
+			total -= rec.Size
+		}
+	}
+}
@@ -0,0 +1,92 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package artifact
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/pingcap/tidb-dashboard/pkg/config"
+	"github.com/pingcap/tidb-dashboard/pkg/dbstore"
+	"github.com/pingcap/tidb-dashboard/util/testutil"
+)
+
+func newTestManager(t *testing.T) *Manager {
+	db := &dbstore.DB{DB: testutil.OpenTestSQLiteDB(t)}
+	require.Nil(t, autoMigrate(db))
+	return &Manager{
+		params:    ManagerParams{LocalStore: db},
+		kinds:     map[string]kindInfo{},
+		triggerCh: make(chan struct{}, 1),
+		touched:   map[groupKey]int64{},
+	}
+}
+
+func listGroups(t *testing.T, m *Manager) []uint {
+	var records []Model
+	require.Nil(t, m.params.LocalStore.Order("group_id").Find(&records).Error)
+	ids := make([]uint, 0, len(records))
+	for _, r := range records {
+		ids = append(ids, r.GroupID)
+	}
+	return ids
+}
+
+func TestCleanup(t *testing.T) {
+	m := newTestManager(t)
+	evicted := make([]uint, 0)
+	m.RegisterKind("test", t.TempDir(), func(groupID uint) error {
+		if groupID == 1 {
+			return ErrInUse.NewWithNoMessage()
+		}
+		evicted = append(evicted, groupID)
+		return nil
+	})
+
+	for id := uint(1); id <= 4; id++ {
+		m.Record("test", id, 400*mb)
+	}
+	m.Record("unknown", 5, 0)
+	// Group 4 is the least recently used one
+	m.params.LocalStore.Model(&Model{}).Where("group_id = ?", 4).Update("last_accessed_at", 1)
+	m.Touch("test", 1)
+	require.Nil(t, m.params.LocalStore.Model(&Model{}).Where("group_id = 5").
+		Update("last_accessed_at", time.Now().Add(-48*time.Hour).Unix()).Error)
+
+	cfg := &config.ArtifactConfig{QuotaMB: 1300, MaxAgeDays: 1}
+	m.cleanup(cfg)
+	require.Equal(t, []uint{4}, evicted)
+	require.Equal(t, []uint{1, 2, 3}, listGroups(t, m))
+
+	// Artifacts in use are kept even if the quota is exceeded
+	cfg.QuotaMB = 100
+	m.cleanup(cfg)
+	require.Equal(t, []uint{1}, listGroups(t, m))
+	total, err := m.totalSize()
+	require.Nil(t, err)
+	require.Equal(t, int64(400*mb), total)
+
+	m.Forget("test", 1)
+	require.Empty(t, listGroups(t, m))
+}
+
+func TestTouch(t *testing.T) {
+	m := newTestManager(t)
+	m.Record("test", 1, mb)
+	require.Nil(t, m.params.LocalStore.Model(&Model{}).Where("group_id = 1").Update("last_accessed_at", 1).Error)
+
+	// The access time is not written until the cleanup
+	m.Touch("test", 1)
+	var rec Model
+	require.Nil(t, m.params.LocalStore.First(&rec).Error)
+	require.Equal(t, int64(1), rec.LastAccessedAt)
+	records := []Model{rec}
+	m.applyTouched(records)
+	require.Greater(t, records[0].LastAccessedAt, int64(1))
+
+	m.cleanup(&config.ArtifactConfig{QuotaMB: 100, MaxAgeDays: 1})
+	require.Nil(t, m.params.LocalStore.First(&rec).Error)
+	require.Equal(t, records[0].LastAccessedAt, rec.LastAccessedAt)
+}
@@ -0,0 +1,114 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package artifact
+
+import (
+	"net/http"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/pingcap/tidb-dashboard/pkg/apiserver/user"
+	"github.com/pingcap/tidb-dashboard/pkg/config"
+	"github.com/pingcap/tidb-dashboard/util/rest"
+)
+
+func RegisterRouter(r *gin.RouterGroup, auth *user.AuthService, m *Manager) {
+	endpoint := r.Group("/artifacts")
+	endpoint.Use(auth.MWAuthRequired())
+	endpoint.Use(auth.MWRequirePermission(user.PermArtifactView))
+	endpoint.GET("/usage", m.getUsage)
+	endpoint.GET("/config", m.getDynamicConfig)
+	endpoint.PUT("/config", auth.MWRequirePermission(user.PermArtifactConfig), m.setDynamicConfig)
+}
+
+type KindUsage struct {
+	Kind string `json:"kind"`
+	Size int64  `json:"size"`
+	// Free disk space of the directory storing artifacts of the kind. 0 means unknown.
+	FreeDiskSize uint64 `json:"free_disk_size"`
+}
+
+type UsageResponse struct {
+	TotalSize int64       `json:"total_size"`
+	Kinds     []KindUsage `json:"kinds"`
+	// Ordered by the last access time, i.e. artifacts listed first are removed first when the quota is exceeded.
+	Artifacts []Model `json:"artifacts"`
+}
+
+// @Summary Get the disk usage of artifacts
+// @Security JwtAuth
+// @Success 200 {object} UsageResponse
+// @Failure 401 {object} rest.ErrorResponse
+// @Failure 500 {object} rest.ErrorResponse
+// @Router /artifacts/usage [get]
+func (m *Manager) getUsage(c *gin.Context) {
+	resp := UsageResponse{
+		Kinds:     []KindUsage{},
+		Artifacts: []Model{},
+	}
+	if err := m.params.LocalStore.Order("last_accessed_at ASC").Find(&resp.Artifacts).Error; err != nil {
+		_ = c.Error(err)
+		return
+	}
+	m.applyTouched(resp.Artifacts)
+	sort.SliceStable(resp.Artifacts, func(i, j int) bool {
+		return resp.Artifacts[i].LastAccessedAt < resp.Artifacts[j].LastAccessedAt
+	})
+	sizes := make(map[string]int64)
+	for _, a := range resp.Artifacts {
+		resp.TotalSize += a.Size
+		sizes[a.Kind] += a.Size
+	}
+
+	m.mu.Lock()
+	for kind, info := range m.kinds {
+		free, _ := getFreeDiskBytes(info.dir)
+		resp.Kinds = append(resp.Kinds, KindUsage{Kind: kind, Size: sizes[kind], FreeDiskSize: free})
+	}
+	m.mu.Unlock()
+	sort.Slice(resp.Kinds, func(i, j int) bool {
+		return resp.Kinds[i].Kind < resp.Kinds[j].Kind
+	})
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// @Summary Get Artifact Dynamic Config
+// @Success 200 {object} config.ArtifactConfig
+// @Router /artifacts/config [get]
+// @Security JwtAuth
+// @Failure 401 {object} rest.ErrorResponse
+// @Failure 500 {object} rest.ErrorResponse
+func (m *Manager) getDynamicConfig(c *gin.Context) {
+	dc, err := m.params.ConfigManager.Get()
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, dc.Artifact)
+}
+
+// @Summary Set Artifact Dynamic Config
+// @Param request body config.ArtifactConfig true "Request body"
+// @Success 200 {object} config.ArtifactConfig
+// @Router /artifacts/config [put]
+// @Security JwtAuth
+// @Failure 400 {object} rest.ErrorResponse
+// @Failure 401 {object} rest.ErrorResponse
+// @Failure 500 {object} rest.ErrorResponse
+func (m *Manager) setDynamicConfig(c *gin.Context) {
+	var req config.ArtifactConfig
+	if err := c.ShouldBindJSON(&req); err != nil {
+		_ = c.Error(rest.ErrBadRequest.NewWithNoMessage())
+		return
+	}
+	var opt config.DynamicConfigOption = func(dc *config.DynamicConfig) {
+		dc.Artifact = req
+	}
+	if err := m.params.ConfigManager.Modify(opt); err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, req)
+}
@@ -0,0 +1,35 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package audit
+
+import (
+	"github.com/pingcap/tidb-dashboard/pkg/apiserver/utils"
+	"github.com/pingcap/tidb-dashboard/pkg/dbstore"
+)
+
+type LogModel struct {
+	ID         uint           `json:"id" gorm:"primary_key"`
+	Timestamp  int64          `json:"timestamp" gorm:"index"` // Unix milliseconds
+	DurationMs int64          `json:"duration_ms"`
+	User       string         `json:"user" gorm:"size:256;index"`
+	SQLUser    string         `json:"sql_user" gorm:"size:128"`
+	AuthType   utils.AuthType `json:"auth_type"`
+	ClientIP   string         `json:"client_ip" gorm:"size:64"`
+	Method     string         `json:"method" gorm:"size:8"`
+	Endpoint   string         `json:"endpoint" gorm:"size:256;index"` // The route, like `/dashboard/api/topology/tidb/:address`
+	Path       string         `json:"path" gorm:"type:text"`
+	Payload    string         `json:"payload" gorm:"type:text"` // Truncated request payload, with credentials redacted
+	Targets    string         `json:"targets" gorm:"type:text"` // Comma separated target instances
+	StatusCode int            `json:"status_code"`
+	IsSuccess  bool           `json:"is_success" gorm:"index"`
+	ErrorCode  string         `json:"error_code" gorm:"size:128"`
+	ErrorMsg   string         `json:"error_msg" gorm:"type:text"`
+}
+
+func (LogModel) TableName() string {
+	return "audit_logs"
+}
+
+func autoMigrate(db *dbstore.DB) error {
+	return db.AutoMigrate(&LogModel{})
+}
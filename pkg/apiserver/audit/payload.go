@@ -0,0 +1,108 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	maxPayloadSummaryLen = 2048
+	redactedValue        = "[redacted]"
+)
+
+// Values of these JSON fields are never persisted.
+var sensitiveFields = map[string]struct{}{
+	"password":      {},
+	"token":         {},
+	"code":          {},
+	"code_verifier": {},
+	"extra":         {},
+}
+
+type payloadSummary struct {
+	Text     string
+	Targets  []string
+	Username string
+}
+
+// summarizePayload redacts sensitive fields in the JSON request payload, extracts target instances from the
+// `targets` field and truncates the payload to a reasonable length.
+func summarizePayload(body []byte) payloadSummary {
+	if len(body) == 0 {
+		return payloadSummary{}
+	}
+
+	var v interface{}
+	if err := json.Unmarshal(body, &v); err != nil {
+		return payloadSummary{Text: fmt.Sprintf("<%d bytes non-JSON payload>", len(body))}
+	}
+
+	summary := payloadSummary{}
+	if m, ok := v.(map[string]interface{}); ok {
+		summary.Targets = extractTargets(m["targets"])
+		if username, ok := m["username"].(string); ok {
+			summary.Username = username
+		}
+	}
+
+	redacted, _ := json.Marshal(redact(v))
+	summary.Text = truncate(string(redacted), maxPayloadSummaryLen)
+	return summary
+}
+
+func redact(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for k, field := range val {
+			if _, ok := sensitiveFields[strings.ToLower(k)]; ok {
+				val[k] = redactedValue
+			} else {
+				val[k] = redact(field)
+			}
+		}
+		return val
+	case []interface{}:
+		for i := range val {
+			val[i] = redact(val[i])
+		}
+		return val
+	default:
+		return v
+	}
+}
+
+// extractTargets accepts a list of `model.RequestTargetNode` in the JSON form.
+func extractTargets(v interface{}) []string {
+	list, ok := v.([]interface{})
+	if !ok {
+		return nil
+	}
+	targets := make([]string, 0, len(list))
+	for _, item := range list {
+		m, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		kind, _ := m["kind"].(string)
+		addr, _ := m["display_name"].(string)
+		if addr == "" {
+			ip, _ := m["ip"].(string)
+			port, _ := m["port"].(float64)
+			addr = fmt.Sprintf("%s:%d", ip, int(port))
+		}
+		targets = append(targets, fmt.Sprintf("%s(%s)", kind, addr))
+	}
+	sort.Strings(targets)
+	return targets
+}
+
+func truncate(s string, maxLen int) string {
+	if len(s) <= maxLen {
+		return s
+	}
+	return strings.ToValidUTF8(s[:maxLen], "") + "...(truncated)"
+}
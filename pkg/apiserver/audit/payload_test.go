@@ -0,0 +1,41 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package audit
+
+import (
+	"strings"
+	"testing"
+
+	. "github.com/pingcap/check"
+)
+
+func TestT(t *testing.T) {
+	CustomVerboseFlag = true
+	TestingT(t)
+}
+
+var _ = Suite(&testPayloadSuite{})
+
+type testPayloadSuite struct{}
+
+func (t *testPayloadSuite) Test_summarizePayload(c *C) {
+	s := summarizePayload([]byte(`{"type":0,"username":"root","password":"secret"}`))
+	c.Assert(s.Username, Equals, "root")
+	c.Assert(strings.Contains(s.Text, "secret"), IsFalse)
+	c.Assert(strings.Contains(s.Text, redactedValue), IsTrue)
+
+	s = summarizePayload([]byte(`{"targets":[{"kind":"tikv","display_name":"127.0.0.1:20160"},{"kind":"tidb","ip":"10.0.0.1","port":4000}],"duration_secs":30}`))
+	c.Assert(s.Targets, DeepEquals, []string{"tidb(10.0.0.1:4000)", "tikv(127.0.0.1:20160)"})
+
+	s = summarizePayload([]byte(`not json`))
+	c.Assert(s.Text, Equals, "<8 bytes non-JSON payload>")
+
+	s = summarizePayload(nil)
+	c.Assert(s.Text, Equals, "")
+}
+
+func (t *testPayloadSuite) Test_truncate(c *C) {
+	c.Assert(truncate("abc", 5), Equals, "abc")
+	c.Assert(truncate("abcdef", 3), Equals, "abc...(truncated)")
+	c.Assert(truncate("a中文", 2), Equals, "a...(truncated)")
+}
@@ -0,0 +1,151 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package audit
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/pingcap/tidb-dashboard/pkg/apiserver/user"
+	"github.com/pingcap/tidb-dashboard/pkg/config"
+	"github.com/pingcap/tidb-dashboard/util/rest"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 1000
+)
+
+func RegisterRouter(r *gin.RouterGroup, auth *user.AuthService, s *Service) {
+	endpoint := r.Group("/audit")
+	endpoint.Use(auth.MWAuthRequired())
+	endpoint.Use(auth.MWRequirePermission(user.PermAuditView))
+	endpoint.GET("/logs", s.listLogsHandler)
+	endpoint.GET("/config", s.getDynamicConfig)
+	endpoint.PUT("/config", auth.MWRequirePermission(user.PermAuditConfig), s.setDynamicConfig)
+}
+
+type ListLogsRequest struct {
+	Page      int    `json:"page" form:"page"`
+	PageSize  int    `json:"page_size" form:"page_size"`
+	BeginTime int64  `json:"begin_time" form:"begin_time"` // Unix milliseconds, inclusive
+	EndTime   int64  `json:"end_time" form:"end_time"`     // Unix milliseconds, exclusive
+	User      string `json:"user" form:"user"`
+	Endpoint  string `json:"endpoint" form:"endpoint"` // Substring match
+	Target    string `json:"target" form:"target"`     // Substring match
+	// Possible values: "success", "failure". Both are returned when empty.
+	Result string `json:"result" form:"result"`
+}
+
+type ListLogsResponse struct {
+	Total int64      `json:"total"`
+	Items []LogModel `json:"items"`
+}
+
+// @ID auditListLogs
+// @Summary List audit logs of mutating actions
+// @Param q query ListLogsRequest true "Query"
+// @Success 200 {object} ListLogsResponse
+// @Router /audit/logs [get]
+// @Security JwtAuth
+// @Failure 400 {object} rest.ErrorResponse
+// @Failure 401 {object} rest.ErrorResponse
+// @Failure 403 {object} rest.ErrorResponse
+func (s *Service) listLogsHandler(c *gin.Context) {
+	var req ListLogsRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		_ = c.Error(rest.ErrBadRequest.NewWithNoMessage())
+		return
+	}
+	if req.PageSize <= 0 {
+		req.PageSize = defaultPageSize
+	}
+	if req.PageSize > maxPageSize {
+		req.PageSize = maxPageSize
+	}
+	if req.Page < 1 {
+		req.Page = 1
+	}
+
+	tx := s.params.LocalStore.Model(&LogModel{})
+	if req.BeginTime > 0 {
+		tx = tx.Where("timestamp >= ?", req.BeginTime)
+	}
+	if req.EndTime > 0 {
+		tx = tx.Where("timestamp < ?", req.EndTime)
+	}
+	if req.User != "" {
+		// `user` is a reserved word in MySQL, so that the column must be quoted.
+		tx = tx.Where(clause.Eq{Column: clause.Column{Name: "user"}, Value: req.User})
+	}
+	if req.Endpoint != "" {
+		tx = tx.Where("endpoint LIKE ?", "%"+req.Endpoint+"%")
+	}
+	if req.Target != "" {
+		tx = tx.Where("targets LIKE ?", "%"+req.Target+"%")
+	}
+	switch req.Result {
+	case "success":
+		tx = tx.Where("is_success = ?", true)
+	case "failure":
+		tx = tx.Where("is_success = ?", false)
+	case "":
+	default:
+		_ = c.Error(rest.ErrBadRequest.New("Unknown result filter %s", req.Result))
+		return
+	}
+
+	var resp ListLogsResponse
+	if err := tx.Session(&gorm.Session{}).Count(&resp.Total).Error; err != nil {
+		_ = c.Error(err)
+		return
+	}
+	resp.Items = make([]LogModel, 0)
+	if err := tx.Session(&gorm.Session{}).Order("id DESC").Offset((req.Page - 1) * req.PageSize).Limit(req.PageSize).Find(&resp.Items).Error; err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// @Summary Get Audit Dynamic Config
+// @Success 200 {object} config.AuditConfig
+// @Router /audit/config [get]
+// @Security JwtAuth
+// @Failure 401 {object} rest.ErrorResponse
+// @Failure 500 {object} rest.ErrorResponse
+func (s *Service) getDynamicConfig(c *gin.Context) {
+	dc, err := s.params.ConfigManager.Get()
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, dc.Audit)
+}
+
+// @Summary Set Audit Dynamic Config
+// @Param request body config.AuditConfig true "Request body"
+// @Success 200 {object} config.AuditConfig
+// @Router /audit/config [put]
+// @Security JwtAuth
+// @Failure 400 {object} rest.ErrorResponse
+// @Failure 401 {object} rest.ErrorResponse
+// @Failure 500 {object} rest.ErrorResponse
+func (s *Service) setDynamicConfig(c *gin.Context) {
+	var req config.AuditConfig
+	if err := c.ShouldBindJSON(&req); err != nil {
+		_ = c.Error(rest.ErrBadRequest.NewWithNoMessage())
+		return
+	}
+	var opt config.DynamicConfigOption = func(dc *config.DynamicConfig) {
+		dc.Audit = req
+	}
+	if err := s.params.ConfigManager.Modify(opt); err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, req)
+}
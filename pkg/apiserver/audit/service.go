@@ -0,0 +1,172 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package audit
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joomcode/errorx"
+	"github.com/pingcap/log"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+
+	"github.com/pingcap/tidb-dashboard/pkg/apiserver/utils"
+	"github.com/pingcap/tidb-dashboard/pkg/config"
+	"github.com/pingcap/tidb-dashboard/pkg/dbstore"
+	"github.com/pingcap/tidb-dashboard/util/rest"
+)
+
+const (
+	// Only the beginning of the request body is read for the summary, the rest is streamed to handlers as usual.
+	maxPayloadReadLen = 64 * 1024
+	cleanupInterval   = time.Hour
+)
+
+var (
+	ErrNS           = errorx.NewNamespace("error.api.audit")
+	ErrRecordFailed = ErrNS.NewType("record_failed")
+)
+
+type ServiceParams struct {
+	fx.In
+	LocalStore    *dbstore.DB
+	ConfigManager *config.DynamicConfigManager
+}
+
+type Service struct {
+	params ServiceParams
+	wg     sync.WaitGroup
+}
+
+func NewService(lc fx.Lifecycle, p ServiceParams) (*Service, error) {
+	if err := autoMigrate(p.LocalStore); err != nil {
+		return nil, err
+	}
+	s := &Service{params: p}
+	lc.Append(fx.Hook{
+		OnStart: func(ctx context.Context) error {
+			s.wg.Add(1)
+			go func() {
+				defer s.wg.Done()
+				s.retentionLoop(ctx)
+			}()
+			return nil
+		},
+		OnStop: func(context.Context) error {
+			s.wg.Wait()
+			return nil
+		},
+	})
+	return s, nil
+}
+
+func (s *Service) retentionLoop(ctx context.Context) {
+	cfgCh := s.params.ConfigManager.NewPushChannel()
+	ticker := time.NewTicker(cleanupInterval)
+	defer ticker.Stop()
+
+	var retentionDays uint
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case dc, ok := <-cfgCh:
+			if !ok {
+				return
+			}
+			retentionDays = dc.Audit.RetentionDays
+			s.cleanup(retentionDays)
+		case <-ticker.C:
+			s.cleanup(retentionDays)
+		}
+	}
+}
+
+func (s *Service) cleanup(retentionDays uint) {
+	if retentionDays == 0 {
+		return
+	}
+	deadline := time.Now().Add(-time.Duration(retentionDays)*24*time.Hour).UnixNano() / int64(time.Millisecond)
+	if err := s.params.LocalStore.Where("timestamp < ?", deadline).Delete(&LogModel{}).Error; err != nil {
+		log.Warn("Failed to clean up outdated audit logs", zap.Error(err))
+	}
+}
+
+func isMutatingMethod(method string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	default:
+		return false
+	}
+}
+
+// MWRecordMutation creates a middleware that records all mutating API requests, i.e. POST, PUT, PATCH and DELETE.
+//
+// This middleware must be placed before `rest.ErrorHandlerFn()`, so that the final status code is recorded.
+func (s *Service) MWRecordMutation() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !isMutatingMethod(c.Request.Method) || !strings.HasPrefix(c.Request.URL.Path, config.APIPathPrefix) {
+			c.Next()
+			return
+		}
+
+		var head []byte
+		if c.Request.Body != nil {
+			head, _ = ioutil.ReadAll(io.LimitReader(c.Request.Body, maxPayloadReadLen))
+			c.Request.Body = readCloser{
+				Reader: io.MultiReader(bytes.NewReader(head), c.Request.Body),
+				Closer: c.Request.Body,
+			}
+		}
+
+		startTime := time.Now()
+		c.Next()
+
+		payload := summarizePayload(head)
+		rec := &LogModel{
+			Timestamp:  startTime.UnixNano() / int64(time.Millisecond),
+			DurationMs: time.Since(startTime).Milliseconds(),
+			User:       payload.Username,
+			ClientIP:   c.ClientIP(),
+			Method:     c.Request.Method,
+			Endpoint:   c.FullPath(),
+			Path:       c.Request.URL.Path,
+			Payload:    payload.Text,
+			StatusCode: c.Writer.Status(),
+		}
+		if u := utils.GetSession(c); u != nil {
+			rec.User = u.DisplayName
+			rec.SQLUser = u.TiDBUsername
+			rec.AuthType = u.AuthFrom
+		}
+		targets := payload.Targets
+		if addr := c.Param("address"); addr != "" {
+			targets = append(targets, addr)
+		}
+		rec.Targets = strings.Join(targets, ",")
+		if err := c.Errors.Last(); err != nil {
+			resp := rest.NewErrorResponse(err.Err)
+			rec.ErrorCode = resp.Code
+			rec.ErrorMsg = resp.Message
+		}
+		rec.IsSuccess = rec.ErrorCode == "" && rec.StatusCode < http.StatusBadRequest
+
+		if err := s.params.LocalStore.Create(rec).Error; err != nil {
+			log.Warn("Failed to record audit log", zap.Error(ErrRecordFailed.WrapWithNoMessage(err)))
+		}
+	}
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
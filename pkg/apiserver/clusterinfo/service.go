@@ -53,8 +53,9 @@ func NewService(lc fx.Lifecycle, p ServiceParams) *Service {
 func RegisterRouter(r *gin.RouterGroup, auth *user.AuthService, s *Service) {
 	endpoint := r.Group("/topology")
 	endpoint.Use(auth.MWAuthRequired())
+	endpoint.DELETE("/tidb/:address", auth.MWRequirePermission(user.PermClusterInfoEdit), s.deleteTiDBTopology)
+	endpoint.Use(auth.MWRequirePermission(user.PermClusterInfoView))
 	endpoint.GET("/tidb", s.getTiDBTopology)
-	endpoint.DELETE("/tidb/:address", s.deleteTiDBTopology)
 	endpoint.GET("/store", s.getStoreTopology)
 	endpoint.GET("/pd", s.getPDTopology)
 	endpoint.GET("/alertmanager", s.getAlertManagerTopology)
@@ -65,6 +66,7 @@ func RegisterRouter(r *gin.RouterGroup, auth *user.AuthService, s *Service) {
 
 	endpoint = r.Group("/host")
 	endpoint.Use(auth.MWAuthRequired())
+	endpoint.Use(auth.MWRequirePermission(user.PermClusterInfoView))
 	endpoint.Use(utils.MWConnectTiDB(s.params.TiDBClient))
 	endpoint.GET("/all", s.getHostsInfo)
 	endpoint.GET("/statistics", s.getStatistics)
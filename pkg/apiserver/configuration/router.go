@@ -17,8 +17,8 @@ func RegisterRouter(r *gin.RouterGroup, auth *user.AuthService, s *Service) {
 	endpoint.Use(auth.MWAuthRequired())
 	endpoint.Use(utils.MWConnectTiDB(s.params.TiDBClient))
 	endpoint.Use(utils.MWForbidByExperimentalFlag(s.params.Config.EnableExperimental))
-	endpoint.GET("/all", s.getHandler)
-	endpoint.POST("/edit", auth.MWRequireWritePriv(), s.editHandler)
+	endpoint.GET("/all", auth.MWRequirePermission(user.PermConfigurationView), s.getHandler)
+	endpoint.POST("/edit", auth.MWRequirePermission(user.PermConfigurationEdit), s.editHandler)
 }
 
 // @ID configurationGetAll
@@ -0,0 +1,451 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package conprof
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/joomcode/errorx"
+	"github.com/pingcap/log"
+	"go.uber.org/zap"
+
+	"github.com/pingcap/tidb-dashboard/pkg/apiserver/model"
+	"github.com/pingcap/tidb-dashboard/pkg/apiserver/profiling"
+	"github.com/pingcap/tidb-dashboard/pkg/config"
+	"github.com/pingcap/tidb-dashboard/pkg/dbstore"
+	"github.com/pingcap/tidb-dashboard/pkg/utils/topology"
+	"github.com/pingcap/tidb-dashboard/util/rest"
+)
+
+// The built-in continuous profiling collects CPU and heap profiles periodically when NgMonitoring is not deployed,
+// and serves them in the same API shape as NgMonitoring.
+
+const (
+	localCleanupInterval = 10 * time.Minute
+	// localEstimatedProfileBytes is used to estimate the disk usage before any profile is collected.
+	localEstimatedProfileBytes = 100 * 1024
+
+	// Profile types and states are the same as NgMonitoring.
+	localProfileTypeCPU  = "profile"
+	localProfileTypeHeap = "heap"
+
+	localStateSuccess       = "success"
+	localStateFailed        = "failed"
+	localStatePartialFailed = "partial_failed"
+
+	// artifactKind is the kind of local profiles in the artifact manager, in which each round of collection is
+	// tracked as a group identified by the timestamp.
+	artifactKind = "conprof"
+)
+
+var localProfileTypes = []struct {
+	name          string
+	profilingType profiling.TaskProfilingType
+}{
+	{localProfileTypeCPU, profiling.ProfilingTypeCPU},
+	{localProfileTypeHeap, profiling.ProfilingTypeHeap},
+}
+
+type localProfileModel struct {
+	ID          uint  `gorm:"primary_key"`
+	Ts          int64 `gorm:"index"`
+	ProfileSecs uint
+	ProfileType string                    `gorm:"size:16"`
+	Component   string                    `gorm:"size:16"`
+	Address     string                    `gorm:"size:64"`
+	State       string                    `gorm:"size:16"`
+	Error       string                    `gorm:"type:text"`
+	FilePath    string                    `gorm:"type:text"`
+	RawDataType profiling.TaskRawDataType `gorm:"size:16"`
+	Size        int64
+}
+
+func (localProfileModel) TableName() string {
+	return "conprof_profiles"
+}
+
+func autoMigrate(db *dbstore.DB) error {
+	return db.AutoMigrate(&localProfileModel{})
+}
+
+func (s *Service) localDataDir() string {
+	return path.Join(s.params.Config.DataDir, "conprof")
+}
+
+// isNgMonitoringAbsent returns whether the error means NgMonitoring is not available, in which case the built-in
+// continuous profiling is used.
+func isNgMonitoringAbsent(err error) bool {
+	return errorx.IsOfType(err, ErrNgMonitoringNotDeploy) || errorx.IsOfType(err, ErrNgMonitoringNotStart)
+}
+
+func (s *Service) localCollectLoop(ctx context.Context) {
+	cfgCh := s.params.ConfigManager.NewPushChannel()
+	cleanupTicker := time.NewTicker(localCleanupInterval)
+	defer cleanupTicker.Stop()
+
+	var cfg *config.ConprofConfig
+	var timeCh <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case dc, ok := <-cfgCh:
+			if !ok {
+				return
+			}
+			cfg = &dc.Conprof
+			if !cfg.Enable {
+				timeCh = nil
+			} else if timeCh == nil {
+				timeCh = time.After(0)
+			}
+		case <-timeCh:
+			timeCh = time.After(time.Duration(cfg.IntervalSecs) * time.Second)
+			if _, err := s.getNgMonitoringAddrFromCache(); !isNgMonitoringAbsent(err) {
+				continue
+			}
+			s.collectLocalProfiles(ctx, cfg)
+		case <-cleanupTicker.C:
+			if cfg != nil {
+				s.cleanupLocalProfiles(cfg.RetentionSecs)
+			}
+		}
+	}
+}
+
+// localTargets returns instances to be profiled. The status address is used, which is the same as NgMonitoring.
+func (s *Service) localTargets(ctx context.Context, components []model.NodeKind) []model.RequestTargetNode {
+	selected := func(kind model.NodeKind) bool {
+		if len(components) == 0 {
+			return true
+		}
+		for _, c := range components {
+			if c == kind {
+				return true
+			}
+		}
+		return false
+	}
+	targets := make([]model.RequestTargetNode, 0)
+	add := func(kind model.NodeKind, ip string, port uint) {
+		targets = append(targets, model.RequestTargetNode{
+			Kind:        kind,
+			DisplayName: fmt.Sprintf("%s:%d", ip, port),
+			IP:          ip,
+			Port:        int(port),
+		})
+	}
+
+	if selected(model.NodeKindTiDB) {
+		tidbs, err := topology.FetchTiDBTopology(ctx, s.params.EtcdClient)
+		if err != nil {
+			log.Warn("Failed to fetch TiDB topology for continuous profiling", zap.Error(err))
+		}
+		for _, i := range tidbs {
+			if i.Status == topology.ComponentStatusUp {
+				add(model.NodeKindTiDB, i.IP, i.StatusPort)
+			}
+		}
+	}
+	if selected(model.NodeKindPD) {
+		pds, err := topology.FetchPDTopology(s.params.PDClient)
+		if err != nil {
+			log.Warn("Failed to fetch PD topology for continuous profiling", zap.Error(err))
+		}
+		for _, i := range pds {
+			if i.Status == topology.ComponentStatusUp {
+				add(model.NodeKindPD, i.IP, i.Port)
+			}
+		}
+	}
+	if selected(model.NodeKindTiKV) || selected(model.NodeKindTiFlash) {
+		tikvs, tiflashes, err := topology.FetchStoreTopology(s.params.PDClient)
+		if err != nil {
+			log.Warn("Failed to fetch store topology for continuous profiling", zap.Error(err))
+		}
+		for kind, stores := range map[model.NodeKind][]topology.StoreInfo{model.NodeKindTiKV: tikvs, model.NodeKindTiFlash: tiflashes} {
+			if !selected(kind) {
+				continue
+			}
+			for _, i := range stores {
+				if i.Status == topology.ComponentStatusUp {
+					add(kind, i.IP, i.StatusPort)
+				}
+			}
+		}
+	}
+	sort.Slice(targets, func(i, j int) bool {
+		if targets[i].Kind != targets[j].Kind {
+			return targets[i].Kind < targets[j].Kind
+		}
+		return targets[i].DisplayName < targets[j].DisplayName
+	})
+	return targets
+}
+
+func (s *Service) collectLocalProfiles(ctx context.Context, cfg *config.ConprofConfig) {
+	targets := s.localTargets(ctx, cfg.Components)
+	if len(targets) == 0 {
+		return
+	}
+	if err := os.MkdirAll(s.localDataDir(), 0o755); err != nil { // #nosec
+		log.Warn("Failed to create directory for continuous profiling", zap.Error(err))
+		return
+	}
+	if err := s.params.Artifacts.CheckAvailable(artifactKind); err != nil {
+		log.Warn("Skip collecting continuous profiles", zap.Error(err))
+		return
+	}
+
+	ts := time.Now().Unix()
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	profiles := make([]*localProfileModel, 0, len(targets)*len(localProfileTypes))
+	for i := range targets {
+		for _, t := range localProfileTypes {
+			target := &targets[i]
+			name, profilingType := t.name, t.profilingType
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				p := s.collectLocalProfile(ts, cfg.ProfileSecs, target, name, profilingType)
+				if p == nil {
+					return
+				}
+				mu.Lock()
+				profiles = append(profiles, p)
+				mu.Unlock()
+			}()
+		}
+	}
+	wg.Wait()
+
+	if len(profiles) == 0 {
+		return
+	}
+	if err := s.params.LocalStore.Create(&profiles).Error; err != nil {
+		log.Warn("Failed to save continuous profiles", zap.Error(err))
+		return
+	}
+	var size int64
+	for _, p := range profiles {
+		size += p.Size
+	}
+	s.params.Artifacts.Record(artifactKind, uint(ts), size)
+}
+
+// collectLocalProfile returns nil if the profile type is not supported by the target.
+func (s *Service) collectLocalProfile(ts int64, profileSecs uint, target *model.RequestTargetNode, name string, profilingType profiling.TaskProfilingType) *localProfileModel {
+	p := &localProfileModel{
+		Ts:          ts,
+		ProfileSecs: profileSecs,
+		ProfileType: name,
+		Component:   string(target.Kind),
+		Address:     target.DisplayName,
+		State:       localStateSuccess,
+	}
+	tmpPath, rawDataType, err := s.params.Profiling.FetchProfile(target, profileSecs, profilingType)
+	if errorx.IsOfType(err, profiling.ErrUnsupportedProfilingType) {
+		return nil
+	}
+	if err != nil {
+		p.State = localStateFailed
+		p.Error = err.Error()
+		return p
+	}
+	defer os.Remove(tmpPath) // #nosec
+
+	content, err := ioutil.ReadFile(tmpPath)
+	if err == nil {
+		p.FilePath = path.Join(s.localDataDir(), fmt.Sprintf("%d_%s_%s%s", ts, name, target.FileName(), filepath.Ext(tmpPath)))
+		err = ioutil.WriteFile(p.FilePath, content, 0o600)
+	}
+	if err != nil {
+		p.State = localStateFailed
+		p.Error = err.Error()
+		p.FilePath = ""
+		return p
+	}
+	p.RawDataType = rawDataType
+	p.Size = int64(len(content))
+	return p
+}
+
+func (s *Service) cleanupLocalProfiles(retentionSecs uint) {
+	before := time.Now().Add(-time.Duration(retentionSecs) * time.Second).Unix()
+	rounds, err := s.removeLocalProfiles("ts < ?", before)
+	if err != nil {
+		log.Warn("Failed to remove expired continuous profiles", zap.Error(err))
+		return
+	}
+	for ts := range rounds {
+		s.params.Artifacts.Forget(artifactKind, uint(ts))
+	}
+}
+
+// evictLocalProfiles removes profiles of a round of collection, which is evicted by the artifact manager.
+func (s *Service) evictLocalProfiles(groupID uint) error {
+	_, err := s.removeLocalProfiles("ts = ?", int64(groupID))
+	return err
+}
+
+// removeLocalProfiles removes files and records of profiles matching the condition, returning timestamps of
+// rounds of collection having profiles removed.
+func (s *Service) removeLocalProfiles(query string, args ...interface{}) (map[int64]struct{}, error) {
+	var profiles []localProfileModel
+	if err := s.params.LocalStore.Where(query, args...).Find(&profiles).Error; err != nil {
+		return nil, err
+	}
+	rounds := map[int64]struct{}{}
+	for _, p := range profiles {
+		rounds[p.Ts] = struct{}{}
+		if p.FilePath == "" {
+			continue
+		}
+		if err := os.Remove(p.FilePath); err != nil && !os.IsNotExist(err) {
+			log.Warn("Failed to remove continuous profile", zap.String("path", p.FilePath), zap.Error(err))
+		}
+	}
+	if err := s.params.LocalStore.Where(query, args...).Delete(&localProfileModel{}).Error; err != nil {
+		return nil, err
+	}
+	return rounds, nil
+}
+
+// localGroupProfiles returns profiles collected in each round between the time range, ordered by time desc.
+func (s *Service) localGroupProfiles(beginTime, endTime int64) ([]GroupProfiles, error) {
+	var profiles []localProfileModel
+	err := s.params.LocalStore.
+		Where("ts >= ? AND ts <= ?", beginTime, endTime).
+		Order("ts DESC").
+		Find(&profiles).Error
+	if err != nil {
+		return nil, err
+	}
+
+	groups := make([]GroupProfiles, 0)
+	var success, failed int
+	targets := map[Target]struct{}{}
+	flush := func() {
+		g := &groups[len(groups)-1]
+		switch {
+		case failed == 0:
+			g.State = localStateSuccess
+		case success == 0:
+			g.State = localStateFailed
+		default:
+			g.State = localStatePartialFailed
+		}
+		for t := range targets {
+			switch model.NodeKind(t.Component) {
+			case model.NodeKindTiDB:
+				g.CompNum.TiDB++
+			case model.NodeKindPD:
+				g.CompNum.PD++
+			case model.NodeKindTiKV:
+				g.CompNum.TiKV++
+			case model.NodeKindTiFlash:
+				g.CompNum.TiFlash++
+			}
+		}
+		success, failed = 0, 0
+		targets = map[Target]struct{}{}
+	}
+	for _, p := range profiles {
+		if len(groups) == 0 || groups[len(groups)-1].Ts != p.Ts {
+			if len(groups) > 0 {
+				flush()
+			}
+			groups = append(groups, GroupProfiles{Ts: p.Ts, ProfileSecs: int(p.ProfileSecs)})
+		}
+		if p.State == localStateSuccess {
+			success++
+		} else {
+			failed++
+		}
+		targets[Target{Component: p.Component, Address: p.Address}] = struct{}{}
+	}
+	if len(groups) > 0 {
+		flush()
+	}
+	return groups, nil
+}
+
+func (s *Service) localGroupProfileDetail(ts int64) (*GroupProfileDetail, error) {
+	var profiles []localProfileModel
+	err := s.params.LocalStore.
+		Where("ts = ?", ts).
+		Order("component, address, profile_type").
+		Find(&profiles).Error
+	if err != nil {
+		return nil, err
+	}
+	detail := &GroupProfileDetail{Ts: ts, State: localStateSuccess, TargetProfiles: make([]ProfileDetail, 0, len(profiles))}
+	var success, failed int
+	for _, p := range profiles {
+		detail.ProfileSecs = int(p.ProfileSecs)
+		if p.State == localStateSuccess {
+			success++
+		} else {
+			failed++
+		}
+		detail.TargetProfiles = append(detail.TargetProfiles, ProfileDetail{
+			State:  p.State,
+			Error:  p.Error,
+			Type:   p.ProfileType,
+			Target: Target{Component: p.Component, Address: p.Address},
+		})
+	}
+	if failed > 0 {
+		detail.State = localStatePartialFailed
+		if success == 0 {
+			detail.State = localStateFailed
+		}
+	}
+	return detail, nil
+}
+
+// localEstimateSize estimates the size of profiles collected each day.
+func (s *Service) localEstimateSize(ctx context.Context, cfg *config.ConprofConfig) (*EstimateSizeRes, error) {
+	var avgSize struct {
+		Size float64
+	}
+	err := s.params.LocalStore.
+		Model(&localProfileModel{}).
+		Select("AVG(size) AS size").
+		Where("state = ?", localStateSuccess).
+		Scan(&avgSize).Error
+	if err != nil {
+		return nil, err
+	}
+	profileBytes := int(avgSize.Size)
+	if profileBytes == 0 {
+		profileBytes = localEstimatedProfileBytes
+	}
+	n := len(s.localTargets(ctx, cfg.Components))
+	rounds := 24 * 3600 / int(cfg.IntervalSecs)
+	return &EstimateSizeRes{
+		InstanceCount: n,
+		ProfileSize:   profileBytes * n * len(localProfileTypes) * rounds,
+	}, nil
+}
+
+func (s *Service) localProfile(ts int64, profileType, component, address string) (*localProfileModel, error) {
+	var p localProfileModel
+	err := s.params.LocalStore.
+		Where("ts = ? AND profile_type = ? AND component = ? AND address = ? AND state = ?", ts, profileType, component, address, localStateSuccess).
+		First(&p).Error
+	if err != nil {
+		return nil, rest.ErrNotFound.New("Profile not found")
+	}
+	s.params.Artifacts.Touch(artifactKind, uint(ts))
+	return &p, nil
+}
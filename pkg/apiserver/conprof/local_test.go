@@ -0,0 +1,84 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package conprof
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/fx/fxtest"
+
+	"github.com/pingcap/tidb-dashboard/pkg/apiserver/artifact"
+	"github.com/pingcap/tidb-dashboard/pkg/dbstore"
+	"github.com/pingcap/tidb-dashboard/util/testutil"
+)
+
+func newTestService(t *testing.T) *Service {
+	db := &dbstore.DB{DB: testutil.OpenTestSQLiteDB(t)}
+	require.Nil(t, autoMigrate(db))
+	artifacts, err := artifact.NewManager(fxtest.NewLifecycle(t), artifact.ManagerParams{LocalStore: db})
+	require.Nil(t, err)
+	return &Service{params: ServiceParams{LocalStore: db, Artifacts: artifacts}}
+}
+
+func TestLocalGroupProfiles(t *testing.T) {
+	s := newTestService(t)
+	now := time.Now().Unix()
+	profiles := []localProfileModel{
+		{Ts: now - 120, ProfileSecs: 10, ProfileType: localProfileTypeCPU, Component: "tidb", Address: "a:10080", State: localStateSuccess},
+		{Ts: now - 120, ProfileSecs: 10, ProfileType: localProfileTypeHeap, Component: "tidb", Address: "a:10080", State: localStateSuccess},
+		{Ts: now - 60, ProfileSecs: 10, ProfileType: localProfileTypeCPU, Component: "tidb", Address: "a:10080", State: localStateSuccess},
+		{Ts: now - 60, ProfileSecs: 10, ProfileType: localProfileTypeCPU, Component: "tikv", Address: "b:20180", State: localStateFailed, Error: "timeout"},
+		{Ts: now, ProfileSecs: 10, ProfileType: localProfileTypeCPU, Component: "tikv", Address: "b:20180", State: localStateFailed},
+		{Ts: now - 3600, ProfileSecs: 10, ProfileType: localProfileTypeCPU, Component: "pd", Address: "c:2379", State: localStateSuccess},
+	}
+	require.Nil(t, s.params.LocalStore.Create(&profiles).Error)
+
+	groups, err := s.localGroupProfiles(now-600, now)
+	require.Nil(t, err)
+	require.Len(t, groups, 3)
+	require.Equal(t, now, groups[0].Ts)
+	require.Equal(t, localStateFailed, groups[0].State)
+	require.Equal(t, ComponentNum{TiKV: 1}, groups[0].CompNum)
+	require.Equal(t, localStatePartialFailed, groups[1].State)
+	require.Equal(t, ComponentNum{TiDB: 1, TiKV: 1}, groups[1].CompNum)
+	require.Equal(t, localStateSuccess, groups[2].State)
+	require.Equal(t, ComponentNum{TiDB: 1}, groups[2].CompNum)
+	require.Equal(t, 10, groups[2].ProfileSecs)
+
+	detail, err := s.localGroupProfileDetail(now - 60)
+	require.Nil(t, err)
+	require.Equal(t, localStatePartialFailed, detail.State)
+	require.Len(t, detail.TargetProfiles, 2)
+	require.Equal(t, "timeout", detail.TargetProfiles[1].Error)
+
+	s.cleanupLocalProfiles(1800)
+	groups, err = s.localGroupProfiles(0, now)
+	require.Nil(t, err)
+	require.Len(t, groups, 3)
+}
+
+func TestEvictLocalProfiles(t *testing.T) {
+	s := newTestService(t)
+	dir := t.TempDir()
+	filePath := path.Join(dir, "100_profile_tidb.proto")
+	require.Nil(t, ioutil.WriteFile(filePath, []byte("foo"), 0o600))
+	profiles := []localProfileModel{
+		{Ts: 100, ProfileType: localProfileTypeCPU, Component: "tidb", Address: "a:10080", State: localStateSuccess, FilePath: filePath, Size: 3},
+		{Ts: 100, ProfileType: localProfileTypeCPU, Component: "tikv", Address: "b:20180", State: localStateFailed},
+		{Ts: 200, ProfileType: localProfileTypeCPU, Component: "tidb", Address: "a:10080", State: localStateFailed},
+	}
+	require.Nil(t, s.params.LocalStore.Create(&profiles).Error)
+
+	require.Nil(t, s.evictLocalProfiles(100))
+	_, err := os.Stat(filePath)
+	require.True(t, os.IsNotExist(err))
+	var remaining []localProfileModel
+	require.Nil(t, s.params.LocalStore.Find(&remaining).Error)
+	require.Len(t, remaining, 1)
+	require.Equal(t, int64(200), remaining[0].Ts)
+}
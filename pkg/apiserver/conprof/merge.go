@@ -0,0 +1,281 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package conprof
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/pprof/profile"
+	"github.com/pingcap/log"
+	"go.uber.org/zap"
+
+	"github.com/pingcap/tidb-dashboard/pkg/apiserver/model"
+	"github.com/pingcap/tidb-dashboard/pkg/apiserver/profiling"
+	"github.com/pingcap/tidb-dashboard/util/pprofutil"
+	"github.com/pingcap/tidb-dashboard/util/rest"
+)
+
+const (
+	// maxMergedProfiles limits the time range of merging, e.g. 1 day when profiling every minute.
+	maxMergedProfiles  = 1440
+	mergeFetchRoutines = 8
+	// Fetched profiles are merged in batches, so that parsed profiles in memory are limited.
+	mergeBatchSize      = 32
+	mergeOutputGraph    = "graph"
+	mergeOutputProtobuf = "protobuf"
+)
+
+// mergeableProfileTypes are profile types in protobuf format of each component, which can be merged. Heap profiles
+// of TiKV are dumped by jemalloc, and TiFlash does not serve heap profiles.
+var mergeableProfileTypes = map[model.NodeKind][]string{
+	model.NodeKindTiDB:    {localProfileTypeCPU, localProfileTypeHeap},
+	model.NodeKindPD:      {localProfileTypeCPU, localProfileTypeHeap},
+	model.NodeKindTiKV:    {localProfileTypeCPU},
+	model.NodeKindTiFlash: {localProfileTypeCPU},
+}
+
+func isMergeable(component, profileType string) bool {
+	for _, t := range mergeableProfileTypes[model.NodeKind(component)] {
+		if t == profileType {
+			return true
+		}
+	}
+	return false
+}
+
+type MergeProfilesReq struct {
+	BeginTime   int64  `json:"begin_time" form:"begin_time" binding:"required"`
+	EndTime     int64  `json:"end_time" form:"end_time" binding:"required"`
+	ProfileType string `json:"profile_type" form:"profile_type" binding:"required"` // profile (i.e. CPU) or heap
+	Component   string `json:"component" form:"component" binding:"required"`
+	Address     string `json:"address" form:"address" binding:"required"`
+	// graph, protobuf, or a JSON output, i.e. top, flamegraph, speedscope and calltree. default: graph
+	OutputType string `json:"output_type" form:"output_type"`
+	pprofutil.Options
+}
+
+// @Summary Merge profiles in a time range
+// @Description Merge all CPU or heap profiles of an instance in the time range into a single profile. CPU samples are
+// @Description summed up, while heap samples are averaged. Heap profiles of TiKV and TiFlash cannot be merged.
+// @Router /continuous_profiling/merged_profile [get]
+// @Param q query MergeProfilesReq true "Query"
+// @Security JwtAuth
+// @Produce json,image/svg+xml,application/octet-stream
+// @Success 200 {object} pprofutil.TopResponse
+// @Failure 400 {object} rest.ErrorResponse
+// @Failure 401 {object} rest.ErrorResponse
+// @Failure 404 {object} rest.ErrorResponse
+// @Failure 500 {object} rest.ErrorResponse
+func (s *Service) conprofMergeProfiles(c *gin.Context) {
+	var req MergeProfilesReq
+	if err := c.ShouldBindQuery(&req); err != nil {
+		_ = c.Error(rest.ErrBadRequest.WrapWithNoMessage(err))
+		return
+	}
+	if !isMergeable(req.Component, req.ProfileType) {
+		_ = c.Error(rest.ErrBadRequest.New("Merging %s profiles of %s is not supported", req.ProfileType, req.Component))
+		return
+	}
+	if req.EndTime < req.BeginTime {
+		_ = c.Error(rest.ErrBadRequest.New("end_time cannot be less than begin_time"))
+		return
+	}
+	switch req.OutputType {
+	case "", mergeOutputGraph, mergeOutputProtobuf:
+	default:
+		if !pprofutil.IsJSONFormat(req.OutputType) {
+			_ = c.Error(rest.ErrBadRequest.New("Unsupported output type %s", req.OutputType))
+			return
+		}
+	}
+
+	timestamps, err := s.profileTimestamps(c.Request.Context(), req.BeginTime, req.EndTime)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	if len(timestamps) > maxMergedProfiles {
+		_ = c.Error(rest.ErrBadRequest.New("Too many profiles in the time range, at most %d profiles can be merged", maxMergedProfiles))
+		return
+	}
+	merged, err := s.fetchMergedProfile(c.Request.Context(), timestamps, &req)
+	if err != nil {
+		_ = c.Error(rest.ErrBadRequest.WrapWithNoMessage(err))
+		return
+	}
+	if merged == nil {
+		_ = c.Error(rest.ErrNotFound.New("No profile found in the time range"))
+		return
+	}
+
+	switch req.OutputType {
+	case "", mergeOutputGraph, mergeOutputProtobuf:
+		var buf bytes.Buffer
+		if err := merged.Write(&buf); err != nil {
+			_ = c.Error(err)
+			return
+		}
+		if req.OutputType == mergeOutputProtobuf {
+			fileName := fmt.Sprintf("merged_%s_%s_%d_%d.proto", req.ProfileType, req.Component, req.BeginTime, req.EndTime)
+			c.Writer.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", fileName))
+			c.Data(http.StatusOK, "application/octet-stream", buf.Bytes())
+			return
+		}
+		svgContent, err := profiling.ConvertProtobufToSVG(buf.Bytes())
+		if err != nil {
+			_ = c.Error(err)
+			return
+		}
+		c.Data(http.StatusOK, "image/svg+xml", svgContent)
+	default:
+		resp, err := pprofutil.Convert(merged, pprofutil.Format(req.OutputType), &req.Options)
+		if err != nil {
+			_ = c.Error(rest.ErrBadRequest.WrapWithNoMessage(err))
+			return
+		}
+		c.JSON(http.StatusOK, resp)
+	}
+}
+
+// profileTimestamps returns the time of each profiling round in the time range.
+func (s *Service) profileTimestamps(ctx context.Context, beginTime, endTime int64) ([]int64, error) {
+	var groups []GroupProfiles
+	ngMonitoringAddr, err := s.getNgMonitoringAddrFromCache()
+	if isNgMonitoringAbsent(err) {
+		groups, err = s.localGroupProfiles(beginTime, endTime)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		if err != nil {
+			return nil, err
+		}
+		query := url.Values{}
+		query.Set("begin_time", fmt.Sprint(beginTime))
+		query.Set("end_time", fmt.Sprint(endTime))
+		uri := fmt.Sprintf("%s/continuous_profiling/group_profiles?%s", ngMonitoringAddr, query.Encode())
+		data, err := s.params.HTTPClient.
+			WithTimeout(fetchProfileTimeout).
+			SendRequest(ctx, uri, http.MethodGet, nil, ErrNgMonitoringRequest, "NgMonitoring")
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, &groups); err != nil {
+			return nil, ErrNgMonitoringRequest.Wrap(err, "failed to read group profiles from NgMonitoring")
+		}
+	}
+
+	timestamps := make([]int64, 0, len(groups))
+	for _, g := range groups {
+		if g.State != localStateFailed {
+			timestamps = append(timestamps, g.Ts)
+		}
+	}
+	return timestamps, nil
+}
+
+// fetchMergedProfile fetches and merges profiles of the instance at each time. Profiles failed to fetch are
+// skipped, e.g. the instance is not profiled in some rounds. Returns nil if no profile is fetched.
+func (s *Service) fetchMergedProfile(ctx context.Context, timestamps []int64, req *MergeProfilesReq) (*profile.Profile, error) {
+	mergers := make([]profileMerger, mergeFetchRoutines)
+	var wg sync.WaitGroup
+	tsCh := make(chan int64)
+	for i := range mergers {
+		wg.Add(1)
+		go func(m *profileMerger) {
+			defer wg.Done()
+			for ts := range tsCh {
+				if m.err != nil {
+					continue
+				}
+				data, err := s.fetchProfileData(ctx, ts, req.ProfileType, req.Component, req.Address)
+				if err != nil {
+					continue
+				}
+				p, err := profile.ParseData(data)
+				if err != nil {
+					log.Warn("Failed to parse continuous profile", zap.Int64("ts", ts), zap.Error(err))
+					continue
+				}
+				m.add(p)
+			}
+			m.flush()
+		}(&mergers[i])
+	}
+produce:
+	for _, ts := range timestamps {
+		select {
+		case tsCh <- ts:
+		case <-ctx.Done():
+			break produce
+		}
+	}
+	close(tsCh)
+	wg.Wait()
+
+	var result profileMerger
+	for i := range mergers {
+		if mergers[i].err != nil {
+			return nil, mergers[i].err
+		}
+		if mergers[i].merged != nil {
+			result.addMerged(mergers[i].merged, mergers[i].count)
+		}
+	}
+	return result.result(req.ProfileType)
+}
+
+// profileMerger merges profiles incrementally. Added profiles are kept until there are mergeBatchSize of them, then
+// they are merged into the running merged profile.
+type profileMerger struct {
+	merged  *profile.Profile
+	pending []*profile.Profile
+	// Number of profiles merged, including pending ones.
+	count int
+	err   error
+}
+
+func (m *profileMerger) add(p *profile.Profile) {
+	m.addMerged(p, 1)
+}
+
+// addMerged adds a profile merged from count profiles.
+func (m *profileMerger) addMerged(p *profile.Profile, count int) {
+	m.pending = append(m.pending, p)
+	m.count += count
+	if len(m.pending) >= mergeBatchSize {
+		m.flush()
+	}
+}
+
+func (m *profileMerger) flush() {
+	if m.err != nil || len(m.pending) == 0 {
+		return
+	}
+	profiles := m.pending
+	if m.merged != nil {
+		profiles = append(profiles, m.merged)
+	}
+	m.merged, m.err = profile.Merge(profiles)
+	m.pending = nil
+}
+
+// result returns the merged profile, or nil if no profile is added. Heap profiles are snapshots, so the merged heap
+// profile is scaled to the average of all snapshots.
+func (m *profileMerger) result(profileType string) (*profile.Profile, error) {
+	m.flush()
+	if m.err != nil || m.merged == nil {
+		return nil, m.err
+	}
+	if profileType == localProfileTypeHeap {
+		m.merged.Scale(1 / float64(m.count))
+	}
+	return m.merged, nil
+}
@@ -0,0 +1,86 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package conprof
+
+import (
+	"testing"
+
+	"github.com/google/pprof/profile"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestHeapProfile(value int64) *profile.Profile {
+	fn := &profile.Function{ID: 1, Name: "main.alloc"}
+	loc := &profile.Location{ID: 1, Line: []profile.Line{{Function: fn}}}
+	return &profile.Profile{
+		SampleType: []*profile.ValueType{{Type: "inuse_space", Unit: "bytes"}},
+		PeriodType: &profile.ValueType{Type: "space", Unit: "bytes"},
+		Sample:     []*profile.Sample{{Location: []*profile.Location{loc}, Value: []int64{value}}},
+		Location:   []*profile.Location{loc},
+		Function:   []*profile.Function{fn},
+	}
+}
+
+func mergeTestHeapProfiles(values []int64, profileType string) (*profile.Profile, error) {
+	var m profileMerger
+	for _, v := range values {
+		m.add(newTestHeapProfile(v))
+	}
+	return m.result(profileType)
+}
+
+func TestMergeProfiles(t *testing.T) {
+	merged, err := mergeTestHeapProfiles([]int64{100, 300}, localProfileTypeCPU)
+	require.Nil(t, err)
+	require.Len(t, merged.Sample, 1)
+	require.Equal(t, int64(400), merged.Sample[0].Value[0])
+
+	merged, err = mergeTestHeapProfiles([]int64{100, 300}, localProfileTypeHeap)
+	require.Nil(t, err)
+	require.Len(t, merged.Sample, 1)
+	require.Equal(t, int64(200), merged.Sample[0].Value[0])
+
+	// Profiles more than a batch are merged into the running merged profile.
+	values := make([]int64, mergeBatchSize*2+1)
+	for i := range values {
+		values[i] = 100
+	}
+	merged, err = mergeTestHeapProfiles(values, localProfileTypeCPU)
+	require.Nil(t, err)
+	require.Equal(t, int64(100*len(values)), merged.Sample[0].Value[0])
+	merged, err = mergeTestHeapProfiles(values, localProfileTypeHeap)
+	require.Nil(t, err)
+	require.Equal(t, int64(100), merged.Sample[0].Value[0])
+
+	var m profileMerger
+	m.add(newTestHeapProfile(100))
+	m.addMerged(newTestHeapProfile(300), 2)
+	merged, err = m.result(localProfileTypeHeap)
+	require.Nil(t, err)
+	require.Equal(t, int64(400/3), merged.Sample[0].Value[0])
+
+	merged, err = mergeTestHeapProfiles(nil, localProfileTypeHeap)
+	require.Nil(t, err)
+	require.Nil(t, merged)
+}
+
+func TestIsMergeable(t *testing.T) {
+	tests := []struct {
+		component   string
+		profileType string
+		expected    bool
+	}{
+		{"tidb", localProfileTypeCPU, true},
+		{"tidb", localProfileTypeHeap, true},
+		{"pd", localProfileTypeHeap, true},
+		{"tikv", localProfileTypeCPU, true},
+		{"tikv", localProfileTypeHeap, false},
+		{"tiflash", localProfileTypeCPU, true},
+		{"tiflash", localProfileTypeHeap, false},
+		{"tidb", "goroutine", false},
+		{"unknown", localProfileTypeCPU, false},
+	}
+	for _, tt := range tests {
+		require.Equal(t, tt.expected, isMergeable(tt.component, tt.profileType), "%s %s", tt.component, tt.profileType)
+	}
+}
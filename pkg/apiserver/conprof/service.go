@@ -6,34 +6,51 @@ package conprof
 import (
 	"context"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
+	"path/filepath"
+	"strconv"
+	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/pprof/profile"
 	"github.com/joomcode/errorx"
+	"github.com/pingcap/log"
 	"go.etcd.io/etcd/clientv3"
 	"go.uber.org/fx"
+	"go.uber.org/zap"
 	"golang.org/x/sync/singleflight"
 
+	"github.com/pingcap/tidb-dashboard/pkg/apiserver/artifact"
+	"github.com/pingcap/tidb-dashboard/pkg/apiserver/model"
+	"github.com/pingcap/tidb-dashboard/pkg/apiserver/profiling"
 	"github.com/pingcap/tidb-dashboard/pkg/apiserver/user"
 	"github.com/pingcap/tidb-dashboard/pkg/apiserver/utils"
 	"github.com/pingcap/tidb-dashboard/pkg/config"
+	"github.com/pingcap/tidb-dashboard/pkg/dbstore"
+	"github.com/pingcap/tidb-dashboard/pkg/httpc"
+	"github.com/pingcap/tidb-dashboard/pkg/pd"
 	"github.com/pingcap/tidb-dashboard/pkg/utils/topology"
 	"github.com/pingcap/tidb-dashboard/util/featureflag"
+	"github.com/pingcap/tidb-dashboard/util/pprofutil"
 	"github.com/pingcap/tidb-dashboard/util/rest"
+	"github.com/pingcap/tidb-dashboard/util/ziputil"
 )
 
 var (
 	ConProfErrNS             = errorx.NewNamespace("error.api.continuous_profiling")
 	ErrNgMonitoringNotDeploy = ConProfErrNS.NewType("ng_monitoring_not_deploy")
 	ErrNgMonitoringNotStart  = ConProfErrNS.NewType("ng_monitoring_not_start")
+	ErrNgMonitoringRequest   = ConProfErrNS.NewType("ng_monitoring_request_failed")
 )
 
 const (
 	ngMonitoringCacheTTL = time.Second * 5
+	fetchProfileTimeout  = time.Minute
 )
 
 type ngMonitoringAddrCacheEntity struct {
@@ -45,9 +62,15 @@ type ngMonitoringAddrCacheEntity struct {
 type ServiceParams struct {
 	fx.In
 
-	EtcdClient   *clientv3.Client
-	Config       *config.Config
-	FeatureFlags *featureflag.Registry
+	EtcdClient    *clientv3.Client
+	PDClient      *pd.Client
+	Config        *config.Config
+	ConfigManager *config.DynamicConfigManager
+	LocalStore    *dbstore.DB
+	FeatureFlags  *featureflag.Registry
+	HTTPClient    *httpc.Client
+	Profiling     *profiling.Service
+	Artifacts     *artifact.Manager
 }
 
 type Service struct {
@@ -55,25 +78,39 @@ type Service struct {
 
 	params       ServiceParams
 	lifecycleCtx context.Context
+	wg           sync.WaitGroup
 
 	ngMonitoringReqGroup  singleflight.Group
 	ngMonitoringAddrCache atomic.Value
 }
 
-func newService(lc fx.Lifecycle, p ServiceParams) *Service {
+func newService(lc fx.Lifecycle, p ServiceParams) (*Service, error) {
+	if err := autoMigrate(p.LocalStore); err != nil {
+		return nil, err
+	}
 	s := &Service{
 		FeatureFlagConprof: p.FeatureFlags.Register("conprof", ">= 5.3.0"),
 		params:             p,
 	}
+	p.Artifacts.RegisterKind(artifactKind, s.localDataDir(), s.evictLocalProfiles)
 
 	lc.Append(fx.Hook{
 		OnStart: func(ctx context.Context) error {
 			s.lifecycleCtx = ctx
+			s.wg.Add(1)
+			go func() {
+				defer s.wg.Done()
+				s.localCollectLoop(ctx)
+			}()
+			return nil
+		},
+		OnStop: func(context.Context) error {
+			s.wg.Wait()
 			return nil
 		},
 	})
 
-	return s
+	return s, nil
 }
 
 // Register register the handlers to the service.
@@ -82,22 +119,30 @@ func registerRouter(r *gin.RouterGroup, auth *user.AuthService, s *Service) {
 
 	endpoint.Use(s.FeatureFlagConprof.VersionGuard())
 	{
-		endpoint.GET("/config", auth.MWAuthRequired(), s.reverseProxy("/config"), s.conprofConfig)
-		endpoint.POST("/config", auth.MWAuthRequired(), auth.MWRequireWritePriv(), s.reverseProxy("/config"), s.updateConprofConfig)
-		endpoint.GET("/components", auth.MWAuthRequired(), s.reverseProxy("/continuous_profiling/components"), s.conprofComponents)
-		endpoint.GET("/estimate_size", auth.MWAuthRequired(), s.reverseProxy("/continuous_profiling/estimate_size"), s.estimateSize)
-		endpoint.GET("/group_profiles", auth.MWAuthRequired(), s.reverseProxy("/continuous_profiling/group_profiles"), s.conprofGroupProfiles)
-		endpoint.GET("/group_profile/detail", auth.MWAuthRequired(), s.reverseProxy("/continuous_profiling/group_profile/detail"), s.conprofGroupProfileDetail)
-
-		endpoint.GET("/action_token", auth.MWAuthRequired(), s.genConprofActionToken)
+		endpoint.GET("/config", auth.MWAuthRequired(), auth.MWRequirePermission(user.PermConprofView), s.reverseProxy("/config"), s.conprofConfig)
+		endpoint.POST("/config", auth.MWAuthRequired(), auth.MWRequirePermission(user.PermConprofConfig), s.reverseProxy("/config"), s.updateConprofConfig)
+		endpoint.GET("/components", auth.MWAuthRequired(), auth.MWRequirePermission(user.PermConprofView), s.reverseProxy("/continuous_profiling/components"), s.conprofComponents)
+		endpoint.GET("/estimate_size", auth.MWAuthRequired(), auth.MWRequirePermission(user.PermConprofView), s.reverseProxy("/continuous_profiling/estimate_size"), s.estimateSize)
+		endpoint.GET("/group_profiles", auth.MWAuthRequired(), auth.MWRequirePermission(user.PermConprofView), s.reverseProxy("/continuous_profiling/group_profiles"), s.conprofGroupProfiles)
+		endpoint.GET("/group_profile/detail", auth.MWAuthRequired(), auth.MWRequirePermission(user.PermConprofView), s.reverseProxy("/continuous_profiling/group_profile/detail"), s.conprofGroupProfileDetail)
+
+		endpoint.GET("/action_token", auth.MWAuthRequired(), auth.MWRequirePermission(user.PermConprofView), s.genConprofActionToken)
 		endpoint.GET("/download", s.reverseProxy("/continuous_profiling/download"), s.conprofDownload)
 		endpoint.GET("/single_profile/view", s.reverseProxy("/continuous_profiling/single_profile/view"), s.conprofViewProfile)
+		endpoint.GET("/single_profile/analyze", auth.MWAuthRequired(), auth.MWRequirePermission(user.PermConprofView), s.conprofAnalyzeProfile)
+		endpoint.GET("/merged_profile", auth.MWAuthRequired(), auth.MWRequirePermission(user.PermConprofView), s.conprofMergeProfiles)
 	}
 }
 
+// reverseProxy forwards the request to NgMonitoring. When NgMonitoring is not available, the request is passed to
+// the next handler, which is served by the built-in continuous profiling.
 func (s *Service) reverseProxy(targetPath string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		ngMonitoringAddr, err := s.getNgMonitoringAddrFromCache()
+		if isNgMonitoringAbsent(err) {
+			return
+		}
+		defer c.Abort()
 		if err != nil {
 			_ = c.Error(err)
 			return
@@ -166,6 +211,9 @@ type ContinuousProfilingConfig struct {
 	IntervalSeconds      int  `json:"interval_seconds"`
 	TimeoutSeconds       int  `json:"timeout_seconds"`
 	DataRetentionSeconds int  `json:"data_retention_seconds"`
+	// Components profiled by the built-in continuous profiling, all components are profiled when empty.
+	// It is not supported by NgMonitoring.
+	Components []model.NodeKind `json:"components,omitempty"`
 }
 
 type NgMonitoringConfig struct {
@@ -179,7 +227,18 @@ type NgMonitoringConfig struct {
 // @Failure 401 {object} rest.ErrorResponse
 // @Failure 500 {object} rest.ErrorResponse
 func (s *Service) conprofConfig(c *gin.Context) {
-	// dummy, for generate openapi
+	dc, err := s.params.ConfigManager.Get()
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, NgMonitoringConfig{ContinuousProfiling: ContinuousProfilingConfig{
+		Enable:               dc.Conprof.Enable,
+		ProfileSeconds:       int(dc.Conprof.ProfileSecs),
+		IntervalSeconds:      int(dc.Conprof.IntervalSecs),
+		DataRetentionSeconds: int(dc.Conprof.RetentionSecs),
+		Components:           dc.Conprof.Components,
+	}})
 }
 
 // @Summary Update Continuous Profiling Config
@@ -190,7 +249,35 @@ func (s *Service) conprofConfig(c *gin.Context) {
 // @Failure 401 {object} rest.ErrorResponse
 // @Failure 500 {object} rest.ErrorResponse
 func (s *Service) updateConprofConfig(c *gin.Context) {
-	// dummy, for generate openapi
+	var req NgMonitoringConfig
+	if err := c.ShouldBindJSON(&req); err != nil {
+		_ = c.Error(rest.ErrBadRequest.WrapWithNoMessage(err))
+		return
+	}
+	cfg := req.ContinuousProfiling
+	if cfg.ProfileSeconds < 0 || cfg.IntervalSeconds < 0 || cfg.DataRetentionSeconds < 0 {
+		_ = c.Error(rest.ErrBadRequest.New("Seconds cannot be negative"))
+		return
+	}
+	var opt config.DynamicConfigOption = func(dc *config.DynamicConfig) {
+		dc.Conprof.Enable = cfg.Enable
+		dc.Conprof.Components = cfg.Components
+		// Zero values are not modified, as NgMonitoring does.
+		if cfg.ProfileSeconds > 0 {
+			dc.Conprof.ProfileSecs = uint(cfg.ProfileSeconds)
+		}
+		if cfg.IntervalSeconds > 0 {
+			dc.Conprof.IntervalSecs = uint(cfg.IntervalSeconds)
+		}
+		if cfg.DataRetentionSeconds > 0 {
+			dc.Conprof.RetentionSecs = uint(cfg.DataRetentionSeconds)
+		}
+	}
+	if err := s.params.ConfigManager.Modify(opt); err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.String(http.StatusOK, "ok")
 }
 
 type Component struct {
@@ -207,7 +294,18 @@ type Component struct {
 // @Failure 401 {object} rest.ErrorResponse
 // @Failure 500 {object} rest.ErrorResponse
 func (s *Service) conprofComponents(c *gin.Context) {
-	// dummy, for generate openapi
+	dc, err := s.params.ConfigManager.Get()
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	components := make([]Component, 0)
+	if dc.Conprof.Enable {
+		for _, t := range s.localTargets(c.Request.Context(), dc.Conprof.Components) {
+			components = append(components, Component{Name: string(t.Kind), IP: t.IP, Port: uint(t.Port), StatusPort: uint(t.Port)})
+		}
+	}
+	c.JSON(http.StatusOK, components)
 }
 
 type EstimateSizeRes struct {
@@ -222,12 +320,22 @@ type EstimateSizeRes struct {
 // @Failure 401 {object} rest.ErrorResponse
 // @Failure 500 {object} rest.ErrorResponse
 func (s *Service) estimateSize(c *gin.Context) {
-	// dummy, for generate openapi
+	dc, err := s.params.ConfigManager.Get()
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	resp, err := s.localEstimateSize(c.Request.Context(), &dc.Conprof)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, resp)
 }
 
 type GetGroupProfileReq struct {
-	BeginTime int `json:"begin_time"`
-	EndTime   int `json:"end_time"`
+	BeginTime int `json:"begin_time" form:"begin_time"`
+	EndTime   int `json:"end_time" form:"end_time"`
 }
 
 type ComponentNum struct {
@@ -271,7 +379,17 @@ type Target struct {
 // @Failure 401 {object} rest.ErrorResponse
 // @Failure 500 {object} rest.ErrorResponse
 func (s *Service) conprofGroupProfiles(c *gin.Context) {
-	// dummy, for generate openapi
+	var req GetGroupProfileReq
+	if err := c.ShouldBindQuery(&req); err != nil {
+		_ = c.Error(rest.ErrBadRequest.WrapWithNoMessage(err))
+		return
+	}
+	groups, err := s.localGroupProfiles(int64(req.BeginTime), int64(req.EndTime))
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, groups)
 }
 
 // @Summary Get Group Profile Detail
@@ -282,7 +400,17 @@ func (s *Service) conprofGroupProfiles(c *gin.Context) {
 // @Failure 401 {object} rest.ErrorResponse
 // @Failure 500 {object} rest.ErrorResponse
 func (s *Service) conprofGroupProfileDetail(c *gin.Context) {
-	// dummy, for generate openapi
+	ts, err := strconv.ParseInt(c.Query("ts"), 10, 64)
+	if err != nil {
+		_ = c.Error(rest.ErrBadRequest.WrapWithNoMessage(err))
+		return
+	}
+	detail, err := s.localGroupProfileDetail(ts)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, detail)
 }
 
 // @Summary Get action token for download or view profile
@@ -310,14 +438,39 @@ func (s *Service) genConprofActionToken(c *gin.Context) {
 // @Failure 401 {object} rest.ErrorResponse
 // @Failure 500 {object} rest.ErrorResponse
 func (s *Service) conprofDownload(c *gin.Context) {
-	// dummy, for generate openapi
+	var req struct {
+		Ts int64 `form:"ts" binding:"required"`
+	}
+	if err := bindActionToken(c, &req); err != nil {
+		_ = c.Error(rest.ErrBadRequest.WrapWithNoMessage(err))
+		return
+	}
+	var profiles []localProfileModel
+	err := s.params.LocalStore.Where("ts = ? AND state = ?", req.Ts, localStateSuccess).Find(&profiles).Error
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	filePathes := make([]string, len(profiles))
+	for i, p := range profiles {
+		filePathes[i] = p.FilePath
+	}
+	fileName := fmt.Sprintf("conprof_pack_%d.zip", req.Ts)
+	c.Writer.Header().Set("Content-type", "application/octet-stream")
+	c.Writer.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", fileName))
+	err = ziputil.WriteZipFromFiles(c.Writer, filePathes, true)
+	if err != nil {
+		log.Error("Stream zip pack failed", zap.Error(err))
+	}
 }
 
 type ViewSingleProfileReq struct {
-	Ts          int    `json:"ts"`
-	ProfileType string `json:"profile_type"`
-	Component   string `json:"component"`
-	Address     string `json:"address"`
+	Ts          int    `json:"ts" form:"ts" binding:"required"`
+	ProfileType string `json:"profile_type" form:"profile_type" binding:"required"`
+	Component   string `json:"component" form:"component" binding:"required"`
+	Address     string `json:"address" form:"address" binding:"required"`
+	DataFormat  string `json:"data_format" form:"data_format"` // svg or protobuf, default: svg
 }
 
 // @Summary View Single Profile files
@@ -328,5 +481,114 @@ type ViewSingleProfileReq struct {
 // @Failure 401 {object} rest.ErrorResponse
 // @Failure 500 {object} rest.ErrorResponse
 func (s *Service) conprofViewProfile(c *gin.Context) {
-	// dummy, for generate openapi
+	var req ViewSingleProfileReq
+	if err := bindActionToken(c, &req); err != nil {
+		_ = c.Error(rest.ErrBadRequest.WrapWithNoMessage(err))
+		return
+	}
+	p, err := s.localProfile(int64(req.Ts), req.ProfileType, req.Component, req.Address)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	content, err := ioutil.ReadFile(p.FilePath)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	if req.DataFormat == "protobuf" || p.RawDataType != profiling.RawDataTypeProtobuf {
+		c.Writer.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", filepath.Base(p.FilePath)))
+		c.Data(http.StatusOK, "application/octet-stream", content)
+		return
+	}
+	svgContent, err := profiling.ConvertProtobufToSVG(content)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.Data(http.StatusOK, "image/svg+xml", svgContent)
+}
+
+type AnalyzeSingleProfileReq struct {
+	Ts          int              `json:"ts" form:"ts" binding:"required"`
+	ProfileType string           `json:"profile_type" form:"profile_type" binding:"required"`
+	Component   string           `json:"component" form:"component" binding:"required"`
+	Address     string           `json:"address" form:"address" binding:"required"`
+	OutputType  pprofutil.Format `json:"output_type" form:"output_type" binding:"required"` // top, flamegraph, speedscope or calltree
+	pprofutil.Options
+}
+
+// @Summary Analyze Single Profile
+// @Description Convert a profile in protobuf format into JSON outputs, i.e. top, flamegraph, speedscope and calltree.
+// @Router /continuous_profiling/single_profile/analyze [get]
+// @Param q query AnalyzeSingleProfileReq true "Query"
+// @Security JwtAuth
+// @Success 200 {object} pprofutil.TopResponse
+// @Failure 400 {object} rest.ErrorResponse
+// @Failure 401 {object} rest.ErrorResponse
+// @Failure 500 {object} rest.ErrorResponse
+func (s *Service) conprofAnalyzeProfile(c *gin.Context) {
+	var req AnalyzeSingleProfileReq
+	if err := c.ShouldBindQuery(&req); err != nil {
+		_ = c.Error(rest.ErrBadRequest.WrapWithNoMessage(err))
+		return
+	}
+	if !pprofutil.IsJSONFormat(string(req.OutputType)) {
+		_ = c.Error(rest.ErrBadRequest.New("Unsupported output type %s", req.OutputType))
+		return
+	}
+	data, err := s.fetchProfileData(c.Request.Context(), int64(req.Ts), req.ProfileType, req.Component, req.Address)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	p, err := profile.ParseData(data)
+	if err != nil {
+		// Profiles of some types, e.g. goroutine, are not in protobuf format
+		_ = c.Error(rest.ErrBadRequest.Wrap(err, "Profile is not in protobuf format"))
+		return
+	}
+	resp, err := pprofutil.Convert(p, req.OutputType, &req.Options)
+	if err != nil {
+		_ = c.Error(rest.ErrBadRequest.WrapWithNoMessage(err))
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// fetchProfileData returns the profile from NgMonitoring in protobuf format, or from the built-in continuous
+// profiling when NgMonitoring is not available.
+func (s *Service) fetchProfileData(ctx context.Context, ts int64, profileType, component, address string) ([]byte, error) {
+	ngMonitoringAddr, err := s.getNgMonitoringAddrFromCache()
+	if isNgMonitoringAbsent(err) {
+		p, err := s.localProfile(ts, profileType, component, address)
+		if err != nil {
+			return nil, err
+		}
+		return ioutil.ReadFile(p.FilePath)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	query := url.Values{}
+	query.Set("ts", strconv.FormatInt(ts, 10))
+	query.Set("profile_type", profileType)
+	query.Set("component", component)
+	query.Set("address", address)
+	query.Set("data_format", "protobuf")
+	uri := fmt.Sprintf("%s/continuous_profiling/single_profile/view?%s", ngMonitoringAddr, query.Encode())
+	return s.params.HTTPClient.
+		WithTimeout(fetchProfileTimeout).
+		SendRequest(ctx, uri, http.MethodGet, nil, ErrNgMonitoringRequest, "NgMonitoring")
+}
+
+// bindActionToken binds the query string in the action token, which is used by the built-in continuous profiling.
+func bindActionToken(c *gin.Context, req interface{}) error {
+	queryStr, err := utils.ParseJWTString("conprof", c.Query("token"))
+	if err != nil {
+		return err
+	}
+	c.Request.URL.RawQuery = queryStr
+	return c.ShouldBindQuery(req)
 }
@@ -23,6 +23,7 @@ func registerRouter(r *gin.RouterGroup, auth *user.AuthService, s *Service) {
 	ep.GET("/download", s.Download)
 	{
 		ep.Use(auth.MWAuthRequired())
+		ep.Use(auth.MWRequirePermission(user.PermDebugAPIRequest))
 		ep.GET("/endpoints", s.GetEndpoints)
 		ep.POST("/endpoint", s.RequestEndpoint)
 	}
@@ -3,13 +3,19 @@
 package diagnose
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/pingcap/log"
+	"go.uber.org/fx"
 	"go.uber.org/zap"
+	"gorm.io/gorm"
 
 	"github.com/pingcap/tidb-dashboard/pkg/apiserver/user"
 	"github.com/pingcap/tidb-dashboard/pkg/apiserver/utils"
@@ -30,41 +36,87 @@ type Service struct {
 	db         *dbstore.DB
 	tidbClient *tidb.Client
 	fileServer http.Handler
+	wg         sync.WaitGroup
+
+	lifecycleCtx context.Context
 }
 
-func NewService(config *config.Config, tidbClient *tidb.Client, db *dbstore.DB, uiAssetFS http.FileSystem) *Service {
+func NewService(lc fx.Lifecycle, config *config.Config, tidbClient *tidb.Client, db *dbstore.DB, uiAssetFS http.FileSystem) *Service {
 	err := autoMigrate(db)
 	if err != nil {
 		log.Fatal("Failed to initialize database", zap.Error(err))
 	}
 
-	return &Service{
+	s := &Service{
 		config:     config,
 		db:         db,
 		tidbClient: tidbClient,
 		fileServer: uiserver.Handler(uiAssetFS),
 	}
+	lc.Append(fx.Hook{
+		OnStart: func(ctx context.Context) error {
+			s.lifecycleCtx = ctx
+			s.wg.Add(1)
+			go func() {
+				defer s.wg.Done()
+				s.scheduleLoop(ctx)
+			}()
+			return nil
+		},
+		OnStop: func(context.Context) error {
+			s.wg.Wait()
+			return nil
+		},
+	})
+	return s
 }
 
 func RegisterRouter(r *gin.RouterGroup, auth *user.AuthService, s *Service) {
 	endpoint := r.Group("/diagnose")
 	endpoint.GET("/reports",
 		auth.MWAuthRequired(),
+		auth.MWRequirePermission(user.PermDiagnoseView),
 		s.reportsHandler)
 	endpoint.POST("/reports",
 		auth.MWAuthRequired(),
+		auth.MWRequirePermission(user.PermDiagnoseGenerate),
 		utils.MWConnectTiDB(s.tidbClient),
 		s.genReportHandler)
 	endpoint.GET("/reports/:id/detail", s.reportHTMLHandler)
 	endpoint.GET("/reports/:id/data.js", s.reportDataHandler)
+	endpoint.GET("/reports/:id/export",
+		auth.MWAuthRequired(),
+		auth.MWRequirePermission(user.PermDiagnoseView),
+		s.exportReportHandler)
 	endpoint.GET("/reports/:id/status",
 		auth.MWAuthRequired(),
+		auth.MWRequirePermission(user.PermDiagnoseView),
 		s.reportStatusHandler)
 
 	endpoint.POST("/diagnosis",
 		auth.MWAuthRequired(),
+		auth.MWRequirePermission(user.PermDiagnoseGenerate),
 		utils.MWConnectTiDB((s.tidbClient)),
 		s.genDiagnosisHandler)
+
+	endpoint.GET("/schedules",
+		auth.MWAuthRequired(),
+		auth.MWRequirePermission(user.PermDiagnoseView),
+		s.getSchedulesHandler)
+	endpoint.POST("/schedules",
+		auth.MWAuthRequired(),
+		auth.MWRequirePermission(user.PermDiagnoseGenerate),
+		utils.MWConnectTiDB(s.tidbClient),
+		s.createScheduleHandler)
+	endpoint.PUT("/schedules/:id",
+		auth.MWAuthRequired(),
+		auth.MWRequirePermission(user.PermDiagnoseGenerate),
+		utils.MWConnectTiDB(s.tidbClient),
+		s.updateScheduleHandler)
+	endpoint.DELETE("/schedules/:id",
+		auth.MWAuthRequired(),
+		auth.MWRequirePermission(user.PermDiagnoseGenerate),
+		s.deleteScheduleHandler)
 }
 
 type GenerateReportRequest struct {
@@ -124,26 +176,49 @@ func (s *Service) genReportHandler(c *gin.Context) {
 
 	go func() {
 		defer utils.CloseTiDBConnection(db) //nolint:errcheck
-
-		var tables []*TableDef
-		if compareStartTime == nil || compareEndTime == nil {
-			tables = GetReportTablesForDisplay(startTime.Format(timeLayout), endTime.Format(timeLayout), db, s.db, reportID)
-		} else {
-			tables = GetCompareReportTablesForDisplay(
-				compareStartTime.Format(timeLayout), compareEndTime.Format(timeLayout),
-				startTime.Format(timeLayout), endTime.Format(timeLayout),
-				db, s.db, reportID)
-		}
-		_ = UpdateReportProgress(s.db, reportID, 100)
-		content, err := json.Marshal(tables)
-		if err == nil {
-			_ = SaveReportContent(s.db, reportID, string(content))
-		}
+		s.generateReport(s.lifecycleCtx, db, reportID, startTime, endTime, compareStartTime, compareEndTime)
 	}()
 
 	c.JSON(http.StatusOK, reportID)
 }
 
+// generateReport queries TiDB using the context, so that the generation is cancelled when the service stops. The
+// report is left unfinished in this case.
+func (s *Service) generateReport(ctx context.Context, db *gorm.DB, reportID string, startTime, endTime time.Time, compareStartTime, compareEndTime *time.Time) {
+	db = db.WithContext(ctx)
+	var tables []*TableDef
+	if compareStartTime == nil || compareEndTime == nil {
+		tables = GetReportTablesForDisplay(startTime.Format(timeLayout), endTime.Format(timeLayout), db, s.db, reportID)
+	} else {
+		tables = GetCompareReportTablesForDisplay(
+			compareStartTime.Format(timeLayout), compareEndTime.Format(timeLayout),
+			startTime.Format(timeLayout), endTime.Format(timeLayout),
+			db, s.db, reportID)
+		if ctx.Err() != nil {
+			return
+		}
+		_ = UpdateReportHasFindings(s.db, reportID, hasCompareFindings(tables))
+	}
+	if ctx.Err() != nil {
+		return
+	}
+	_ = UpdateReportProgress(s.db, reportID, 100)
+	content, err := json.Marshal(tables)
+	if err == nil {
+		_ = SaveReportContent(s.db, reportID, string(content))
+	}
+}
+
+// hasCompareFindings returns whether the `CompareDiagnose` table in the report contains any rows.
+func hasCompareFindings(tables []*TableDef) bool {
+	for _, tbl := range tables {
+		if tbl != nil && tbl.Title == compareDiagnoseTitle && len(tbl.Rows) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
 // @Summary Diagnosis report status
 // @Description Get diagnosis report status
 // @Param id path string true "report id"
@@ -194,6 +269,55 @@ func (s *Service) reportDataHandler(c *gin.Context) {
 	c.Data(http.StatusOK, "text/javascript", []byte(data))
 }
 
+type ExportReportRequest struct {
+	Format string `json:"format" form:"format"` // values: html, md, json
+}
+
+// @Summary Export diagnosis report
+// @Description Export a finished diagnosis report as a standalone HTML, Markdown or JSON file
+// @Produce html
+// @Produce json
+// @Param id path string true "report id"
+// @Param q query ExportReportRequest true "Query"
+// @Success 200 {string} string
+// @Router /diagnose/reports/{id}/export [get]
+// @Security JwtAuth
+// @Failure 400 {object} rest.ErrorResponse
+// @Failure 401 {object} rest.ErrorResponse
+func (s *Service) exportReportHandler(c *gin.Context) {
+	var req ExportReportRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		_ = c.Error(rest.ErrBadRequest.NewWithNoMessage())
+		return
+	}
+	switch req.Format {
+	case ExportFormatHTML, ExportFormatMarkdown, ExportFormatJSON:
+	default:
+		_ = c.Error(rest.ErrBadRequest.New("Unsupported export format %s", req.Format))
+		return
+	}
+
+	report, err := GetReport(s.db, c.Param("id"))
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	if report.Progress < 100 || report.Content == "" {
+		_ = c.Error(rest.ErrBadRequest.New("Report is not finished yet"))
+		return
+	}
+
+	data, contentType, err := exportReport(report, req.Format)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	fileName := fmt.Sprintf("diagnosis_report_%s_%s.%s",
+		report.StartTime.Format("20060102150405"), report.EndTime.Format("20060102150405"), req.Format)
+	c.Writer.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, fileName))
+	c.Data(http.StatusOK, contentType, data)
+}
+
 type GenDiagnosisReportRequest struct {
 	StartTime int64  `json:"start_time"`
 	EndTime   int64  `json:"end_time"`
@@ -237,3 +361,135 @@ func (s *Service) genDiagnosisHandler(c *gin.Context) {
 	}
 	c.JSON(http.StatusOK, table)
 }
+
+type ScheduleRequest struct {
+	Name                      string `json:"name"`
+	Enabled                   bool   `json:"enabled"`
+	PeriodSecs                int64  `json:"period_secs"`
+	WindowOffsetSecs          int64  `json:"window_offset_secs"`
+	WindowDurationSecs        int64  `json:"window_duration_secs"`
+	TimezoneOffsetSecs        int64  `json:"timezone_offset_secs"`
+	CompareWithPreviousPeriod bool   `json:"compare_with_previous_period"`
+	KeepLast                  int    `json:"keep_last"`
+}
+
+// @Summary Get diagnosis report schedules
+// @Success 200 {array} ReportSchedule
+// @Router /diagnose/schedules [get]
+// @Security JwtAuth
+// @Failure 401 {object} rest.ErrorResponse
+func (s *Service) getSchedulesHandler(c *gin.Context) {
+	schedules, err := GetReportSchedules(s.db)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, schedules)
+}
+
+// @Summary Create a diagnosis report schedule
+// @Description Reports will be generated using the SQL credential of current user.
+// @Description The SQL password is stored in the local store of the dashboard, encrypted by its master key, until the schedule is updated by another user or deleted.
+// @Param request body ScheduleRequest true "Request body"
+// @Success 200 {object} ReportSchedule
+// @Router /diagnose/schedules [post]
+// @Security JwtAuth
+// @Failure 400 {object} rest.ErrorResponse
+// @Failure 401 {object} rest.ErrorResponse
+func (s *Service) createScheduleHandler(c *gin.Context) {
+	var sch ReportSchedule
+	if !s.bindSchedule(c, &sch) {
+		return
+	}
+	// Only windows finished after the creation will be generated.
+	_, windowEnd := sch.latestWindow(time.Now())
+	sch.LastWindowEnd = windowEnd.Unix()
+	if err := s.db.Create(&sch).Error; err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, sch)
+}
+
+// @Summary Update a diagnosis report schedule
+// @Description Reports will be generated using the SQL credential of current user.
+// @Description The SQL password is stored in the local store of the dashboard, encrypted by its master key, until the schedule is updated by another user or deleted.
+// @Param id path string true "schedule id"
+// @Param request body ScheduleRequest true "Request body"
+// @Success 200 {object} ReportSchedule
+// @Router /diagnose/schedules/{id} [put]
+// @Security JwtAuth
+// @Failure 400 {object} rest.ErrorResponse
+// @Failure 401 {object} rest.ErrorResponse
+func (s *Service) updateScheduleHandler(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		_ = c.Error(rest.ErrBadRequest.New("Invalid schedule id"))
+		return
+	}
+	var sch ReportSchedule
+	if err := s.db.First(&sch, id).Error; err != nil {
+		_ = c.Error(err)
+		return
+	}
+	if !s.bindSchedule(c, &sch) {
+		return
+	}
+	if err := s.db.Save(&sch).Error; err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, sch)
+}
+
+// bindSchedule fills the schedule by the request body and the credential of current session.
+// Errors are attached to the context when false is returned.
+func (s *Service) bindSchedule(c *gin.Context, sch *ReportSchedule) bool {
+	var req ScheduleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		_ = c.Error(rest.ErrBadRequest.NewWithNoMessage())
+		return false
+	}
+	sch.Name = req.Name
+	sch.Enabled = req.Enabled
+	sch.PeriodSecs = req.PeriodSecs
+	sch.WindowOffsetSecs = req.WindowOffsetSecs
+	sch.WindowDurationSecs = req.WindowDurationSecs
+	sch.TimezoneOffsetSecs = req.TimezoneOffsetSecs
+	sch.CompareWithPreviousPeriod = req.CompareWithPreviousPeriod
+	sch.KeepLast = req.KeepLast
+	if !sch.isValid() {
+		_ = c.Error(rest.ErrBadRequest.New("Invalid schedule"))
+		return false
+	}
+
+	sessionUser := utils.GetSession(c)
+	encrypted, err := s.db.EncryptSecret(sessionUser.TiDBPassword)
+	if err != nil {
+		_ = c.Error(err)
+		return false
+	}
+	sch.SQLUser = sessionUser.TiDBUsername
+	sch.EncryptedPass = encrypted
+	return true
+}
+
+// @Summary Delete a diagnosis report schedule
+// @Description Reports generated by the schedule are kept.
+// @Param id path string true "schedule id"
+// @Success 200 {object} rest.EmptyResponse
+// @Router /diagnose/schedules/{id} [delete]
+// @Security JwtAuth
+// @Failure 401 {object} rest.ErrorResponse
+func (s *Service) deleteScheduleHandler(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		_ = c.Error(rest.ErrBadRequest.New("Invalid schedule id"))
+		return
+	}
+	if err := s.db.Delete(&ReportSchedule{}, id).Error; err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, rest.EmptyResponse{})
+}
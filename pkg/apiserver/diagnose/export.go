@@ -0,0 +1,193 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package diagnose
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html"
+	"html/template"
+	"strings"
+	"time"
+)
+
+const (
+	ExportFormatHTML     = "html"
+	ExportFormatMarkdown = "md"
+	ExportFormatJSON     = "json"
+)
+
+type exportedSection struct {
+	Category string
+	Tables   []*TableDef
+}
+
+type exportedReport struct {
+	Title            string
+	TimeRange        string
+	CompareTimeRange string
+	GeneratedAt      string
+	Sections         []exportedSection
+}
+
+func newExportedReport(report *Report, tables []*TableDef) *exportedReport {
+	r := &exportedReport{
+		Title:       "TiDB Dashboard Diagnosis Report",
+		TimeRange:   formatTimeRange(report.StartTime, report.EndTime),
+		GeneratedAt: report.CreatedAt.Format(timeLayout),
+	}
+	if report.CompareStartTime != nil && report.CompareEndTime != nil {
+		r.CompareTimeRange = formatTimeRange(*report.CompareStartTime, *report.CompareEndTime)
+	}
+	// Category of tables is cleared when it is the same as the previous table, see `GetReportTablesForDisplay`.
+	for _, tbl := range tables {
+		if tbl == nil {
+			continue
+		}
+		category := strings.Join(tbl.Category, ",")
+		if category != "" || len(r.Sections) == 0 {
+			r.Sections = append(r.Sections, exportedSection{Category: category})
+		}
+		section := &r.Sections[len(r.Sections)-1]
+		section.Tables = append(section.Tables, tbl)
+	}
+	return r
+}
+
+func formatTimeRange(start, end time.Time) string {
+	return fmt.Sprintf("%s ~ %s", start.Format(timeLayout), end.Format(timeLayout))
+}
+
+// exportReport renders a finished report into the specified format, returning the content and the MIME type.
+func exportReport(report *Report, format string) ([]byte, string, error) {
+	var tables []*TableDef
+	if err := json.Unmarshal([]byte(report.Content), &tables); err != nil {
+		return nil, "", err
+	}
+	switch format {
+	case ExportFormatJSON:
+		b, err := json.MarshalIndent(tables, "", "  ")
+		return b, "application/json; charset=utf-8", err
+	case ExportFormatMarkdown:
+		return renderMarkdown(newExportedReport(report, tables)), "text/markdown; charset=utf-8", nil
+	case ExportFormatHTML:
+		var buf bytes.Buffer
+		err := htmlReportTemplate.Execute(&buf, newExportedReport(report, tables))
+		return buf.Bytes(), "text/html; charset=utf-8", err
+	default:
+		return nil, "", fmt.Errorf("unsupported export format %s", format)
+	}
+}
+
+// escapeMarkdownText escapes HTML in the text, since Markdown renderers pass inline HTML through.
+func escapeMarkdownText(s string) string {
+	return html.EscapeString(s)
+}
+
+func escapeMarkdownCell(s string) string {
+	s = escapeMarkdownText(s)
+	s = strings.ReplaceAll(s, "|", `\|`)
+	s = strings.ReplaceAll(s, "\r\n", "<br>")
+	return strings.ReplaceAll(s, "\n", "<br>")
+}
+
+func writeMarkdownRow(buf *bytes.Buffer, values []string, columns int) {
+	buf.WriteString("|")
+	for i := 0; i < columns; i++ {
+		v := ""
+		if i < len(values) {
+			v = values[i]
+		}
+		buf.WriteString(" ")
+		buf.WriteString(escapeMarkdownCell(v))
+		buf.WriteString(" |")
+	}
+	buf.WriteString("\n")
+}
+
+func renderMarkdown(r *exportedReport) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "# %s\n\n", r.Title)
+	fmt.Fprintf(&buf, "- Time range: %s\n", r.TimeRange)
+	if r.CompareTimeRange != "" {
+		fmt.Fprintf(&buf, "- Compare time range: %s\n", r.CompareTimeRange)
+	}
+	fmt.Fprintf(&buf, "- Generated at: %s\n", r.GeneratedAt)
+	for _, section := range r.Sections {
+		if section.Category != "" {
+			fmt.Fprintf(&buf, "\n## %s\n", escapeMarkdownText(section.Category))
+		}
+		for _, tbl := range section.Tables {
+			fmt.Fprintf(&buf, "\n### %s\n\n", escapeMarkdownText(tbl.Title))
+			if tbl.Comment != "" {
+				fmt.Fprintf(&buf, "%s\n\n", escapeMarkdownText(strings.TrimSpace(tbl.Comment)))
+			}
+			columns := len(tbl.Column)
+			if columns == 0 {
+				continue
+			}
+			writeMarkdownRow(&buf, tbl.Column, columns)
+			buf.WriteString("|" + strings.Repeat(" --- |", columns) + "\n")
+			for _, row := range tbl.Rows {
+				writeMarkdownRow(&buf, row.Values, columns)
+				for _, subValues := range row.SubValues {
+					writeMarkdownRow(&buf, subValues, columns)
+				}
+			}
+		}
+	}
+	return buf.Bytes()
+}
+
+var htmlReportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8" />
+<title>{{.Title}}</title>
+<style>
+body { font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", Roboto, Arial, sans-serif; font-size: 13px; margin: 24px; color: #262626; }
+h1 { font-size: 22px; }
+h2 { font-size: 18px; margin-top: 32px; border-bottom: 1px solid #e8e8e8; padding-bottom: 4px; }
+h3 { font-size: 14px; margin-top: 20px; }
+.comment { color: #8c8c8c; white-space: pre-wrap; }
+table { border-collapse: collapse; margin-bottom: 8px; }
+th, td { border: 1px solid #e8e8e8; padding: 4px 8px; text-align: left; vertical-align: top; white-space: pre-wrap; }
+th { background: #fafafa; }
+tr.sub td { color: #595959; background: #fcfcfc; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<ul>
+<li>Time range: {{.TimeRange}}</li>
+{{- if .CompareTimeRange}}
+<li>Compare time range: {{.CompareTimeRange}}</li>
+{{- end}}
+<li>Generated at: {{.GeneratedAt}}</li>
+</ul>
+{{- range .Sections}}
+{{- if .Category}}
+<h2>{{.Category}}</h2>
+{{- end}}
+{{- range .Tables}}
+<h3>{{.Title}}</h3>
+{{- if .Comment}}
+<p class="comment">{{.Comment}}</p>
+{{- end}}
+{{- if .Column}}
+<table>
+<tr>{{range .Column}}<th>{{.}}</th>{{end}}</tr>
+{{- range .Rows}}
+<tr{{if .Comment}} title="{{.Comment}}"{{end}}>{{range .Values}}<td>{{.}}</td>{{end}}</tr>
+{{- range .SubValues}}
+<tr class="sub">{{range .}}<td>{{.}}</td>{{end}}</tr>
+{{- end}}
+{{- end}}
+</table>
+{{- end}}
+{{- end}}
+{{- end}}
+</body>
+</html>
+`))
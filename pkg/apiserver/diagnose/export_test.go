@@ -0,0 +1,70 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package diagnose
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	. "github.com/pingcap/check"
+)
+
+var _ = Suite(&testExportSuite{})
+
+type testExportSuite struct{}
+
+func newTestReport(c *C) *Report {
+	tables := []*TableDef{
+		{Category: []string{"header"}, Title: "report_time_range", Column: []string{"START_TIME", "END_TIME"}, Rows: []TableRowDef{{Values: []string{"a", "b"}}}},
+		nil,
+		{Category: []string{""}, Title: "cluster_info", Column: []string{"TYPE", "DETAIL"}, Rows: []TableRowDef{
+			{Values: []string{"tidb", "x|y"}, SubValues: [][]string{{"", "<script>"}}},
+		}},
+		{Category: []string{"diagnose"}, Title: "compare_diagnose", Comment: "some <b>comment</b>", Column: []string{"RULE"}},
+	}
+	content, err := json.Marshal(tables)
+	c.Assert(err, IsNil)
+	return &Report{
+		ID:        "id",
+		CreatedAt: time.Unix(0, 0),
+		Progress:  100,
+		Content:   string(content),
+		StartTime: time.Unix(0, 0),
+		EndTime:   time.Unix(3600, 0),
+	}
+}
+
+func (t *testExportSuite) TestExportMarkdown(c *C) {
+	data, contentType, err := exportReport(newTestReport(c), ExportFormatMarkdown)
+	c.Assert(err, IsNil)
+	c.Assert(strings.HasPrefix(contentType, "text/markdown"), IsTrue)
+	md := string(data)
+	c.Assert(strings.Count(md, "\n## "), Equals, 2)
+	c.Assert(strings.Contains(md, "| tidb | x\\|y |"), IsTrue)
+	c.Assert(strings.Contains(md, "|  | &lt;script&gt; |"), IsTrue)
+	c.Assert(strings.Contains(md, "<script>"), IsFalse)
+	c.Assert(strings.Contains(md, "some &lt;b&gt;comment&lt;/b&gt;"), IsTrue)
+	c.Assert(strings.Contains(md, "Compare time range"), IsFalse)
+}
+
+func (t *testExportSuite) TestExportHTML(c *C) {
+	data, _, err := exportReport(newTestReport(c), ExportFormatHTML)
+	c.Assert(err, IsNil)
+	html := string(data)
+	c.Assert(strings.Contains(html, "<h3>cluster_info</h3>"), IsTrue)
+	c.Assert(strings.Contains(html, "&lt;script&gt;"), IsTrue)
+	c.Assert(strings.Contains(html, "<script>"), IsFalse)
+	c.Assert(strings.Contains(html, "<b>"), IsFalse)
+}
+
+func (t *testExportSuite) TestExportJSON(c *C) {
+	data, _, err := exportReport(newTestReport(c), ExportFormatJSON)
+	c.Assert(err, IsNil)
+	var tables []*TableDef
+	c.Assert(json.Unmarshal(data, &tables), IsNil)
+	c.Assert(tables, HasLen, 4)
+
+	_, _, err = exportReport(newTestReport(c), "pdf")
+	c.Assert(err, NotNil)
+}
@@ -11,6 +11,8 @@ import (
 	"gorm.io/gorm"
 )
 
+const compareDiagnoseTitle = "compare_diagnose"
+
 type clusterInspection struct {
 	referStartTime string
 	referEndTime   string
@@ -29,7 +31,7 @@ func CompareDiagnose(referStartTime, referEndTime, startTime, endTime string, db
 	}
 	table := TableDef{
 		Category: []string{CategoryDiagnose},
-		Title:    "compare_diagnose",
+		Title:    compareDiagnoseTitle,
 		Comment:  "",
 		Column:   []string{"RULE", "DETAIL"},
 	}
@@ -19,6 +19,9 @@ type Report struct {
 	EndTime          time.Time  `json:"end_time"`
 	CompareStartTime *time.Time `json:"compare_start_time"`
 	CompareEndTime   *time.Time `json:"compare_end_time"`
+	ScheduleID       *uint      `gorm:"index" json:"schedule_id"` // nil for reports generated on demand
+	// Whether the compare diagnosis of the report has findings. Always false for reports without comparison.
+	HasFindings bool `json:"has_findings"`
 }
 
 func (Report) TableName() string {
@@ -26,10 +29,14 @@ func (Report) TableName() string {
 }
 
 func autoMigrate(db *dbstore.DB) error {
-	return db.AutoMigrate(&Report{})
+	return db.AutoMigrate(&Report{}, &ReportSchedule{})
 }
 
 func NewReport(db *dbstore.DB, startTime, endTime time.Time, compareStartTime, compareEndTime *time.Time) (string, error) {
+	return newReport(db, startTime, endTime, compareStartTime, compareEndTime, nil)
+}
+
+func newReport(db *dbstore.DB, startTime, endTime time.Time, compareStartTime, compareEndTime *time.Time, scheduleID *uint) (string, error) {
 	report := Report{
 		ID:               uuid.New().String(),
 		CreatedAt:        time.Now(),
@@ -37,6 +44,7 @@ func NewReport(db *dbstore.DB, startTime, endTime time.Time, compareStartTime, c
 		EndTime:          endTime,
 		CompareStartTime: compareStartTime,
 		CompareEndTime:   compareEndTime,
+		ScheduleID:       scheduleID,
 	}
 	err := db.Create(&report).Error
 	if err != nil {
@@ -48,7 +56,7 @@ func NewReport(db *dbstore.DB, startTime, endTime time.Time, compareStartTime, c
 func GetReports(db *dbstore.DB) ([]Report, error) {
 	var reports []Report
 	err := db.
-		Select("id, created_at, progress, start_time, end_time, compare_start_time, compare_end_time").
+		Select("id, created_at, progress, start_time, end_time, compare_start_time, compare_end_time, schedule_id, has_findings").
 		Order("created_at desc").
 		Find(&reports).Error
 	return reports, err
@@ -71,3 +79,9 @@ func SaveReportContent(db *dbstore.DB, reportID string, content string) error {
 	report.ID = reportID
 	return db.Model(&report).Update("content", content).Error
 }
+
+func UpdateReportHasFindings(db *dbstore.DB, reportID string, hasFindings bool) error {
+	var report Report
+	report.ID = reportID
+	return db.Model(&report).Update("has_findings", hasFindings).Error
+}
@@ -0,0 +1,178 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package diagnose
+
+import (
+	"context"
+	"time"
+
+	"github.com/pingcap/log"
+	"go.uber.org/zap"
+
+	"github.com/pingcap/tidb-dashboard/pkg/apiserver/utils"
+	"github.com/pingcap/tidb-dashboard/pkg/dbstore"
+)
+
+const (
+	scheduleCheckInterval = time.Minute
+	defaultKeepLast       = 7
+	maxKeepLast           = 100
+)
+
+// ReportSchedule describes a recurring report. A report is generated for the time window
+// [period start + WindowOffsetSecs, period start + WindowOffsetSecs + WindowDurationSecs) once the window is
+// over, where periods are aligned to multiples of PeriodSecs in the time zone of TimezoneOffsetSecs.
+// For example, PeriodSecs=86400, WindowOffsetSecs=0, WindowDurationSecs=21600 means daily 00:00~06:00.
+type ReportSchedule struct {
+	ID                 uint      `gorm:"primary_key" json:"id"`
+	CreatedAt          time.Time `json:"created_at"`
+	Name               string    `gorm:"size:128" json:"name"`
+	Enabled            bool      `json:"enabled"`
+	PeriodSecs         int64     `json:"period_secs"`
+	WindowOffsetSecs   int64     `json:"window_offset_secs"`
+	WindowDurationSecs int64     `json:"window_duration_secs"`
+	TimezoneOffsetSecs int64     `json:"timezone_offset_secs"`
+	// When enabled, the report compares the window with the same window in the previous period.
+	CompareWithPreviousPeriod bool `json:"compare_with_previous_period"`
+	// Only the latest N reports generated by this schedule are kept.
+	KeepLast int `json:"keep_last"`
+	// Reports are generated using the SQL credential of the user who created or last updated the schedule, so
+	// that reports never contain data the user is not privileged to read. The password is encrypted by the master
+	// key of the local store (see `dbstore.DB.EncryptSecret`), and is removed together with the schedule.
+	// Use a SQL user with only the privileges required by diagnosis to limit the exposure.
+	SQLUser       string `gorm:"size:128" json:"sql_user"`
+	EncryptedPass string `gorm:"type:text" json:"-"`
+	// Unix seconds. Windows ending no later than this are already generated.
+	LastWindowEnd int64 `json:"last_window_end"`
+}
+
+func (ReportSchedule) TableName() string {
+	return "diagnose_report_schedules"
+}
+
+func (sch *ReportSchedule) isValid() bool {
+	return sch.PeriodSecs >= 60 &&
+		sch.WindowDurationSecs > 0 &&
+		sch.WindowOffsetSecs >= 0 &&
+		sch.WindowOffsetSecs+sch.WindowDurationSecs <= sch.PeriodSecs &&
+		sch.KeepLast >= 0 && sch.KeepLast <= maxKeepLast
+}
+
+// latestWindow returns the latest window that is completely before `now`.
+func (sch *ReportSchedule) latestWindow(now time.Time) (time.Time, time.Time) {
+	local := now.Unix() + sch.TimezoneOffsetSecs
+	periodStart := local - mod(local, sch.PeriodSecs) - sch.TimezoneOffsetSecs
+	start := periodStart + sch.WindowOffsetSecs
+	if start+sch.WindowDurationSecs > now.Unix() {
+		start -= sch.PeriodSecs
+	}
+	return time.Unix(start, 0), time.Unix(start+sch.WindowDurationSecs, 0)
+}
+
+func mod(a, b int64) int64 {
+	r := a % b
+	if r < 0 {
+		r += b
+	}
+	return r
+}
+
+func GetReportSchedules(db *dbstore.DB) ([]ReportSchedule, error) {
+	schedules := make([]ReportSchedule, 0)
+	err := db.Order("id").Find(&schedules).Error
+	return schedules, err
+}
+
+// pruneScheduledReports removes reports generated by the schedule except for the latest `keepLast` ones.
+func pruneScheduledReports(db *dbstore.DB, scheduleID uint, keepLast int) error {
+	var ids []string
+	err := db.Model(&Report{}).
+		Where("schedule_id = ?", scheduleID).
+		Order("created_at desc").
+		Offset(keepLast).
+		Pluck("id", &ids).Error
+	if err != nil || len(ids) == 0 {
+		return err
+	}
+	return db.Where("id IN ?", ids).Delete(&Report{}).Error
+}
+
+func (s *Service) scheduleLoop(ctx context.Context) {
+	ticker := time.NewTicker(scheduleCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.runDueSchedules(ctx)
+		}
+	}
+}
+
+func (s *Service) runDueSchedules(ctx context.Context) {
+	var schedules []ReportSchedule
+	if err := s.db.Where("enabled = ?", true).Find(&schedules).Error; err != nil {
+		log.Warn("Failed to load diagnose report schedules", zap.Error(err))
+		return
+	}
+	now := time.Now()
+	for i := range schedules {
+		if ctx.Err() != nil {
+			return
+		}
+		sch := &schedules[i]
+		if !sch.isValid() {
+			continue
+		}
+		startTime, endTime := sch.latestWindow(now)
+		if endTime.Unix() <= sch.LastWindowEnd {
+			continue
+		}
+		// Mark the window as handled first, so that a failing schedule is not retried every minute.
+		if err := s.db.Model(sch).Update("last_window_end", endTime.Unix()).Error; err != nil {
+			log.Warn("Failed to update diagnose report schedule", zap.Uint("schedule", sch.ID), zap.Error(err))
+			continue
+		}
+		if err := s.runSchedule(ctx, sch, startTime, endTime); err != nil {
+			log.Warn("Failed to generate scheduled diagnose report", zap.Uint("schedule", sch.ID), zap.Error(err))
+		}
+	}
+}
+
+func (s *Service) runSchedule(ctx context.Context, sch *ReportSchedule, startTime, endTime time.Time) error {
+	pass, err := s.db.DecryptSecret(sch.EncryptedPass)
+	if err != nil {
+		return err
+	}
+	db, err := s.tidbClient.OpenSQLConn(sch.SQLUser, pass)
+	if err != nil {
+		return err
+	}
+	defer utils.CloseTiDBConnection(db) //nolint:errcheck
+
+	var compareStartTime, compareEndTime *time.Time
+	if sch.CompareWithPreviousPeriod {
+		period := time.Duration(sch.PeriodSecs) * time.Second
+		compareStartTime = new(time.Time)
+		compareEndTime = new(time.Time)
+		*compareStartTime = startTime.Add(-period)
+		*compareEndTime = endTime.Add(-period)
+	}
+
+	scheduleID := sch.ID
+	reportID, err := newReport(s.db, startTime, endTime, compareStartTime, compareEndTime, &scheduleID)
+	if err != nil {
+		return err
+	}
+	s.generateReport(ctx, db, reportID, startTime, endTime, compareStartTime, compareEndTime)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	keepLast := sch.KeepLast
+	if keepLast == 0 {
+		keepLast = defaultKeepLast
+	}
+	return pruneScheduledReports(s.db, sch.ID, keepLast)
+}
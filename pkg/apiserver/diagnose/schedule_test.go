@@ -0,0 +1,46 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package diagnose
+
+import (
+	"time"
+
+	. "github.com/pingcap/check"
+)
+
+var _ = Suite(&testScheduleSuite{})
+
+type testScheduleSuite struct{}
+
+func (t *testScheduleSuite) TestLatestWindow(c *C) {
+	tz := time.FixedZone("UTC+8", 8*3600)
+	// Daily 00:00~06:00 in UTC+8
+	sch := ReportSchedule{
+		PeriodSecs:         86400,
+		WindowOffsetSecs:   0,
+		WindowDurationSecs: 6 * 3600,
+		TimezoneOffsetSecs: 8 * 3600,
+	}
+	c.Assert(sch.isValid(), IsTrue)
+
+	start, end := sch.latestWindow(time.Date(2021, 3, 10, 7, 0, 0, 0, tz))
+	c.Assert(start.Equal(time.Date(2021, 3, 10, 0, 0, 0, 0, tz)), IsTrue)
+	c.Assert(end.Equal(time.Date(2021, 3, 10, 6, 0, 0, 0, tz)), IsTrue)
+
+	start, end = sch.latestWindow(time.Date(2021, 3, 10, 5, 59, 0, 0, tz))
+	c.Assert(start.Equal(time.Date(2021, 3, 9, 0, 0, 0, 0, tz)), IsTrue)
+	c.Assert(end.Equal(time.Date(2021, 3, 9, 6, 0, 0, 0, tz)), IsTrue)
+
+	sch.WindowOffsetSecs = 20 * 3600
+	c.Assert(sch.isValid(), IsFalse)
+}
+
+func (t *testScheduleSuite) TestHasCompareFindings(c *C) {
+	tables := []*TableDef{
+		{Title: "other", Rows: []TableRowDef{{}}},
+		{Title: compareDiagnoseTitle},
+	}
+	c.Assert(hasCompareFindings(tables), IsFalse)
+	tables[1].Rows = []TableRowDef{{Values: []string{"big-query", ""}}}
+	c.Assert(hasCompareFindings(tables), IsTrue)
+}
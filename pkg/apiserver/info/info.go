@@ -26,6 +26,7 @@ type ServiceParams struct {
 	LocalStore   *dbstore.DB
 	TiDBClient   *tidb.Client
 	FeatureFlags *featureflag.Registry
+	AuthService  *user.AuthService
 }
 
 type Service struct {
@@ -71,9 +72,11 @@ func (s *Service) infoHandler(c *gin.Context) {
 }
 
 type WhoAmIResponse struct {
-	DisplayName string `json:"display_name"`
-	IsShareable bool   `json:"is_shareable"`
-	IsWriteable bool   `json:"is_writeable"`
+	DisplayName string            `json:"display_name"`
+	IsShareable bool              `json:"is_shareable"`
+	IsWriteable bool              `json:"is_writeable"`
+	Roles       []string          `json:"roles"`
+	Permissions []user.Permission `json:"permissions"`
 }
 
 // @ID infoWhoami
@@ -84,10 +87,17 @@ type WhoAmIResponse struct {
 // @Failure 401 {object} rest.ErrorResponse
 func (s *Service) whoamiHandler(c *gin.Context) {
 	sessionUser := utils.GetSession(c)
+	perms, err := s.params.AuthService.GetPermissions(sessionUser)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
 	resp := WhoAmIResponse{
 		DisplayName: sessionUser.DisplayName,
 		IsShareable: sessionUser.IsShareable,
 		IsWriteable: sessionUser.IsWriteable,
+		Roles:       sessionUser.Roles,
+		Permissions: perms,
 	}
 	c.JSON(http.StatusOK, resp)
 }
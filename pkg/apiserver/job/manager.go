@@ -0,0 +1,176 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+// Package job records background jobs like log searching and profiling task groups in the local store, so that
+// jobs interrupted by a restart of the dashboard, e.g. caused by a PD leader change, are resumed, or marked as
+// interrupted when they cannot be resumed.
+package job
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pingcap/log"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+
+	"github.com/pingcap/tidb-dashboard/pkg/dbstore"
+)
+
+type State int
+
+const (
+	StateRunning     State = 1
+	StateFinished    State = 2
+	StateInterrupted State = 3
+)
+
+// InterruptedError is the error message of jobs, and tasks of the owner module, interrupted by a restart.
+const InterruptedError = "interrupted by a restart of TiDB Dashboard"
+
+// Model is a background job, which refers to a task group of the owner module by RefID.
+type Model struct {
+	ID    uint   `json:"id" gorm:"primary_key"`
+	Kind  string `json:"kind" gorm:"size:32;uniqueIndex:idx_kind_ref"`
+	RefID uint   `json:"ref_id" gorm:"uniqueIndex:idx_kind_ref"`
+	State State  `json:"state" gorm:"index"`
+	// Number of runs, including resumed runs.
+	Attempts  int    `json:"attempts"`
+	Error     string `json:"error" gorm:"type:text"`
+	StartedAt int64  `json:"started_at"` // Unix seconds
+	UpdatedAt int64  `json:"updated_at"` // Unix seconds
+}
+
+func (Model) TableName() string {
+	return "background_jobs"
+}
+
+func autoMigrate(db *dbstore.DB) error {
+	return db.AutoMigrate(&Model{})
+}
+
+// Kind defines how interrupted jobs of a kind are recovered.
+type Kind struct {
+	// MaxAttempts is the max number of runs of a job, including the first run.
+	MaxAttempts int
+	// Resume runs an interrupted job again. Interrupted jobs are never resumed if it is nil.
+	Resume func(refID uint) error
+	// Interrupt is called when an interrupted job is not going to be resumed. The owner should mark the task group
+	// as interrupted and keep partial results.
+	Interrupt func(refID uint) error
+}
+
+type Manager struct {
+	db    *dbstore.DB
+	mu    sync.Mutex
+	kinds map[string]Kind
+}
+
+func NewManager(db *dbstore.DB) (*Manager, error) {
+	if err := autoMigrate(db); err != nil {
+		return nil, err
+	}
+	return &Manager{db: db, kinds: map[string]Kind{}}, nil
+}
+
+// RegisterRecovery recovers jobs interrupted in the last run when the application is started. It must be invoked
+// after all modules owning jobs, so that their own start hooks are executed before recovering.
+func RegisterRecovery(lc fx.Lifecycle, m *Manager) {
+	lc.Append(fx.Hook{
+		OnStart: func(context.Context) error {
+			m.Recover()
+			return nil
+		},
+	})
+}
+
+func (m *Manager) RegisterKind(name string, kind Kind) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.kinds[name] = kind
+}
+
+func (m *Manager) getKind(name string) (Kind, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	k, ok := m.kinds[name]
+	return k, ok
+}
+
+// Start records that a job is started or restarted by the user.
+func (m *Manager) Start(kind string, refID uint) {
+	now := time.Now().Unix()
+	var rec Model
+	err := m.db.Where(Model{Kind: kind, RefID: refID}).
+		Assign(map[string]interface{}{
+			"state":      StateRunning,
+			"attempts":   1,
+			"error":      "",
+			"started_at": now,
+			"updated_at": now,
+		}).
+		FirstOrCreate(&rec).Error
+	if err != nil {
+		log.Warn("Failed to record job", zap.String("kind", kind), zap.Uint("ref_id", refID), zap.Error(err))
+	}
+}
+
+func (m *Manager) update(kind string, refID uint, values map[string]interface{}) {
+	values["updated_at"] = time.Now().Unix()
+	err := m.db.Model(&Model{}).Where("kind = ? AND ref_id = ?", kind, refID).Updates(values).Error
+	if err != nil {
+		log.Warn("Failed to update job", zap.String("kind", kind), zap.Uint("ref_id", refID), zap.Error(err))
+	}
+}
+
+// Finish records that a job is finished, no matter whether it succeeds or not.
+func (m *Manager) Finish(kind string, refID uint) {
+	m.update(kind, refID, map[string]interface{}{"state": StateFinished})
+}
+
+// ListRefIDs returns referred IDs of all recorded jobs of the kind.
+func (m *Manager) ListRefIDs(kind string) ([]uint, error) {
+	var ids []uint
+	err := m.db.Model(&Model{}).Where("kind = ?", kind).Pluck("ref_id", &ids).Error
+	return ids, err
+}
+
+// Forget removes the job, usually when the task group is deleted.
+func (m *Manager) Forget(kind string, refID uint) {
+	m.db.Where("kind = ? AND ref_id = ?", kind, refID).Delete(&Model{})
+}
+
+// Recover resumes or interrupts jobs left running by the last run.
+func (m *Manager) Recover() {
+	var jobs []Model
+	if err := m.db.Where("state = ?", StateRunning).Find(&jobs).Error; err != nil {
+		log.Warn("Failed to load interrupted jobs", zap.Error(err))
+		return
+	}
+	for _, j := range jobs {
+		kind, ok := m.getKind(j.Kind)
+		if ok && kind.Resume != nil && j.Attempts < kind.MaxAttempts {
+			m.update(j.Kind, j.RefID, map[string]interface{}{"attempts": j.Attempts + 1})
+			err := kind.Resume(j.RefID)
+			if err == nil {
+				log.Info("Interrupted job resumed",
+					zap.String("kind", j.Kind),
+					zap.Uint("ref_id", j.RefID),
+					zap.Int("attempt", j.Attempts+1))
+				continue
+			}
+			log.Warn("Failed to resume interrupted job", zap.String("kind", j.Kind), zap.Uint("ref_id", j.RefID), zap.Error(err))
+		}
+
+		m.update(j.Kind, j.RefID, map[string]interface{}{
+			"state": StateInterrupted,
+			"error": InterruptedError,
+		})
+		if ok && kind.Interrupt != nil {
+			if err := kind.Interrupt(j.RefID); err != nil {
+				log.Warn("Failed to mark job as interrupted", zap.String("kind", j.Kind), zap.Uint("ref_id", j.RefID), zap.Error(err))
+			}
+		}
+		log.Info("Interrupted job is not resumed", zap.String("kind", j.Kind), zap.Uint("ref_id", j.RefID))
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package job
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/pingcap/tidb-dashboard/pkg/dbstore"
+	"github.com/pingcap/tidb-dashboard/util/testutil"
+)
+
+func newTestManager(t *testing.T) *Manager {
+	m, err := NewManager(&dbstore.DB{DB: testutil.OpenTestSQLiteDB(t)})
+	require.Nil(t, err)
+	return m
+}
+
+func getJob(t *testing.T, m *Manager, kind string, refID uint) Model {
+	var j Model
+	require.Nil(t, m.db.Where("kind = ? AND ref_id = ?", kind, refID).First(&j).Error)
+	return j
+}
+
+func TestRecover(t *testing.T) {
+	m := newTestManager(t)
+	resumed := make([]uint, 0)
+	interrupted := make([]uint, 0)
+	m.RegisterKind("resumable", Kind{
+		MaxAttempts: 2,
+		Resume: func(refID uint) error {
+			resumed = append(resumed, refID)
+			return nil
+		},
+		Interrupt: func(refID uint) error {
+			interrupted = append(interrupted, refID)
+			return nil
+		},
+	})
+	m.RegisterKind("oneshot", Kind{
+		Interrupt: func(refID uint) error {
+			interrupted = append(interrupted, refID)
+			return nil
+		},
+	})
+
+	m.Start("resumable", 1)
+	m.Start("resumable", 2)
+	m.Finish("resumable", 2)
+	m.Start("oneshot", 3)
+
+	m.Recover()
+	require.Equal(t, []uint{1}, resumed)
+	require.Equal(t, []uint{3}, interrupted)
+	require.Equal(t, StateRunning, getJob(t, m, "resumable", 1).State)
+	require.Equal(t, 2, getJob(t, m, "resumable", 1).Attempts)
+	require.Equal(t, StateFinished, getJob(t, m, "resumable", 2).State)
+	require.Equal(t, StateInterrupted, getJob(t, m, "oneshot", 3).State)
+
+	// The max number of attempts is reached
+	m.Recover()
+	require.Equal(t, []uint{1}, resumed)
+	require.Equal(t, []uint{3, 1}, interrupted)
+	require.Equal(t, StateInterrupted, getJob(t, m, "resumable", 1).State)
+
+	// Restarted by the user
+	m.Start("resumable", 1)
+	require.Equal(t, StateRunning, getJob(t, m, "resumable", 1).State)
+	require.Equal(t, 1, getJob(t, m, "resumable", 1).Attempts)
+
+	m.Forget("resumable", 1)
+	m.Recover()
+	require.Equal(t, []uint{1}, resumed)
+
+	ids, err := m.ListRefIDs("resumable")
+	require.Nil(t, err)
+	require.Equal(t, []uint{2}, ids)
+	require.Equal(t, InterruptedError, getJob(t, m, "oneshot", 3).Error)
+}
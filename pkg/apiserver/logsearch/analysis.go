@@ -0,0 +1,228 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package logsearch
+
+import (
+	"fmt"
+	"sort"
+)
+
+const (
+	defaultHistogramBuckets = 60
+	maxHistogramBuckets     = 1000
+	defaultMaxLogTemplates  = 50
+	maxLogTemplates         = 1000
+)
+
+type GetTaskGroupAnalysisRequest struct {
+	Filter string `json:"filter" form:"filter"`
+	// Calculated from the time range of the search when not specified.
+	BucketSeconds int64 `json:"bucket_seconds" form:"bucket_seconds"`
+	MaxTemplates  int   `json:"max_templates" form:"max_templates"` // default: 50
+}
+
+// LogHistogramSeries is the number of lines of an instance in a level in each bucket.
+type LogHistogramSeries struct {
+	Instance string   `json:"instance"`
+	Level    LogLevel `json:"level"`
+	Counts   []int    `json:"counts"`
+}
+
+type LogHistogram struct {
+	BucketSeconds int64 `json:"bucket_seconds"`
+	// The begin time of each bucket in milliseconds.
+	Buckets []int64              `json:"buckets"`
+	Series  []LogHistogramSeries `json:"series"`
+}
+
+type LogTemplateInstance struct {
+	Instance string `json:"instance"`
+	Count    int    `json:"count"`
+}
+
+// LogTemplate is a cluster of similar messages, in which variable tokens are replaced by `<*>`.
+type LogTemplate struct {
+	Template  string                `json:"template"`
+	Level     LogLevel              `json:"level"`
+	Count     int                   `json:"count"`
+	FirstSeen int64                 `json:"first_seen"`
+	LastSeen  int64                 `json:"last_seen"`
+	Sample    string                `json:"sample"`
+	Instances []LogTemplateInstance `json:"instances"`
+}
+
+type LogAnalysis struct {
+	TotalLines int           `json:"total_lines"`
+	Histogram  LogHistogram  `json:"histogram"`
+	Templates  []LogTemplate `json:"templates"`
+}
+
+type histogramSeriesKey struct {
+	instance string
+	level    LogLevel
+}
+
+type logTemplateStats struct {
+	level     LogLevel
+	firstSeen int64
+	lastSeen  int64
+	sample    string
+	instances map[string]int
+}
+
+type logAnalyzer struct {
+	bucketMillis int64
+	totalLines   int
+	series       map[histogramSeriesKey]map[int64]int // bucket index -> count
+	minBucket    int64
+	maxBucket    int64
+	drains       map[LogLevel]*drain
+	templates    map[*drainCluster]*logTemplateStats
+}
+
+func newLogAnalyzer(bucketSeconds int64) *logAnalyzer {
+	return &logAnalyzer{
+		bucketMillis: bucketSeconds * 1000,
+		series:       map[histogramSeriesKey]map[int64]int{},
+		drains:       map[LogLevel]*drain{},
+		templates:    map[*drainCluster]*logTemplateStats{},
+	}
+}
+
+func (a *logAnalyzer) add(instance string, row *LogRow) {
+	bucket := row.Time / a.bucketMillis
+	if a.totalLines == 0 || bucket < a.minBucket {
+		a.minBucket = bucket
+	}
+	if a.totalLines == 0 || bucket > a.maxBucket {
+		a.maxBucket = bucket
+	}
+	a.totalLines++
+	key := histogramSeriesKey{instance: instance, level: row.Level}
+	counts, ok := a.series[key]
+	if !ok {
+		counts = map[int64]int{}
+		a.series[key] = counts
+	}
+	counts[bucket]++
+
+	d, ok := a.drains[row.Level]
+	if !ok {
+		d = newDrain()
+		a.drains[row.Level] = d
+	}
+	cluster := d.add(row.Message)
+	stats, ok := a.templates[cluster]
+	if !ok {
+		stats = &logTemplateStats{
+			level:     row.Level,
+			firstSeen: row.Time,
+			lastSeen:  row.Time,
+			sample:    row.Message,
+			instances: map[string]int{},
+		}
+		a.templates[cluster] = stats
+	}
+	if row.Time < stats.firstSeen {
+		stats.firstSeen = row.Time
+	}
+	if row.Time > stats.lastSeen {
+		stats.lastSeen = row.Time
+	}
+	stats.instances[instance]++
+}
+
+func (a *logAnalyzer) result(maxTemplates int) (*LogAnalysis, error) {
+	result := &LogAnalysis{
+		TotalLines: a.totalLines,
+		Histogram: LogHistogram{
+			BucketSeconds: a.bucketMillis / 1000,
+			Buckets:       []int64{},
+			Series:        []LogHistogramSeries{},
+		},
+		Templates: []LogTemplate{},
+	}
+	if a.totalLines == 0 {
+		return result, nil
+	}
+
+	n := a.maxBucket - a.minBucket + 1
+	if n > maxHistogramBuckets {
+		return nil, fmt.Errorf("too many buckets, expect at most %d buckets", maxHistogramBuckets)
+	}
+	for i := int64(0); i < n; i++ {
+		result.Histogram.Buckets = append(result.Histogram.Buckets, (a.minBucket+i)*a.bucketMillis)
+	}
+	for key, counts := range a.series {
+		s := LogHistogramSeries{Instance: key.instance, Level: key.level, Counts: make([]int, n)}
+		for bucket, count := range counts {
+			s.Counts[bucket-a.minBucket] = count
+		}
+		result.Histogram.Series = append(result.Histogram.Series, s)
+	}
+	sort.Slice(result.Histogram.Series, func(i, j int) bool {
+		si, sj := result.Histogram.Series[i], result.Histogram.Series[j]
+		if si.Instance != sj.Instance {
+			return si.Instance < sj.Instance
+		}
+		return si.Level < sj.Level
+	})
+
+	for cluster, stats := range a.templates {
+		t := LogTemplate{
+			Template:  cluster.template(),
+			Level:     stats.level,
+			Count:     cluster.count,
+			FirstSeen: stats.firstSeen,
+			LastSeen:  stats.lastSeen,
+			Sample:    stats.sample,
+			Instances: make([]LogTemplateInstance, 0, len(stats.instances)),
+		}
+		for instance, count := range stats.instances {
+			t.Instances = append(t.Instances, LogTemplateInstance{Instance: instance, Count: count})
+		}
+		sort.Slice(t.Instances, func(i, j int) bool {
+			if t.Instances[i].Count != t.Instances[j].Count {
+				return t.Instances[i].Count > t.Instances[j].Count
+			}
+			return t.Instances[i].Instance < t.Instances[j].Instance
+		})
+		result.Templates = append(result.Templates, t)
+	}
+	sort.Slice(result.Templates, func(i, j int) bool {
+		ti, tj := result.Templates[i], result.Templates[j]
+		if ti.Count != tj.Count {
+			return ti.Count > tj.Count
+		}
+		return ti.FirstSeen < tj.FirstSeen
+	})
+	if len(result.Templates) > maxTemplates {
+		result.Templates = result.Templates[:maxTemplates]
+	}
+	return result, nil
+}
+
+// checkHistogramBuckets checks the number of buckets covering the time range of the search, so that a request with
+// a small bucket size is rejected before reading any logs.
+func checkHistogramBuckets(req *SearchLogRequest, bucketSeconds int64) error {
+	if req == nil || req.EndTime <= req.StartTime {
+		return nil
+	}
+	if (req.EndTime-req.StartTime)/1000/bucketSeconds > maxHistogramBuckets {
+		return fmt.Errorf("too many buckets, expect at most %d buckets", maxHistogramBuckets)
+	}
+	return nil
+}
+
+// histogramBucketSeconds chooses the bucket size so that the time range of the search is divided into about
+// `defaultHistogramBuckets` buckets.
+func histogramBucketSeconds(req *SearchLogRequest) int64 {
+	if req == nil || req.EndTime <= req.StartTime {
+		return 60
+	}
+	seconds := (req.EndTime - req.StartTime) / 1000 / defaultHistogramBuckets
+	if seconds < 1 {
+		seconds = 1
+	}
+	return seconds
+}
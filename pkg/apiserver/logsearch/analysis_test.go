@@ -0,0 +1,71 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package logsearch
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDrain(t *testing.T) {
+	d := newDrain()
+	c1 := d.add("connection 12 closed by peer 10.0.1.2")
+	c2 := d.add("connection 34 closed by peer 10.0.1.3")
+	c3 := d.add("region 5 is not leader")
+	c4 := d.add("connection 56 closed by peer 10.0.1.3")
+	require.True(t, c1 == c2 && c2 == c4)
+	require.False(t, c1 == c3)
+	require.Equal(t, "connection <*> closed by peer <*>", c1.template())
+	require.Equal(t, 3, c1.count)
+	require.Equal(t, "region 5 is not leader", c3.template())
+	require.Len(t, d.clusters, 2)
+
+	// Messages with different number of tokens are never in the same cluster
+	c5 := d.add("connection 78 closed")
+	require.False(t, c5 == c1)
+}
+
+func TestLogAnalyzer(t *testing.T) {
+	a := newLogAnalyzer(10)
+	a.add("tikv-1", &LogRow{Time: 1000, Level: LogLevelWarn, ParsedLogMessage: ParsedLogMessage{Message: "slow store 1"}})
+	a.add("tikv-1", &LogRow{Time: 25000, Level: LogLevelWarn, ParsedLogMessage: ParsedLogMessage{Message: "slow store 2"}})
+	a.add("tikv-2", &LogRow{Time: 5000, Level: LogLevelWarn, ParsedLogMessage: ParsedLogMessage{Message: "slow store 3"}})
+	a.add("tikv-2", &LogRow{Time: 9000, Level: LogLevelError, ParsedLogMessage: ParsedLogMessage{Message: "disk full"}})
+
+	r, err := a.result(1)
+	require.Nil(t, err)
+	require.Equal(t, 4, r.TotalLines)
+	require.Equal(t, []int64{0, 10000, 20000}, r.Histogram.Buckets)
+	require.Equal(t, []LogHistogramSeries{
+		{Instance: "tikv-1", Level: LogLevelWarn, Counts: []int{1, 0, 1}},
+		{Instance: "tikv-2", Level: LogLevelWarn, Counts: []int{1, 0, 0}},
+		{Instance: "tikv-2", Level: LogLevelError, Counts: []int{1, 0, 0}},
+	}, r.Histogram.Series)
+	require.Equal(t, []LogTemplate{{
+		Template:  "slow store <*>",
+		Level:     LogLevelWarn,
+		Count:     3,
+		FirstSeen: 1000,
+		LastSeen:  25000,
+		Sample:    "slow store 1",
+		Instances: []LogTemplateInstance{{Instance: "tikv-1", Count: 2}, {Instance: "tikv-2", Count: 1}},
+	}}, r.Templates)
+
+	a = newLogAnalyzer(1)
+	a.add("tikv-1", &LogRow{Time: 0})
+	a.add("tikv-1", &LogRow{Time: 2000000})
+	_, err = a.result(1)
+	require.NotNil(t, err)
+}
+
+func TestCheckHistogramBuckets(t *testing.T) {
+	req := &SearchLogRequest{StartTime: 0, EndTime: 3600 * 1000}
+	require.Equal(t, int64(60), histogramBucketSeconds(req))
+	require.Nil(t, checkHistogramBuckets(req, 60))
+	require.Nil(t, checkHistogramBuckets(req, 4))
+	require.NotNil(t, checkHistogramBuckets(req, 3))
+	// The time range is unknown
+	require.Nil(t, checkHistogramBuckets(&SearchLogRequest{}, 1))
+	require.Nil(t, checkHistogramBuckets(nil, 1))
+}
@@ -0,0 +1,126 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package logsearch
+
+import (
+	"strings"
+	"unicode"
+)
+
+const (
+	drainWildcard = "<*>"
+	// Depth of the parse tree, including the root layer and the leaf layer.
+	drainDepth = 4
+	// Messages are in the same cluster only when at least this fraction of tokens are the same.
+	drainSimThreshold = 0.4
+	drainMaxChildren  = 100
+)
+
+type drainCluster struct {
+	tokens []string
+	count  int
+}
+
+func (c *drainCluster) template() string {
+	return strings.Join(c.tokens, " ")
+}
+
+type drainNode struct {
+	children map[string]*drainNode
+	clusters []*drainCluster
+}
+
+func newDrainNode() *drainNode {
+	return &drainNode{children: map[string]*drainNode{}}
+}
+
+// drain clusters log messages into templates using the Drain algorithm described in "Drain: An Online Log
+// Parsing Approach with Fixed Depth Tree". Messages are first grouped by the number of tokens, then by the
+// first few tokens, and finally matched with clusters in the leaf by the similarity of tokens. Tokens that are
+// different among messages of a cluster are replaced by `<*>` in the template.
+type drain struct {
+	root     map[int]*drainNode
+	clusters []*drainCluster
+}
+
+func newDrain() *drain {
+	return &drain{root: map[int]*drainNode{}}
+}
+
+func hasDigit(s string) bool {
+	for _, c := range s {
+		if unicode.IsDigit(c) {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *drain) searchLeaf(tokens []string) *drainNode {
+	node, ok := d.root[len(tokens)]
+	if !ok {
+		node = newDrainNode()
+		d.root[len(tokens)] = node
+	}
+	for i := 0; i < drainDepth-2 && i < len(tokens); i++ {
+		// Tokens with digits are likely to be variables
+		token := tokens[i]
+		if hasDigit(token) {
+			token = drainWildcard
+		}
+		child, ok := node.children[token]
+		if !ok {
+			if len(node.children) >= drainMaxChildren {
+				token = drainWildcard
+			}
+			child, ok = node.children[token]
+			if !ok {
+				child = newDrainNode()
+				node.children[token] = child
+			}
+		}
+		node = child
+	}
+	return node
+}
+
+// similarity returns the fraction of tokens equal to the template, where wildcards are not counted.
+func (c *drainCluster) similarity(tokens []string) float64 {
+	if len(tokens) == 0 {
+		return 1
+	}
+	same := 0
+	for i, t := range c.tokens {
+		if t != drainWildcard && t == tokens[i] {
+			same++
+		}
+	}
+	return float64(same) / float64(len(tokens))
+}
+
+// add adds the message into a cluster and returns the cluster.
+func (d *drain) add(message string) *drainCluster {
+	tokens := strings.Fields(message)
+	leaf := d.searchLeaf(tokens)
+
+	var best *drainCluster
+	bestSim := -1.0
+	for _, c := range leaf.clusters {
+		if sim := c.similarity(tokens); sim > bestSim {
+			best, bestSim = c, sim
+		}
+	}
+	if best == nil || bestSim < drainSimThreshold {
+		best = &drainCluster{tokens: tokens}
+		leaf.clusters = append(leaf.clusters, best)
+		d.clusters = append(d.clusters, best)
+	} else {
+		for i, t := range best.tokens {
+			if t != tokens[i] {
+				best.tokens[i] = drainWildcard
+			}
+		}
+	}
+	best.count++
+	return best
+}
@@ -0,0 +1,82 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package logsearch
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/antonmedv/expr"
+	"github.com/antonmedv/expr/vm"
+	"github.com/pingcap/kvproto/pkg/diagnosticspb"
+)
+
+// A log filter is an expr (https://github.com/antonmedv/expr) expression over parsed log messages, for example:
+//
+// level == "error" and (fields.conn == "5" or int(fields.txn_start_ts) >= 422847525383421953) and not (message matches "^slow")
+//
+// `message`, `source` and `level` are the message, the source file and the lower case level of the log. `fields`
+// is a map of fields in the message, in which fields can be accessed by `fields["Release Version"]` if they contain
+// spaces, or tested by `"conn" in fields`. Values of fields are strings, which are empty if the field does not
+// exist, and can be converted to numbers by `int()` and `float()`. A log does not match if the evaluation fails.
+
+func parseFilterInt(s string) (int64, error) {
+	return strconv.ParseInt(s, 10, 64)
+}
+
+func parseFilterFloat(s string) (float64, error) {
+	return strconv.ParseFloat(s, 64)
+}
+
+func buildFilterEnv(level LogLevel, msg *ParsedLogMessage) map[string]interface{} {
+	fields := msg.Fields
+	if fields == nil {
+		fields = map[string]string{}
+	}
+	return map[string]interface{}{
+		"message": msg.Message,
+		"source":  msg.Source,
+		"level":   strings.ToLower(diagnosticspb.LogLevel(level).String()),
+		"fields":  fields,
+		"int":     parseFilterInt,
+		"float":   parseFilterFloat,
+	}
+}
+
+type logFilter struct {
+	program *vm.Program
+}
+
+// compileLogFilter compiles the filter expression. A nil filter, which matches everything, is returned when the
+// expression is empty.
+func compileLogFilter(input string) (*logFilter, error) {
+	if strings.TrimSpace(input) == "" {
+		return nil, nil
+	}
+	program, err := expr.Compile(input, expr.Env(buildFilterEnv(0, &ParsedLogMessage{})), expr.AsBool())
+	if err != nil {
+		return nil, err
+	}
+	return &logFilter{program: program}, nil
+}
+
+func (f *logFilter) match(level LogLevel, msg *ParsedLogMessage) bool {
+	if f == nil {
+		return true
+	}
+	out, err := expr.Run(f.program, buildFilterEnv(level, msg))
+	if err != nil {
+		return false
+	}
+	matched, _ := out.(bool)
+	return matched
+}
+
+// matchLogFilter parses the message only when it is necessary.
+func matchLogFilter(f *logFilter, msg *diagnosticspb.LogMessage) bool {
+	if f == nil {
+		return true
+	}
+	parsed := parseLogMessage(msg.Message)
+	return f.match(LogLevel(msg.Level), &parsed)
+}
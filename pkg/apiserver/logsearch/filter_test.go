@@ -0,0 +1,115 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package logsearch
+
+import (
+	"archive/zip"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/pingcap/kvproto/pkg/diagnosticspb"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLogMessage(t *testing.T) {
+	p := parseLogMessage(`[session.go:1234] ["execute SQL"] [conn=5] [txn_start_ts=422847525383421953] [sql="select \"a]\""] ["Release Version"=v5.0.0]`)
+	require.Equal(t, "session.go:1234", p.Source)
+	require.Equal(t, "execute SQL", p.Message)
+	require.Equal(t, map[string]string{
+		"conn":            "5",
+		"txn_start_ts":    "422847525383421953",
+		"sql":             `select "a]"`,
+		"Release Version": "v5.0.0",
+	}, p.Fields)
+
+	p = parseLogMessage(`[region_id=2] [peer_id=3]`)
+	require.Equal(t, "", p.Source)
+	require.Equal(t, "", p.Message)
+	require.Equal(t, "2", p.Fields["region_id"])
+
+	p = parseLogMessage(`# Time: 2021-01-01T00:00:00 [not unified`)
+	require.Equal(t, `# Time: 2021-01-01T00:00:00 [not unified`, p.Message)
+	require.Empty(t, p.Fields)
+
+	row, ok := parseLogLine(`[2021/04/01 10:20:30.456 +08:00] [Warn] [pd.go:42] [slow] [region_id=7]`)
+	require.True(t, ok)
+	require.Equal(t, int64(1617243630456), row.Time)
+	require.Equal(t, LogLevelWarn, row.Level)
+	require.Equal(t, "slow", row.Message)
+	require.Equal(t, "7", row.Fields["region_id"])
+}
+
+func TestLogFilter(t *testing.T) {
+	msg := parseLogMessage(`[session.go:1] ["execute SQL"] [conn=5] [txn_start_ts=422847525383421953] [cost=1.5] ["Release Version"=v5.0.0]`)
+	cases := []struct {
+		expr  string
+		match bool
+	}{
+		{``, true},
+		{`fields.conn == "5"`, true},
+		{`fields.conn == "6"`, false},
+		{`fields.conn != "6"`, true},
+		{`"region_id" in fields && fields.region_id != "6"`, false},
+		{`level == "warn"`, true},
+		{`level == "info" or message matches "^execute"`, true},
+		{`level == "info" && !(fields.conn == "5")`, false},
+		{`int(fields.txn_start_ts) >= 422847525383421953 and int(fields.txn_start_ts) < 422847525383421954`, true},
+		{`float(fields.cost) > 1.2 and float(fields.cost) <= 1.5`, true},
+		{`float(message) > 1`, false},
+		{`not (message matches 'SQL$')`, false},
+		{`fields["Release Version"] == "v5.0.0" and source == "session.go:1"`, true},
+		{`"conn" in fields and not ("region_id" in fields)`, true},
+	}
+	for _, c := range cases {
+		f, err := compileLogFilter(c.expr)
+		require.Nil(t, err, c.expr)
+		require.Equal(t, c.match, f.match(LogLevelWarn, &msg), c.expr)
+	}
+
+	for _, expr := range []string{`fields.conn ==`, `(level == "warn"`, `message`, `message matches "("`, `"abc`, `and`, `foo == 1`} {
+		_, err := compileLogFilter(expr)
+		require.NotNil(t, err, expr)
+	}
+}
+
+func TestReadLogRows(t *testing.T) {
+	p := path.Join(t.TempDir(), "test.zip")
+	f, err := os.Create(p)
+	require.Nil(t, err)
+	zw := zip.NewWriter(f)
+	w, err := zw.Create("test.log")
+	require.Nil(t, err)
+	for _, msg := range []*diagnosticspb.LogMessage{
+		{Time: 1000, Level: diagnosticspb.LogLevel_Info, Message: `[a.go:1] [first] [conn=1]`},
+		{Time: 2000, Level: diagnosticspb.LogLevel_Error, Message: "[a.go:2] [panic] [conn=2]\ngoroutine 1\nmain.main()"},
+		{Time: 3000, Level: diagnosticspb.LogLevel_Info, Message: `[a.go:3] [third] [conn=2]`},
+	} {
+		_, err := w.Write([]byte(logMessageToString(msg)))
+		require.Nil(t, err)
+	}
+	require.Nil(t, zw.Close())
+	require.Nil(t, f.Close())
+
+	rows, err := readLogRows(p, 3, nil, 10)
+	require.Nil(t, err)
+	require.Len(t, rows, 3)
+	require.Equal(t, "[a.go:2] [panic] [conn=2]\ngoroutine 1\nmain.main()", rows[1].Message)
+	require.Equal(t, LogLevelError, rows[1].Level)
+	require.Equal(t, uint(3), rows[2].TaskID)
+
+	filter, err := compileLogFilter(`fields.conn == "2"`)
+	require.Nil(t, err)
+	rows, err = readLogRows(p, 3, filter, 10)
+	require.Nil(t, err)
+	require.Len(t, rows, 1)
+	require.Equal(t, int64(3000), rows[0].Time)
+
+	rows, err = readLogRows(p, 3, nil, 1)
+	require.Nil(t, err)
+	require.Len(t, rows, 1)
+	require.Equal(t, "first", rows[0].Message)
+
+	merged := mergeLogRows([][]LogRow{{{Time: 1}, {Time: 3}}, {{Time: 2}}}, 2)
+	require.Equal(t, []LogRow{{Time: 1}, {Time: 2}}, merged)
+}
@@ -19,6 +19,8 @@ const (
 	TaskStateRunning  TaskState = 1
 	TaskStateFinished TaskState = 2
 	TaskStateError    TaskState = 3
+	// The task is interrupted by a restart and is not resumed. Searched logs before the interruption are kept.
+	TaskStateInterrupted TaskState = 4
 )
 
 type TaskGroupState int
@@ -58,6 +60,8 @@ type SearchLogRequest struct {
 	// SELECT * FROM t WHERE c LIKE '%s%' and c REGEXP '.*a.*' because
 	// Golang and Rust don't support perl-like (?=re1)(?=re2)
 	Patterns []string `json:"patterns"`
+	// Filter on fields of parsed log messages, applied after patterns. See filter.go for the syntax.
+	Filter string `json:"filter"`
 }
 
 func (r *SearchLogRequest) ConvertToPB(target diagnosticspb.SearchLogRequest_Target) *diagnosticspb.SearchLogRequest {
@@ -101,6 +105,10 @@ func (task *TaskModel) RemoveDataAndPreview(db *dbstore.DB) {
 		_ = os.RemoveAll(*task.LogStorePath)
 		task.LogStorePath = nil
 	}
+	if task.SlowLogStorePath != nil {
+		_ = os.RemoveAll(*task.SlowLogStorePath)
+		task.SlowLogStorePath = nil
+	}
 	db.Where("task_id = ?", task.ID).Delete(&PreviewModel{})
 }
 
@@ -110,6 +118,7 @@ type TaskGroupModel struct {
 	State         TaskGroupState                `json:"state" gorm:"index"`
 	TargetStats   model.RequestTargetStatistics `json:"target_stats" gorm:"embedded;embedded_prefix:target_stats_"`
 	LogStoreDir   *string                       `json:"log_store_dir" gorm:"type:text"`
+	Size          int64                         `json:"size"` // Total size of stored logs, updated when finished
 }
 
 func (TaskGroupModel) TableName() string {
@@ -142,10 +151,5 @@ func autoMigrate(db *dbstore.DB) error {
 	return db.AutoMigrate(&TaskModel{}, &TaskGroupModel{}, &PreviewModel{})
 }
 
-func cleanupAllTasks(db *dbstore.DB) {
-	var taskGroups []*TaskGroupModel
-	db.Find(&taskGroups)
-	for _, tg := range taskGroups {
-		tg.Delete(db)
-	}
-}
+// tasksWithResults are states of tasks that may have searched logs.
+var tasksWithResults = []TaskState{TaskStateFinished, TaskStateInterrupted}
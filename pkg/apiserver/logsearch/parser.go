@@ -0,0 +1,154 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package logsearch
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pingcap/kvproto/pkg/diagnosticspb"
+)
+
+const logTimeFormat = "2006/01/02 15:04:05.000 -07:00"
+
+var logSourceRegex = regexp.MustCompile(`^[^\s:]+:\d+$`)
+
+// ParsedLogMessage is a log message in the unified log format used by TiDB, TiKV and PD, which looks like
+// `[session.go:1234] ["execute SQL"] [conn=5] [txn_start_ts=422847525383421953]`, excluding the time and level.
+type ParsedLogMessage struct {
+	Source  string            `json:"source"` // file name and line number, e.g. session.go:1234
+	Message string            `json:"message"`
+	Fields  map[string]string `json:"fields"`
+}
+
+// LogRow is a parsed log line.
+type LogRow struct {
+	TaskID uint     `json:"task_id"`
+	Time   int64    `json:"time"`
+	Level  LogLevel `json:"level"`
+	ParsedLogMessage
+}
+
+// readLogSection reads a `[...]` section at the beginning of `s`. The content of the section is either a quoted
+// string, or an unquoted string or a key value pair separated by `=`, in which the key and the value can be
+// quoted. `ok` is false if `s` does not start with a section.
+func readLogSection(s string) (key string, value string, hasValue bool, rest string, ok bool) {
+	if !strings.HasPrefix(s, "[") {
+		return "", "", false, s, false
+	}
+	s = s[1:]
+	key, s, ok = readLogToken(s, true)
+	if !ok {
+		return "", "", false, s, false
+	}
+	if strings.HasPrefix(s, "=") {
+		hasValue = true
+		value, s, ok = readLogToken(s[1:], false)
+		if !ok {
+			return "", "", false, s, false
+		}
+	}
+	if !strings.HasPrefix(s, "]") {
+		return "", "", false, s, false
+	}
+	return key, value, hasValue, strings.TrimLeft(s[1:], " "), true
+}
+
+// readLogToken reads a quoted or unquoted token. An unquoted key ends before `=` or `]`, and an unquoted value
+// ends before `]`.
+func readLogToken(s string, isKey bool) (token string, rest string, ok bool) {
+	if strings.HasPrefix(s, `"`) {
+		for i := 1; i < len(s); i++ {
+			switch s[i] {
+			case '\\':
+				i++
+			case '"':
+				quoted := s[:i+1]
+				token, err := strconv.Unquote(quoted)
+				if err != nil {
+					// Escapes of Rust are slightly different from Go, keep it as it is.
+					token = quoted[1 : len(quoted)-1]
+				}
+				return token, s[i+1:], true
+			}
+		}
+		return "", s, false
+	}
+	end := strings.IndexByte(s, ']')
+	if isKey {
+		if eq := strings.IndexByte(s, '='); eq >= 0 && (end < 0 || eq < end) {
+			end = eq
+		}
+	}
+	if end < 0 {
+		return "", s, false
+	}
+	return s[:end], s[end:], true
+}
+
+// parseLogMessage parses the message of a log line. Messages not in the unified log format, e.g. slow logs, are
+// kept as it is without any fields.
+func parseLogMessage(msg string) ParsedLogMessage {
+	result := ParsedLogMessage{Fields: map[string]string{}}
+	rest := strings.TrimSpace(msg)
+	hasMessage := false
+	for rest != "" {
+		key, value, hasValue, r, ok := readLogSection(rest)
+		if !ok {
+			break
+		}
+		rest = r
+		switch {
+		case hasValue:
+			result.Fields[key] = value
+		case !hasMessage && result.Source == "" && logSourceRegex.MatchString(key):
+			result.Source = key
+		case !hasMessage:
+			result.Message = key
+			hasMessage = true
+		}
+	}
+	if rest != "" {
+		// Not in the unified log format
+		return ParsedLogMessage{Message: msg, Fields: map[string]string{}}
+	}
+	return result
+}
+
+func parseLogLevel(level string) LogLevel {
+	for name, v := range diagnosticspb.LogLevel_value {
+		if strings.EqualFold(name, level) {
+			return LogLevel(v)
+		}
+	}
+	if strings.EqualFold(level, "WARNING") {
+		return LogLevelWarn
+	}
+	if strings.EqualFold(level, "FATAL") {
+		return LogLevelCritical
+	}
+	return LogLevelUnknown
+}
+
+// parseLogLine parses a line of the stored log, which is written by logMessageToString.
+func parseLogLine(line string) (*LogRow, bool) {
+	timeStr, _, hasValue, rest, ok := readLogSection(line)
+	if !ok || hasValue {
+		return nil, false
+	}
+	t, err := time.Parse(logTimeFormat, timeStr)
+	if err != nil {
+		return nil, false
+	}
+	level, _, hasValue, rest, ok := readLogSection(rest)
+	if !ok || hasValue {
+		return nil, false
+	}
+	return &LogRow{
+		Time:             t.UnixNano() / int64(time.Millisecond),
+		Level:            parseLogLevel(level),
+		ParsedLogMessage: parseLogMessage(rest),
+	}, true
+}
@@ -0,0 +1,123 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package logsearch
+
+import (
+	"archive/zip"
+	"fmt"
+	"os"
+	"path"
+
+	"github.com/pingcap/tidb-dashboard/pkg/apiserver/job"
+)
+
+// isStopping returns whether the service is being stopped, in which case running tasks are cancelled and should
+// be resumed after restart.
+func (s *Service) isStopping() bool {
+	return s.lifecycleCtx != nil && s.lifecycleCtx.Err() != nil
+}
+
+// removeUntrackedTaskGroups removes task groups without job records. They are created by previous versions, which
+// stored logs in temporary directories and removed all task groups at every start, so that they cannot be resumed
+// and their logs may be already removed.
+func (s *Service) removeUntrackedTaskGroups() error {
+	ids, err := s.jobs.ListRefIDs(jobKind)
+	if err != nil {
+		return err
+	}
+	tracked := make(map[uint]struct{}, len(ids))
+	for _, id := range ids {
+		tracked[id] = struct{}{}
+	}
+	var taskGroups []*TaskGroupModel
+	if err := s.db.Find(&taskGroups).Error; err != nil {
+		return err
+	}
+	for _, tg := range taskGroups {
+		if _, ok := tracked[tg.ID]; ok {
+			continue
+		}
+		tg.Delete(s.db)
+		s.artifacts.Forget(artifactKind, tg.ID)
+	}
+	return nil
+}
+
+// resumeTaskGroup searches logs again for tasks interrupted by the last restart.
+func (s *Service) resumeTaskGroup(taskGroupID uint) error {
+	taskGroup := TaskGroupModel{}
+	if err := s.db.Where("id = ?", taskGroupID).First(&taskGroup).Error; err != nil {
+		return err
+	}
+	if taskGroup.State != TaskGroupStateRunning {
+		s.jobs.Finish(jobKind, taskGroupID)
+		return nil
+	}
+
+	var tasks []*TaskModel
+	if err := s.db.Where("task_group_id = ? AND state = ?", taskGroupID, TaskStateRunning).Find(&tasks).Error; err != nil {
+		return err
+	}
+	if len(tasks) == 0 {
+		s.finishTaskGroup(&taskGroup)
+		return nil
+	}
+	for _, task := range tasks {
+		// Partial results are discarded since the search is started over.
+		task.RemoveDataAndPreview(s.db)
+		task.Size = 0
+		task.Error = nil
+		s.db.Save(task)
+	}
+	if !s.scheduler.AsyncStart(&taskGroup, tasks) {
+		return fmt.Errorf("task group %d is already running", taskGroupID)
+	}
+	return nil
+}
+
+// keepPartialLog returns the path of the log written by an interrupted task, if the log file is complete.
+func keepPartialLog(logStoreDir string, fileName string) (*string, int64) {
+	p := path.Join(logStoreDir, fileName+".zip")
+	zr, err := zip.OpenReader(p)
+	if err != nil {
+		// The file does not exist, or is not closed when the process exits
+		_ = os.Remove(p)
+		return nil, 0
+	}
+	_ = zr.Close()
+	stat, err := os.Stat(p)
+	if err != nil {
+		return nil, 0
+	}
+	return &p, stat.Size()
+}
+
+// interruptTaskGroup marks tasks interrupted by the last restart as interrupted, and keeps logs searched before
+// the interruption.
+func (s *Service) interruptTaskGroup(taskGroupID uint) error {
+	taskGroup := TaskGroupModel{}
+	if err := s.db.Where("id = ?", taskGroupID).First(&taskGroup).Error; err != nil {
+		return err
+	}
+	var tasks []*TaskModel
+	if err := s.db.Where("task_group_id = ? AND state = ?", taskGroupID, TaskStateRunning).Find(&tasks).Error; err != nil {
+		return err
+	}
+	errStr := job.InterruptedError
+	for _, task := range tasks {
+		task.State = TaskStateInterrupted
+		task.Error = &errStr
+		task.Size = 0
+		if taskGroup.LogStoreDir != nil {
+			var size int64
+			fileName := task.Target.FileName()
+			task.LogStorePath, size = keepPartialLog(*taskGroup.LogStoreDir, fileName)
+			task.Size += size
+			task.SlowLogStorePath, size = keepPartialLog(*taskGroup.LogStoreDir, fileName+"-slow")
+			task.Size += size
+		}
+		s.db.Save(task)
+	}
+	s.finishTaskGroup(&taskGroup)
+	return nil
+}
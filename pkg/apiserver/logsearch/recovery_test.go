@@ -0,0 +1,45 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package logsearch
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/fx/fxtest"
+
+	"github.com/pingcap/tidb-dashboard/pkg/apiserver/artifact"
+	"github.com/pingcap/tidb-dashboard/pkg/apiserver/job"
+	"github.com/pingcap/tidb-dashboard/pkg/dbstore"
+	"github.com/pingcap/tidb-dashboard/util/testutil"
+)
+
+func TestRemoveUntrackedTaskGroups(t *testing.T) {
+	db := &dbstore.DB{DB: testutil.OpenTestSQLiteDB(t)}
+	require.Nil(t, autoMigrate(db))
+	jobs, err := job.NewManager(db)
+	require.Nil(t, err)
+	artifacts, err := artifact.NewManager(fxtest.NewLifecycle(t), artifact.ManagerParams{LocalStore: db})
+	require.Nil(t, err)
+	s := &Service{db: db, jobs: jobs, artifacts: artifacts}
+
+	// Task group 1 is created by a previous version, which stores logs in a temporary directory
+	staleDir := path.Join(t.TempDir(), "dashboard-logs", "1")
+	require.Nil(t, os.MkdirAll(staleDir, 0o700))
+	require.Nil(t, db.Create(&TaskGroupModel{ID: 1, State: TaskGroupStateFinished, LogStoreDir: &staleDir}).Error)
+	require.Nil(t, db.Create(&TaskModel{TaskGroupID: 1, State: TaskStateFinished}).Error)
+	require.Nil(t, db.Create(&TaskGroupModel{ID: 2, State: TaskGroupStateRunning}).Error)
+	jobs.Start(jobKind, 2)
+
+	require.Nil(t, s.removeUntrackedTaskGroups())
+	var ids []uint
+	require.Nil(t, db.Model(&TaskGroupModel{}).Pluck("id", &ids).Error)
+	require.Equal(t, []uint{2}, ids)
+	var count int64
+	require.Nil(t, db.Model(&TaskModel{}).Count(&count).Error)
+	require.Equal(t, int64(0), count)
+	_, err = os.Stat(staleDir)
+	require.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,108 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package logsearch
+
+import (
+	"archive/zip"
+	"bufio"
+	"sort"
+	"strings"
+)
+
+const (
+	defaultLogRowsLimit = 1000
+	maxLogRowsLimit     = 10000
+	maxLogLineSize      = 16 * 1024 * 1024
+)
+
+// scanLogRows parses rows from the stored log of a task, until `fn` returns false. Lines not starting with the
+// time and the level are considered as continuations of the previous line, e.g. stack traces.
+func scanLogRows(path string, fn func(row *LogRow) bool) error {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return err
+	}
+	defer zr.Close() // #nosec
+
+	for _, zf := range zr.File {
+		r, err := zf.Open()
+		if err != nil {
+			return err
+		}
+		stopped := false
+		var current *LogRow
+		var lines []string
+		flush := func() {
+			if current == nil {
+				return
+			}
+			if len(lines) > 1 {
+				if row, ok := parseLogLine(strings.Join(lines, "\n")); ok {
+					current = row
+				}
+			}
+			stopped = !fn(current)
+			current = nil
+			lines = lines[:0]
+		}
+
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 0, 64*1024), maxLogLineSize)
+		for !stopped && scanner.Scan() {
+			line := scanner.Text()
+			if row, ok := parseLogLine(line); ok {
+				flush()
+				current = row
+			} else if current == nil {
+				continue
+			}
+			lines = append(lines, line)
+		}
+		if !stopped {
+			flush()
+		}
+		err = scanner.Err()
+		_ = r.Close()
+		if err != nil {
+			return err
+		}
+		if stopped {
+			return nil
+		}
+	}
+	return nil
+}
+
+// readLogRows reads at most `limit` rows matching the filter from the stored log of a task.
+func readLogRows(path string, taskID uint, filter *logFilter, limit int) ([]LogRow, error) {
+	rows := make([]LogRow, 0)
+	if limit <= 0 {
+		return rows, nil
+	}
+	err := scanLogRows(path, func(row *LogRow) bool {
+		row.TaskID = taskID
+		if filter.match(row.Level, &row.ParsedLogMessage) {
+			rows = append(rows, *row)
+		}
+		return len(rows) < limit
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// mergeLogRows merges rows of tasks and keeps the first `limit` rows ordered by time.
+func mergeLogRows(rowsOfTasks [][]LogRow, limit int) []LogRow {
+	rows := make([]LogRow, 0)
+	for _, r := range rowsOfTasks {
+		rows = append(rows, r...)
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		return rows[i].Time < rows[j].Time
+	})
+	if len(rows) > limit {
+		rows = rows[:limit]
+	}
+	return rows
+}
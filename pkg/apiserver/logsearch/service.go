@@ -4,8 +4,10 @@ package logsearch
 
 import (
 	"context"
-	"io/ioutil"
+	"errors"
 	"net/http"
+	"os"
+	"path"
 	"strconv"
 	"strings"
 
@@ -13,7 +15,10 @@ import (
 	"github.com/pingcap/log"
 	"go.uber.org/fx"
 	"go.uber.org/zap"
+	"gorm.io/gorm"
 
+	"github.com/pingcap/tidb-dashboard/pkg/apiserver/artifact"
+	"github.com/pingcap/tidb-dashboard/pkg/apiserver/job"
 	"github.com/pingcap/tidb-dashboard/pkg/apiserver/model"
 	"github.com/pingcap/tidb-dashboard/pkg/apiserver/user"
 	"github.com/pingcap/tidb-dashboard/pkg/apiserver/utils"
@@ -22,6 +27,14 @@ import (
 	"github.com/pingcap/tidb-dashboard/util/rest"
 )
 
+const (
+	// artifactKind is the kind of stored logs in the artifact manager.
+	artifactKind = "logsearch"
+	jobKind      = "logsearch"
+	// An interrupted task group is searched again at most twice.
+	jobMaxAttempts = 3
+)
+
 type Service struct {
 	// FIXME: Use fx.In
 	lifecycleCtx context.Context
@@ -29,32 +42,44 @@ type Service struct {
 	config            *config.Config
 	logStoreDirectory string
 	db                *dbstore.DB
+	artifacts         *artifact.Manager
+	jobs              *job.Manager
 	scheduler         *Scheduler
 }
 
-func NewService(lc fx.Lifecycle, config *config.Config, db *dbstore.DB) *Service {
+func NewService(lc fx.Lifecycle, config *config.Config, db *dbstore.DB, artifacts *artifact.Manager, jobs *job.Manager) *Service {
+	// Logs are stored in the data directory by default, so that they are kept after restarts.
 	dir := config.TempDir
 	if dir == "" {
-		var err error
-		dir, err = ioutil.TempDir("", "dashboard-logs")
-		if err != nil {
-			log.Fatal("Failed to create directory for storing logs", zap.Error(err))
-		}
+		dir = path.Join(config.DataDir, "logs")
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		log.Fatal("Failed to create directory for storing logs", zap.Error(err))
 	}
 	err := autoMigrate(db)
 	if err != nil {
 		log.Fatal("Failed to initialize database", zap.Error(err))
 	}
-	cleanupAllTasks(db)
 
 	service := &Service{
 		config:            config,
 		logStoreDirectory: dir,
 		db:                db,
+		artifacts:         artifacts,
+		jobs:              jobs,
 		scheduler:         nil, // will be filled after scheduler is created
 	}
+	if err := service.removeUntrackedTaskGroups(); err != nil {
+		log.Fatal("Failed to remove task groups created by previous versions", zap.Error(err))
+	}
 	scheduler := NewScheduler(service)
 	service.scheduler = scheduler
+	artifacts.RegisterKind(artifactKind, dir, service.evictTaskGroup)
+	jobs.RegisterKind(jobKind, job.Kind{
+		MaxAttempts: jobMaxAttempts,
+		Resume:      service.resumeTaskGroup,
+		Interrupt:   service.interruptTaskGroup,
+	})
 
 	lc.Append(fx.Hook{
 		OnStart: func(ctx context.Context) error {
@@ -70,13 +95,18 @@ func RegisterRouter(r *gin.RouterGroup, auth *user.AuthService, s *Service) {
 	endpoint := r.Group("/logs")
 	{
 		endpoint.GET("/download", s.DownloadLogs)
+		endpoint.GET("/stream", s.StreamLogs)
 		endpoint.Use(auth.MWAuthRequired())
 		{
-			endpoint.GET("/download/acquire_token", s.GetDownloadToken)
+			endpoint.GET("/download/acquire_token", auth.MWRequirePermission(user.PermLogsDownload), s.GetDownloadToken)
+			endpoint.Use(auth.MWRequirePermission(user.PermLogsSearch))
 			endpoint.PUT("/taskgroup", s.CreateTaskGroup)
 			endpoint.GET("/taskgroups", s.GetAllTaskGroups)
 			endpoint.GET("/taskgroups/:id", s.GetTaskGroup)
 			endpoint.GET("/taskgroups/:id/preview", s.GetTaskGroupPreview)
+			endpoint.GET("/taskgroups/:id/rows", s.GetTaskGroupRows)
+			endpoint.GET("/taskgroups/:id/analysis", s.GetTaskGroupAnalysis)
+			endpoint.POST("/stream/token", s.GetStreamToken)
 			endpoint.POST("/taskgroups/:id/retry", s.RetryTask)
 			endpoint.POST("/taskgroups/:id/cancel", s.CancelTask)
 			endpoint.DELETE("/taskgroups/:id", s.DeleteTaskGroup)
@@ -84,6 +114,31 @@ func RegisterRouter(r *gin.RouterGroup, auth *user.AuthService, s *Service) {
 	}
 }
 
+// touchTaskGroup marks stored logs of the task group as recently used.
+func (s *Service) touchTaskGroup(taskGroupID string) {
+	if id, err := strconv.Atoi(taskGroupID); err == nil {
+		s.artifacts.Touch(artifactKind, uint(id))
+	}
+}
+
+// evictTaskGroup removes a finished task group and its stored logs when they exceed the quota or are outdated.
+func (s *Service) evictTaskGroup(taskGroupID uint) error {
+	taskGroup := TaskGroupModel{}
+	err := s.db.Where("id = ?", taskGroupID).First(&taskGroup).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if taskGroup.State == TaskGroupStateRunning {
+		return artifact.ErrInUse.NewWithNoMessage()
+	}
+	taskGroup.Delete(s.db)
+	s.jobs.Forget(jobKind, taskGroupID)
+	return nil
+}
+
 type CreateTaskGroupRequest struct {
 	Request SearchLogRequest          `json:"request" binding:"required"`
 	Targets []model.RequestTargetNode `json:"targets" binding:"required"`
@@ -100,6 +155,7 @@ type TaskGroupResponse struct {
 // @Success 200 {object} TaskGroupResponse
 // @Failure 400 {object} rest.ErrorResponse
 // @Failure 401 {object} rest.ErrorResponse
+// @Failure 409 {object} rest.ErrorResponse
 // @Failure 500 {object} rest.ErrorResponse
 // @Router /logs/taskgroup [put]
 func (s *Service) CreateTaskGroup(c *gin.Context) {
@@ -112,6 +168,14 @@ func (s *Service) CreateTaskGroup(c *gin.Context) {
 		_ = c.Error(rest.ErrBadRequest.New("Expect at least 1 target"))
 		return
 	}
+	if _, err := compileLogFilter(req.Request.Filter); err != nil {
+		_ = c.Error(rest.ErrBadRequest.New("Invalid filter: %s", err.Error()))
+		return
+	}
+	if err := s.artifacts.CheckAvailable(artifactKind); err != nil {
+		_ = c.Error(err)
+		return
+	}
 	stats := model.NewRequestTargetStatisticsFromArray(&req.Targets)
 	taskGroup := TaskGroupModel{
 		SearchRequest: &req.Request,
@@ -136,6 +200,8 @@ func (s *Service) CreateTaskGroup(c *gin.Context) {
 	}
 	if !s.scheduler.AsyncStart(&taskGroup, tasks) {
 		log.Error("Failed to start task group", zap.Uint("task_group_id", taskGroup.ID))
+	} else {
+		s.jobs.Start(jobKind, taskGroup.ID)
 	}
 	resp := TaskGroupResponse{
 		TaskGroup: taskGroup,
@@ -199,6 +265,7 @@ func (s *Service) GetTaskGroup(c *gin.Context) {
 func (s *Service) GetTaskGroupPreview(c *gin.Context) {
 	taskGroupID := c.Param("id")
 	var lines []PreviewModel
+	s.touchTaskGroup(taskGroupID)
 	err := s.db.
 		Where("task_group_id = ?", taskGroupID).
 		Order("time").
@@ -211,12 +278,150 @@ func (s *Service) GetTaskGroupPreview(c *gin.Context) {
 	c.JSON(http.StatusOK, lines)
 }
 
+type GetTaskGroupRowsRequest struct {
+	Filter string `json:"filter" form:"filter"`
+	Limit  int    `json:"limit" form:"limit"` // default: 1000, max: 10000
+}
+
+// @Summary Get parsed log rows of a log search task group
+// @Description Rows are read from logs stored by finished or interrupted tasks, ordered by time. Slow logs are not included.
+// @Param id path string true "task group id"
+// @Param q query GetTaskGroupRowsRequest true "Query"
+// @Security JwtAuth
+// @Success 200 {array} LogRow
+// @Failure 400 {object} rest.ErrorResponse
+// @Failure 401 {object} rest.ErrorResponse
+// @Failure 500 {object} rest.ErrorResponse
+// @Router /logs/taskgroups/{id}/rows [get]
+func (s *Service) GetTaskGroupRows(c *gin.Context) {
+	var req GetTaskGroupRowsRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		_ = c.Error(rest.ErrBadRequest.NewWithNoMessage())
+		return
+	}
+	filter, err := compileLogFilter(req.Filter)
+	if err != nil {
+		_ = c.Error(rest.ErrBadRequest.New("Invalid filter: %s", err.Error()))
+		return
+	}
+	limit := req.Limit
+	if limit <= 0 {
+		limit = defaultLogRowsLimit
+	}
+	if limit > maxLogRowsLimit {
+		limit = maxLogRowsLimit
+	}
+
+	s.touchTaskGroup(c.Param("id"))
+	var tasks []*TaskModel
+	err = s.db.
+		Where("task_group_id = ? AND state IN ?", c.Param("id"), tasksWithResults).
+		Find(&tasks).Error
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	rowsOfTasks := make([][]LogRow, 0, len(tasks))
+	for _, task := range tasks {
+		if task.LogStorePath == nil {
+			continue
+		}
+		rows, err := readLogRows(*task.LogStorePath, task.ID, filter, limit)
+		if err != nil {
+			_ = c.Error(err)
+			return
+		}
+		rowsOfTasks = append(rowsOfTasks, rows)
+	}
+	c.JSON(http.StatusOK, mergeLogRows(rowsOfTasks, limit))
+}
+
+// @Summary Analyze logs of a log search task group
+// @Description Returns the number of lines per instance and level over time, and templates of similar messages.
+// @Description Logs stored by finished or interrupted tasks are analyzed. Slow logs are not included.
+// @Param id path string true "task group id"
+// @Param q query GetTaskGroupAnalysisRequest true "Query"
+// @Security JwtAuth
+// @Success 200 {object} LogAnalysis
+// @Failure 400 {object} rest.ErrorResponse
+// @Failure 401 {object} rest.ErrorResponse
+// @Failure 500 {object} rest.ErrorResponse
+// @Router /logs/taskgroups/{id}/analysis [get]
+func (s *Service) GetTaskGroupAnalysis(c *gin.Context) {
+	var req GetTaskGroupAnalysisRequest
+	if err := c.ShouldBindQuery(&req); err != nil || req.BucketSeconds < 0 {
+		_ = c.Error(rest.ErrBadRequest.NewWithNoMessage())
+		return
+	}
+	filter, err := compileLogFilter(req.Filter)
+	if err != nil {
+		_ = c.Error(rest.ErrBadRequest.New("Invalid filter: %s", err.Error()))
+		return
+	}
+	maxTemplates := req.MaxTemplates
+	if maxTemplates <= 0 {
+		maxTemplates = defaultMaxLogTemplates
+	}
+	if maxTemplates > maxLogTemplates {
+		maxTemplates = maxLogTemplates
+	}
+
+	taskGroup := TaskGroupModel{}
+	if err := s.db.First(&taskGroup, "id = ?", c.Param("id")).Error; err != nil {
+		_ = c.Error(err)
+		return
+	}
+	bucketSeconds := req.BucketSeconds
+	if bucketSeconds == 0 {
+		bucketSeconds = histogramBucketSeconds(taskGroup.SearchRequest)
+	}
+	if err := checkHistogramBuckets(taskGroup.SearchRequest, bucketSeconds); err != nil {
+		_ = c.Error(rest.ErrBadRequest.WrapWithNoMessage(err))
+		return
+	}
+
+	s.artifacts.Touch(artifactKind, taskGroup.ID)
+	var tasks []*TaskModel
+	err = s.db.
+		Where("task_group_id = ? AND state IN ?", taskGroup.ID, tasksWithResults).
+		Find(&tasks).Error
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	analyzer := newLogAnalyzer(bucketSeconds)
+	for _, task := range tasks {
+		if task.LogStorePath == nil {
+			continue
+		}
+		instance := task.Target.DisplayName
+		err := scanLogRows(*task.LogStorePath, func(row *LogRow) bool {
+			if filter.match(row.Level, &row.ParsedLogMessage) {
+				analyzer.add(instance, row)
+			}
+			return true
+		})
+		if err != nil {
+			_ = c.Error(err)
+			return
+		}
+	}
+	result, err := analyzer.result(maxTemplates)
+	if err != nil {
+		_ = c.Error(rest.ErrBadRequest.WrapWithNoMessage(err))
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
 // @Summary Retry failed tasks in a log search task group
 // @Param id path string true "task group id"
 // @Security JwtAuth
 // @Success 200 {object} rest.EmptyResponse
 // @Failure 400 {object} rest.ErrorResponse
 // @Failure 401 {object} rest.ErrorResponse
+// @Failure 409 {object} rest.ErrorResponse
 // @Failure 500 {object} rest.ErrorResponse
 // @Router /logs/taskgroups/{id}/retry [post]
 func (s *Service) RetryTask(c *gin.Context) {
@@ -234,7 +439,10 @@ func (s *Service) RetryTask(c *gin.Context) {
 	}
 
 	tasks := make([]*TaskModel, 0)
-	if err := s.db.Where("task_group_id = ? AND state = ?", taskGroupID, TaskStateError).Find(&tasks).Error; err != nil {
+	err = s.db.
+		Where("task_group_id = ? AND state IN ?", taskGroupID, []TaskState{TaskStateError, TaskStateInterrupted}).
+		Find(&tasks).Error
+	if err != nil {
 		_ = c.Error(err)
 		return
 	}
@@ -244,11 +452,18 @@ func (s *Service) RetryTask(c *gin.Context) {
 		c.JSON(http.StatusOK, rest.EmptyResponse{})
 		return
 	}
+	if err := s.artifacts.CheckAvailable(artifactKind); err != nil {
+		_ = c.Error(err)
+		return
+	}
 
 	// Reset task status
 	taskGroup.State = TaskGroupStateRunning
 	s.db.Save(&taskGroup)
 	for _, task := range tasks {
+		// Interrupted tasks may have partial results
+		task.RemoveDataAndPreview(s.db)
+		task.Size = 0
 		task.Error = nil
 		task.State = TaskStateRunning
 		s.db.Save(task)
@@ -256,6 +471,8 @@ func (s *Service) RetryTask(c *gin.Context) {
 
 	if !s.scheduler.AsyncStart(&taskGroup, tasks) {
 		log.Error("Failed to retry task group", zap.Uint("task_group_id", taskGroup.ID))
+	} else {
+		s.jobs.Start(jobKind, taskGroup.ID)
 	}
 	c.JSON(http.StatusOK, rest.EmptyResponse{})
 }
@@ -303,6 +520,8 @@ func (s *Service) DeleteTaskGroup(c *gin.Context) {
 		return
 	}
 	taskGroup.Delete(s.db)
+	s.artifacts.Forget(artifactKind, taskGroup.ID)
+	s.jobs.Forget(jobKind, taskGroup.ID)
 	c.JSON(http.StatusOK, rest.EmptyResponse{})
 }
 
@@ -344,10 +563,11 @@ func (s *Service) DownloadLogs(c *gin.Context) {
 	for _, id := range ids {
 		var task TaskModel
 		if s.db.
-			Where("id = ? AND state = ?", id, TaskStateFinished).
+			Where("id = ? AND state IN ?", id, tasksWithResults).
 			First(&task).
 			Error == nil {
 			tasks = append(tasks, &task)
+			s.artifacts.Touch(artifactKind, task.TaskGroupID)
 			// Ignore errors silently
 		}
 	}
@@ -0,0 +1,348 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package logsearch
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pingcap/kvproto/pkg/diagnosticspb"
+
+	"github.com/pingcap/tidb-dashboard/pkg/apiserver/model"
+	"github.com/pingcap/tidb-dashboard/pkg/apiserver/utils"
+	"github.com/pingcap/tidb-dashboard/util/rest"
+)
+
+const (
+	// Number of messages buffered for each target. Receiving from the target is paused when the buffer is full,
+	// so that a slow client applies backpressure to targets via gRPC flow control.
+	streamBufferSize        = 1024
+	streamKeepAliveInterval = 10 * time.Second
+	// A pending line is written after waiting for this long, even if some targets have not produced any newer line.
+	streamMaxMergeWait = 2 * time.Second
+)
+
+type StreamLogsRequest struct {
+	Request SearchLogRequest          `json:"request" binding:"required"`
+	Targets []model.RequestTargetNode `json:"targets" binding:"required"`
+	// The stream is closed after sending this number of lines. 0 means unlimited.
+	Limit int `json:"limit"`
+}
+
+// StreamLogLine is the data of the `log` event.
+type StreamLogLine struct {
+	Target  model.RequestTargetNode `json:"target"`
+	Time    int64                   `json:"time"`
+	Level   LogLevel                `json:"level"`
+	Message string                  `json:"message"`
+	Parsed  ParsedLogMessage        `json:"parsed"`
+}
+
+// StreamLogError is the data of the `error` event, sent when searching a target fails.
+type StreamLogError struct {
+	Target model.RequestTargetNode `json:"target"`
+	Error  string                  `json:"error"`
+}
+
+type logSource struct {
+	target model.RequestTargetNode
+	ch     chan *diagnosticspb.LogMessage
+	// notify is shared by all sources to be merged. It is signaled after a message is sent to ch or ch is closed.
+	notify chan struct{}
+	// err is only valid after ch is closed.
+	err error
+}
+
+func newLogSource(target model.RequestTargetNode, notify chan struct{}) *logSource {
+	return &logSource{
+		target: target,
+		ch:     make(chan *diagnosticspb.LogMessage, streamBufferSize),
+		notify: notify,
+	}
+}
+
+func (src *logSource) signal() {
+	select {
+	case src.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (src *logSource) close() {
+	close(src.ch)
+	src.signal()
+}
+
+func (s *Service) searchLogToSource(ctx context.Context, src *logSource, req *SearchLogRequest, filter *logFilter) {
+	defer src.close()
+
+	conn, err := s.dialTarget(&src.target)
+	if err != nil {
+		src.err = err
+		return
+	}
+	defer conn.Close()
+
+	cli := diagnosticspb.NewDiagnosticsClient(conn)
+	stream, err := cli.SearchLog(ctx, buildSearchLogPBRequest(req, diagnosticspb.SearchLogRequest_Normal))
+	if err != nil {
+		src.err = err
+		return
+	}
+	for {
+		res, err := stream.Recv()
+		if err != nil {
+			if err != io.EOF {
+				src.err = err
+			}
+			return
+		}
+		for _, msg := range res.Messages {
+			if !matchLogFilter(filter, msg) {
+				continue
+			}
+			select {
+			case src.ch <- msg:
+				src.signal()
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+type logStreamWriter interface {
+	writeLine(line *StreamLogLine) error
+	writeError(e *StreamLogError) error
+	// flush is called before waiting for new messages.
+	flush() error
+	keepAlive() error
+}
+
+// mergeLogSources writes messages from all sources ordered by time, until all sources are finished, or `limit`
+// lines are written. The earliest pending message is written when every unfinished source has a pending message,
+// so that the output is ordered as long as messages from each source are ordered. If some sources have not
+// produced any message for `maxWait`, the earliest pending message is written without waiting for them, in which
+// case messages arriving later from these sources may be out of order.
+func mergeLogSources(ctx context.Context, sources []*logSource, notify <-chan struct{}, w logStreamWriter, limit int, keepAliveInterval, maxWait time.Duration) error {
+	heads := make([]*diagnosticspb.LogMessage, len(sources))
+	finished := make([]bool, len(sources))
+	keepAliveTicker := time.NewTicker(keepAliveInterval)
+	defer keepAliveTicker.Stop()
+
+	// The time since when there are pending messages, but some sources have not produced any message.
+	var waitingSince time.Time
+	written := 0
+	for limit <= 0 || written < limit {
+		// Fill heads of sources without blocking.
+		for i := range sources {
+			if finished[i] || heads[i] != nil {
+				continue
+			}
+			select {
+			case msg, ok := <-sources[i].ch:
+				if ok {
+					heads[i] = msg
+					continue
+				}
+				finished[i] = true
+				if sources[i].err != nil {
+					err := w.writeError(&StreamLogError{Target: sources[i].target, Error: sources[i].err.Error()})
+					if err != nil {
+						return err
+					}
+				}
+			default:
+			}
+		}
+
+		minIdx := -1
+		allReceived := true
+		for i := range sources {
+			if heads[i] != nil {
+				if minIdx == -1 || heads[i].Time < heads[minIdx].Time {
+					minIdx = i
+				}
+			} else if !finished[i] {
+				allReceived = false
+			}
+		}
+		if allReceived {
+			waitingSince = time.Time{}
+			if minIdx == -1 {
+				break
+			}
+		} else if minIdx != -1 && waitingSince.IsZero() {
+			waitingSince = time.Now()
+		}
+
+		if minIdx != -1 && (allReceived || time.Since(waitingSince) >= maxWait) {
+			msg := heads[minIdx]
+			heads[minIdx] = nil
+			err := w.writeLine(&StreamLogLine{
+				Target:  sources[minIdx].target,
+				Time:    msg.Time,
+				Level:   LogLevel(msg.Level),
+				Message: msg.Message,
+				Parsed:  parseLogMessage(msg.Message),
+			})
+			if err != nil {
+				return err
+			}
+			written++
+			continue
+		}
+
+		// Wait for new messages from any source.
+		if err := w.flush(); err != nil {
+			return err
+		}
+		var timer *time.Timer
+		var timeout <-chan time.Time
+		if minIdx != -1 {
+			timer = time.NewTimer(maxWait - time.Since(waitingSince))
+			timeout = timer.C
+		}
+		select {
+		case <-notify:
+		case <-timeout:
+		case <-keepAliveTicker.C:
+			if err := w.keepAlive(); err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+	return w.flush()
+}
+
+type sseLogStreamWriter struct {
+	c *gin.Context
+}
+
+// Write errors are not reported here. When the connection is broken, the request context is cancelled.
+func (w *sseLogStreamWriter) writeLine(line *StreamLogLine) error {
+	w.c.SSEvent("log", line)
+	return nil
+}
+
+func (w *sseLogStreamWriter) writeError(e *StreamLogError) error {
+	w.c.SSEvent("error", e)
+	return nil
+}
+
+func (w *sseLogStreamWriter) flush() error {
+	w.c.Writer.Flush()
+	return nil
+}
+
+func (w *sseLogStreamWriter) keepAlive() error {
+	// Lines starting with a colon are comments and ignored by clients.
+	if _, err := io.WriteString(w.c.Writer, ":\n\n"); err != nil {
+		return err
+	}
+	return w.flush()
+}
+
+const (
+	streamTokenIssuer = "logs/stream"
+	// The token is used to open the event stream right after it is generated, so that it is short-lived.
+	streamTokenExpire = time.Minute
+)
+
+// @Summary Generate a token for streaming logs
+// @Description EventSource only supports GET requests without custom headers, so that the search request is
+// @Description carried by a token.
+// @Param request body StreamLogsRequest true "Request body"
+// @Produce plain
+// @Security JwtAuth
+// @Success 200 {string} string "xxx"
+// @Failure 400 {object} rest.ErrorResponse
+// @Failure 401 {object} rest.ErrorResponse
+// @Router /logs/stream/token [post]
+func (s *Service) GetStreamToken(c *gin.Context) {
+	var req StreamLogsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		_ = c.Error(rest.ErrBadRequest.NewWithNoMessage())
+		return
+	}
+	if len(req.Targets) == 0 {
+		_ = c.Error(rest.ErrBadRequest.New("Expect at least 1 target"))
+		return
+	}
+	if _, err := compileLogFilter(req.Request.Filter); err != nil {
+		_ = c.Error(rest.ErrBadRequest.New("Invalid filter: %s", err.Error()))
+		return
+	}
+	data, err := json.Marshal(req)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	token, err := utils.NewJWTStringWithExpire(streamTokenIssuer, string(data), streamTokenExpire)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.String(http.StatusOK, token)
+}
+
+// @Summary Search logs and stream results as server-sent events
+// @Description Matched lines from all targets are streamed as `log` events ordered by time as they arrive. A line
+// @Description is delayed for a while if some targets are slow, and may be out of order if they are even slower.
+// @Description Failures of targets are sent as `error` events, and an `end` event is sent when the search is finished.
+// @Description The search is cancelled when the connection is closed.
+// @Param token query string true "stream token"
+// @Produce text/event-stream
+// @Success 200 {object} StreamLogLine
+// @Failure 400 {object} rest.ErrorResponse
+// @Router /logs/stream [get]
+func (s *Service) StreamLogs(c *gin.Context) {
+	data, err := utils.ParseJWTString(streamTokenIssuer, c.Query("token"))
+	if err != nil {
+		_ = c.Error(rest.ErrBadRequest.NewWithNoMessage())
+		return
+	}
+	var req StreamLogsRequest
+	if err := json.Unmarshal([]byte(data), &req); err != nil {
+		_ = c.Error(rest.ErrBadRequest.NewWithNoMessage())
+		return
+	}
+	filter, err := compileLogFilter(req.Request.Filter)
+	if err != nil {
+		_ = c.Error(rest.ErrBadRequest.New("Invalid filter: %s", err.Error()))
+		return
+	}
+
+	ctx, cancel := context.WithCancel(c.Request.Context())
+	defer cancel()
+
+	notify := make(chan struct{}, 1)
+	sources := make([]*logSource, 0, len(req.Targets))
+	for _, target := range req.Targets {
+		src := newLogSource(target, notify)
+		sources = append(sources, src)
+		go s.searchLogToSource(ctx, src, &req.Request, filter)
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	w := &sseLogStreamWriter{c: c}
+	if err := mergeLogSources(ctx, sources, notify, w, req.Limit, streamKeepAliveInterval, streamMaxMergeWait); err != nil {
+		// The connection is likely to be broken, nothing more can be sent.
+		return
+	}
+	c.SSEvent("end", "")
+	c.Writer.Flush()
+}
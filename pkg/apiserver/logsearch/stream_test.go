@@ -0,0 +1,121 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package logsearch
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/pingcap/kvproto/pkg/diagnosticspb"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pingcap/tidb-dashboard/pkg/apiserver/model"
+)
+
+type fakeLogStreamWriter struct {
+	lines      []*StreamLogLine
+	errors     []*StreamLogError
+	keepAlives int
+}
+
+func (w *fakeLogStreamWriter) writeLine(line *StreamLogLine) error {
+	w.lines = append(w.lines, line)
+	return nil
+}
+
+func (w *fakeLogStreamWriter) writeError(e *StreamLogError) error {
+	w.errors = append(w.errors, e)
+	return nil
+}
+
+func (w *fakeLogStreamWriter) flush() error {
+	return nil
+}
+
+func (w *fakeLogStreamWriter) keepAlive() error {
+	w.keepAlives++
+	return nil
+}
+
+func newTestLogSource(notify chan struct{}, name string, times ...int64) *logSource {
+	src := newLogSource(model.RequestTargetNode{DisplayName: name}, notify)
+	for _, t := range times {
+		src.ch <- &diagnosticspb.LogMessage{Time: t, Message: name}
+	}
+	return src
+}
+
+func collectTimes(w *fakeLogStreamWriter) []int64 {
+	times := make([]int64, 0, len(w.lines))
+	for _, l := range w.lines {
+		times = append(times, l.Time)
+	}
+	return times
+}
+
+func TestMergeLogSources(t *testing.T) {
+	notify := make(chan struct{}, 1)
+	src1 := newTestLogSource(notify, "a", 1, 4, 5, 8)
+	src2 := newTestLogSource(notify, "b", 2, 3, 6)
+	src3 := newTestLogSource(notify, "c")
+	src3.err = errors.New("connection refused")
+	src1.close()
+	src3.close()
+
+	go func() {
+		// src2 is still running, so that lines after 6 are not written until src2 produces a newer line
+		time.Sleep(50 * time.Millisecond)
+		src2.ch <- &diagnosticspb.LogMessage{Time: 7, Message: "b"}
+		src2.signal()
+		src2.close()
+	}()
+
+	w := &fakeLogStreamWriter{}
+	err := mergeLogSources(context.Background(), []*logSource{src1, src2, src3}, notify, w, 0, 10*time.Millisecond, time.Second)
+	require.Nil(t, err)
+
+	require.Equal(t, []int64{1, 2, 3, 4, 5, 6, 7, 8}, collectTimes(w))
+	require.Equal(t, "b", w.lines[1].Message)
+	require.Equal(t, "b", w.lines[1].Target.DisplayName)
+	require.Len(t, w.errors, 1)
+	require.Equal(t, "c", w.errors[0].Target.DisplayName)
+	require.Greater(t, w.keepAlives, 0)
+}
+
+func TestMergeLogSourcesLimitAndCancel(t *testing.T) {
+	notify := make(chan struct{}, 1)
+	src := newTestLogSource(notify, "a", 1, 2, 3)
+	w := &fakeLogStreamWriter{}
+	err := mergeLogSources(context.Background(), []*logSource{src}, notify, w, 2, time.Second, time.Second)
+	require.Nil(t, err)
+	require.Len(t, w.lines, 2)
+
+	// The source is neither finished nor producing messages
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	w = &fakeLogStreamWriter{}
+	err = mergeLogSources(ctx, []*logSource{newTestLogSource(notify, "b")}, notify, w, 0, time.Second, time.Second)
+	require.Equal(t, context.Canceled, err)
+}
+
+func TestMergeLogSourcesSlowSource(t *testing.T) {
+	notify := make(chan struct{}, 1)
+	src1 := newTestLogSource(notify, "a", 1, 2)
+	src2 := newTestLogSource(notify, "b")
+	src1.close()
+
+	go func() {
+		// Lines of src1 are written after waiting src2 for a while, so that the line of src2 is out of order
+		time.Sleep(200 * time.Millisecond)
+		src2.ch <- &diagnosticspb.LogMessage{Time: 0, Message: "b"}
+		src2.signal()
+		src2.close()
+	}()
+
+	w := &fakeLogStreamWriter{}
+	err := mergeLogSources(context.Background(), []*logSource{src1, src2}, notify, w, 0, time.Second, 20*time.Millisecond)
+	require.Nil(t, err)
+	require.Equal(t, []int64{1, 2, 0}, collectTimes(w))
+}
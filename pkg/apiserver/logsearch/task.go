@@ -18,10 +18,12 @@ import (
 
 	"github.com/pingcap/kvproto/pkg/diagnosticspb"
 	"github.com/pingcap/log"
+	"github.com/prometheus/client_golang/prometheus"
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
 
+	"github.com/pingcap/tidb-dashboard/pkg/apiserver/metrics/selfmetrics"
 	"github.com/pingcap/tidb-dashboard/pkg/apiserver/model"
 )
 
@@ -78,9 +80,29 @@ func (tg *TaskGroup) SyncRun() {
 	}
 	wg.Wait()
 
+	if tg.service.isStopping() {
+		// Keep the task group running, so that it is resumed after restart.
+		log.Debug("LogSearchTaskGroup interrupted", zap.Uint("task_group_id", tg.model.ID))
+		return
+	}
+
 	log.Debug("LogSearchTaskGroup finished", zap.Uint("task_group_id", tg.model.ID))
-	tg.model.State = TaskGroupStateFinished
-	tg.service.db.Save(tg.model)
+	tg.service.finishTaskGroup(tg.model)
+}
+
+func (s *Service) finishTaskGroup(taskGroup *TaskGroupModel) {
+	taskGroup.State = TaskGroupStateFinished
+	// Tasks finished before retrying are included.
+	var size int64
+	_ = s.db.Model(&TaskModel{}).
+		Select("COALESCE(SUM(size), 0)").
+		Where("task_group_id = ?", taskGroup.ID).
+		Row().
+		Scan(&size)
+	taskGroup.Size = size
+	s.db.Save(taskGroup)
+	s.artifacts.Record(artifactKind, taskGroup.ID, size)
+	s.jobs.Finish(jobKind, taskGroup.ID)
 }
 
 // This function is multi-thread safe.
@@ -135,8 +157,27 @@ func (t *Task) accumulateLogSize(path *string) {
 	}
 }
 
+var runningTasksGauge = prometheus.NewGauge(
+	prometheus.GaugeOpts{
+		Namespace: "tidb_dashboard",
+		Subsystem: "logsearch",
+		Name:      "running_tasks",
+		Help:      "Number of running log search tasks.",
+	})
+
+func init() {
+	selfmetrics.Add(runningTasksGauge)
+}
+
 func (t *Task) SyncRun() {
+	runningTasksGauge.Inc()
+	defer runningTasksGauge.Dec()
 	defer func() {
+		if t.model.Error != nil && t.taskGroup.service.isStopping() {
+			// Keep the task running, so that it is resumed after restart.
+			log.Debug("LogSearchTask interrupted", zap.Any("task", t))
+			return
+		}
 		if t.model.Error != nil {
 			log.Warn("LogSearchTask stopped with error",
 				zap.Any("task", t),
@@ -161,16 +202,7 @@ func (t *Task) SyncRun() {
 		return
 	}
 
-	secureOpt := grpc.WithInsecure()
-	if t.taskGroup.service.config.ClusterTLSConfig != nil {
-		creds := credentials.NewTLS(t.taskGroup.service.config.ClusterTLSConfig)
-		secureOpt = grpc.WithTransportCredentials(creds)
-	}
-
-	conn, err := grpc.Dial(fmt.Sprintf("%s:%d", t.model.Target.IP, t.model.Target.Port),
-		secureOpt,
-		grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(MaxRecvMsgSize)),
-	)
+	conn, err := t.taskGroup.service.dialTarget(t.model.Target)
 	if err != nil {
 		t.setError(err)
 		return
@@ -189,12 +221,13 @@ func (t *Task) searchLog(client diagnosticspb.DiagnosticsClient, targetType diag
 	if t.model.Error != nil {
 		return
 	}
-	req := t.taskGroup.model.SearchRequest.ConvertToPB(targetType)
-	patterns := make([]string, len(req.Patterns))
-	for i, p := range req.Patterns {
-		patterns[i] = "(?i)" + p
+	// The filter is already validated when the task group is created.
+	filter, err := compileLogFilter(t.taskGroup.model.SearchRequest.Filter)
+	if err != nil {
+		t.setError(err)
+		return
 	}
-	req.Patterns = patterns
+	req := buildSearchLogPBRequest(t.taskGroup.model.SearchRequest, targetType)
 	stream, err := client.SearchLog(t.ctx, req)
 	if err != nil {
 		t.setError(err)
@@ -248,6 +281,9 @@ func (t *Task) searchLog(client diagnosticspb.DiagnosticsClient, targetType diag
 			return
 		}
 		for _, msg := range res.Messages {
+			if !matchLogFilter(filter, msg) {
+				continue
+			}
 			line := logMessageToString(msg)
 			_, err := bufWriter.Write(*(*[]byte)(unsafe.Pointer(&line))) // #nosec
 			if err != nil {
@@ -268,7 +304,30 @@ func (t *Task) searchLog(client diagnosticspb.DiagnosticsClient, targetType diag
 	}
 }
 
+func (s *Service) dialTarget(target *model.RequestTargetNode) (*grpc.ClientConn, error) {
+	secureOpt := grpc.WithInsecure()
+	if s.config.ClusterTLSConfig != nil {
+		creds := credentials.NewTLS(s.config.ClusterTLSConfig)
+		secureOpt = grpc.WithTransportCredentials(creds)
+	}
+	return grpc.Dial(fmt.Sprintf("%s:%d", target.IP, target.Port),
+		secureOpt,
+		grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(MaxRecvMsgSize)),
+	)
+}
+
+// buildSearchLogPBRequest converts the request, where patterns are matched case-insensitively.
+func buildSearchLogPBRequest(r *SearchLogRequest, targetType diagnosticspb.SearchLogRequest_Target) *diagnosticspb.SearchLogRequest {
+	req := r.ConvertToPB(targetType)
+	patterns := make([]string, len(req.Patterns))
+	for i, p := range req.Patterns {
+		patterns[i] = "(?i)" + p
+	}
+	req.Patterns = patterns
+	return req
+}
+
 func logMessageToString(msg *diagnosticspb.LogMessage) string {
-	timeStr := time.Unix(0, msg.Time*int64(time.Millisecond)).Format("2006/01/02 15:04:05.000 -07:00")
+	timeStr := time.Unix(0, msg.Time*int64(time.Millisecond)).Format(logTimeFormat)
 	return fmt.Sprintf("[%s] [%s] %s\n", timeStr, msg.Level.String(), msg.Message)
 }
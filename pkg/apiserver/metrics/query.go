@@ -0,0 +1,83 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// PromSample is a series of an instant vector.
+type PromSample struct {
+	Metric map[string]string
+	Value  float64
+}
+
+type promInstantQueryResponse struct {
+	Status string `json:"status"`
+	Error  string `json:"error"`
+	Data   struct {
+		ResultType string `json:"resultType"`
+		Result     []struct {
+			Metric map[string]string `json:"metric"`
+			Value  [2]interface{}    `json:"value"` // [unix time, value string]
+		} `json:"result"`
+	} `json:"data"`
+}
+
+func (s *Service) resolvePromAddress() (string, error) {
+	addr, err := s.getPromAddressFromCache()
+	if err != nil {
+		return "", ErrLoadPrometheusAddressFailed.Wrap(err, "Load prometheus address failed")
+	}
+	if addr == "" {
+		return "", ErrPrometheusNotFound.New("Prometheus is not deployed in the cluster")
+	}
+	return addr, nil
+}
+
+// QueryInstant evaluates a PromQL query at the current time. The result of the query must be an instant vector.
+func (s *Service) QueryInstant(ctx context.Context, query string) ([]PromSample, error) {
+	addr, err := s.resolvePromAddress()
+	if err != nil {
+		return nil, err
+	}
+
+	params := url.Values{}
+	params.Add("query", query)
+	uri := fmt.Sprintf("%s/api/v1/query?%s", addr, params.Encode())
+	data, err := s.params.HTTPClient.
+		WithTimeout(defaultPromQueryTimeout).
+		SendRequest(ctx, uri, http.MethodGet, nil, ErrPrometheusQueryFailed, "Prometheus")
+	if err != nil {
+		return nil, err
+	}
+
+	var resp promInstantQueryResponse
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return nil, ErrPrometheusQueryFailed.Wrap(err, "failed to read Prometheus query result")
+	}
+	if resp.Status != "success" {
+		return nil, ErrPrometheusQueryFailed.New("failed to query Prometheus: %s", resp.Error)
+	}
+	if resp.Data.ResultType != "vector" {
+		return nil, ErrPrometheusQueryFailed.New("expect a vector result, got %s", resp.Data.ResultType)
+	}
+	samples := make([]PromSample, 0, len(resp.Data.Result))
+	for _, r := range resp.Data.Result {
+		str, ok := r.Value[1].(string)
+		if !ok {
+			continue
+		}
+		v, err := strconv.ParseFloat(str, 64)
+		if err != nil {
+			continue
+		}
+		samples = append(samples, PromSample{Metric: r.Metric, Value: v})
+	}
+	return samples, nil
+}
@@ -30,9 +30,10 @@ type QueryResponse struct {
 func RegisterRouter(r *gin.RouterGroup, auth *user.AuthService, s *Service) {
 	endpoint := r.Group("/metrics")
 	endpoint.Use(auth.MWAuthRequired())
-	endpoint.GET("/query", s.queryMetrics)
-	endpoint.GET("/prom_address", s.getPromAddressConfig)
-	endpoint.PUT("/prom_address", auth.MWRequireWritePriv(), s.putCustomPromAddress)
+	endpoint.GET("/self", auth.MWRequirePermission(user.PermMetricsView), s.selfMetricsHandler())
+	endpoint.GET("/query", auth.MWRequirePermission(user.PermMetricsView), s.queryMetrics)
+	endpoint.GET("/prom_address", auth.MWRequirePermission(user.PermMetricsView), s.getPromAddressConfig)
+	endpoint.PUT("/prom_address", auth.MWRequirePermission(user.PermMetricsConfig), s.putCustomPromAddress)
 }
 
 // @Summary Query metrics
@@ -49,13 +50,9 @@ func (s *Service) queryMetrics(c *gin.Context) {
 		return
 	}
 
-	addr, err := s.getPromAddressFromCache()
+	addr, err := s.resolvePromAddress()
 	if err != nil {
-		_ = c.Error(ErrLoadPrometheusAddressFailed.Wrap(err, "Load prometheus address failed"))
-		return
-	}
-	if addr == "" {
-		_ = c.Error(ErrPrometheusNotFound.New("Prometheus is not deployed in the cluster"))
+		_ = c.Error(err)
 		return
 	}
 
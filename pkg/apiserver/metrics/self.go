@@ -0,0 +1,79 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package metrics
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/pingcap/tidb-dashboard/pkg/apiserver/metrics/selfmetrics"
+)
+
+// Routes that are not matched are recorded using this label, to avoid unbounded label values.
+const unmatchedRoute = "<unmatched>"
+
+var (
+	apiRequestCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "tidb_dashboard",
+			Subsystem: "api",
+			Name:      "requests_total",
+			Help:      "Counter of API requests handled by the dashboard server.",
+		}, []string{"method", "route", "status"})
+
+	apiRequestDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: "tidb_dashboard",
+			Subsystem: "api",
+			Name:      "request_duration_seconds",
+			Help:      "Bucketed histogram of API request handling duration.",
+			Buckets:   prometheus.ExponentialBuckets(0.001, 2, 18), // 1ms ~ 131s
+		}, []string{"method", "route"})
+)
+
+func init() {
+	selfmetrics.Add(apiRequestCounter, apiRequestDuration)
+}
+
+// SelfRegistry collects metrics of the dashboard server itself. It is separated from the default registry, so that
+// metrics of the host process are not exposed when the dashboard is embedded, e.g. in PD.
+type SelfRegistry struct {
+	*prometheus.Registry
+}
+
+func NewSelfRegistry() *SelfRegistry {
+	r := &SelfRegistry{Registry: prometheus.NewRegistry()}
+	r.MustRegister(selfmetrics.Collectors()...)
+	return r
+}
+
+// MWRecordRequest creates a middleware that records the count and the latency of requests per route.
+func MWRecordRequest() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		startTime := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = unmatchedRoute
+		}
+		method := c.Request.Method
+		apiRequestCounter.WithLabelValues(method, route, strconv.Itoa(c.Writer.Status())).Inc()
+		apiRequestDuration.WithLabelValues(method, route).Observe(time.Since(startTime).Seconds())
+	}
+}
+
+// @ID metricsGetSelf
+// @Summary Get metrics of the dashboard server itself in Prometheus format
+// @Produce plain
+// @Success 200 {string} string
+// @Router /metrics/self [get]
+// @Security JwtAuth
+// @Failure 401 {object} rest.ErrorResponse
+func (s *Service) selfMetricsHandler() gin.HandlerFunc {
+	return gin.WrapH(promhttp.HandlerFor(s.params.SelfRegistry, promhttp.HandlerOpts{}))
+}
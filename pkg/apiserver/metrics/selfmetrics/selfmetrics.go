@@ -0,0 +1,31 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+// Package selfmetrics collects metrics of the dashboard server itself from modules. Collected metrics are registered
+// into metrics.SelfRegistry and exported by `/metrics/self`.
+package selfmetrics
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	mu         sync.Mutex
+	collectors []prometheus.Collector
+)
+
+// Add adds collectors to be exported as metrics of the dashboard server. Usually called in `init()` of the module
+// defining these collectors.
+func Add(cs ...prometheus.Collector) {
+	mu.Lock()
+	defer mu.Unlock()
+	collectors = append(collectors, cs...)
+}
+
+// Collectors returns all added collectors.
+func Collectors() []prometheus.Collector {
+	mu.Lock()
+	defer mu.Unlock()
+	return append([]prometheus.Collector(nil), collectors...)
+}
@@ -32,6 +32,8 @@ type ServiceParams struct {
 	HTTPClient *httpc.Client
 	EtcdClient *clientv3.Client
 	PDClient   *pd.Client
+
+	SelfRegistry *SelfRegistry
 }
 
 type Service struct {
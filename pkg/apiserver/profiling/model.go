@@ -10,7 +10,9 @@ import (
 	"time"
 
 	"github.com/joomcode/errorx"
+	"github.com/prometheus/client_golang/prometheus"
 
+	"github.com/pingcap/tidb-dashboard/pkg/apiserver/metrics/selfmetrics"
 	"github.com/pingcap/tidb-dashboard/pkg/apiserver/model"
 	"github.com/pingcap/tidb-dashboard/pkg/dbstore"
 )
@@ -25,6 +27,7 @@ const (
 	TaskStateFinish
 	TaskStatePartialFinish // Only valid for task group
 	TaskStateSkipped
+	TaskStateInterrupted // Interrupted by a restart of TiDB Dashboard
 )
 
 type TaskRawDataType string
@@ -32,6 +35,10 @@ type TaskRawDataType string
 const (
 	RawDataTypeProtobuf TaskRawDataType = "protobuf"
 	RawDataTypeText     TaskRawDataType = "text"
+	// Go execution trace, which can be viewed by `go tool trace`
+	RawDataTypeTrace TaskRawDataType = "trace"
+	// Raw heap profile of jemalloc, which can be viewed by `jeprof` with the binary
+	RawDataTypeJemalloc TaskRawDataType = "jemalloc"
 )
 
 type (
@@ -53,13 +60,22 @@ const (
 	ProfilingTypeHeap      TaskProfilingType = "heap"
 	ProfilingTypeGoroutine TaskProfilingType = "goroutine"
 	ProfilingTypeMutex     TaskProfilingType = "mutex"
+	// Following types are only supported by TiDB and PD.
+	ProfilingTypeBlock        TaskProfilingType = "block"
+	ProfilingTypeAllocs       TaskProfilingType = "allocs"
+	ProfilingTypeThreadCreate TaskProfilingType = "threadcreate"
+	ProfilingTypeTrace        TaskProfilingType = "trace"
 )
 
 var profilingTypeMap = map[TaskProfilingType]struct{}{
-	ProfilingTypeCPU:       {},
-	ProfilingTypeHeap:      {},
-	ProfilingTypeGoroutine: {},
-	ProfilingTypeMutex:     {},
+	ProfilingTypeCPU:          {},
+	ProfilingTypeHeap:         {},
+	ProfilingTypeGoroutine:    {},
+	ProfilingTypeMutex:        {},
+	ProfilingTypeBlock:        {},
+	ProfilingTypeAllocs:       {},
+	ProfilingTypeThreadCreate: {},
+	ProfilingTypeTrace:        {},
 }
 
 type TaskModel struct {
@@ -85,6 +101,9 @@ type TaskGroupModel struct {
 	TargetStats            model.RequestTargetStatistics `json:"target_stats" gorm:"embedded;embedded_prefix:target_stats_"`
 	StartedAt              int64                         `json:"started_at"`
 	RequstedProfilingTypes TaskProfilingTypeList         `json:"requsted_profiling_types"`
+	Size                   int64                         `json:"size"` // Total size of profiling results, updated when finished
+	// The trigger rule and the metric value starting profiling, which is empty when started by the user.
+	TriggeredBy string `json:"triggered_by" gorm:"type:text"`
 }
 
 func (TaskGroupModel) TableName() string {
@@ -98,15 +117,18 @@ func autoMigrate(db *dbstore.DB) error {
 // Task is the unit to fetch profiling information.
 type Task struct {
 	*TaskModel
+	// parentCtx is done when the service is stopping, in which case the task is interrupted instead of failed.
+	parentCtx context.Context
 	ctx       context.Context
 	cancel    context.CancelFunc
 	taskGroup *TaskGroup
 	fetchers  *fetchers
+	dir       string
 }
 
 // NewTask creates a new profiling task.
-func NewTask(ctx context.Context, taskGroup *TaskGroup, target model.RequestTargetNode, fts *fetchers, profilingType TaskProfilingType) *Task {
-	ctx, cancel := context.WithCancel(ctx)
+func NewTask(parentCtx context.Context, taskGroup *TaskGroup, target model.RequestTargetNode, fts *fetchers, dir string, profilingType TaskProfilingType) *Task {
+	ctx, cancel := context.WithCancel(parentCtx)
 	return &Task{
 		TaskModel: &TaskModel{
 			TaskGroupID:   taskGroup.ID,
@@ -115,17 +137,38 @@ func NewTask(ctx context.Context, taskGroup *TaskGroup, target model.RequestTarg
 			StartedAt:     time.Now().Unix(),
 			ProfilingType: profilingType,
 		},
+		parentCtx: parentCtx,
 		ctx:       ctx,
 		cancel:    cancel,
 		taskGroup: taskGroup,
 		fetchers:  fts,
+		dir:       dir,
 	}
 }
 
+var runningTasksGauge = prometheus.NewGauge(
+	prometheus.GaugeOpts{
+		Namespace: "tidb_dashboard",
+		Subsystem: "profiling",
+		Name:      "running_tasks",
+		Help:      "Number of running profiling tasks.",
+	})
+
+func init() {
+	selfmetrics.Add(runningTasksGauge)
+}
+
 func (t *Task) run() {
+	runningTasksGauge.Inc()
+	defer runningTasksGauge.Dec()
+
 	fileNameWithoutExt := fmt.Sprintf("profiling_%d_%d_%s_%s", t.TaskGroupID, t.ID, t.ProfilingType, t.Target.FileName())
-	protoFilePath, rawDataType, err := profileAndWritePprof(t.ctx, t.fetchers, &t.Target, fileNameWithoutExt, t.taskGroup.ProfileDurationSecs, t.ProfilingType)
+	protoFilePath, rawDataType, err := profileAndWritePprof(t.ctx, t.fetchers, &t.Target, t.dir, fileNameWithoutExt, t.taskGroup.ProfileDurationSecs, t.ProfilingType)
 	if err != nil {
+		if t.parentCtx.Err() != nil {
+			// Leave the task running, it is marked as interrupted after restart.
+			return
+		}
 		if errorx.IsOfType(err, ErrUnsupportedProfilingType) {
 			t.State = TaskStateSkipped
 		} else {
@@ -5,28 +5,29 @@ package profiling
 import (
 	"fmt"
 	"io/ioutil"
-	"strconv"
 
 	"github.com/pingcap/tidb-dashboard/pkg/apiserver/model"
 )
 
 type pprofOptions struct {
-	duration           uint
+	duration uint
+	// The directory to write the profile, or the default temporary directory if it is empty.
+	dir                string
 	fileNameWithoutExt string
 
-	target        *model.RequestTargetNode
-	fetcher       *profileFetcher
-	profilingType TaskProfilingType
+	target   *model.RequestTargetNode
+	fetcher  *profileFetcher
+	endpoint *profileEndpoint
 }
 
 func fetchPprof(op *pprofOptions) (string, TaskRawDataType, error) {
 	fetcher := &fetcher{profileFetcher: op.fetcher, target: op.target}
-	tmpPath, rawDataType, err := fetcher.FetchAndWriteToFile(op.duration, op.fileNameWithoutExt, op.profilingType)
+	tmpPath, err := fetcher.FetchAndWriteToFile(op.duration, op.dir, op.fileNameWithoutExt, op.endpoint)
 	if err != nil {
 		return "", "", fmt.Errorf("failed to fetch and write to temp file: %v", err)
 	}
 
-	return tmpPath, rawDataType, nil
+	return tmpPath, op.endpoint.rawDataType, nil
 }
 
 type fetcher struct {
@@ -34,48 +35,25 @@ type fetcher struct {
 	profileFetcher *profileFetcher
 }
 
-func (f *fetcher) FetchAndWriteToFile(duration uint, fileNameWithoutExt string, profilingType TaskProfilingType) (string, TaskRawDataType, error) {
-	var profilingRawDataType TaskRawDataType
-	var fileExtenstion string
-	secs := strconv.Itoa(int(duration))
-	var url string
-	switch profilingType {
-	case ProfilingTypeCPU:
-		url = "/debug/pprof/profile?seconds=" + secs
-		profilingRawDataType = RawDataTypeProtobuf
-		fileExtenstion = "*.proto"
-	case ProfilingTypeHeap:
-		url = "/debug/pprof/heap"
-		profilingRawDataType = RawDataTypeProtobuf
-		fileExtenstion = "*.proto"
-	case ProfilingTypeGoroutine:
-		url = "/debug/pprof/goroutine?debug=1"
-		profilingRawDataType = RawDataTypeText
-		fileExtenstion = "*.txt"
-	case ProfilingTypeMutex:
-		url = "/debug/pprof/mutex?debug=1"
-		profilingRawDataType = RawDataTypeText
-		fileExtenstion = "*.txt"
-	}
-
-	tmpfile, err := ioutil.TempFile("", fileNameWithoutExt+fileExtenstion)
+func (f *fetcher) FetchAndWriteToFile(duration uint, dir string, fileNameWithoutExt string, endpoint *profileEndpoint) (string, error) {
+	tmpfile, err := ioutil.TempFile(dir, fileNameWithoutExt+endpoint.fileExt)
 	if err != nil {
-		return "", "", fmt.Errorf("failed to create tmpfile to write profile: %v", err)
+		return "", fmt.Errorf("failed to create tmpfile to write profile: %v", err)
 	}
 
 	defer func() {
 		_ = tmpfile.Close()
 	}()
 
-	resp, err := (*f.profileFetcher).fetch(&fetchOptions{ip: f.target.IP, port: f.target.Port, path: url})
+	resp, err := (*f.profileFetcher).fetch(&fetchOptions{ip: f.target.IP, port: f.target.Port, path: endpoint.url(duration)})
 	if err != nil {
-		return "", "", fmt.Errorf("failed to fetch profile with %v format: %v", fileExtenstion, err)
+		return "", fmt.Errorf("failed to fetch profile with %v format: %v", endpoint.fileExt, err)
 	}
 
 	_, err = tmpfile.Write(resp)
 	if err != nil {
-		return "", "", fmt.Errorf("failed to write profile: %v", err)
+		return "", fmt.Errorf("failed to write profile: %v", err)
 	}
 
-	return tmpfile.Name(), profilingRawDataType, nil
+	return tmpfile.Name(), nil
 }
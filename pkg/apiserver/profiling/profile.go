@@ -4,29 +4,81 @@ package profiling
 
 import (
 	"context"
+	"fmt"
+	"strings"
 
 	"github.com/pingcap/tidb-dashboard/pkg/apiserver/model"
 )
 
-func profileAndWritePprof(ctx context.Context, fts *fetchers, target *model.RequestTargetNode, fileNameWithoutExt string, profileDurationSecs uint, profilingType TaskProfilingType) (string, TaskRawDataType, error) {
+type profileEndpoint struct {
+	path string
+	// Whether the profile is collected during the profiling duration, which is passed by the `seconds` parameter.
+	withDuration bool
+	rawDataType  TaskRawDataType
+	fileExt      string
+}
+
+func (e *profileEndpoint) url(durationSecs uint) string {
+	if !e.withDuration {
+		return e.path
+	}
+	sep := "?"
+	if strings.Contains(e.path, "?") {
+		sep = "&"
+	}
+	return fmt.Sprintf("%s%sseconds=%d", e.path, sep, durationSecs)
+}
+
+// goProfileEndpoints are pprof endpoints of components written in Go, i.e. TiDB and PD. Goroutine dumps with
+// `debug=2` contain states and wait durations of each goroutine.
+var goProfileEndpoints = map[TaskProfilingType]*profileEndpoint{
+	ProfilingTypeCPU:          {path: "/debug/pprof/profile", withDuration: true, rawDataType: RawDataTypeProtobuf, fileExt: "*.proto"},
+	ProfilingTypeHeap:         {path: "/debug/pprof/heap", rawDataType: RawDataTypeProtobuf, fileExt: "*.proto"},
+	ProfilingTypeGoroutine:    {path: "/debug/pprof/goroutine?debug=2", rawDataType: RawDataTypeText, fileExt: "*.txt"},
+	ProfilingTypeMutex:        {path: "/debug/pprof/mutex?debug=1", rawDataType: RawDataTypeText, fileExt: "*.txt"},
+	ProfilingTypeBlock:        {path: "/debug/pprof/block", rawDataType: RawDataTypeProtobuf, fileExt: "*.proto"},
+	ProfilingTypeAllocs:       {path: "/debug/pprof/allocs", rawDataType: RawDataTypeProtobuf, fileExt: "*.proto"},
+	ProfilingTypeThreadCreate: {path: "/debug/pprof/threadcreate", rawDataType: RawDataTypeProtobuf, fileExt: "*.proto"},
+	ProfilingTypeTrace:        {path: "/debug/pprof/trace", withDuration: true, rawDataType: RawDataTypeTrace, fileExt: "*.trace"},
+}
+
+// tikvProfileEndpoints are pprof endpoints of the status server of TiKV. Heap profiles are dumped by jemalloc after
+// profiling for the duration.
+var tikvProfileEndpoints = map[TaskProfilingType]*profileEndpoint{
+	ProfilingTypeCPU:  {path: "/debug/pprof/profile", withDuration: true, rawDataType: RawDataTypeProtobuf, fileExt: "*.proto"},
+	ProfilingTypeHeap: {path: "/debug/pprof/heap", withDuration: true, rawDataType: RawDataTypeJemalloc, fileExt: "*.prof"},
+}
+
+// tiflashProfileEndpoints are pprof endpoints of the status server of TiFlash, which does not serve heap profiles.
+var tiflashProfileEndpoints = map[TaskProfilingType]*profileEndpoint{
+	ProfilingTypeCPU: {path: "/debug/pprof/profile", withDuration: true, rawDataType: RawDataTypeProtobuf, fileExt: "*.proto"},
+}
+
+func profileAndWritePprof(ctx context.Context, fts *fetchers, target *model.RequestTargetNode, dir string, fileNameWithoutExt string, profileDurationSecs uint, profilingType TaskProfilingType) (string, TaskRawDataType, error) {
+	var endpoints map[TaskProfilingType]*profileEndpoint
+	var fetcher *profileFetcher
 	switch target.Kind {
 	case model.NodeKindTiKV:
-		// TiKV only supports CPU Profiling
-		if profilingType != ProfilingTypeCPU {
-			return "", "", ErrUnsupportedProfilingType.NewWithNoMessage()
-		}
-		return fetchPprof(&pprofOptions{duration: profileDurationSecs, fileNameWithoutExt: fileNameWithoutExt, target: target, fetcher: &fts.tikv, profilingType: profilingType})
+		endpoints, fetcher = tikvProfileEndpoints, &fts.tikv
 	case model.NodeKindTiFlash:
-		// TiFlash only supports CPU Profiling
-		if profilingType != ProfilingTypeCPU {
-			return "", "", ErrUnsupportedProfilingType.NewWithNoMessage()
-		}
-		return fetchPprof(&pprofOptions{duration: profileDurationSecs, fileNameWithoutExt: fileNameWithoutExt, target: target, fetcher: &fts.tiflash, profilingType: profilingType})
+		endpoints, fetcher = tiflashProfileEndpoints, &fts.tiflash
 	case model.NodeKindTiDB:
-		return fetchPprof(&pprofOptions{duration: profileDurationSecs, fileNameWithoutExt: fileNameWithoutExt, target: target, fetcher: &fts.tidb, profilingType: profilingType})
+		endpoints, fetcher = goProfileEndpoints, &fts.tidb
 	case model.NodeKindPD:
-		return fetchPprof(&pprofOptions{duration: profileDurationSecs, fileNameWithoutExt: fileNameWithoutExt, target: target, fetcher: &fts.pd, profilingType: profilingType})
+		endpoints, fetcher = goProfileEndpoints, &fts.pd
 	default:
 		return "", "", ErrUnsupportedProfilingTarget.New(target.String())
 	}
+	endpoint, ok := endpoints[profilingType]
+	if !ok {
+		return "", "", ErrUnsupportedProfilingType.NewWithNoMessage()
+	}
+	return fetchPprof(&pprofOptions{duration: profileDurationSecs, dir: dir, fileNameWithoutExt: fileNameWithoutExt, target: target, fetcher: fetcher, endpoint: endpoint})
+}
+
+// FetchProfile profiles the target and writes the result into a temporary file, which is used by the built-in
+// continuous profiling. The caller is responsible for removing the file.
+func (s *Service) FetchProfile(target *model.RequestTargetNode, durationSecs uint, profilingType TaskProfilingType) (string, TaskRawDataType, error) {
+	fileNameWithoutExt := fmt.Sprintf("conprof_%s_%s", profilingType, target.FileName())
+	return profileAndWritePprof(s.lifecycleCtx, s.fetchers, target, "", fileNameWithoutExt, durationSecs, profilingType)
 }
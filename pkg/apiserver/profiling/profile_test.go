@@ -0,0 +1,61 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package profiling
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/pingcap/tidb-dashboard/pkg/apiserver/model"
+	"github.com/pingcap/tidb-dashboard/pkg/dbstore"
+	"github.com/pingcap/tidb-dashboard/util/testutil"
+)
+
+func TestProfileEndpointURL(t *testing.T) {
+	tests := []struct {
+		endpoint *profileEndpoint
+		expected string
+	}{
+		{goProfileEndpoints[ProfilingTypeCPU], "/debug/pprof/profile?seconds=30"},
+		{goProfileEndpoints[ProfilingTypeHeap], "/debug/pprof/heap"},
+		{goProfileEndpoints[ProfilingTypeGoroutine], "/debug/pprof/goroutine?debug=2"},
+		{goProfileEndpoints[ProfilingTypeTrace], "/debug/pprof/trace?seconds=30"},
+		{tikvProfileEndpoints[ProfilingTypeHeap], "/debug/pprof/heap?seconds=30"},
+		{tiflashProfileEndpoints[ProfilingTypeCPU], "/debug/pprof/profile?seconds=30"},
+		{&profileEndpoint{path: "/debug/pprof/foo?debug=1", withDuration: true}, "/debug/pprof/foo?debug=1&seconds=30"},
+	}
+	for _, tt := range tests {
+		require.Equal(t, tt.expected, tt.endpoint.url(30))
+	}
+}
+
+func TestTaskSkipped(t *testing.T) {
+	db := &dbstore.DB{DB: testutil.OpenTestSQLiteDB(t)}
+	require.Nil(t, autoMigrate(db))
+
+	tests := []struct {
+		kind          model.NodeKind
+		profilingType TaskProfilingType
+	}{
+		{model.NodeKindTiFlash, ProfilingTypeHeap},
+		{model.NodeKindTiFlash, ProfilingTypeGoroutine},
+		{model.NodeKindTiKV, ProfilingTypeTrace},
+		{model.NodeKindPD, TaskProfilingType("unknown")},
+	}
+	for _, tt := range tests {
+		tg := NewTaskGroup(db, 30, model.RequestTargetStatistics{}, TaskProfilingTypeList{tt.profilingType})
+		require.Nil(t, db.Create(tg.TaskGroupModel).Error)
+		target := model.RequestTargetNode{Kind: tt.kind, DisplayName: "127.0.0.1:1234", IP: "127.0.0.1", Port: 1234}
+		task := NewTask(context.Background(), tg, target, &fetchers{}, t.TempDir(), tt.profilingType)
+		require.Nil(t, db.Create(task.TaskModel).Error)
+
+		// Unsupported profiling types are skipped without fetching the target.
+		task.run()
+		var saved TaskModel
+		require.Nil(t, db.First(&saved, task.ID).Error)
+		require.Equal(t, TaskStateSkipped, saved.State, "%s %s", tt.kind, tt.profilingType)
+		require.Empty(t, saved.Error)
+	}
+}
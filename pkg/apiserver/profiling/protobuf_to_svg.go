@@ -14,6 +14,11 @@ import (
 	"github.com/google/pprof/profile"
 )
 
+// ConvertProtobufToSVG renders a profile in protobuf format as a SVG graph.
+func ConvertProtobufToSVG(content []byte) ([]byte, error) {
+	return convertProtobufToSVG(content, TaskModel{})
+}
+
 func convertProtobufToSVG(content []byte, task TaskModel) ([]byte, error) {
 	dotContent, err := convertProtobufToDot(content, task)
 	if err != nil {
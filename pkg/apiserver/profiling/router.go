@@ -3,6 +3,7 @@
 package profiling
 
 import (
+	"bytes"
 	"fmt"
 	"io/ioutil"
 	"net/http"
@@ -10,12 +11,14 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/pprof/profile"
 	"github.com/pingcap/log"
 	"go.uber.org/zap"
 
 	"github.com/pingcap/tidb-dashboard/pkg/apiserver/user"
 	"github.com/pingcap/tidb-dashboard/pkg/apiserver/utils"
 	"github.com/pingcap/tidb-dashboard/pkg/config"
+	"github.com/pingcap/tidb-dashboard/util/pprofutil"
 	"github.com/pingcap/tidb-dashboard/util/rest"
 	"github.com/pingcap/tidb-dashboard/util/ziputil"
 )
@@ -23,19 +26,22 @@ import (
 // Register register the handlers to the service.
 func RegisterRouter(r *gin.RouterGroup, auth *user.AuthService, s *Service) {
 	endpoint := r.Group("/profiling")
-	endpoint.GET("/group/list", auth.MWAuthRequired(), s.getGroupList)
-	endpoint.POST("/group/start", auth.MWAuthRequired(), s.handleStartGroup)
-	endpoint.GET("/group/detail/:groupId", auth.MWAuthRequired(), s.getGroupDetail)
-	endpoint.POST("/group/cancel/:groupId", auth.MWAuthRequired(), s.handleCancelGroup)
-	endpoint.DELETE("/group/delete/:groupId", auth.MWAuthRequired(), s.deleteGroup)
+	endpoint.GET("/group/list", auth.MWAuthRequired(), auth.MWRequirePermission(user.PermProfilingView), s.getGroupList)
+	endpoint.POST("/group/start", auth.MWAuthRequired(), auth.MWRequirePermission(user.PermProfilingStart), s.handleStartGroup)
+	endpoint.GET("/group/detail/:groupId", auth.MWAuthRequired(), auth.MWRequirePermission(user.PermProfilingView), s.getGroupDetail)
+	endpoint.POST("/group/cancel/:groupId", auth.MWAuthRequired(), auth.MWRequirePermission(user.PermProfilingStart), s.handleCancelGroup)
+	endpoint.DELETE("/group/delete/:groupId", auth.MWAuthRequired(), auth.MWRequirePermission(user.PermProfilingStart), s.deleteGroup)
 
-	endpoint.GET("/action_token", auth.MWAuthRequired(), s.getActionToken)
+	endpoint.GET("/action_token", auth.MWAuthRequired(), auth.MWRequirePermission(user.PermProfilingView), s.getActionToken)
 	endpoint.GET("/group/download", s.downloadGroup)
 	endpoint.GET("/single/download", s.downloadSingle)
 	endpoint.GET("/single/view", s.viewSingle)
+	endpoint.GET("/diff", auth.MWAuthRequired(), auth.MWRequirePermission(user.PermProfilingView), s.viewDiff)
+	endpoint.GET("/goroutine/analyze", auth.MWAuthRequired(), auth.MWRequirePermission(user.PermProfilingView), s.analyzeGoroutine)
+	endpoint.GET("/goroutine/diff", auth.MWAuthRequired(), auth.MWRequirePermission(user.PermProfilingView), s.diffGoroutine)
 
-	endpoint.GET("/config", auth.MWAuthRequired(), s.getDynamicConfig)
-	endpoint.PUT("/config", auth.MWAuthRequired(), auth.MWRequireWritePriv(), s.setDynamicConfig)
+	endpoint.GET("/config", auth.MWAuthRequired(), auth.MWRequirePermission(user.PermProfilingView), s.getDynamicConfig)
+	endpoint.PUT("/config", auth.MWAuthRequired(), auth.MWRequirePermission(user.PermProfilingConfig), s.setDynamicConfig)
 }
 
 // @ID startProfiling
@@ -46,6 +52,7 @@ func RegisterRouter(r *gin.RouterGroup, auth *user.AuthService, s *Service) {
 // @Success 200 {object} TaskGroupModel "task group"
 // @Failure 400 {object} rest.ErrorResponse
 // @Failure 401 {object} rest.ErrorResponse
+// @Failure 409 {object} rest.ErrorResponse
 // @Failure 500 {object} rest.ErrorResponse
 // @Router /profiling/group/start [post]
 func (s *Service) handleStartGroup(c *gin.Context) {
@@ -66,21 +73,12 @@ func (s *Service) handleStartGroup(c *gin.Context) {
 		req.DurationSecs = config.MaxProfilingAutoCollectionDurationSecs
 	}
 
-	session := &StartRequestSession{
-		req: req,
-		ch:  make(chan struct{}, 1),
-	}
-	s.sessionCh <- session
-	select {
-	case <-session.ch:
-		if session.err != nil {
-			_ = c.Error(session.err)
-		} else {
-			c.JSON(http.StatusOK, session.taskGroup.TaskGroupModel)
-		}
-	case <-time.After(Timeout):
-		_ = c.Error(ErrTimeout.NewWithNoMessage())
+	taskGroup, err := s.submit(c.Request.Context(), req)
+	if err != nil {
+		_ = c.Error(err)
+		return
 	}
+	c.JSON(http.StatusOK, taskGroup.TaskGroupModel)
 }
 
 // @ID getProfilingGroups
@@ -216,6 +214,8 @@ func (s *Service) downloadGroup(c *gin.Context) {
 		return
 	}
 
+	s.params.Artifacts.Touch(artifactKind, uint(taskGroupID))
+
 	filePathes := make([]string, len(tasks))
 	for i, task := range tasks {
 		filePathes[i] = task.FilePath
@@ -260,6 +260,8 @@ func (s *Service) downloadSingle(c *gin.Context) {
 		return
 	}
 
+	s.params.Artifacts.Touch(artifactKind, task.TaskGroupID)
+
 	fileName := fmt.Sprintf("profiling_%d.zip", taskID)
 	c.Writer.Header().Set("Content-type", "application/octet-stream")
 	c.Writer.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", fileName))
@@ -275,13 +277,21 @@ const (
 	ViewOutputTypeProtobuf ViewOutputType = "protobuf"
 	ViewOutputTypeGraph    ViewOutputType = "graph"
 	ViewOutputTypeText     ViewOutputType = "text"
+	// JSON outputs of protobuf profiles, see pprofutil.Format
+	ViewOutputTypeTop        ViewOutputType = ViewOutputType(pprofutil.FormatTop)
+	ViewOutputTypeFlameGraph ViewOutputType = ViewOutputType(pprofutil.FormatFlameGraph)
+	ViewOutputTypeSpeedscope ViewOutputType = ViewOutputType(pprofutil.FormatSpeedscope)
+	ViewOutputTypeCallTree   ViewOutputType = ViewOutputType(pprofutil.FormatCallTree)
 )
 
 // @ID viewProfilingSingle
 // @Summary View the result of a task
 // @Description View the finished profiling result of a task
+// @Description Protobuf results can be converted into JSON outputs, i.e. top, flamegraph, speedscope and calltree, with options like focus and ignore.
 // @Produce html
 // @Param token query string true "download token"
+// @Param output_type query string false "output type"
+// @Param q query pprofutil.Options false "Options of JSON outputs"
 // @Security JwtAuth
 // @Failure 400 {object} rest.ErrorResponse
 // @Failure 401 {object} rest.ErrorResponse
@@ -307,6 +317,8 @@ func (s *Service) viewSingle(c *gin.Context) {
 		return
 	}
 
+	s.params.Artifacts.Touch(artifactKind, task.TaskGroupID)
+
 	content, err := ioutil.ReadFile(task.FilePath)
 	if err != nil {
 		_ = c.Error(err)
@@ -329,10 +341,27 @@ func (s *Service) viewSingle(c *gin.Context) {
 		case string(ViewOutputTypeProtobuf):
 			contentType = "application/protobuf"
 		default:
-			// Will not handle converting protobuf to other formats except flamegraph and graph
-			_ = c.Error(rest.ErrBadRequest.New("Cannot output protobuf as %s", outputType))
+			if !pprofutil.IsJSONFormat(outputType) {
+				_ = c.Error(rest.ErrBadRequest.New("Cannot output protobuf as %s", outputType))
+				return
+			}
+			var opts pprofutil.Options
+			if err := c.ShouldBindQuery(&opts); err != nil {
+				_ = c.Error(rest.ErrBadRequest.WrapWithNoMessage(err))
+				return
+			}
+			p, err := profile.ParseData(content)
+			if err != nil {
+				_ = c.Error(err)
+				return
+			}
+			writeProfileJSON(c, p, ViewOutputType(outputType), &opts)
 			return
 		}
+	} else if task.RawDataType == RawDataTypeTrace || task.RawDataType == RawDataTypeJemalloc {
+		// Viewing requires the binary or the Go toolchain
+		_ = c.Error(rest.ErrBadRequest.New("Cannot view %s profiling result, please download it", task.RawDataType))
+		return
 	} else if task.RawDataType == RawDataTypeText {
 		switch outputType {
 		case string(ViewOutputTypeText):
@@ -346,6 +375,207 @@ func (s *Service) viewSingle(c *gin.Context) {
 	c.Data(http.StatusOK, contentType, content)
 }
 
+type ViewDiffRequest struct {
+	BaseTaskID   uint           `json:"base" form:"base" binding:"required"`
+	TargetTaskID uint           `json:"target" form:"target" binding:"required"`
+	OutputType   ViewOutputType `json:"output_type" form:"output_type"` // graph, protobuf or a JSON output, default: graph
+	pprofutil.Options
+}
+
+// @ID viewProfilingDiff
+// @Summary View the difference between results of two tasks
+// @Description Subtract the base profile from the target profile like `pprof -diff_base`, e.g. to compare CPU before and after a config change.
+// @Description Both tasks must be finished, and have the same profiling type in protobuf format.
+// @Description The diff is rendered as a SVG graph, JSON outputs like a top table and a flame graph in the d3-flame-graph format, or downloaded in protobuf format.
+// @Produce json,image/svg+xml,application/octet-stream
+// @Param q query ViewDiffRequest true "Query"
+// @Security JwtAuth
+// @Success 200 {object} pprofutil.TopResponse
+// @Failure 400 {object} rest.ErrorResponse
+// @Failure 401 {object} rest.ErrorResponse
+// @Failure 500 {object} rest.ErrorResponse
+// @Router /profiling/diff [get]
+func (s *Service) viewDiff(c *gin.Context) {
+	var req ViewDiffRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		_ = c.Error(rest.ErrBadRequest.WrapWithNoMessage(err))
+		return
+	}
+
+	var tasks [2]TaskModel
+	for i, id := range []uint{req.BaseTaskID, req.TargetTaskID} {
+		err := s.params.LocalStore.Where("id = ? AND state = ?", id, TaskStateFinish).First(&tasks[i]).Error
+		if err != nil {
+			_ = c.Error(rest.ErrNotFound.New("Finished task %d not found", id))
+			return
+		}
+	}
+	base, target := tasks[0], tasks[1]
+	if base.ProfilingType != target.ProfilingType {
+		_ = c.Error(rest.ErrBadRequest.New("Cannot compare %s profile with %s profile", base.ProfilingType, target.ProfilingType))
+		return
+	}
+	s.params.Artifacts.Touch(artifactKind, base.TaskGroupID)
+	s.params.Artifacts.Touch(artifactKind, target.TaskGroupID)
+
+	baseProfile, err := loadProtobufProfile(&base)
+	if err != nil {
+		_ = c.Error(rest.ErrBadRequest.WrapWithNoMessage(err))
+		return
+	}
+	targetProfile, err := loadProtobufProfile(&target)
+	if err != nil {
+		_ = c.Error(rest.ErrBadRequest.WrapWithNoMessage(err))
+		return
+	}
+	diff, err := pprofutil.Diff(baseProfile, targetProfile)
+	if err != nil {
+		// Profiles are incompatible, e.g. sample types are different
+		_ = c.Error(rest.ErrBadRequest.WrapWithNoMessage(err))
+		return
+	}
+
+	switch req.OutputType {
+	case ViewOutputTypeGraph, "", ViewOutputTypeProtobuf:
+		var buf bytes.Buffer
+		if err := diff.Write(&buf); err != nil {
+			_ = c.Error(err)
+			return
+		}
+		if req.OutputType == ViewOutputTypeProtobuf {
+			fileName := fmt.Sprintf("diff_%d_%d.proto", req.BaseTaskID, req.TargetTaskID)
+			c.Writer.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", fileName))
+			c.Data(http.StatusOK, "application/octet-stream", buf.Bytes())
+			return
+		}
+		svgContent, err := convertProtobufToSVG(buf.Bytes(), target)
+		if err != nil {
+			_ = c.Error(err)
+			return
+		}
+		c.Data(http.StatusOK, "image/svg+xml", svgContent)
+	default:
+		if !pprofutil.IsJSONFormat(string(req.OutputType)) {
+			_ = c.Error(rest.ErrBadRequest.New("Cannot output diff as %s", req.OutputType))
+			return
+		}
+		writeProfileJSON(c, diff, req.OutputType, &req.Options)
+	}
+}
+
+// writeProfileJSON converts the profile into a JSON output. Conversion errors are caused by invalid options.
+func writeProfileJSON(c *gin.Context, p *profile.Profile, outputType ViewOutputType, opts *pprofutil.Options) {
+	resp, err := pprofutil.Convert(p, pprofutil.Format(outputType), opts)
+	if err != nil {
+		_ = c.Error(rest.ErrBadRequest.WrapWithNoMessage(err))
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// loadProtobufProfile parses the profiling result of a finished task in the protobuf format.
+func loadProtobufProfile(task *TaskModel) (*profile.Profile, error) {
+	if task.RawDataType != RawDataTypeProtobuf {
+		return nil, fmt.Errorf("profiling result of task %d is not in protobuf format", task.ID)
+	}
+	content, err := ioutil.ReadFile(task.FilePath)
+	if err != nil {
+		return nil, err
+	}
+	return profile.ParseData(content)
+}
+
+type AnalyzeGoroutineRequest struct {
+	TaskID uint `json:"task" form:"task" binding:"required"`
+}
+
+// @ID analyzeProfilingGoroutine
+// @Summary Analyze the goroutine dump of a task
+// @Description Group goroutines by identical stacks, with their states and wait durations.
+// @Param q query AnalyzeGoroutineRequest true "Query"
+// @Security JwtAuth
+// @Success 200 {object} pprofutil.GoroutineDump
+// @Failure 400 {object} rest.ErrorResponse
+// @Failure 401 {object} rest.ErrorResponse
+// @Failure 500 {object} rest.ErrorResponse
+// @Router /profiling/goroutine/analyze [get]
+func (s *Service) analyzeGoroutine(c *gin.Context) {
+	var req AnalyzeGoroutineRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		_ = c.Error(rest.ErrBadRequest.WrapWithNoMessage(err))
+		return
+	}
+	dump, err := s.loadGoroutineDump(req.TaskID)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, dump)
+}
+
+type DiffGoroutineRequest struct {
+	BaseTaskID   uint `json:"base" form:"base" binding:"required"`
+	TargetTaskID uint `json:"target" form:"target" binding:"required"`
+}
+
+// @ID diffProfilingGoroutine
+// @Summary Compare goroutine dumps of two tasks
+// @Description Compare the number of goroutines of each stack. Stacks keep growing between dumps are likely leaks.
+// @Description Dumps collected before and after goroutine profiling switched to `debug=2` cannot be compared.
+// @Param q query DiffGoroutineRequest true "Query"
+// @Security JwtAuth
+// @Success 200 {object} pprofutil.GoroutineDumpDiff
+// @Failure 400 {object} rest.ErrorResponse
+// @Failure 401 {object} rest.ErrorResponse
+// @Failure 500 {object} rest.ErrorResponse
+// @Router /profiling/goroutine/diff [get]
+func (s *Service) diffGoroutine(c *gin.Context) {
+	var req DiffGoroutineRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		_ = c.Error(rest.ErrBadRequest.WrapWithNoMessage(err))
+		return
+	}
+	base, err := s.loadGoroutineDump(req.BaseTaskID)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	target, err := s.loadGoroutineDump(req.TargetTaskID)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	diff, err := pprofutil.DiffGoroutineDumps(base, target)
+	if err != nil {
+		_ = c.Error(rest.ErrBadRequest.WrapWithNoMessage(err))
+		return
+	}
+	c.JSON(http.StatusOK, diff)
+}
+
+// loadGoroutineDump parses the result of a finished goroutine profiling task.
+func (s *Service) loadGoroutineDump(taskID uint) (*pprofutil.GoroutineDump, error) {
+	var task TaskModel
+	err := s.params.LocalStore.Where("id = ? AND state = ?", taskID, TaskStateFinish).First(&task).Error
+	if err != nil {
+		return nil, rest.ErrNotFound.New("Finished task %d not found", taskID)
+	}
+	if task.ProfilingType != ProfilingTypeGoroutine {
+		return nil, rest.ErrBadRequest.New("Task %d is not a goroutine profiling task", taskID)
+	}
+	s.params.Artifacts.Touch(artifactKind, task.TaskGroupID)
+
+	content, err := ioutil.ReadFile(task.FilePath)
+	if err != nil {
+		return nil, err
+	}
+	dump, err := pprofutil.ParseGoroutineDump(content)
+	if err != nil {
+		return nil, rest.ErrBadRequest.WrapWithNoMessage(err)
+	}
+	return dump, nil
+}
+
 // @ID deleteProfilingGroup
 // @Summary Delete all tasks with a given group ID
 // @Description Delete all finished profiling tasks with a given group ID
@@ -367,14 +597,11 @@ func (s *Service) deleteGroup(c *gin.Context) {
 		return
 	}
 
-	if err = s.params.LocalStore.Where("task_group_id = ?", taskGroupID).Delete(&TaskModel{}).Error; err != nil {
-		_ = c.Error(err)
-		return
-	}
-	if err = s.params.LocalStore.Where("id = ?", taskGroupID).Delete(&TaskGroupModel{}).Error; err != nil {
+	if err := s.removeGroup(uint(taskGroupID)); err != nil {
 		_ = c.Error(err)
 		return
 	}
+	s.params.Artifacts.Forget(artifactKind, uint(taskGroupID))
 	c.JSON(http.StatusOK, rest.EmptyResponse{})
 }
 
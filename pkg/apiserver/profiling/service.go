@@ -4,6 +4,9 @@ package profiling
 
 import (
 	"context"
+	"errors"
+	"os"
+	"path"
 	"sync"
 	"time"
 
@@ -12,7 +15,11 @@ import (
 	"go.etcd.io/etcd/clientv3"
 	"go.uber.org/fx"
 	"go.uber.org/zap"
+	"gorm.io/gorm"
 
+	"github.com/pingcap/tidb-dashboard/pkg/apiserver/artifact"
+	"github.com/pingcap/tidb-dashboard/pkg/apiserver/job"
+	"github.com/pingcap/tidb-dashboard/pkg/apiserver/metrics"
 	"github.com/pingcap/tidb-dashboard/pkg/apiserver/model"
 	"github.com/pingcap/tidb-dashboard/pkg/config"
 	"github.com/pingcap/tidb-dashboard/pkg/dbstore"
@@ -22,6 +29,11 @@ import (
 
 const (
 	Timeout = 5 * time.Second
+
+	// artifactKind is the kind of profiling results in the artifact manager.
+	artifactKind = "profiling"
+	// jobKind is the kind of profiling task groups in the job manager.
+	jobKind = "profiling"
 )
 
 var (
@@ -36,6 +48,9 @@ type StartRequest struct {
 	Targets                []model.RequestTargetNode `json:"targets"`
 	DurationSecs           uint                      `json:"duration_secs"`
 	RequstedProfilingTypes TaskProfilingTypeList     `json:"requsted_profiling_types"`
+
+	// The trigger rule starting profiling, which is empty when started by the user.
+	triggeredBy string
 }
 
 type StartRequestSession struct {
@@ -47,8 +62,12 @@ type StartRequestSession struct {
 
 type ServiceParams struct {
 	fx.In
+	Config        *config.Config
 	ConfigManager *config.DynamicConfigManager
 	LocalStore    *dbstore.DB
+	Artifacts     *artifact.Manager
+	Jobs          *job.Manager
+	Metrics       *metrics.Service
 
 	HTTPClient *httpc.Client
 	EtcdClient *clientv3.Client
@@ -58,6 +77,8 @@ type ServiceParams struct {
 type Service struct {
 	params       ServiceParams
 	lifecycleCtx context.Context
+	// Profiling results are stored in this directory.
+	dataDir string
 
 	wg            sync.WaitGroup
 	sessionCh     chan *StartRequestSession
@@ -70,15 +91,26 @@ var newService = fx.Provide(func(lc fx.Lifecycle, p ServiceParams, fts *fetchers
 	if err := autoMigrate(p.LocalStore); err != nil {
 		return nil, err
 	}
-	s := &Service{params: p, fetchers: fts}
+	s := &Service{params: p, fetchers: fts, dataDir: path.Join(p.Config.DataDir, "profiling")}
+	if err := os.MkdirAll(s.dataDir, 0o700); err != nil {
+		return nil, err
+	}
+	p.Artifacts.RegisterKind(artifactKind, s.dataDir, s.evictGroup)
+	p.ConfigManager.AddValidator(validateTriggerRules)
+	// Profiling is not resumed after restart, because the profiled duration would not match the request.
+	p.Jobs.RegisterKind(jobKind, job.Kind{Interrupt: s.interruptGroup})
 	lc.Append(fx.Hook{
 		OnStart: func(ctx context.Context) error {
 			s.lifecycleCtx = ctx
-			s.wg.Add(1)
+			s.wg.Add(2)
 			go func() {
 				defer s.wg.Done()
 				s.serviceLoop(ctx)
 			}()
+			go func() {
+				defer s.wg.Done()
+				s.triggerLoop(ctx)
+			}()
 			return nil
 		},
 		OnStop: func(context.Context) error {
@@ -134,7 +166,7 @@ func (s *Service) serviceLoop(ctx context.Context) {
 
 func (s *Service) handleRequest(ctx context.Context, session *StartRequestSession, dc *config.DynamicConfig) {
 	defer close(session.ch)
-	if dc.Profiling.AutoCollectionDurationSecs > 0 {
+	if dc.Profiling.AutoCollectionDurationSecs > 0 && session.req.triggeredBy == "" {
 		session.err = ErrIgnoredRequest.New("automatic collection is enabled")
 		log.Warn("request is ignored", zap.Error(session.err))
 		return
@@ -142,6 +174,23 @@ func (s *Service) handleRequest(ctx context.Context, session *StartRequestSessio
 	session.taskGroup, session.err = s.exclusiveExecute(ctx, &session.req)
 }
 
+// submit starts a task group by the service loop.
+func (s *Service) submit(ctx context.Context, req StartRequest) (*TaskGroup, error) {
+	session := &StartRequestSession{
+		req: req,
+		ch:  make(chan struct{}, 1),
+	}
+	s.sessionCh <- session
+	select {
+	case <-session.ch:
+		return session.taskGroup, session.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-time.After(Timeout):
+		return nil, ErrTimeout.NewWithNoMessage()
+	}
+}
+
 func (s *Service) exclusiveExecute(ctx context.Context, req *StartRequest) (*TaskGroup, error) {
 	if s.lastTaskGroup != nil {
 		if err := s.cancelGroup(s.lastTaskGroup.ID); err != nil {
@@ -153,23 +202,28 @@ func (s *Service) exclusiveExecute(ctx context.Context, req *StartRequest) (*Tas
 }
 
 func (s *Service) startGroup(ctx context.Context, req *StartRequest) (*TaskGroup, error) {
+	for _, profilingType := range req.RequstedProfilingTypes {
+		// profilingTypeMap checks the validation of requestedProfilingType.
+		if _, valid := profilingTypeMap[profilingType]; !valid {
+			return nil, ErrUnsupportedProfilingType.NewWithNoMessage()
+		}
+	}
+	if err := s.params.Artifacts.CheckAvailable(artifactKind); err != nil {
+		log.Warn("failed to start task group", zap.Error(err))
+		return nil, err
+	}
 	taskGroup := NewTaskGroup(s.params.LocalStore, req.DurationSecs, model.NewRequestTargetStatisticsFromArray(&req.Targets), req.RequstedProfilingTypes)
+	taskGroup.TriggeredBy = req.triggeredBy
 	if err := s.params.LocalStore.Create(taskGroup.TaskGroupModel).Error; err != nil {
 		log.Warn("failed to start task group", zap.Error(err))
 		return nil, err
 	}
+	s.params.Jobs.Start(jobKind, taskGroup.ID)
 
 	tasks := make([]*Task, 0, len(req.Targets))
 	for _, target := range req.Targets {
-		profileTypeList := req.RequstedProfilingTypes
-		for _, profilingType := range profileTypeList {
-			// profilingTypeMap checks the validation of requestedProfilingType.
-			_, valid := profilingTypeMap[profilingType]
-			if !valid {
-				return nil, ErrUnsupportedProfilingType.NewWithNoMessage()
-			}
-
-			t := NewTask(ctx, taskGroup, target, s.fetchers, profilingType)
+		for _, profilingType := range req.RequstedProfilingTypes {
+			t := NewTask(ctx, taskGroup, target, s.fetchers, s.dataDir, profilingType)
 			s.params.LocalStore.Create(t.TaskModel)
 			s.tasks.Store(t.ID, t)
 			tasks = append(tasks, t)
@@ -189,6 +243,10 @@ func (s *Service) startGroup(ctx context.Context, req *StartRequest) (*TaskGroup
 			}(i)
 		}
 		wg.Wait()
+		if s.lifecycleCtx.Err() != nil {
+			// The service is stopping, the task group is marked as interrupted after restart.
+			return
+		}
 		errorTasks := 0
 		finishedTasks := 0
 		for _, task := range tasks {
@@ -206,7 +264,12 @@ func (s *Service) startGroup(ctx context.Context, req *StartRequest) (*TaskGroup
 		} else {
 			taskGroup.State = TaskStateFinish
 		}
+		for _, task := range tasks {
+			taskGroup.Size += fileSize(task.FilePath)
+		}
 		s.params.LocalStore.Save(taskGroup.TaskGroupModel)
+		s.params.Artifacts.Record(artifactKind, taskGroup.ID, taskGroup.Size)
+		s.params.Jobs.Finish(jobKind, taskGroup.ID)
 	}()
 
 	return taskGroup, nil
@@ -243,3 +306,95 @@ func (s *Service) cancelGroup(taskGroupID uint) error {
 
 	return nil
 }
+
+// removeGroup removes profiling results and records of a task group.
+func (s *Service) removeGroup(taskGroupID uint) error {
+	var tasks []TaskModel
+	if err := s.params.LocalStore.Where("task_group_id = ?", taskGroupID).Find(&tasks).Error; err != nil {
+		return err
+	}
+	for _, task := range tasks {
+		if task.FilePath != "" {
+			_ = os.Remove(task.FilePath)
+		}
+	}
+	if err := s.params.LocalStore.Where("task_group_id = ?", taskGroupID).Delete(&TaskModel{}).Error; err != nil {
+		return err
+	}
+	if err := s.params.LocalStore.Where("id = ?", taskGroupID).Delete(&TaskGroupModel{}).Error; err != nil {
+		return err
+	}
+	s.params.Jobs.Forget(jobKind, taskGroupID)
+	return nil
+}
+
+// evictGroup removes a finished task group when profiling results exceed the quota or are outdated.
+func (s *Service) evictGroup(taskGroupID uint) error {
+	var taskGroup TaskGroupModel
+	err := s.params.LocalStore.Where("id = ?", taskGroupID).First(&taskGroup).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if taskGroup.State == TaskStateRunning {
+		return artifact.ErrInUse.NewWithNoMessage()
+	}
+	return s.removeGroup(taskGroupID)
+}
+
+func fileSize(filePath string) int64 {
+	if filePath == "" {
+		return 0
+	}
+	if stat, err := os.Stat(filePath); err == nil {
+		return stat.Size()
+	}
+	return 0
+}
+
+// interruptGroup marks a task group left running by the last run as interrupted, keeping finished results.
+func (s *Service) interruptGroup(taskGroupID uint) error {
+	var taskGroup TaskGroupModel
+	err := s.params.LocalStore.Where("id = ?", taskGroupID).First(&taskGroup).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if taskGroup.State != TaskStateRunning {
+		return nil
+	}
+
+	var tasks []TaskModel
+	if err := s.params.LocalStore.Where("task_group_id = ?", taskGroupID).Find(&tasks).Error; err != nil {
+		return err
+	}
+	finishedTasks := 0
+	taskGroup.Size = 0
+	for i := range tasks {
+		task := &tasks[i]
+		switch task.State {
+		case TaskStateRunning:
+			task.State = TaskStateInterrupted
+			task.Error = job.InterruptedError
+			if err := s.params.LocalStore.Save(task).Error; err != nil {
+				return err
+			}
+		case TaskStateFinish:
+			finishedTasks++
+			taskGroup.Size += fileSize(task.FilePath)
+		}
+	}
+	taskGroup.State = TaskStateInterrupted
+	if finishedTasks > 0 {
+		taskGroup.State = TaskStatePartialFinish
+	}
+	if err := s.params.LocalStore.Save(&taskGroup).Error; err != nil {
+		return err
+	}
+	s.params.Artifacts.Record(artifactKind, taskGroup.ID, taskGroup.Size)
+	return nil
+}
@@ -0,0 +1,192 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package profiling
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/pingcap/log"
+	"go.uber.org/zap"
+
+	"github.com/pingcap/tidb-dashboard/pkg/apiserver/model"
+	"github.com/pingcap/tidb-dashboard/pkg/config"
+)
+
+const triggerCheckInterval = 15 * time.Second
+
+// validateTriggerRules checks profiling types of trigger rules, which are not known by the config package.
+func validateTriggerRules(dc *config.DynamicConfig) error {
+	for _, rule := range dc.Profiling.TriggerRules {
+		for _, t := range rule.ProfilingTypes {
+			if _, valid := profilingTypeMap[TaskProfilingType(t)]; !valid {
+				return config.ErrVerificationFailed.New("profiling type %s of trigger rule %s is not supported", t, rule.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// triggerQuery returns the PromQL query of the metric watched by the rule, which returns a value for each instance.
+// The job names are the same as Prometheus deployed by TiUP.
+func triggerQuery(rule *config.ProfilingTriggerRule) string {
+	if rule.Query != "" {
+		return rule.Query
+	}
+	switch rule.Metric {
+	case config.ProfilingTriggerMetricCPU:
+		return fmt.Sprintf(`100 * rate(process_cpu_seconds_total{job="%s"}[1m])`, rule.Component)
+	case config.ProfilingTriggerMetricHeap:
+		if rule.Component == model.NodeKindTiKV {
+			return `sum by (instance) (tikv_allocator_stats{job="tikv",type="allocated"})`
+		}
+		return fmt.Sprintf(`go_memstats_heap_inuse_bytes{job="%s"}`, rule.Component)
+	default:
+		return fmt.Sprintf(`process_resident_memory_bytes{job="%s"}`, rule.Component)
+	}
+}
+
+type triggerKey struct {
+	rule     string
+	instance string
+}
+
+// triggerState tracks how long the metric of each instance has exceeded the threshold of each rule.
+type triggerState struct {
+	exceededSince map[triggerKey]time.Time
+	lastTriggered map[triggerKey]time.Time
+}
+
+func newTriggerState() *triggerState {
+	return &triggerState{
+		exceededSince: map[triggerKey]time.Time{},
+		lastTriggered: map[triggerKey]time.Time{},
+	}
+}
+
+// reset forgets the state of rules not in the list, e.g. after rules are modified.
+func (t *triggerState) reset(rules []config.ProfilingTriggerRule) {
+	names := make(map[string]struct{}, len(rules))
+	for _, r := range rules {
+		names[r.Name] = struct{}{}
+	}
+	for _, m := range []map[triggerKey]time.Time{t.exceededSince, t.lastTriggered} {
+		for key := range m {
+			if _, ok := names[key.rule]; !ok {
+				delete(m, key)
+			}
+		}
+	}
+}
+
+// check updates the state by the current value of each instance, and returns instances to be profiled.
+func (t *triggerState) check(rule *config.ProfilingTriggerRule, values map[string]float64, now time.Time) []string {
+	instances := make([]string, 0, len(values))
+	for instance := range values {
+		instances = append(instances, instance)
+	}
+	sort.Strings(instances)
+
+	triggered := make([]string, 0)
+	for _, instance := range instances {
+		key := triggerKey{rule: rule.Name, instance: instance}
+		if values[instance] <= rule.Threshold {
+			delete(t.exceededSince, key)
+			continue
+		}
+		since, ok := t.exceededSince[key]
+		if !ok {
+			since = now
+			t.exceededSince[key] = now
+		}
+		if now.Sub(since) < time.Duration(rule.ForSecs)*time.Second {
+			continue
+		}
+		if last, ok := t.lastTriggered[key]; ok && now.Sub(last) < time.Duration(rule.CooldownSecs)*time.Second {
+			continue
+		}
+		t.lastTriggered[key] = now
+		triggered = append(triggered, instance)
+	}
+	// Instances without values, e.g. which are down, are considered as not exceeding.
+	for key := range t.exceededSince {
+		if _, ok := values[key.instance]; key.rule == rule.Name && !ok {
+			delete(t.exceededSince, key)
+		}
+	}
+	return triggered
+}
+
+func (s *Service) triggerLoop(ctx context.Context) {
+	cfgCh := s.params.ConfigManager.NewPushChannel()
+	ticker := time.NewTicker(triggerCheckInterval)
+	defer ticker.Stop()
+
+	state := newTriggerState()
+	var rules []config.ProfilingTriggerRule
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case dc, ok := <-cfgCh:
+			if !ok {
+				return
+			}
+			rules = dc.Profiling.TriggerRules
+			state.reset(rules)
+		case <-ticker.C:
+			for i := range rules {
+				s.checkTriggerRule(ctx, &rules[i], state)
+			}
+		}
+	}
+}
+
+func (s *Service) checkTriggerRule(ctx context.Context, rule *config.ProfilingTriggerRule, state *triggerState) {
+	samples, err := s.params.Metrics.QueryInstant(ctx, triggerQuery(rule))
+	if err != nil {
+		log.Warn("Failed to check profiling trigger rule", zap.String("rule", rule.Name), zap.Error(err))
+		return
+	}
+	values := make(map[string]float64, len(samples))
+	for _, sample := range samples {
+		instance := sample.Metric["instance"]
+		if instance == "" {
+			continue
+		}
+		if v, ok := values[instance]; !ok || sample.Value > v {
+			values[instance] = sample.Value
+		}
+	}
+
+	for _, instance := range state.check(rule, values, time.Now()) {
+		host, portStr, err := net.SplitHostPort(instance)
+		if err != nil {
+			log.Warn("Invalid instance of profiling trigger rule", zap.String("rule", rule.Name), zap.String("instance", instance))
+			continue
+		}
+		port, err := strconv.Atoi(portStr)
+		if err != nil {
+			log.Warn("Invalid instance of profiling trigger rule", zap.String("rule", rule.Name), zap.String("instance", instance))
+			continue
+		}
+		types := make(TaskProfilingTypeList, 0, len(rule.ProfilingTypes))
+		for _, t := range rule.ProfilingTypes {
+			types = append(types, TaskProfilingType(t))
+		}
+		req := StartRequest{
+			Targets:                []model.RequestTargetNode{{Kind: rule.Component, DisplayName: instance, IP: host, Port: port}},
+			DurationSecs:           rule.DurationSecs,
+			RequstedProfilingTypes: types,
+			triggeredBy:            fmt.Sprintf("%s: %g > %g", rule.Name, values[instance], rule.Threshold),
+		}
+		log.Info("Profiling is triggered", zap.String("rule", rule.Name), zap.String("instance", instance), zap.Float64("value", values[instance]))
+		if _, err := s.submit(ctx, req); err != nil {
+			log.Warn("Failed to start triggered profiling", zap.String("rule", rule.Name), zap.Error(err))
+		}
+	}
+}
@@ -0,0 +1,77 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package profiling
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/pingcap/tidb-dashboard/pkg/apiserver/model"
+	"github.com/pingcap/tidb-dashboard/pkg/config"
+)
+
+func TestTriggerState(t *testing.T) {
+	rule := &config.ProfilingTriggerRule{
+		Name:         "cpu",
+		Component:    model.NodeKindTiDB,
+		Metric:       config.ProfilingTriggerMetricCPU,
+		Threshold:    80,
+		ForSecs:      120,
+		CooldownSecs: 600,
+		DurationSecs: 30,
+	}
+	state := newTriggerState()
+	now := time.Unix(1600000000, 0)
+	at := func(secs int) time.Time {
+		return now.Add(time.Duration(secs) * time.Second)
+	}
+
+	require.Empty(t, state.check(rule, map[string]float64{"a:10080": 90, "b:10080": 10}, at(0)))
+	require.Empty(t, state.check(rule, map[string]float64{"a:10080": 90, "b:10080": 90}, at(60)))
+	require.Equal(t, []string{"a:10080"}, state.check(rule, map[string]float64{"a:10080": 90, "b:10080": 90}, at(120)))
+	// Dropping below the threshold resets the duration
+	require.Empty(t, state.check(rule, map[string]float64{"a:10080": 90, "b:10080": 50}, at(180)))
+	require.Empty(t, state.check(rule, map[string]float64{"a:10080": 90, "b:10080": 90}, at(240)))
+	require.Empty(t, state.check(rule, map[string]float64{"a:10080": 90}, at(300)))
+	require.Empty(t, state.check(rule, map[string]float64{"a:10080": 90, "b:10080": 90}, at(360)))
+	require.Equal(t, []string{"b:10080"}, state.check(rule, map[string]float64{"a:10080": 90, "b:10080": 90}, at(480)))
+	// Cooldown
+	require.Empty(t, state.check(rule, map[string]float64{"a:10080": 90}, at(690)))
+	require.Equal(t, []string{"a:10080"}, state.check(rule, map[string]float64{"a:10080": 90}, at(720)))
+
+	state.reset(nil)
+	require.Empty(t, state.exceededSince)
+	require.Empty(t, state.lastTriggered)
+}
+
+func TestTriggerQuery(t *testing.T) {
+	require.Equal(t, `100 * rate(process_cpu_seconds_total{job="pd"}[1m])`, triggerQuery(&config.ProfilingTriggerRule{
+		Component: model.NodeKindPD,
+		Metric:    config.ProfilingTriggerMetricCPU,
+	}))
+	require.Equal(t, `go_memstats_heap_inuse_bytes{job="tidb"}`, triggerQuery(&config.ProfilingTriggerRule{
+		Component: model.NodeKindTiDB,
+		Metric:    config.ProfilingTriggerMetricHeap,
+	}))
+	require.Equal(t, `up`, triggerQuery(&config.ProfilingTriggerRule{
+		Component: model.NodeKindTiDB,
+		Metric:    config.ProfilingTriggerMetricHeap,
+		Query:     "up",
+	}))
+}
+
+func TestValidateTriggerRules(t *testing.T) {
+	dc := &config.DynamicConfig{}
+	dc.Profiling.TriggerRules = []config.ProfilingTriggerRule{{
+		Name:           "cpu",
+		ProfilingTypes: []string{"cpu", "goroutin"},
+	}}
+	err := validateTriggerRules(dc)
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "profiling type goroutin of trigger rule cpu")
+
+	dc.Profiling.TriggerRules[0].ProfilingTypes = []string{"cpu", "goroutine"}
+	require.Nil(t, validateTriggerRules(dc))
+}
@@ -48,7 +48,7 @@ func RegisterRouter(r *gin.RouterGroup, auth *user.AuthService, s *Service) {
 	endpoint.Use(auth.MWAuthRequired())
 	endpoint.Use(utils.MWConnectTiDB(s.params.TiDBClient))
 	endpoint.Use(utils.MWForbidByExperimentalFlag(s.params.Config.EnableExperimental))
-	endpoint.POST("/run", auth.MWRequireWritePriv(), s.runHandler)
+	endpoint.POST("/run", auth.MWRequirePermission(user.PermQueryEditorRun), s.runHandler)
 }
 
 type RunRequest struct {
@@ -0,0 +1,127 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package slowquery
+
+import (
+	"github.com/thoas/go-funk"
+	"gorm.io/gorm"
+
+	"github.com/pingcap/tidb-dashboard/util/gormutil/virtualview"
+)
+
+// GroupModel is an aggregated view of slow queries. Only the field of the group dimension is filled.
+// Column names are in lower case so that results of the virtual view projections can be scanned back.
+type GroupModel struct {
+	Digest     string `gorm:"column:digest" json:"digest,omitempty"`
+	User       string `gorm:"column:user" json:"user,omitempty"`
+	DB         string `gorm:"column:db" json:"db,omitempty"`
+	Instance   string `gorm:"column:instance" json:"instance,omitempty"`
+	PlanDigest string `gorm:"column:plan_digest" json:"plan_digest,omitempty"`
+
+	// Only available when grouping by digest.
+	QuerySample string `gorm:"column:query_sample" vexpr:"ANY_VALUE(Query)" json:"query_sample,omitempty"`
+
+	Count        int     `gorm:"column:count" vexpr:"COUNT(Query_time)" json:"count"`
+	SumQueryTime float64 `gorm:"column:sum_query_time" vexpr:"SUM(Query_time)" json:"sum_query_time"`
+	AvgQueryTime float64 `gorm:"column:avg_query_time" vexpr:"AVG(Query_time)" json:"avg_query_time"`
+	MaxQueryTime float64 `gorm:"column:max_query_time" vexpr:"MAX(Query_time)" json:"max_query_time"`
+	// Only available in TiDB >= 5.0, which supports APPROX_PERCENTILE.
+	P99QueryTime float64 `gorm:"column:p99_query_time" vexpr:"APPROX_PERCENTILE(Query_time, 99)" json:"p99_query_time,omitempty"`
+	MaxMemory    int     `gorm:"column:max_memory" vexpr:"MAX(Mem_max)" json:"max_memory"`
+	FirstSeen    float64 `gorm:"column:first_seen" vexpr:"(UNIX_TIMESTAMP(MIN(Time)) + 0E0)" json:"first_seen"`
+	LastSeen     float64 `gorm:"column:last_seen" vexpr:"(UNIX_TIMESTAMP(MAX(Time)) + 0E0)" json:"last_seen"`
+}
+
+var groupView = virtualview.MustNew(GroupModel{})
+
+// groupByColumns maps the supported group dimensions to the slow query table columns.
+var groupByColumns = map[string]string{
+	"digest":      "Digest",
+	"user":        "User",
+	"db":          "DB",
+	"instance":    "INSTANCE",
+	"plan_digest": "Plan_digest",
+}
+
+var groupAggFields = []string{
+	"count",
+	"sum_query_time",
+	"avg_query_time",
+	"max_query_time",
+	"p99_query_time",
+	"max_memory",
+	"first_seen",
+	"last_seen",
+}
+
+type GetGroupRequest struct {
+	BeginTime int      `json:"begin_time" form:"begin_time"`
+	EndTime   int      `json:"end_time" form:"end_time"`
+	GroupBy   string   `json:"group_by" form:"group_by"` // values: digest (default), user, db, instance, plan_digest
+	DB        []string `json:"db" form:"db"`
+	Limit     int      `json:"limit" form:"limit"`
+	OrderBy   string   `json:"orderBy" form:"orderBy"` // default: sum_query_time
+	IsDesc    bool     `json:"desc" form:"desc"`
+}
+
+func (s *Service) querySlowLogGroups(db *gorm.DB, req *GetGroupRequest) ([]GroupModel, error) {
+	tableColumns, err := s.params.SysSchema.GetTableColumnNames(db, slowQueryTable)
+	if err != nil {
+		return nil, err
+	}
+	return buildSlowLogGroupQuery(db, tableColumns, req, s.featureFlagGroupP99.IsSupported())
+}
+
+func buildSlowLogGroupQuery(db *gorm.DB, tableColumns []string, req *GetGroupRequest, withP99 bool) ([]GroupModel, error) {
+	if req.GroupBy == "" {
+		req.GroupBy = "digest"
+	}
+	groupColumn, ok := groupByColumns[req.GroupBy]
+	if !ok {
+		return nil, ErrUnknownColumn.New("unknown group by %s", req.GroupBy)
+	}
+	// Plan digest is not available in old TiDB versions.
+	if !funk.ContainsString(tableColumns, groupColumn) {
+		return nil, ErrUnknownColumn.New("group by %s is not supported in the current version TiDB schema", req.GroupBy)
+	}
+	if req.OrderBy == "" {
+		req.OrderBy = "sum_query_time"
+	}
+	if req.OrderBy == "p99_query_time" && !withP99 {
+		return nil, ErrUnknownColumn.New("order by p99_query_time is not supported in the current version TiDB")
+	}
+
+	fields := make([]string, 0, len(groupAggFields)+1)
+	fields = append(fields, req.GroupBy)
+	for _, f := range groupAggFields {
+		if f == "p99_query_time" && !withP99 {
+			continue
+		}
+		fields = append(fields, f)
+	}
+	if req.GroupBy == "digest" {
+		fields = append(fields, "query_sample")
+	}
+	groupView.SetSourceDBColumns(tableColumns)
+	clauses := groupView.Clauses(fields)
+
+	tx := db.
+		Table(slowQueryTable).
+		Clauses(clauses.Select()).
+		Where("Time BETWEEN FROM_UNIXTIME(?) AND FROM_UNIXTIME(?)", req.BeginTime, req.EndTime)
+	if len(req.DB) > 0 {
+		tx = tx.Where("DB IN (?)", req.DB)
+	}
+	tx = tx.
+		Group(groupColumn).
+		Clauses(clauses.OrderBy([]virtualview.OrderByField{{JSONFieldName: req.OrderBy, IsDesc: req.IsDesc}}))
+	if req.Limit > 0 {
+		tx = tx.Limit(req.Limit)
+	}
+
+	var results []GroupModel
+	if err := tx.Find(&results).Error; err != nil {
+		return nil, err
+	}
+	return results, nil
+}
@@ -0,0 +1,90 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package slowquery
+
+import (
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pingcap/tidb-dashboard/util/testutil"
+)
+
+var testTableColumns = []string{"INSTANCE", "Time", "Digest", "Query", "Query_time", "Mem_max", "DB", "User"}
+
+func TestBuildSlowLogGroupQuery(t *testing.T) {
+	db := testutil.OpenMockDB(t)
+	defer db.MustClose()
+
+	db.Mocker().
+		ExpectQuery("SELECT `user`,COUNT(Query_time) AS count,SUM(Query_time) AS sum_query_time,AVG(Query_time) AS avg_query_time,MAX(Query_time) AS max_query_time,"+
+			"APPROX_PERCENTILE(Query_time, 99) AS p99_query_time,MAX(Mem_max) AS max_memory,(UNIX_TIMESTAMP(MIN(Time)) + 0E0) AS first_seen,"+
+			"(UNIX_TIMESTAMP(MAX(Time)) + 0E0) AS last_seen "+
+			"FROM `INFORMATION_SCHEMA`.`CLUSTER_SLOW_QUERY` WHERE (Time BETWEEN FROM_UNIXTIME(?) AND FROM_UNIXTIME(?)) "+
+			"AND DB IN (?,?) GROUP BY `User` ORDER BY `max_memory` DESC LIMIT 10").
+		WithArgs(100, 200, "a", "b").
+		WillReturnRows(sqlmock.NewRows([]string{"user", "count", "max_memory"}).AddRow("root", 5, 1024))
+	results, err := buildSlowLogGroupQuery(db.Gorm(), testTableColumns, &GetGroupRequest{
+		BeginTime: 100,
+		EndTime:   200,
+		GroupBy:   "user",
+		DB:        []string{"a", "b"},
+		Limit:     10,
+		OrderBy:   "max_memory",
+		IsDesc:    true,
+	}, true)
+	require.Nil(t, err)
+	require.Equal(t, []GroupModel{{User: "root", Count: 5, MaxMemory: 1024}}, results)
+	db.MustMeetMockExpectation()
+}
+
+func TestBuildSlowLogGroupQueryByDigest(t *testing.T) {
+	db := testutil.OpenMockDB(t)
+	defer db.MustClose()
+
+	db.Mocker().
+		ExpectQuery("SELECT `digest`,COUNT(Query_time) AS count,SUM(Query_time) AS sum_query_time,AVG(Query_time) AS avg_query_time,MAX(Query_time) AS max_query_time,"+
+			"APPROX_PERCENTILE(Query_time, 99) AS p99_query_time,MAX(Mem_max) AS max_memory,(UNIX_TIMESTAMP(MIN(Time)) + 0E0) AS first_seen,"+
+			"(UNIX_TIMESTAMP(MAX(Time)) + 0E0) AS last_seen,ANY_VALUE(Query) AS query_sample "+
+			"FROM `INFORMATION_SCHEMA`.`CLUSTER_SLOW_QUERY` WHERE Time BETWEEN FROM_UNIXTIME(?) AND FROM_UNIXTIME(?) "+
+			"GROUP BY `Digest` ORDER BY `sum_query_time`").
+		WithArgs(0, 0).
+		WillReturnRows(sqlmock.NewRows([]string{"digest", "query_sample", "sum_query_time"}).AddRow("d", "select 1", 1.5))
+	results, err := buildSlowLogGroupQuery(db.Gorm(), testTableColumns, &GetGroupRequest{}, true)
+	require.Nil(t, err)
+	require.Equal(t, []GroupModel{{Digest: "d", QuerySample: "select 1", SumQueryTime: 1.5}}, results)
+	db.MustMeetMockExpectation()
+}
+
+func TestBuildSlowLogGroupQueryWithoutP99(t *testing.T) {
+	db := testutil.OpenMockDB(t)
+	defer db.MustClose()
+
+	db.Mocker().
+		ExpectQuery("SELECT `db`,COUNT(Query_time) AS count,SUM(Query_time) AS sum_query_time,AVG(Query_time) AS avg_query_time,MAX(Query_time) AS max_query_time,"+
+			"MAX(Mem_max) AS max_memory,(UNIX_TIMESTAMP(MIN(Time)) + 0E0) AS first_seen,"+
+			"(UNIX_TIMESTAMP(MAX(Time)) + 0E0) AS last_seen "+
+			"FROM `INFORMATION_SCHEMA`.`CLUSTER_SLOW_QUERY` WHERE Time BETWEEN FROM_UNIXTIME(?) AND FROM_UNIXTIME(?) "+
+			"GROUP BY `DB` ORDER BY `sum_query_time`").
+		WithArgs(0, 0).
+		WillReturnRows(sqlmock.NewRows([]string{"db", "count"}).AddRow("test", 2))
+	results, err := buildSlowLogGroupQuery(db.Gorm(), testTableColumns, &GetGroupRequest{GroupBy: "db"}, false)
+	require.Nil(t, err)
+	require.Equal(t, []GroupModel{{DB: "test", Count: 2}}, results)
+	db.MustMeetMockExpectation()
+}
+
+func TestBuildSlowLogGroupQueryInvalid(t *testing.T) {
+	db := testutil.OpenMockDB(t)
+	defer db.MustClose()
+
+	_, err := buildSlowLogGroupQuery(db.Gorm(), testTableColumns, &GetGroupRequest{GroupBy: "foo"}, true)
+	require.NotNil(t, err)
+	// Plan_digest is not in the table
+	_, err = buildSlowLogGroupQuery(db.Gorm(), testTableColumns, &GetGroupRequest{GroupBy: "plan_digest"}, true)
+	require.NotNil(t, err)
+	// P99 is not available in TiDB < 5.0
+	_, err = buildSlowLogGroupQuery(db.Gorm(), testTableColumns, &GetGroupRequest{OrderBy: "p99_query_time"}, false)
+	require.NotNil(t, err)
+}
@@ -36,6 +36,20 @@ type GetDetailRequest struct {
 }
 
 func (s *Service) querySlowLogList(db *gorm.DB, req *GetListRequest) ([]Model, error) {
+	tx, err := s.buildSlowLogListQuery(db, req)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []Model
+	err = tx.Find(&results).Error
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+func (s *Service) buildSlowLogListQuery(db *gorm.DB, req *GetListRequest) (*gorm.DB, error) {
 	tableColumns, err := s.params.SysSchema.GetTableColumnNames(db, slowQueryTable)
 	if err != nil {
 		return nil, err
@@ -94,12 +108,7 @@ func (s *Service) querySlowLogList(db *gorm.DB, req *GetListRequest) ([]Model, e
 		tx = tx.Where("Digest = ?", req.Digest)
 	}
 
-	var results []Model
-	err = tx.Find(&results).Error
-	if err != nil {
-		return nil, err
-	}
-	return results, nil
+	return tx, nil
 }
 
 func (s *Service) querySlowLogDetail(db *gorm.DB, req *GetDetailRequest) (*Model, error) {
@@ -17,7 +17,9 @@ import (
 	"github.com/pingcap/tidb-dashboard/pkg/apiserver/utils"
 	"github.com/pingcap/tidb-dashboard/pkg/tidb"
 	commonUtils "github.com/pingcap/tidb-dashboard/pkg/utils"
+	"github.com/pingcap/tidb-dashboard/util/featureflag"
 	"github.com/pingcap/tidb-dashboard/util/rest"
+	"github.com/pingcap/tidb-dashboard/util/rest/fileswap"
 )
 
 var (
@@ -27,16 +29,25 @@ var (
 
 type ServiceParams struct {
 	fx.In
-	TiDBClient *tidb.Client
-	SysSchema  *commonUtils.SysSchema
+	TiDBClient   *tidb.Client
+	SysSchema    *commonUtils.SysSchema
+	FeatureFlags *featureflag.Registry
 }
 
 type Service struct {
 	params ServiceParams
+	fSwap  *fileswap.Handler
+
+	// APPROX_PERCENTILE is only supported since TiDB 5.0.
+	featureFlagGroupP99 *featureflag.FeatureFlag
 }
 
 func newService(p ServiceParams) *Service {
-	return &Service{params: p}
+	return &Service{
+		params:              p,
+		fSwap:               fileswap.New(),
+		featureFlagGroupP99: p.FeatureFlags.Register("slow_query_group_p99", ">= 5.0.0"),
+	}
 }
 
 func registerRouter(r *gin.RouterGroup, auth *user.AuthService, s *Service) {
@@ -45,10 +56,12 @@ func registerRouter(r *gin.RouterGroup, auth *user.AuthService, s *Service) {
 		endpoint.GET("/download", s.downloadHandler)
 
 		endpoint.Use(auth.MWAuthRequired())
+		endpoint.Use(auth.MWRequirePermission(user.PermSlowQueryView))
 		endpoint.Use(utils.MWConnectTiDB(s.params.TiDBClient))
 		{
 			endpoint.GET("/list", s.getList)
 			endpoint.GET("/detail", s.getDetails)
+			endpoint.GET("/group", s.getGroups)
 
 			endpoint.POST("/download/token", s.downloadTokenHandler)
 
@@ -80,6 +93,29 @@ func (s *Service) getList(c *gin.Context) {
 	c.JSON(http.StatusOK, results)
 }
 
+// @Summary Aggregate slow queries by digest, user, db, instance or plan digest
+// @Param q query GetGroupRequest true "Query"
+// @Success 200 {array} GroupModel
+// @Router /slow_query/group [get]
+// @Security JwtAuth
+// @Failure 400 {object} rest.ErrorResponse
+// @Failure 401 {object} rest.ErrorResponse
+func (s *Service) getGroups(c *gin.Context) {
+	var req GetGroupRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		_ = c.Error(rest.ErrBadRequest.NewWithNoMessage())
+		return
+	}
+
+	db := utils.GetTiDBConnection(c)
+	results, err := s.querySlowLogGroups(db, &req)
+	if err != nil {
+		_ = c.Error(rest.ErrBadRequest.WrapWithNoMessage(err))
+		return
+	}
+	c.JSON(http.StatusOK, results)
+}
+
 // @Summary Get details of a slow query
 // @Param q query GetDetailRequest true "Query"
 // @Success 200 {object} Model
@@ -102,67 +138,67 @@ func (s *Service) getDetails(c *gin.Context) {
 	c.JSON(http.StatusOK, *result)
 }
 
+type ExportRequest struct {
+	GetListRequest
+	Format utils.ExportFormat `json:"format"` // values: csv (default), ndjson, parquet
+}
+
 // @Router /slow_query/download/token [post]
 // @Summary Generate a download token for exported slow query statements
 // @Produce plain
-// @Param request body GetListRequest true "Request body"
+// @Param request body ExportRequest true "Request body"
 // @Success 200 {string} string "xxx"
 // @Security JwtAuth
 // @Failure 400 {object} rest.ErrorResponse
 // @Failure 401 {object} rest.ErrorResponse
 func (s *Service) downloadTokenHandler(c *gin.Context) {
-	var req GetListRequest
+	var req ExportRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		_ = c.Error(rest.ErrBadRequest.NewWithNoMessage())
 		return
 	}
+	if req.Format == "" {
+		req.Format = utils.ExportFormatCSV
+	}
+	if !req.Format.IsValid() {
+		_ = c.Error(rest.ErrBadRequest.New("Unsupported export format %s", req.Format))
+		return
+	}
 	db := utils.GetTiDBConnection(c)
 	fields := []string{}
 	if strings.TrimSpace(req.Fields) != "" {
 		fields = strings.Split(req.Fields, ",")
 	}
-	list, err := s.querySlowLogList(db, &req)
+	tx, err := s.buildSlowLogListQuery(db, &req.GetListRequest)
 	if err != nil {
 		_ = c.Error(rest.ErrBadRequest.NewWithNoMessage())
 		return
 	}
-	if len(list) == 0 {
-		_ = c.Error(ErrNoData.NewWithNoMessage())
-		return
-	}
-
-	// interface{} tricky
-	rawData := make([]interface{}, len(list))
-	for i, v := range list {
-		rawData[i] = v
-	}
 
-	// convert data
-	csvData := utils.GenerateCSVFromRaw(rawData, fields, []string{})
-
-	// generate temp file that persist encrypted data
 	timeLayout := "0102150405"
 	beginTime := time.Unix(int64(req.BeginTime), 0).Format(timeLayout)
 	endTime := time.Unix(int64(req.EndTime), 0).Format(timeLayout)
-	token, err := utils.ExportCSV(csvData,
-		fmt.Sprintf("slowquery_%s_%s_*.csv", beginTime, endTime),
-		"slowquery/download")
+	token, err := utils.StreamExport(s.fSwap, tx, &Model{}, fields, req.Format,
+		fmt.Sprintf("slowquery_%s_%s", beginTime, endTime))
 	if err != nil {
 		_ = c.Error(err)
 		return
 	}
+	if token == "" {
+		_ = c.Error(ErrNoData.NewWithNoMessage())
+		return
+	}
 	c.String(http.StatusOK, token)
 }
 
 // @Router /slow_query/download [get]
 // @Summary Download slow query statements
-// @Produce text/csv
+// @Produce octet-stream
 // @Param token query string true "download token"
 // @Failure 400 {object} rest.ErrorResponse
 // @Failure 401 {object} rest.ErrorResponse
 func (s *Service) downloadHandler(c *gin.Context) {
-	token := c.Query("token")
-	utils.DownloadByToken(token, "slowquery/download", c)
+	s.fSwap.HandleDownloadRequest(c)
 }
 
 // @Summary Query table columns
@@ -0,0 +1,259 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package statement
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pingcap/log"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/pingcap/tidb-dashboard/pkg/apiserver/utils"
+	"github.com/pingcap/tidb-dashboard/pkg/dbstore"
+)
+
+const (
+	archiveCheckInterval        = 5 * time.Minute
+	archiveTableName            = "statements_summary_archive"
+	defaultArchiveSchema        = "tidb_dashboard"
+	defaultArchiveRetentionDays = 30
+	maxArchiveRetentionDays     = 366
+	// Expired rows are deleted in batches to avoid huge transactions in TiDB.
+	archiveDeleteBatchSize = 10000
+)
+
+var archiveSchemaNameRegex = regexp.MustCompile(`^[A-Za-z0-9_]{1,64}$`)
+
+// ArchiveConfig controls the statement archiver, which periodically copies finished statement summary windows
+// from TiDB's statement summary history into a regular table in TiDB, so that statements can be queried
+// beyond `tidb_stmt_summary_history_size`. There is at most one config.
+type ArchiveConfig struct {
+	ID            uint   `gorm:"primary_key" json:"-"`
+	Enable        bool   `json:"enable"`
+	SchemaName    string `gorm:"size:64" json:"schema_name"`
+	RetentionDays int    `json:"retention_days"`
+	// Statements are archived in background using this SQL credential, which is specified in the config instead of
+	// taken from any signed in user. The password is encrypted by the master key of the local store (see
+	// `dbstore.DB.EncryptSecret`). Use a SQL user with only the privileges required by archiving.
+	SQLUser       string `gorm:"size:128" json:"sql_user"`
+	EncryptedPass string `gorm:"type:text" json:"-"`
+	// Unix seconds.
+	LastArchivedAt int64  `json:"last_archived_at"`
+	LastError      string `gorm:"type:text" json:"last_error"`
+}
+
+func (ArchiveConfig) TableName() string {
+	return "statement_archive_configs"
+}
+
+func (cfg *ArchiveConfig) isValid() bool {
+	return archiveSchemaNameRegex.MatchString(cfg.SchemaName) &&
+		cfg.RetentionDays > 0 && cfg.RetentionDays <= maxArchiveRetentionDays
+}
+
+func (cfg *ArchiveConfig) archiveTable() string {
+	return fmt.Sprintf("%s.%s", cfg.SchemaName, archiveTableName)
+}
+
+func autoMigrate(db *dbstore.DB) error {
+	return db.AutoMigrate(&ArchiveConfig{})
+}
+
+// getArchiveConfig returns the stored archive config, or a default (disabled) one if it is never configured.
+func getArchiveConfig(db *dbstore.DB) (*ArchiveConfig, error) {
+	cfg := &ArchiveConfig{}
+	err := db.First(cfg).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return &ArchiveConfig{
+			SchemaName:    defaultArchiveSchema,
+			RetentionDays: defaultArchiveRetentionDays,
+		}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+type archiveColumn struct {
+	Field string `gorm:"column:Field"`
+	Type  string `gorm:"column:Type"`
+}
+
+func describeTable(db *gorm.DB, table string) ([]archiveColumn, error) {
+	var cs []archiveColumn
+	err := db.Raw(fmt.Sprintf("DESC %s", table)).Scan(&cs).Error // #nosec
+	return cs, err
+}
+
+// ensureArchiveTable creates the archive table if it does not exist, and adds columns that are newly introduced
+// in the statement summary table, e.g. after TiDB is upgraded. The column names of the archive table are returned.
+func ensureArchiveTable(db *gorm.DB, schemaName string) ([]string, error) {
+	sourceColumns, err := describeTable(db, statementsTable)
+	if err != nil {
+		return nil, err
+	}
+	table := fmt.Sprintf("`%s`.`%s`", schemaName, archiveTableName)
+
+	if err := db.Exec(fmt.Sprintf("CREATE DATABASE IF NOT EXISTS `%s`", schemaName)).Error; err != nil {
+		return nil, err
+	}
+	defs := make([]string, 0, len(sourceColumns)+2)
+	for _, c := range sourceColumns {
+		defs = append(defs, fmt.Sprintf("`%s` %s NULL", c.Field, c.Type))
+	}
+	defs = append(defs,
+		"KEY `idx_summary_end_time` (`summary_end_time`)",
+		"KEY `idx_digest` (`digest`)")
+	err = db.Exec(fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (%s)", table, strings.Join(defs, ", "))).Error // #nosec
+	if err != nil {
+		return nil, err
+	}
+
+	archiveColumns, err := describeTable(db, table)
+	if err != nil {
+		return nil, err
+	}
+	existing := make(map[string]struct{}, len(archiveColumns))
+	for _, c := range archiveColumns {
+		existing[strings.ToLower(c.Field)] = struct{}{}
+	}
+	columns := make([]string, 0, len(sourceColumns))
+	for _, c := range sourceColumns {
+		if _, ok := existing[strings.ToLower(c.Field)]; !ok {
+			err := db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN `%s` %s NULL", table, c.Field, c.Type)).Error // #nosec
+			if err != nil {
+				return nil, err
+			}
+		}
+		columns = append(columns, c.Field)
+	}
+	return columns, nil
+}
+
+// archiveStatements copies statement summary windows that are finished and not yet archived into the archive
+// table, then removes archived windows exceeding the retention.
+func archiveStatements(db *gorm.DB, cfg *ArchiveConfig) error {
+	columns, err := ensureArchiveTable(db, cfg.SchemaName)
+	if err != nil {
+		return err
+	}
+	table := fmt.Sprintf("`%s`.`%s`", cfg.SchemaName, archiveTableName)
+
+	// Windows are immutable once finished, so the latest archived window is used as the watermark.
+	var watermark sql.NullFloat64
+	err = db.Raw(fmt.Sprintf("SELECT UNIX_TIMESTAMP(MAX(summary_end_time)) FROM %s", table)).Row().Scan(&watermark) // #nosec
+	if err != nil {
+		return err
+	}
+
+	columnList := "`" + strings.Join(columns, "`, `") + "`"
+	err = db.Exec(fmt.Sprintf(
+		"INSERT INTO %s (%s) SELECT %s FROM %s WHERE summary_end_time > FROM_UNIXTIME(?) AND summary_end_time <= NOW()",
+		table, columnList, columnList, statementsTable), int64(watermark.Float64)).Error // #nosec
+	if err != nil {
+		return err
+	}
+
+	for {
+		result := db.Exec(fmt.Sprintf("DELETE FROM %s WHERE summary_end_time < DATE_SUB(NOW(), INTERVAL ? DAY) LIMIT ?", table), // #nosec
+			cfg.RetentionDays, archiveDeleteBatchSize)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected < archiveDeleteBatchSize {
+			return nil
+		}
+	}
+}
+
+func (s *Service) archiveLoop(ctx context.Context) {
+	ticker := time.NewTicker(archiveCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.runArchive(ctx)
+		}
+	}
+}
+
+// openArchiveConn opens a SQL connection using the SQL credential in the archive config.
+func (s *Service) openArchiveConn(cfg *ArchiveConfig) (*gorm.DB, error) {
+	if cfg.SQLUser == "" {
+		return nil, ErrArchiveNotConfigured.New("SQL user of statement archive is not specified")
+	}
+	pass, err := s.params.LocalStore.DecryptSecret(cfg.EncryptedPass)
+	if err != nil {
+		return nil, err
+	}
+	return s.params.TiDBClient.OpenSQLConn(cfg.SQLUser, pass)
+}
+
+// verifyArchiveConn checks whether the archive SQL user is able to create the archive table.
+func (s *Service) verifyArchiveConn(cfg *ArchiveConfig) error {
+	db, err := s.openArchiveConn(cfg)
+	if err != nil {
+		return err
+	}
+	defer utils.CloseTiDBConnection(db) //nolint:errcheck
+	_, err = ensureArchiveTable(db, cfg.SchemaName)
+	return err
+}
+
+func (s *Service) runArchive(ctx context.Context) {
+	cfg, err := getArchiveConfig(s.params.LocalStore)
+	if err != nil {
+		log.Warn("Failed to load statement archive config", zap.Error(err))
+		return
+	}
+	if !cfg.Enable || !cfg.isValid() {
+		return
+	}
+
+	err = func() error {
+		db, err := s.openArchiveConn(cfg)
+		if err != nil {
+			return err
+		}
+		defer utils.CloseTiDBConnection(db) //nolint:errcheck
+		return archiveStatements(db.WithContext(ctx), cfg)
+	}()
+
+	lastError := ""
+	if err != nil {
+		log.Warn("Failed to archive statements", zap.Error(err))
+		lastError = err.Error()
+	}
+	err = s.params.LocalStore.Model(cfg).Updates(map[string]interface{}{
+		"last_archived_at": time.Now().Unix(),
+		"last_error":       lastError,
+	}).Error
+	if err != nil {
+		log.Warn("Failed to update statement archive config", zap.Error(err))
+	}
+}
+
+// getSourceTable returns the table to query statements from.
+func (s *Service) getSourceTable(fromArchive bool) (string, error) {
+	if !fromArchive {
+		return statementsTable, nil
+	}
+	cfg, err := getArchiveConfig(s.params.LocalStore)
+	if err != nil {
+		return "", err
+	}
+	if cfg.ID == 0 {
+		return "", ErrArchiveNotConfigured.New("statement archive is not configured")
+	}
+	return cfg.archiveTable(), nil
+}
@@ -0,0 +1,76 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package statement
+
+import (
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/joomcode/errorx"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pingcap/tidb-dashboard/util/testutil"
+)
+
+func TestArchiveConfigIsValid(t *testing.T) {
+	cfg := ArchiveConfig{SchemaName: defaultArchiveSchema, RetentionDays: defaultArchiveRetentionDays}
+	require.True(t, cfg.isValid())
+	require.Equal(t, "tidb_dashboard.statements_summary_archive", cfg.archiveTable())
+
+	cfg.SchemaName = "foo`; DROP DATABASE bar"
+	require.False(t, cfg.isValid())
+
+	cfg.SchemaName = defaultArchiveSchema
+	cfg.RetentionDays = 0
+	require.False(t, cfg.isValid())
+}
+
+func TestOpenArchiveConnWithoutSQLUser(t *testing.T) {
+	s := &Service{}
+	_, err := s.openArchiveConn(&ArchiveConfig{SchemaName: defaultArchiveSchema, RetentionDays: defaultArchiveRetentionDays})
+	require.True(t, errorx.IsOfType(err, ErrArchiveNotConfigured))
+}
+
+func TestArchiveStatements(t *testing.T) {
+	db := testutil.OpenMockDB(t)
+	defer db.MustClose()
+
+	mock := db.Mocker()
+	mock.ExpectQuery("DESC INFORMATION_SCHEMA.CLUSTER_STATEMENTS_SUMMARY_HISTORY").
+		WillReturnRows(sqlmock.NewRows([]string{"Field", "Type"}).
+			AddRow("SUMMARY_END_TIME", "timestamp").
+			AddRow("DIGEST", "varchar(64)").
+			AddRow("EXEC_COUNT", "bigint(20) unsigned"))
+	mock.ExpectExec("CREATE DATABASE IF NOT EXISTS `tidb_dashboard`").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("CREATE TABLE IF NOT EXISTS `tidb_dashboard`.`statements_summary_archive` (" +
+		"`SUMMARY_END_TIME` timestamp NULL, `DIGEST` varchar(64) NULL, `EXEC_COUNT` bigint(20) unsigned NULL, " +
+		"KEY `idx_summary_end_time` (`summary_end_time`), KEY `idx_digest` (`digest`))").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	// EXEC_COUNT is missing in the archive table, e.g. newly added after TiDB is upgraded
+	mock.ExpectQuery("DESC `tidb_dashboard`.`statements_summary_archive`").
+		WillReturnRows(sqlmock.NewRows([]string{"Field", "Type"}).
+			AddRow("SUMMARY_END_TIME", "timestamp").
+			AddRow("DIGEST", "varchar(64)"))
+	mock.ExpectExec("ALTER TABLE `tidb_dashboard`.`statements_summary_archive` ADD COLUMN `EXEC_COUNT` bigint(20) unsigned NULL").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT UNIX_TIMESTAMP(MAX(summary_end_time)) FROM `tidb_dashboard`.`statements_summary_archive`").
+		WillReturnRows(sqlmock.NewRows([]string{"v"}).AddRow(1600000000.0))
+	mock.ExpectExec("INSERT INTO `tidb_dashboard`.`statements_summary_archive` (`SUMMARY_END_TIME`, `DIGEST`, `EXEC_COUNT`) " +
+		"SELECT `SUMMARY_END_TIME`, `DIGEST`, `EXEC_COUNT` FROM INFORMATION_SCHEMA.CLUSTER_STATEMENTS_SUMMARY_HISTORY " +
+		"WHERE summary_end_time > FROM_UNIXTIME(?) AND summary_end_time <= NOW()").
+		WithArgs(1600000000).
+		WillReturnResult(sqlmock.NewResult(0, 10))
+	// Expired rows are deleted until there are less rows than a batch
+	deleteSQL := "DELETE FROM `tidb_dashboard`.`statements_summary_archive` WHERE summary_end_time < DATE_SUB(NOW(), INTERVAL ? DAY) LIMIT ?"
+	mock.ExpectExec(deleteSQL).
+		WithArgs(7, archiveDeleteBatchSize).
+		WillReturnResult(sqlmock.NewResult(0, archiveDeleteBatchSize))
+	mock.ExpectExec(deleteSQL).
+		WithArgs(7, archiveDeleteBatchSize).
+		WillReturnResult(sqlmock.NewResult(0, 20))
+
+	err := archiveStatements(db.Gorm(), &ArchiveConfig{SchemaName: defaultArchiveSchema, RetentionDays: 7})
+	require.Nil(t, err)
+	db.MustMeetMockExpectation()
+}
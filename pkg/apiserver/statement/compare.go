@@ -0,0 +1,205 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package statement
+
+import (
+	"sort"
+
+	"gorm.io/gorm"
+)
+
+const defaultCompareLimit = 100
+
+var compareFields = []string{
+	"schema_name",
+	"digest",
+	"digest_text",
+	"plan_digest",
+	"exec_count",
+	"avg_latency",
+	"avg_processed_keys",
+	"avg_mem",
+}
+
+// compareOrderBy maps supported `order_by` values to the ratio fields of StatementComparison.
+var compareOrderBy = map[string]func(r *StatementComparison) float64{
+	"avg_latency_ratio":        func(r *StatementComparison) float64 { return r.AvgLatencyRatio },
+	"exec_count_ratio":         func(r *StatementComparison) float64 { return r.ExecCountRatio },
+	"avg_processed_keys_ratio": func(r *StatementComparison) float64 { return r.AvgProcessedKeysRatio },
+	"avg_mem_ratio":            func(r *StatementComparison) float64 { return r.AvgMemRatio },
+}
+
+type CompareRequest struct {
+	SourceRequest
+	Base      TimeRange `json:"base"`
+	Target    TimeRange `json:"target"`
+	Schemas   []string  `json:"schemas"`
+	StmtTypes []string  `json:"stmt_types"`
+	OrderBy   string    `json:"order_by"` // default: avg_latency_ratio
+	Limit     int       `json:"limit"`    // default: 100
+}
+
+// StatementStats is the aggregated stats of a statement in a time range over all of its plans.
+type StatementStats struct {
+	ExecCount        int      `json:"exec_count"`
+	AvgLatency       int      `json:"avg_latency"`
+	AvgProcessedKeys int      `json:"avg_processed_keys"`
+	AvgMem           int      `json:"avg_mem"`
+	PlanDigests      []string `json:"plan_digests"`
+}
+
+// StatementComparison compares a statement in the target time range with the base time range. Ratios are
+// positive when the value grows, e.g. 1 means doubled and -1 means halved.
+type StatementComparison struct {
+	SchemaName            string         `json:"schema_name"`
+	Digest                string         `json:"digest"`
+	DigestText            string         `json:"digest_text"`
+	Base                  StatementStats `json:"base"`
+	Target                StatementStats `json:"target"`
+	AvgLatencyRatio       float64        `json:"avg_latency_ratio"`
+	ExecCountRatio        float64        `json:"exec_count_ratio"`
+	AvgProcessedKeysRatio float64        `json:"avg_processed_keys_ratio"`
+	AvgMemRatio           float64        `json:"avg_mem_ratio"`
+	// Whether there are plans in the target time range never used in the base time range.
+	PlanChanged bool     `json:"plan_changed"`
+	NewPlans    []string `json:"new_plans"`
+}
+
+type statementKey struct {
+	schemaName string
+	digest     string
+}
+
+type statementSummary struct {
+	digestText string
+	stats      StatementStats
+	// weighted sums, used to calculate averages over plans
+	sumLatency       float64
+	sumProcessedKeys float64
+	sumMem           float64
+}
+
+func (s *Service) queryStatementsByPlan(
+	db *gorm.DB,
+	table string,
+	timeRange TimeRange,
+	schemas, stmtTypes []string,
+) ([]Model, error) {
+	query, err := s.buildStatementsQuery(
+		db,
+		table,
+		int(timeRange.BeginTime), int(timeRange.EndTime),
+		schemas,
+		stmtTypes,
+		"",
+		compareFields)
+	if err != nil {
+		return nil, err
+	}
+	var result []Model
+	err = query.Group("plan_digest").Find(&result).Error
+	return result, err
+}
+
+// summarizeStatements aggregates per plan statements by schema and digest. Evicted statements are ignored.
+func summarizeStatements(plans []Model) map[statementKey]*statementSummary {
+	summaries := make(map[statementKey]*statementSummary)
+	for _, p := range plans {
+		if p.AggDigest == "" {
+			continue
+		}
+		key := statementKey{schemaName: p.AggSchemaName, digest: p.AggDigest}
+		summary, ok := summaries[key]
+		if !ok {
+			summary = &statementSummary{digestText: p.AggDigestText}
+			summaries[key] = summary
+		}
+		execCount := float64(p.AggExecCount)
+		summary.stats.ExecCount += p.AggExecCount
+		summary.sumLatency += execCount * float64(p.AggAvgLatency)
+		summary.sumProcessedKeys += execCount * float64(p.AggAvgProcessedKeys)
+		summary.sumMem += execCount * float64(p.AggAvgMem)
+		summary.stats.PlanDigests = append(summary.stats.PlanDigests, p.AggPlanDigest)
+	}
+	for _, summary := range summaries {
+		if summary.stats.ExecCount > 0 {
+			execCount := float64(summary.stats.ExecCount)
+			summary.stats.AvgLatency = int(summary.sumLatency / execCount)
+			summary.stats.AvgProcessedKeys = int(summary.sumProcessedKeys / execCount)
+			summary.stats.AvgMem = int(summary.sumMem / execCount)
+		}
+		sort.Strings(summary.stats.PlanDigests)
+	}
+	return summaries
+}
+
+// calcRatio is calculated in the same way as the diagnosis comparison report.
+func calcRatio(v1, v2 float64) float64 {
+	switch {
+	case v1 == v2:
+		return 0
+	case v1 == 0:
+		return v2
+	case v2 == 0:
+		return -v1
+	case v2 > v1:
+		return v2/v1 - 1
+	default:
+		return 1 - v1/v2
+	}
+}
+
+// compareStatements joins statements existing in both time ranges and ranks them by the ratio specified by
+// `orderBy` in descending order.
+func compareStatements(basePlans, targetPlans []Model, orderBy string, limit int) []StatementComparison {
+	baseSummaries := summarizeStatements(basePlans)
+	targetSummaries := summarizeStatements(targetPlans)
+
+	results := make([]StatementComparison, 0)
+	for key, target := range targetSummaries {
+		base, ok := baseSummaries[key]
+		if !ok {
+			continue
+		}
+		r := StatementComparison{
+			SchemaName:            key.schemaName,
+			Digest:                key.digest,
+			DigestText:            target.digestText,
+			Base:                  base.stats,
+			Target:                target.stats,
+			AvgLatencyRatio:       calcRatio(float64(base.stats.AvgLatency), float64(target.stats.AvgLatency)),
+			ExecCountRatio:        calcRatio(float64(base.stats.ExecCount), float64(target.stats.ExecCount)),
+			AvgProcessedKeysRatio: calcRatio(float64(base.stats.AvgProcessedKeys), float64(target.stats.AvgProcessedKeys)),
+			AvgMemRatio:           calcRatio(float64(base.stats.AvgMem), float64(target.stats.AvgMem)),
+			NewPlans:              []string{},
+		}
+		basePlanDigests := make(map[string]struct{}, len(base.stats.PlanDigests))
+		for _, d := range base.stats.PlanDigests {
+			basePlanDigests[d] = struct{}{}
+		}
+		for _, d := range target.stats.PlanDigests {
+			if _, ok := basePlanDigests[d]; !ok {
+				r.NewPlans = append(r.NewPlans, d)
+			}
+		}
+		r.PlanChanged = len(r.NewPlans) > 0
+		results = append(results, r)
+	}
+
+	getRatio := compareOrderBy[orderBy]
+	sort.Slice(results, func(i, j int) bool {
+		ri, rj := getRatio(&results[i]), getRatio(&results[j])
+		if ri != rj {
+			return ri > rj
+		}
+		// make the result stable
+		if results[i].Digest != results[j].Digest {
+			return results[i].Digest < results[j].Digest
+		}
+		return results[i].SchemaName < results[j].SchemaName
+	})
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return results
+}
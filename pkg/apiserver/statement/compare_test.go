@@ -0,0 +1,60 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package statement
+
+import (
+	. "github.com/pingcap/check"
+)
+
+var _ = Suite(&testCompareSuite{})
+
+type testCompareSuite struct{}
+
+func (t *testCompareSuite) Test_calcRatio(c *C) {
+	c.Assert(calcRatio(10, 10), Equals, float64(0))
+	c.Assert(calcRatio(10, 20), Equals, float64(1))
+	c.Assert(calcRatio(20, 10), Equals, float64(-1))
+	c.Assert(calcRatio(0, 5), Equals, float64(5))
+	c.Assert(calcRatio(5, 0), Equals, float64(-5))
+}
+
+func (t *testCompareSuite) Test_compareStatements(c *C) {
+	basePlans := []Model{
+		{AggSchemaName: "test", AggDigest: "d1", AggPlanDigest: "p1", AggExecCount: 10, AggAvgLatency: 100, AggAvgMem: 10},
+		{AggSchemaName: "test", AggDigest: "d2", AggPlanDigest: "p2", AggExecCount: 10, AggAvgLatency: 100},
+		{AggSchemaName: "test", AggDigest: "d3", AggPlanDigest: "p3", AggExecCount: 1, AggAvgLatency: 100},
+		// evicted
+		{AggPlanDigest: "p4", AggExecCount: 1000},
+	}
+	targetPlans := []Model{
+		// slower with a new plan
+		{AggSchemaName: "test", AggDigest: "d1", AggDigestText: "select ?", AggPlanDigest: "p1", AggExecCount: 10, AggAvgLatency: 100, AggAvgMem: 10},
+		{AggSchemaName: "test", AggDigest: "d1", AggDigestText: "select ?", AggPlanDigest: "p5", AggExecCount: 10, AggAvgLatency: 500, AggAvgMem: 10},
+		// faster but executed more
+		{AggSchemaName: "test", AggDigest: "d2", AggPlanDigest: "p2", AggExecCount: 40, AggAvgLatency: 50},
+		// not in base
+		{AggSchemaName: "test", AggDigest: "d6", AggPlanDigest: "p6", AggExecCount: 1, AggAvgLatency: 100},
+		{AggPlanDigest: "p4", AggExecCount: 1},
+	}
+
+	results := compareStatements(basePlans, targetPlans, "avg_latency_ratio", 10)
+	c.Assert(results, HasLen, 2)
+	c.Assert(results[0].Digest, Equals, "d1")
+	c.Assert(results[0].DigestText, Equals, "select ?")
+	c.Assert(results[0].Target.ExecCount, Equals, 20)
+	c.Assert(results[0].Target.AvgLatency, Equals, 300)
+	c.Assert(results[0].Target.AvgMem, Equals, 10)
+	c.Assert(results[0].Target.PlanDigests, DeepEquals, []string{"p1", "p5"})
+	c.Assert(results[0].AvgLatencyRatio, Equals, float64(2))
+	c.Assert(results[0].AvgMemRatio, Equals, float64(0))
+	c.Assert(results[0].PlanChanged, IsTrue)
+	c.Assert(results[0].NewPlans, DeepEquals, []string{"p5"})
+	c.Assert(results[1].Digest, Equals, "d2")
+	c.Assert(results[1].AvgLatencyRatio, Equals, float64(-1))
+	c.Assert(results[1].PlanChanged, IsFalse)
+
+	results = compareStatements(basePlans, targetPlans, "exec_count_ratio", 1)
+	c.Assert(results, HasLen, 1)
+	c.Assert(results[0].Digest, Equals, "d2")
+	c.Assert(results[0].ExecCountRatio, Equals, float64(3))
+}
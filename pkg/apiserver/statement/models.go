@@ -74,8 +74,8 @@ type Model struct {
 	AggAvgDisk               int    `json:"avg_disk" agg:"CAST(SUM(exec_count * avg_disk) / SUM(exec_count) AS SIGNED)"`
 	AggMaxDisk               int    `json:"max_disk" agg:"MAX(max_disk)"`
 	AggAvgAffectedRows       int    `json:"avg_affected_rows" agg:"CAST(SUM(exec_count * avg_affected_rows) / SUM(exec_count) AS SIGNED)"`
-	AggFirstSeen             int    `json:"first_seen" agg:"UNIX_TIMESTAMP(MIN(first_seen))"`
-	AggLastSeen              int    `json:"last_seen" agg:"UNIX_TIMESTAMP(MAX(last_seen))"`
+	AggFirstSeen             int    `json:"first_seen" agg:"UNIX_TIMESTAMP(MIN(first_seen))" csv:",time"`
+	AggLastSeen              int    `json:"last_seen" agg:"UNIX_TIMESTAMP(MAX(last_seen))" csv:",time"`
 	AggSampleUser            string `json:"sample_user" agg:"ANY_VALUE(sample_user)"`
 	AggQuerySampleText       string `json:"query_sample_text" agg:"ANY_VALUE(query_sample_text)"`
 	AggPrevSampleText        string `json:"prev_sample_text" agg:"ANY_VALUE(prev_sample_text)"`
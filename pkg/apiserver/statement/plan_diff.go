@@ -0,0 +1,153 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package statement
+
+import (
+	"regexp"
+	"strings"
+
+	"gorm.io/gorm"
+
+	"github.com/pingcap/tidb-dashboard/util/rest"
+)
+
+const (
+	PlanDiffSame    = "same"
+	PlanDiffChanged = "changed"
+	PlanDiffAdded   = "added"
+	PlanDiffRemoved = "removed"
+)
+
+// Matches the numeric suffix of an operator ID, which may be followed by the role of the child operator in a join
+// or a lookup, e.g. `IndexRangeScan_8(Build)`.
+var operatorIDSuffixRegex = regexp.MustCompile(`_\d+(\((?:Build|Probe)\))?$`)
+
+// PlanOperator is an operator in the plan tree.
+type PlanOperator struct {
+	ID           string `json:"id"`
+	Name         string `json:"name"` // the ID without the numeric suffix, e.g. TableReader or IndexRangeScan(Build)
+	Depth        int    `json:"depth"`
+	Task         string `json:"task"`
+	EstRows      string `json:"est_rows"`
+	AccessObject string `json:"access_object"`
+	OperatorInfo string `json:"operator_info"`
+}
+
+// PlanDiffLine is a line of the diff between two plans in the pre-order of the operator trees.
+// Base is nil when the operator is added, and Target is nil when the operator is removed.
+type PlanDiffLine struct {
+	Status string        `json:"status"`
+	Base   *PlanOperator `json:"base"`
+	Target *PlanOperator `json:"target"`
+}
+
+// parsePlan parses the text plan in the statement summary into operators in pre-order. Each line of the plan is
+// a tab separated row starting with a tab, where the first line is the header like "id, task, estRows, operator info",
+// and the depth of an operator is indicated by the tree prefix of its ID, e.g. "  └─TableFullScan_5".
+func parsePlan(plan string) []PlanOperator {
+	var header []string
+	operators := make([]PlanOperator, 0)
+	for _, line := range strings.Split(plan, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		cols := strings.Split(strings.TrimPrefix(line, "\t"), "\t")
+		if header == nil {
+			header = make([]string, 0, len(cols))
+			for _, c := range cols {
+				header = append(header, strings.ToLower(strings.TrimSpace(c)))
+			}
+			continue
+		}
+
+		op := PlanOperator{}
+		for i, c := range cols {
+			if i >= len(header) {
+				break
+			}
+			switch header[i] {
+			case "id":
+				trimmed := strings.TrimLeft(c, " │├└─")
+				op.Depth = (len([]rune(c)) - len([]rune(trimmed))) / 2
+				op.ID = strings.TrimSpace(trimmed)
+				op.Name = operatorIDSuffixRegex.ReplaceAllString(op.ID, "$1")
+			case "task":
+				op.Task = strings.TrimSpace(c)
+			case "estrows", "count":
+				op.EstRows = strings.TrimSpace(c)
+			case "access object":
+				op.AccessObject = strings.TrimSpace(c)
+			case "operator info":
+				op.OperatorInfo = strings.TrimSpace(c)
+			}
+		}
+		operators = append(operators, op)
+	}
+	return operators
+}
+
+func isSameOperator(a, b *PlanOperator) bool {
+	return a.Depth == b.Depth && a.Name == b.Name && a.Task == b.Task
+}
+
+// diffPlans diffs operators of two plans based on the longest common subsequence of operators. Operators at the
+// same position of the tree with the same type and task are matched, and are changed when their access objects
+// or operator info differ. Operator IDs and estimated rows are not compared.
+func diffPlans(base, target []PlanOperator) []PlanDiffLine {
+	n, m := len(base), len(target)
+	lcs := make([][]int, n+1)
+	for i := range lcs {
+		lcs[i] = make([]int, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if isSameOperator(&base[i], &target[j]) {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	lines := make([]PlanDiffLine, 0, n+m)
+	i, j := 0, 0
+	for i < n || j < m {
+		switch {
+		case i < n && j < m && isSameOperator(&base[i], &target[j]):
+			status := PlanDiffSame
+			if base[i].AccessObject != target[j].AccessObject || base[i].OperatorInfo != target[j].OperatorInfo {
+				status = PlanDiffChanged
+			}
+			lines = append(lines, PlanDiffLine{Status: status, Base: &base[i], Target: &target[j]})
+			i++
+			j++
+		case j < m && (i == n || lcs[i][j+1] >= lcs[i+1][j]):
+			lines = append(lines, PlanDiffLine{Status: PlanDiffAdded, Target: &target[j]})
+			j++
+		default:
+			lines = append(lines, PlanDiffLine{Status: PlanDiffRemoved, Base: &base[i]})
+			i++
+		}
+	}
+	return lines
+}
+
+func queryPlanText(db *gorm.DB, table string, schemaName, digest, planDigest string) (string, error) {
+	var plans []string
+	query := db.
+		Table(table).
+		Where("digest = ? AND plan_digest = ?", digest, planDigest).
+		Limit(1)
+	if schemaName != "" {
+		query = query.Where("schema_name = ?", schemaName)
+	}
+	if err := query.Pluck("plan", &plans).Error; err != nil {
+		return "", err
+	}
+	if len(plans) == 0 {
+		return "", rest.ErrNotFound.New("Plan %s is not found", planDigest)
+	}
+	return plans[0], nil
+}
@@ -0,0 +1,185 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package statement
+
+import (
+	"sort"
+
+	"gorm.io/gorm"
+)
+
+// PlanHistoryPoint is the stats of a plan in a statement summary window, aggregated over all TiDB instances.
+type PlanHistoryPoint struct {
+	BeginTime  int64  `json:"begin_time"`
+	EndTime    int64  `json:"end_time"`
+	PlanDigest string `json:"plan_digest"`
+	ExecCount  int    `json:"exec_count"`
+	AvgLatency int    `json:"avg_latency"`
+	MaxLatency int    `json:"max_latency"`
+	MinLatency int    `json:"min_latency"`
+}
+
+// PlanHistory summarizes a plan over all windows it appears in. Latency percentiles are calculated over the
+// average latency of each window, weighted by the execution count.
+type PlanHistory struct {
+	PlanDigest    string `json:"plan_digest"`
+	FirstSeen     int64  `json:"first_seen"` // begin time of the first window
+	LastSeen      int64  `json:"last_seen"`  // end time of the last window
+	WindowsCount  int    `json:"windows_count"`
+	ExecCount     int    `json:"exec_count"`
+	AvgLatency    int    `json:"avg_latency"`
+	MinLatency    int    `json:"min_latency"`
+	MaxLatency    int    `json:"max_latency"`
+	P50AvgLatency int    `json:"p50_avg_latency"`
+	P90AvgLatency int    `json:"p90_avg_latency"`
+	P99AvgLatency int    `json:"p99_avg_latency"`
+}
+
+// PlanChange means the most executed plan of the statement changes since the window beginning at `Time`.
+type PlanChange struct {
+	Time           int64  `json:"time"`
+	FromPlanDigest string `json:"from_plan_digest"`
+	ToPlanDigest   string `json:"to_plan_digest"`
+}
+
+type PlanHistoryResponse struct {
+	Plans    []PlanHistory      `json:"plans"`
+	Changes  []PlanChange       `json:"changes"`
+	Timeline []PlanHistoryPoint `json:"timeline"`
+}
+
+func queryPlanHistoryPoints(
+	db *gorm.DB,
+	table string,
+	beginTime, endTime int,
+	schemaName, digest string,
+) (result []PlanHistoryPoint, err error) {
+	query := db.
+		Select(`
+			FLOOR(UNIX_TIMESTAMP(summary_begin_time)) AS begin_time,
+			FLOOR(UNIX_TIMESTAMP(summary_end_time)) AS end_time,
+			plan_digest,
+			SUM(exec_count) AS exec_count,
+			CAST(SUM(exec_count * avg_latency) / SUM(exec_count) AS SIGNED) AS avg_latency,
+			MAX(max_latency) AS max_latency,
+			MIN(min_latency) AS min_latency
+		`).
+		Table(table).
+		Where("digest = ?", digest).
+		Group("summary_begin_time, summary_end_time, plan_digest").
+		Order("begin_time ASC, plan_digest ASC")
+
+	if schemaName != "" {
+		query = query.Where("schema_name = ?", schemaName)
+	}
+	// All stored windows are queried when the time range is not specified.
+	if beginTime > 0 {
+		query = query.Where("summary_begin_time >= FROM_UNIXTIME(?)", beginTime)
+	}
+	if endTime > 0 {
+		query = query.Where("summary_end_time <= FROM_UNIXTIME(?)", endTime)
+	}
+
+	err = query.Find(&result).Error
+	return
+}
+
+type weightedLatency struct {
+	latency int
+	weight  int
+}
+
+// weightedPercentile returns the p-th (0~1) percentile. `values` must be sorted by latency.
+func weightedPercentile(values []weightedLatency, totalWeight int, p float64) int {
+	if len(values) == 0 {
+		return 0
+	}
+	target := p * float64(totalWeight)
+	acc := 0
+	for _, v := range values {
+		acc += v.weight
+		if float64(acc) >= target {
+			return v.latency
+		}
+	}
+	return values[len(values)-1].latency
+}
+
+// buildPlanHistory builds the plan history from points sorted by the begin time.
+func buildPlanHistory(points []PlanHistoryPoint) PlanHistoryResponse {
+	resp := PlanHistoryResponse{
+		Plans:    []PlanHistory{},
+		Changes:  []PlanChange{},
+		Timeline: points,
+	}
+	if resp.Timeline == nil {
+		resp.Timeline = []PlanHistoryPoint{}
+	}
+
+	plansMap := make(map[string]*PlanHistory)
+	latencies := make(map[string][]weightedLatency)
+	sumLatency := make(map[string]float64)
+	for _, p := range points {
+		h, ok := plansMap[p.PlanDigest]
+		if !ok {
+			h = &PlanHistory{
+				PlanDigest: p.PlanDigest,
+				FirstSeen:  p.BeginTime,
+				MinLatency: p.MinLatency,
+			}
+			plansMap[p.PlanDigest] = h
+		}
+		if p.EndTime > h.LastSeen {
+			h.LastSeen = p.EndTime
+		}
+		h.WindowsCount++
+		h.ExecCount += p.ExecCount
+		if p.MinLatency < h.MinLatency {
+			h.MinLatency = p.MinLatency
+		}
+		if p.MaxLatency > h.MaxLatency {
+			h.MaxLatency = p.MaxLatency
+		}
+		sumLatency[p.PlanDigest] += float64(p.ExecCount) * float64(p.AvgLatency)
+		latencies[p.PlanDigest] = append(latencies[p.PlanDigest], weightedLatency{latency: p.AvgLatency, weight: p.ExecCount})
+	}
+	for digest, h := range plansMap {
+		if h.ExecCount > 0 {
+			h.AvgLatency = int(sumLatency[digest] / float64(h.ExecCount))
+		}
+		values := latencies[digest]
+		sort.Slice(values, func(i, j int) bool { return values[i].latency < values[j].latency })
+		h.P50AvgLatency = weightedPercentile(values, h.ExecCount, 0.5)
+		h.P90AvgLatency = weightedPercentile(values, h.ExecCount, 0.9)
+		h.P99AvgLatency = weightedPercentile(values, h.ExecCount, 0.99)
+		resp.Plans = append(resp.Plans, *h)
+	}
+	sort.Slice(resp.Plans, func(i, j int) bool {
+		if resp.Plans[i].FirstSeen != resp.Plans[j].FirstSeen {
+			return resp.Plans[i].FirstSeen < resp.Plans[j].FirstSeen
+		}
+		return resp.Plans[i].PlanDigest < resp.Plans[j].PlanDigest
+	})
+
+	// Detect changes of the most executed plan between windows.
+	lastPlan := ""
+	for i := 0; i < len(points); {
+		j := i
+		dominant := points[i]
+		for ; j < len(points) && points[j].BeginTime == points[i].BeginTime; j++ {
+			if points[j].ExecCount > dominant.ExecCount {
+				dominant = points[j]
+			}
+		}
+		if lastPlan != "" && dominant.PlanDigest != lastPlan {
+			resp.Changes = append(resp.Changes, PlanChange{
+				Time:           dominant.BeginTime,
+				FromPlanDigest: lastPlan,
+				ToPlanDigest:   dominant.PlanDigest,
+			})
+		}
+		lastPlan = dominant.PlanDigest
+		i = j
+	}
+	return resp
+}
@@ -0,0 +1,114 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package statement
+
+import (
+	"strings"
+
+	. "github.com/pingcap/check"
+)
+
+var _ = Suite(&testPlanHistorySuite{})
+
+type testPlanHistorySuite struct{}
+
+func (t *testPlanHistorySuite) Test_buildPlanHistory(c *C) {
+	resp := buildPlanHistory(nil)
+	c.Assert(resp.Plans, HasLen, 0)
+	c.Assert(resp.Changes, HasLen, 0)
+	c.Assert(resp.Timeline, NotNil)
+
+	points := []PlanHistoryPoint{
+		{BeginTime: 0, EndTime: 1800, PlanDigest: "p1", ExecCount: 10, AvgLatency: 100, MinLatency: 50, MaxLatency: 200},
+		{BeginTime: 1800, EndTime: 3600, PlanDigest: "p1", ExecCount: 30, AvgLatency: 200, MinLatency: 40, MaxLatency: 300},
+		{BeginTime: 1800, EndTime: 3600, PlanDigest: "p2", ExecCount: 1, AvgLatency: 1000, MinLatency: 1000, MaxLatency: 1000},
+		{BeginTime: 3600, EndTime: 5400, PlanDigest: "p2", ExecCount: 10, AvgLatency: 1000, MinLatency: 900, MaxLatency: 1100},
+		{BeginTime: 5400, EndTime: 7200, PlanDigest: "p1", ExecCount: 10, AvgLatency: 100, MinLatency: 50, MaxLatency: 200},
+	}
+	resp = buildPlanHistory(points)
+	c.Assert(resp.Timeline, HasLen, 5)
+	c.Assert(resp.Plans, DeepEquals, []PlanHistory{
+		{
+			PlanDigest:    "p1",
+			FirstSeen:     0,
+			LastSeen:      7200,
+			WindowsCount:  3,
+			ExecCount:     50,
+			AvgLatency:    160,
+			MinLatency:    40,
+			MaxLatency:    300,
+			P50AvgLatency: 200,
+			P90AvgLatency: 200,
+			P99AvgLatency: 200,
+		},
+		{
+			PlanDigest:    "p2",
+			FirstSeen:     1800,
+			LastSeen:      5400,
+			WindowsCount:  2,
+			ExecCount:     11,
+			AvgLatency:    1000,
+			MinLatency:    900,
+			MaxLatency:    1100,
+			P50AvgLatency: 1000,
+			P90AvgLatency: 1000,
+			P99AvgLatency: 1000,
+		},
+	})
+	c.Assert(resp.Changes, DeepEquals, []PlanChange{
+		{Time: 3600, FromPlanDigest: "p1", ToPlanDigest: "p2"},
+		{Time: 5400, FromPlanDigest: "p2", ToPlanDigest: "p1"},
+	})
+}
+
+const testPlan1 = "\tid                 \ttask     \testRows\toperator info\n" +
+	"\tProjection_4       \troot     \t10000  \ttest.t.a\n" +
+	"\t└─TableReader_6    \troot     \t10000  \tdata:TableFullScan_5\n" +
+	"\t  └─TableFullScan_5\tcop[tikv]\t10000  \ttable:t, keep order:false\n"
+
+const testPlan2 = "\tid                     \ttask     \testRows\toperator info\n" +
+	"\tProjection_4           \troot     \t10     \ttest.t.a\n" +
+	"\t└─IndexLookUp_10       \troot     \t10     \t\n" +
+	"\t  ├─IndexRangeScan_8(Build)\tcop[tikv]\t10     \ttable:t, index:idx(a), range:[1,1]\n" +
+	"\t  └─TableRowIDScan_9(Probe)\tcop[tikv]\t10     \ttable:t, keep order:false\n"
+
+func (t *testPlanHistorySuite) Test_parsePlan(c *C) {
+	ops := parsePlan(testPlan1)
+	c.Assert(ops, DeepEquals, []PlanOperator{
+		{ID: "Projection_4", Name: "Projection", Depth: 0, Task: "root", EstRows: "10000", OperatorInfo: "test.t.a"},
+		{ID: "TableReader_6", Name: "TableReader", Depth: 1, Task: "root", EstRows: "10000", OperatorInfo: "data:TableFullScan_5"},
+		{ID: "TableFullScan_5", Name: "TableFullScan", Depth: 2, Task: "cop[tikv]", EstRows: "10000", OperatorInfo: "table:t, keep order:false"},
+	})
+	c.Assert(parsePlan(""), HasLen, 0)
+
+	ops = parsePlan(testPlan2)
+	c.Assert(ops, HasLen, 4)
+	c.Assert(ops[2].ID, Equals, "IndexRangeScan_8(Build)")
+	c.Assert(ops[2].Name, Equals, "IndexRangeScan(Build)")
+	c.Assert(ops[3].Name, Equals, "TableRowIDScan(Probe)")
+}
+
+func (t *testPlanHistorySuite) Test_diffPlans(c *C) {
+	lines := diffPlans(parsePlan(testPlan1), parsePlan(testPlan2))
+	statuses := make([]string, 0, len(lines))
+	for _, l := range lines {
+		statuses = append(statuses, l.Status)
+	}
+	c.Assert(statuses, DeepEquals, []string{PlanDiffSame, PlanDiffAdded, PlanDiffAdded, PlanDiffAdded, PlanDiffRemoved, PlanDiffRemoved})
+	c.Assert(lines[1].Target.Name, Equals, "IndexLookUp")
+	c.Assert(lines[1].Base, IsNil)
+	c.Assert(lines[5].Base.Name, Equals, "TableFullScan")
+
+	lines = diffPlans(parsePlan(testPlan1), parsePlan(strings.Replace(testPlan1, "keep order:false", "keep order:true", 1)))
+	c.Assert(lines, HasLen, 3)
+	c.Assert(lines[0].Status, Equals, PlanDiffSame)
+	c.Assert(lines[2].Status, Equals, PlanDiffChanged)
+
+	// Operators with different IDs are still matched
+	renumbered := strings.NewReplacer("_10", "_7", "_8(Build)", "_5(Build)", "_9(Probe)", "_6(Probe)").Replace(testPlan2)
+	lines = diffPlans(parsePlan(testPlan2), parsePlan(renumbered))
+	c.Assert(lines, HasLen, 4)
+	for _, l := range lines {
+		c.Assert(l.Status, Equals, PlanDiffSame)
+	}
+}
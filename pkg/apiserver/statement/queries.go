@@ -14,24 +14,24 @@ const (
 	statementsTable = "INFORMATION_SCHEMA.CLUSTER_STATEMENTS_SUMMARY_HISTORY"
 )
 
-func queryTimeRanges(db *gorm.DB) (result []*TimeRange, err error) {
+func queryTimeRanges(db *gorm.DB, table string) (result []*TimeRange, err error) {
 	err = db.
 		Select(`
 			DISTINCT
 			FLOOR(UNIX_TIMESTAMP(summary_begin_time)) AS begin_time,
 			FLOOR(UNIX_TIMESTAMP(summary_end_time)) AS end_time
 		`).
-		Table(statementsTable).
+		Table(table).
 		Order("begin_time DESC, end_time DESC").
 		Find(&result).Error
 	return
 }
 
-func queryStmtTypes(db *gorm.DB) (result []string, err error) {
+func queryStmtTypes(db *gorm.DB, table string) (result []string, err error) {
 	// why should put DISTINCT inside the `Pluck()` method, see here:
 	// https://github.com/jinzhu/gorm/issues/496
 	err = db.
-		Table(statementsTable).
+		Table(table).
 		Order("stmt_type ASC").
 		Pluck("DISTINCT stmt_type", &result).
 		Error
@@ -39,6 +39,7 @@ func queryStmtTypes(db *gorm.DB) (result []string, err error) {
 }
 
 // sample params:
+// table: INFORMATION_SCHEMA.CLUSTER_STATEMENTS_SUMMARY_HISTORY
 // beginTime: 1586844000
 // endTime: 1586845800
 // schemas: ["tpcc", "test"]
@@ -46,12 +47,29 @@ func queryStmtTypes(db *gorm.DB) (result []string, err error) {
 // fields: ["digest_text", "sum_latency"]
 func (s *Service) queryStatements(
 	db *gorm.DB,
+	table string,
 	beginTime, endTime int,
 	schemas, stmtTypes []string,
 	text string,
 	reqFields []string,
 ) (result []Model, err error) {
-	tableColumns, err := s.params.SysSchema.GetTableColumnNames(db, statementsTable)
+	query, err := s.buildStatementsQuery(db, table, beginTime, endTime, schemas, stmtTypes, text, reqFields)
+	if err != nil {
+		return nil, err
+	}
+	err = query.Find(&result).Error
+	return
+}
+
+func (s *Service) buildStatementsQuery(
+	db *gorm.DB,
+	table string,
+	beginTime, endTime int,
+	schemas, stmtTypes []string,
+	text string,
+	reqFields []string,
+) (*gorm.DB, error) {
+	tableColumns, err := s.params.SysSchema.GetTableColumnNames(db, table)
 	if err != nil {
 		return nil, err
 	}
@@ -63,7 +81,7 @@ func (s *Service) queryStatements(
 
 	query := db.
 		Select(selectStmt).
-		Table(statementsTable).
+		Table(table).
 		Where("summary_begin_time >= FROM_UNIXTIME(?) AND summary_end_time <= FROM_UNIXTIME(?)", beginTime, endTime).
 		Group("schema_name, digest").
 		Order("agg_sum_latency DESC")
@@ -96,16 +114,16 @@ func (s *Service) queryStatements(
 		}
 	}
 
-	err = query.Find(&result).Error
-	return
+	return query, nil
 }
 
 func (s *Service) queryPlans(
 	db *gorm.DB,
+	table string,
 	beginTime, endTime int,
 	schemaName, digest string,
 ) (result []Model, err error) {
-	tableColumns, err := s.params.SysSchema.GetTableColumnNames(db, statementsTable)
+	tableColumns, err := s.params.SysSchema.GetTableColumnNames(db, table)
 	if err != nil {
 		return nil, err
 	}
@@ -129,7 +147,7 @@ func (s *Service) queryPlans(
 
 	query := db.
 		Select(selectStmt).
-		Table(statementsTable).
+		Table(table).
 		Where("summary_begin_time >= FROM_UNIXTIME(?) AND summary_end_time <= FROM_UNIXTIME(?)", beginTime, endTime).
 		Group("plan_digest")
 
@@ -150,11 +168,12 @@ func (s *Service) queryPlans(
 
 func (s *Service) queryPlanDetail(
 	db *gorm.DB,
+	table string,
 	beginTime, endTime int,
 	schemaName, digest string,
 	plans []string,
 ) (result Model, err error) {
-	tableColumns, err := s.params.SysSchema.GetTableColumnNames(db, statementsTable)
+	tableColumns, err := s.params.SysSchema.GetTableColumnNames(db, table)
 	if err != nil {
 		return
 	}
@@ -166,7 +185,7 @@ func (s *Service) queryPlanDetail(
 
 	query := db.
 		Select(selectStmt).
-		Table(statementsTable).
+		Table(table).
 		Where("summary_begin_time >= FROM_UNIXTIME(?) AND summary_end_time <= FROM_UNIXTIME(?)", beginTime, endTime)
 
 	if digest == "" {
@@ -3,9 +3,11 @@
 package statement
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -15,28 +17,52 @@ import (
 
 	"github.com/pingcap/tidb-dashboard/pkg/apiserver/user"
 	"github.com/pingcap/tidb-dashboard/pkg/apiserver/utils"
+	"github.com/pingcap/tidb-dashboard/pkg/dbstore"
 	"github.com/pingcap/tidb-dashboard/pkg/tidb"
 	commonUtils "github.com/pingcap/tidb-dashboard/pkg/utils"
 	"github.com/pingcap/tidb-dashboard/util/rest"
+	"github.com/pingcap/tidb-dashboard/util/rest/fileswap"
 )
 
 var (
-	ErrNS     = errorx.NewNamespace("error.api.statement")
-	ErrNoData = ErrNS.NewType("export_no_data")
+	ErrNS                   = errorx.NewNamespace("error.api.statement")
+	ErrNoData               = ErrNS.NewType("export_no_data")
+	ErrArchiveNotConfigured = ErrNS.NewType("archive_not_configured")
 )
 
 type ServiceParams struct {
 	fx.In
 	TiDBClient *tidb.Client
 	SysSchema  *commonUtils.SysSchema
+	LocalStore *dbstore.DB
 }
 
 type Service struct {
 	params ServiceParams
+	fSwap  *fileswap.Handler
+	wg     sync.WaitGroup
 }
 
-func newService(p ServiceParams) *Service {
-	return &Service{params: p}
+func newService(lc fx.Lifecycle, p ServiceParams) (*Service, error) {
+	if err := autoMigrate(p.LocalStore); err != nil {
+		return nil, err
+	}
+	s := &Service{params: p, fSwap: fileswap.New()}
+	lc.Append(fx.Hook{
+		OnStart: func(ctx context.Context) error {
+			s.wg.Add(1)
+			go func() {
+				defer s.wg.Done()
+				s.archiveLoop(ctx)
+			}()
+			return nil
+		},
+		OnStop: func(context.Context) error {
+			s.wg.Wait()
+			return nil
+		},
+	})
+	return s, nil
 }
 
 func registerRouter(r *gin.RouterGroup, auth *user.AuthService, s *Service) {
@@ -45,19 +71,26 @@ func registerRouter(r *gin.RouterGroup, auth *user.AuthService, s *Service) {
 		endpoint.GET("/download", s.downloadHandler)
 
 		endpoint.Use(auth.MWAuthRequired())
+		endpoint.Use(auth.MWRequirePermission(user.PermStatementView))
 		endpoint.Use(utils.MWConnectTiDB(s.params.TiDBClient))
 		{
 			endpoint.GET("/config", s.configHandler)
-			endpoint.POST("/config", auth.MWRequireWritePriv(), s.modifyConfigHandler)
+			endpoint.POST("/config", auth.MWRequirePermission(user.PermStatementConfig), s.modifyConfigHandler)
 			endpoint.GET("/time_ranges", s.timeRangesHandler)
 			endpoint.GET("/stmt_types", s.stmtTypesHandler)
 			endpoint.GET("/list", s.listHandler)
 			endpoint.GET("/plans", s.plansHandler)
 			endpoint.GET("/plan/detail", s.planDetailHandler)
+			endpoint.GET("/plan/history", s.planHistoryHandler)
+			endpoint.GET("/plan/diff", s.planDiffHandler)
+			endpoint.POST("/compare", s.compareHandler)
 
 			endpoint.POST("/download/token", s.downloadTokenHandler)
 
 			endpoint.GET("/table_columns", s.queryTableColumns)
+
+			endpoint.GET("/archive/config", s.archiveConfigHandler)
+			endpoint.PUT("/archive/config", auth.MWRequirePermission(user.PermStatementConfig), s.modifyArchiveConfigHandler)
 		}
 	}
 }
@@ -115,14 +148,31 @@ func (s *Service) modifyConfigHandler(c *gin.Context) {
 	c.Status(http.StatusNoContent)
 }
 
+// SourceRequest specifies where statements are queried from. When FromArchive is true, statements are
+// queried from the archive table instead of the statement summary history.
+type SourceRequest struct {
+	FromArchive bool `json:"from_archive" form:"from_archive"`
+}
+
 // @Summary Get available statement time ranges
+// @Param q query SourceRequest true "Query"
 // @Success 200 {array} statement.TimeRange
 // @Router /statements/time_ranges [get]
 // @Security JwtAuth
 // @Failure 401 {object} rest.ErrorResponse
 func (s *Service) timeRangesHandler(c *gin.Context) {
+	var req SourceRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		_ = c.Error(rest.ErrBadRequest.NewWithNoMessage())
+		return
+	}
+	table, err := s.getSourceTable(req.FromArchive)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
 	db := utils.GetTiDBConnection(c)
-	timeRanges, err := queryTimeRanges(db)
+	timeRanges, err := queryTimeRanges(db, table)
 	if err != nil {
 		_ = c.Error(err)
 		return
@@ -131,13 +181,24 @@ func (s *Service) timeRangesHandler(c *gin.Context) {
 }
 
 // @Summary Get all statement types
+// @Param q query SourceRequest true "Query"
 // @Success 200 {array} string
 // @Router /statements/stmt_types [get]
 // @Security JwtAuth
 // @Failure 401 {object} rest.ErrorResponse
 func (s *Service) stmtTypesHandler(c *gin.Context) {
+	var req SourceRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		_ = c.Error(rest.ErrBadRequest.NewWithNoMessage())
+		return
+	}
+	table, err := s.getSourceTable(req.FromArchive)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
 	db := utils.GetTiDBConnection(c)
-	stmtTypes, err := queryStmtTypes(db)
+	stmtTypes, err := queryStmtTypes(db, table)
 	if err != nil {
 		_ = c.Error(err)
 		return
@@ -146,6 +207,7 @@ func (s *Service) stmtTypesHandler(c *gin.Context) {
 }
 
 type GetStatementsRequest struct {
+	SourceRequest
 	Schemas   []string `json:"schemas" form:"schemas"`
 	StmtTypes []string `json:"stmt_types" form:"stmt_types"`
 	BeginTime int      `json:"begin_time" form:"begin_time"`
@@ -167,6 +229,11 @@ func (s *Service) listHandler(c *gin.Context) {
 		_ = c.Error(rest.ErrBadRequest.NewWithNoMessage())
 		return
 	}
+	table, err := s.getSourceTable(req.FromArchive)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
 	db := utils.GetTiDBConnection(c)
 	fields := []string{}
 	if strings.TrimSpace(req.Fields) != "" {
@@ -174,6 +241,7 @@ func (s *Service) listHandler(c *gin.Context) {
 	}
 	overviews, err := s.queryStatements(
 		db,
+		table,
 		req.BeginTime, req.EndTime,
 		req.Schemas,
 		req.StmtTypes,
@@ -187,6 +255,7 @@ func (s *Service) listHandler(c *gin.Context) {
 }
 
 type GetPlansRequest struct {
+	SourceRequest
 	SchemaName string `json:"schema_name" form:"schema_name"`
 	Digest     string `json:"digest" form:"digest"`
 	BeginTime  int    `json:"begin_time" form:"begin_time"`
@@ -205,8 +274,13 @@ func (s *Service) plansHandler(c *gin.Context) {
 		_ = c.Error(rest.ErrBadRequest.NewWithNoMessage())
 		return
 	}
+	table, err := s.getSourceTable(req.FromArchive)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
 	db := utils.GetTiDBConnection(c)
-	plans, err := s.queryPlans(db, req.BeginTime, req.EndTime, req.SchemaName, req.Digest)
+	plans, err := s.queryPlans(db, table, req.BeginTime, req.EndTime, req.SchemaName, req.Digest)
 	if err != nil {
 		_ = c.Error(err)
 		return
@@ -231,8 +305,13 @@ func (s *Service) planDetailHandler(c *gin.Context) {
 		_ = c.Error(rest.ErrBadRequest.NewWithNoMessage())
 		return
 	}
+	table, err := s.getSourceTable(req.FromArchive)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
 	db := utils.GetTiDBConnection(c)
-	result, err := s.queryPlanDetail(db, req.BeginTime, req.EndTime, req.SchemaName, req.Digest, req.Plans)
+	result, err := s.queryPlanDetail(db, table, req.BeginTime, req.EndTime, req.SchemaName, req.Digest, req.Plans)
 	if err != nil {
 		_ = c.Error(err)
 		return
@@ -240,27 +319,161 @@ func (s *Service) planDetailHandler(c *gin.Context) {
 	c.JSON(http.StatusOK, result)
 }
 
+// @Summary Get the plan history of a statement
+// @Description All stored windows are included when begin_time or end_time is not specified.
+// @Param q query GetPlansRequest true "Query"
+// @Success 200 {object} PlanHistoryResponse
+// @Router /statements/plan/history [get]
+// @Security JwtAuth
+// @Failure 400 {object} rest.ErrorResponse
+// @Failure 401 {object} rest.ErrorResponse
+func (s *Service) planHistoryHandler(c *gin.Context) {
+	var req GetPlansRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		_ = c.Error(rest.ErrBadRequest.NewWithNoMessage())
+		return
+	}
+	if req.Digest == "" {
+		_ = c.Error(rest.ErrBadRequest.New("digest is required"))
+		return
+	}
+	table, err := s.getSourceTable(req.FromArchive)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	db := utils.GetTiDBConnection(c)
+	points, err := queryPlanHistoryPoints(db, table, req.BeginTime, req.EndTime, req.SchemaName, req.Digest)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, buildPlanHistory(points))
+}
+
+type GetPlanDiffRequest struct {
+	SourceRequest
+	SchemaName       string `json:"schema_name" form:"schema_name"`
+	Digest           string `json:"digest" form:"digest"`
+	BasePlanDigest   string `json:"base_plan_digest" form:"base_plan_digest"`
+	TargetPlanDigest string `json:"target_plan_digest" form:"target_plan_digest"`
+}
+
+// @Summary Diff operator trees of two plans of a statement
+// @Param q query GetPlanDiffRequest true "Query"
+// @Success 200 {array} PlanDiffLine
+// @Router /statements/plan/diff [get]
+// @Security JwtAuth
+// @Failure 400 {object} rest.ErrorResponse
+// @Failure 401 {object} rest.ErrorResponse
+// @Failure 404 {object} rest.ErrorResponse
+func (s *Service) planDiffHandler(c *gin.Context) {
+	var req GetPlanDiffRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		_ = c.Error(rest.ErrBadRequest.NewWithNoMessage())
+		return
+	}
+	table, err := s.getSourceTable(req.FromArchive)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	db := utils.GetTiDBConnection(c)
+	basePlan, err := queryPlanText(db, table, req.SchemaName, req.Digest, req.BasePlanDigest)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	targetPlan, err := queryPlanText(db, table, req.SchemaName, req.Digest, req.TargetPlanDigest)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, diffPlans(parsePlan(basePlan), parsePlan(targetPlan)))
+}
+
+// @Summary Compare statements between two time ranges
+// @Description Statements existing in both time ranges are ranked by how much they regress in the target time range.
+// @Param request body CompareRequest true "Request body"
+// @Success 200 {array} StatementComparison
+// @Router /statements/compare [post]
+// @Security JwtAuth
+// @Failure 400 {object} rest.ErrorResponse
+// @Failure 401 {object} rest.ErrorResponse
+func (s *Service) compareHandler(c *gin.Context) {
+	var req CompareRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		_ = c.Error(rest.ErrBadRequest.NewWithNoMessage())
+		return
+	}
+	if req.OrderBy == "" {
+		req.OrderBy = "avg_latency_ratio"
+	}
+	if _, ok := compareOrderBy[req.OrderBy]; !ok {
+		_ = c.Error(rest.ErrBadRequest.New("Unsupported order by %s", req.OrderBy))
+		return
+	}
+	if req.Limit <= 0 {
+		req.Limit = defaultCompareLimit
+	}
+	table, err := s.getSourceTable(req.FromArchive)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	db := utils.GetTiDBConnection(c)
+	basePlans, err := s.queryStatementsByPlan(db, table, req.Base, req.Schemas, req.StmtTypes)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	targetPlans, err := s.queryStatementsByPlan(db, table, req.Target, req.Schemas, req.StmtTypes)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, compareStatements(basePlans, targetPlans, req.OrderBy, req.Limit))
+}
+
+type ExportRequest struct {
+	GetStatementsRequest
+	Format utils.ExportFormat `json:"format"` // values: csv (default), ndjson, parquet
+}
+
 // @Router /statements/download/token [post]
 // @Summary Generate a download token for exported statements
 // @Produce plain
-// @Param request body GetStatementsRequest true "Request body"
+// @Param request body ExportRequest true "Request body"
 // @Success 200 {string} string "xxx"
 // @Security JwtAuth
 // @Failure 400 {object} rest.ErrorResponse
 // @Failure 401 {object} rest.ErrorResponse
 func (s *Service) downloadTokenHandler(c *gin.Context) {
-	var req GetStatementsRequest
+	var req ExportRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		_ = c.Error(rest.ErrBadRequest.NewWithNoMessage())
 		return
 	}
+	if req.Format == "" {
+		req.Format = utils.ExportFormatCSV
+	}
+	if !req.Format.IsValid() {
+		_ = c.Error(rest.ErrBadRequest.New("Unsupported export format %s", req.Format))
+		return
+	}
+	table, err := s.getSourceTable(req.FromArchive)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
 	db := utils.GetTiDBConnection(c)
 	fields := []string{}
 	if strings.TrimSpace(req.Fields) != "" {
 		fields = strings.Split(req.Fields, ",")
 	}
-	overviews, err := s.queryStatements(
+	query, err := s.buildStatementsQuery(
 		db,
+		table,
 		req.BeginTime, req.EndTime,
 		req.Schemas,
 		req.StmtTypes,
@@ -270,57 +483,131 @@ func (s *Service) downloadTokenHandler(c *gin.Context) {
 		_ = c.Error(rest.ErrBadRequest.NewWithNoMessage())
 		return
 	}
-	if len(overviews) == 0 {
-		_ = c.Error(ErrNoData.NewWithNoMessage())
-		return
-	}
-
-	// interface{} tricky
-	rawData := make([]interface{}, len(overviews))
-	for i, v := range overviews {
-		rawData[i] = v
-	}
-
-	// convert data
-	csvData := utils.GenerateCSVFromRaw(rawData, fields, []string{"first_seen", "last_seen"})
 
-	// generate temp file that persist encrypted data
 	timeLayout := "01021504"
 	beginTime := time.Unix(int64(req.BeginTime), 0).Format(timeLayout)
 	endTime := time.Unix(int64(req.EndTime), 0).Format(timeLayout)
-	token, err := utils.ExportCSV(csvData,
-		fmt.Sprintf("statements_%s_%s_*.csv", beginTime, endTime),
-		"statements/download")
+	token, err := utils.StreamExport(s.fSwap, query, &Model{}, fields, req.Format,
+		fmt.Sprintf("statements_%s_%s", beginTime, endTime))
 	if err != nil {
 		_ = c.Error(err)
 		return
 	}
+	if token == "" {
+		_ = c.Error(ErrNoData.NewWithNoMessage())
+		return
+	}
 	c.String(http.StatusOK, token)
 }
 
 // @Router /statements/download [get]
 // @Summary Download statements
-// @Produce text/csv
+// @Produce octet-stream
 // @Param token query string true "download token"
 // @Failure 400 {object} rest.ErrorResponse
 // @Failure 401 {object} rest.ErrorResponse
 func (s *Service) downloadHandler(c *gin.Context) {
-	token := c.Query("token")
-	utils.DownloadByToken(token, "statements/download", c)
+	s.fSwap.HandleDownloadRequest(c)
 }
 
 // @Summary Query table columns
 // @Description Query statements table columns
+// @Param q query SourceRequest true "Query"
 // @Success 200 {array} string
 // @Failure 401 {object} rest.ErrorResponse
 // @Security JwtAuth
 // @Router /statements/table_columns [get]
 func (s *Service) queryTableColumns(c *gin.Context) {
+	var req SourceRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		_ = c.Error(rest.ErrBadRequest.NewWithNoMessage())
+		return
+	}
+	table, err := s.getSourceTable(req.FromArchive)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
 	db := utils.GetTiDBConnection(c)
-	cs, err := s.params.SysSchema.GetTableColumnNames(db, statementsTable)
+	cs, err := s.params.SysSchema.GetTableColumnNames(db, table)
 	if err != nil {
 		_ = c.Error(err)
 		return
 	}
 	c.JSON(http.StatusOK, funk.UniqString(append(cs, getVirtualFields(cs)...)))
 }
+
+type ArchiveConfigRequest struct {
+	Enable        bool   `json:"enable"`
+	SchemaName    string `json:"schema_name"`
+	RetentionDays int    `json:"retention_days"`
+	SQLUser       string `json:"sql_user"`
+	// The stored password is kept when it is empty and the SQL user is unchanged.
+	SQLPassword string `json:"sql_password"`
+}
+
+// @Summary Get statement archive configurations
+// @Success 200 {object} ArchiveConfig
+// @Router /statements/archive/config [get]
+// @Security JwtAuth
+// @Failure 401 {object} rest.ErrorResponse
+func (s *Service) archiveConfigHandler(c *gin.Context) {
+	cfg, err := getArchiveConfig(s.params.LocalStore)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, cfg)
+}
+
+// @Summary Update statement archive configurations
+// @Description Statements will be archived using the specified SQL credential, whose password is stored encrypted.
+// @Description The archive table is created immediately when archiving is enabled.
+// @Param request body ArchiveConfigRequest true "Request body"
+// @Success 200 {object} ArchiveConfig
+// @Router /statements/archive/config [put]
+// @Security JwtAuth
+// @Failure 400 {object} rest.ErrorResponse
+// @Failure 401 {object} rest.ErrorResponse
+func (s *Service) modifyArchiveConfigHandler(c *gin.Context) {
+	var req ArchiveConfigRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		_ = c.Error(rest.ErrBadRequest.NewWithNoMessage())
+		return
+	}
+	cfg, err := getArchiveConfig(s.params.LocalStore)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	cfg.Enable = req.Enable
+	cfg.SchemaName = req.SchemaName
+	cfg.RetentionDays = req.RetentionDays
+	if !cfg.isValid() {
+		_ = c.Error(rest.ErrBadRequest.New("Invalid archive config"))
+		return
+	}
+	if req.SQLUser != cfg.SQLUser || req.SQLPassword != "" {
+		encrypted, err := s.params.LocalStore.EncryptSecret(req.SQLPassword)
+		if err != nil {
+			_ = c.Error(err)
+			return
+		}
+		cfg.SQLUser = req.SQLUser
+		cfg.EncryptedPass = encrypted
+	}
+
+	if cfg.Enable {
+		// Verify the privilege of the archive SQL user as early as possible.
+		if err := s.verifyArchiveConn(cfg); err != nil {
+			_ = c.Error(rest.ErrBadRequest.WrapWithNoMessage(err))
+			return
+		}
+	}
+
+	if err := s.params.LocalStore.Save(cfg).Error; err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, cfg)
+}
@@ -35,6 +35,7 @@ type AuthService struct {
 
 	middleware     *jwt.GinJWTMiddleware
 	authenticators map[utils.AuthType]Authenticator
+	roleResolver   RoleResolver
 }
 
 type AuthenticateForm struct {
@@ -94,6 +95,7 @@ func newAuthService(featureFlags *featureflag.Registry) *AuthService {
 		FeatureFlagNonRootLogin: featureFlags.Register("nonRootLogin", ">= 5.3.0"),
 		middleware:              nil,
 		authenticators:          map[utils.AuthType]Authenticator{},
+		roleResolver:            builtinRoleResolver{},
 	}
 
 	middleware, err := jwt.New(&jwt.GinJWTMiddleware{
@@ -220,6 +222,18 @@ func (s *AuthService) authForm(f AuthenticateForm) (*utils.SessionUser, error) {
 		return nil, err
 	}
 	u.AuthFrom = f.Type
+	// Sessions restored from a sharing code already carry roles of the original session.
+	if u.Roles == nil {
+		roles, err := s.roleResolver.ResolveRoles(u)
+		if err != nil {
+			return nil, err
+		}
+		if len(roles) == 0 {
+			roles = []string{DefaultRole(u)}
+		}
+		u.Roles = roles
+	}
+	u.SSOClaims = nil
 	return u, nil
 }
 
@@ -237,8 +251,11 @@ func (s *AuthService) MWAuthRequired() gin.HandlerFunc {
 	return s.middleware.MiddlewareFunc()
 }
 
-// TODO: Make these MWRequireXxxPriv more general to use.
-func (s *AuthService) MWRequireSharePriv() gin.HandlerFunc {
+// MWRequirePermission creates a middleware that verifies whether the session is granted with the permission by any
+// of its roles. Subsequent handlers will be skipped and errors will be generated if the permission is not granted.
+//
+// This middleware must be placed after the `MWAuthRequired()` middleware.
+func (s *AuthService) MWRequirePermission(perm Permission) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		u := utils.GetSession(c)
 		if u == nil {
@@ -246,8 +263,14 @@ func (s *AuthService) MWRequireSharePriv() gin.HandlerFunc {
 			c.Abort()
 			return
 		}
-		if !u.IsShareable {
-			_ = c.Error(rest.ErrForbidden.NewWithNoMessage())
+		granted, err := s.HasPermission(u, perm)
+		if err != nil {
+			_ = c.Error(err)
+			c.Abort()
+			return
+		}
+		if !granted {
+			_ = c.Error(rest.ErrForbidden.New("Permission %s is required", perm))
 			c.Abort()
 			return
 		}
@@ -255,21 +278,39 @@ func (s *AuthService) MWRequireSharePriv() gin.HandlerFunc {
 	}
 }
 
-func (s *AuthService) MWRequireWritePriv() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		u := utils.GetSession(c)
-		if u == nil {
-			_ = c.Error(rest.ErrUnauthenticated.NewWithNoMessage())
-			c.Abort()
-			return
+// HasPermission returns whether the session is granted with the permission.
+func (s *AuthService) HasPermission(u *utils.SessionUser, perm Permission) (bool, error) {
+	if _, ok := writePermissions[perm]; ok && !u.IsWriteable {
+		return false, nil
+	}
+	if perm == PermUserShare && !u.IsShareable {
+		return false, nil
+	}
+	for _, roleName := range u.Roles {
+		role, err := s.roleResolver.GetRole(roleName)
+		if err != nil {
+			return false, err
 		}
-		if !u.IsWriteable {
-			_ = c.Error(rest.ErrForbidden.NewWithNoMessage())
-			c.Abort()
-			return
+		if role != nil && role.HasPermission(perm) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// GetPermissions returns all permissions granted to the session.
+func (s *AuthService) GetPermissions(u *utils.SessionUser) ([]Permission, error) {
+	perms := make([]Permission, 0)
+	for _, perm := range AllPermissions {
+		granted, err := s.HasPermission(u, perm)
+		if err != nil {
+			return nil, err
+		}
+		if granted {
+			perms = append(perms, perm)
 		}
-		c.Next()
 	}
+	return perms, nil
 }
 
 // RegisterAuthenticator registers an authenticator in the authenticate pipeline.
@@ -277,6 +318,11 @@ func (s *AuthService) RegisterAuthenticator(typeID utils.AuthType, a Authenticat
 	s.authenticators[typeID] = a
 }
 
+// RegisterRoleResolver replaces the role resolver, which only knows built-in roles by default.
+func (s *AuthService) RegisterRoleResolver(r RoleResolver) {
+	s.roleResolver = r
+}
+
 type GetLoginInfoResponse struct {
 	SupportedAuthTypes []int `json:"supported_auth_types"`
 }
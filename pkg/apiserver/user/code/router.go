@@ -16,7 +16,7 @@ import (
 func registerRouter(r *gin.RouterGroup, auth *user.AuthService, s *Service) {
 	endpoint := r.Group("/user/share")
 	endpoint.Use(auth.MWAuthRequired())
-	endpoint.POST("/code", auth.MWRequireSharePriv(), s.shareHandler)
+	endpoint.POST("/code", auth.MWRequirePermission(user.PermUserShare), s.shareHandler)
 }
 
 type ShareRequest struct {
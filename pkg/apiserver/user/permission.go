@@ -0,0 +1,253 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package user
+
+import (
+	"strings"
+
+	"github.com/pingcap/tidb-dashboard/pkg/apiserver/utils"
+)
+
+// Permission is in the form of `module:action`, for example `profiling:start`.
+type Permission string
+
+const (
+	PermAll Permission = "*"
+
+	PermAuditView   Permission = "audit:view"
+	PermAuditConfig Permission = "audit:config"
+
+	PermArtifactView   Permission = "artifact:view"
+	PermArtifactConfig Permission = "artifact:config"
+
+	PermClusterInfoView Permission = "cluster_info:view"
+	PermClusterInfoEdit Permission = "cluster_info:edit"
+
+	PermConfigurationView Permission = "configuration:view"
+	PermConfigurationEdit Permission = "configuration:edit"
+
+	PermConprofView   Permission = "conprof:view"
+	PermConprofConfig Permission = "conprof:config"
+
+	PermDebugAPIRequest Permission = "debug_api:request"
+
+	PermDiagnoseView     Permission = "diagnose:view"
+	PermDiagnoseGenerate Permission = "diagnose:generate"
+
+	PermKeyVisualView   Permission = "keyvisual:view"
+	PermKeyVisualConfig Permission = "keyvisual:config"
+
+	PermLogsSearch   Permission = "logs:search"
+	PermLogsDownload Permission = "logs:download"
+
+	PermMetricsView   Permission = "metrics:view"
+	PermMetricsConfig Permission = "metrics:config"
+
+	PermProfilingView   Permission = "profiling:view"
+	PermProfilingStart  Permission = "profiling:start"
+	PermProfilingConfig Permission = "profiling:config"
+
+	PermQueryEditorRun Permission = "query_editor:run"
+
+	PermSlowQueryView Permission = "slow_query:view"
+
+	PermStatementView   Permission = "statement:view"
+	PermStatementConfig Permission = "statement:config"
+
+	PermUserShare     Permission = "user:share"
+	PermUserSSOConfig Permission = "user:sso_config"
+	PermUserRBAC      Permission = "user:rbac"
+)
+
+// AllPermissions lists all known permissions, used to validate role definitions.
+var AllPermissions = []Permission{
+	PermAuditView,
+	PermAuditConfig,
+	PermArtifactView,
+	PermArtifactConfig,
+	PermClusterInfoView,
+	PermClusterInfoEdit,
+	PermConfigurationView,
+	PermConfigurationEdit,
+	PermConprofView,
+	PermConprofConfig,
+	PermDebugAPIRequest,
+	PermDiagnoseView,
+	PermDiagnoseGenerate,
+	PermKeyVisualView,
+	PermKeyVisualConfig,
+	PermLogsSearch,
+	PermLogsDownload,
+	PermMetricsView,
+	PermMetricsConfig,
+	PermProfilingView,
+	PermProfilingStart,
+	PermProfilingConfig,
+	PermQueryEditorRun,
+	PermSlowQueryView,
+	PermStatementView,
+	PermStatementConfig,
+	PermUserShare,
+	PermUserSSOConfig,
+	PermUserRBAC,
+}
+
+// Permissions listed here modify the cluster or the dashboard. They are only granted when the session is writeable,
+// no matter what role the session has. This keeps the TiDB privilege check and the "revoke write privilege" option
+// of session sharing effective.
+var writePermissions = map[Permission]struct{}{
+	PermAuditConfig:       {},
+	PermArtifactConfig:    {},
+	PermClusterInfoEdit:   {},
+	PermConfigurationEdit: {},
+	PermConprofConfig:     {},
+	PermKeyVisualConfig:   {},
+	PermMetricsConfig:     {},
+	PermProfilingConfig:   {},
+	PermQueryEditorRun:    {},
+	PermStatementConfig:   {},
+	PermUserSSOConfig:     {},
+	PermUserRBAC:          {},
+}
+
+func (p Permission) IsValid() bool {
+	if p == PermAll {
+		return true
+	}
+	if strings.HasSuffix(string(p), ":*") {
+		module := strings.TrimSuffix(string(p), "*")
+		for _, known := range AllPermissions {
+			if strings.HasPrefix(string(known), module) {
+				return true
+			}
+		}
+		return false
+	}
+	for _, known := range AllPermissions {
+		if p == known {
+			return true
+		}
+	}
+	return false
+}
+
+// Covers returns whether the permission p (which may be a wildcard like `*` or `profiling:*`) includes the
+// permission target.
+func (p Permission) Covers(target Permission) bool {
+	if p == PermAll || p == target {
+		return true
+	}
+	if strings.HasSuffix(string(p), ":*") {
+		return strings.HasPrefix(string(target), strings.TrimSuffix(string(p), "*"))
+	}
+	return false
+}
+
+const (
+	RoleViewer   = "viewer"
+	RoleOperator = "operator"
+	RoleAdmin    = "admin"
+)
+
+// DefaultRole returns the role granted to users that don't match any role binding. It keeps the access before
+// roles are introduced, i.e. users with write privileges in TiDB are able to collect diagnostic data. Full access
+// must be granted explicitly by binding the admin role, see `rbac.seedRoleBindings` for the binding created at the
+// first start.
+func DefaultRole(u *utils.SessionUser) string {
+	if u.IsWriteable {
+		return RoleOperator
+	}
+	return RoleViewer
+}
+
+type Role struct {
+	Name        string       `json:"name"`
+	Description string       `json:"description"`
+	Permissions []Permission `json:"permissions"`
+	IsBuiltin   bool         `json:"is_builtin"`
+}
+
+func (r *Role) HasPermission(perm Permission) bool {
+	for _, p := range r.Permissions {
+		if p.Covers(perm) {
+			return true
+		}
+	}
+	return false
+}
+
+var BuiltinRoles = []Role{
+	{
+		Name:        RoleViewer,
+		Description: "Read-only access to all diagnostic pages",
+		Permissions: []Permission{
+			PermClusterInfoView,
+			PermConfigurationView,
+			PermConprofView,
+			PermDiagnoseView,
+			PermKeyVisualView,
+			PermMetricsView,
+			PermProfilingView,
+			PermSlowQueryView,
+			PermStatementView,
+		},
+		IsBuiltin: true,
+	},
+	{
+		Name:        RoleOperator,
+		Description: "Viewer, plus collecting diagnostic data like profiles, logs and reports",
+		Permissions: []Permission{
+			PermClusterInfoView,
+			PermConfigurationView,
+			PermConprofView,
+			PermDebugAPIRequest,
+			PermDiagnoseView,
+			PermDiagnoseGenerate,
+			PermKeyVisualView,
+			PermLogsSearch,
+			PermLogsDownload,
+			PermMetricsView,
+			PermProfilingView,
+			PermProfilingStart,
+			PermSlowQueryView,
+			PermStatementView,
+			PermUserShare,
+		},
+		IsBuiltin: true,
+	},
+	{
+		Name:        RoleAdmin,
+		Description: "Full access",
+		Permissions: []Permission{PermAll},
+		IsBuiltin:   true,
+	},
+}
+
+func GetBuiltinRole(name string) *Role {
+	for i := range BuiltinRoles {
+		if BuiltinRoles[i].Name == name {
+			r := BuiltinRoles[i]
+			return &r
+		}
+	}
+	return nil
+}
+
+// RoleResolver maps signed in users to roles and roles to permissions.
+type RoleResolver interface {
+	// ResolveRoles returns names of the roles granted to a newly signed in user. An empty result means the
+	// default role will be granted.
+	ResolveRoles(u *utils.SessionUser) ([]string, error)
+	// GetRole returns the role definition, or nil if the role does not exist.
+	GetRole(name string) (*Role, error)
+}
+
+type builtinRoleResolver struct{}
+
+func (builtinRoleResolver) ResolveRoles(u *utils.SessionUser) ([]string, error) {
+	return nil, nil
+}
+
+func (builtinRoleResolver) GetRole(name string) (*Role, error) {
+	return GetBuiltinRole(name), nil
+}
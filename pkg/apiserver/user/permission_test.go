@@ -0,0 +1,114 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package user
+
+import (
+	. "github.com/pingcap/check"
+
+	"github.com/pingcap/tidb-dashboard/pkg/apiserver/utils"
+)
+
+var _ = Suite(&testPermissionSuite{})
+
+type testPermissionSuite struct{}
+
+func (t *testPermissionSuite) Test_Covers(c *C) {
+	c.Assert(PermAll.Covers(PermProfilingStart), IsTrue)
+	c.Assert(Permission("profiling:*").Covers(PermProfilingStart), IsTrue)
+	c.Assert(Permission("profiling:*").Covers(PermConprofView), IsFalse)
+	c.Assert(PermProfilingView.Covers(PermProfilingStart), IsFalse)
+	c.Assert(PermProfilingStart.Covers(PermProfilingStart), IsTrue)
+}
+
+func (t *testPermissionSuite) Test_IsValid(c *C) {
+	c.Assert(PermAll.IsValid(), IsTrue)
+	c.Assert(PermLogsDownload.IsValid(), IsTrue)
+	c.Assert(Permission("logs:*").IsValid(), IsTrue)
+	c.Assert(Permission("foo:*").IsValid(), IsFalse)
+	c.Assert(Permission("logs:foo").IsValid(), IsFalse)
+}
+
+func (t *testPermissionSuite) Test_HasPermission(c *C) {
+	s := &AuthService{roleResolver: builtinRoleResolver{}}
+
+	viewer := &utils.SessionUser{Roles: []string{RoleViewer}, IsWriteable: true, IsShareable: true}
+	ok, _ := s.HasPermission(viewer, PermStatementView)
+	c.Assert(ok, IsTrue)
+	ok, _ = s.HasPermission(viewer, PermProfilingStart)
+	c.Assert(ok, IsFalse)
+
+	admin := &utils.SessionUser{Roles: []string{RoleAdmin}, IsWriteable: true, IsShareable: true}
+	ok, _ = s.HasPermission(admin, PermConfigurationEdit)
+	c.Assert(ok, IsTrue)
+
+	// Write permissions are never granted to read-only sessions.
+	admin.IsWriteable = false
+	ok, _ = s.HasPermission(admin, PermConfigurationEdit)
+	c.Assert(ok, IsFalse)
+	ok, _ = s.HasPermission(admin, PermClusterInfoEdit)
+	c.Assert(ok, IsFalse)
+	ok, _ = s.HasPermission(admin, PermProfilingStart)
+	c.Assert(ok, IsTrue)
+
+	// Shared sessions cannot be shared again.
+	admin.IsShareable = false
+	ok, _ = s.HasPermission(admin, PermUserShare)
+	c.Assert(ok, IsFalse)
+
+	// Users without role bindings are not granted full access.
+	c.Assert(GetBuiltinRole(DefaultRole(admin)).HasPermission(PermUserRBAC), IsFalse)
+
+	unknown := &utils.SessionUser{Roles: []string{"foo"}, IsWriteable: true}
+	ok, _ = s.HasPermission(unknown, PermStatementView)
+	c.Assert(ok, IsFalse)
+}
+
+type testAuthenticator struct {
+	BaseAuthenticator
+	user utils.SessionUser
+}
+
+func (a *testAuthenticator) Authenticate(f AuthenticateForm) (*utils.SessionUser, error) {
+	u := a.user
+	return &u, nil
+}
+
+type testRoleResolver struct {
+	builtinRoleResolver
+	roles []string
+}
+
+func (r testRoleResolver) ResolveRoles(u *utils.SessionUser) ([]string, error) {
+	return r.roles, nil
+}
+
+func (t *testPermissionSuite) Test_authFormDefaultRole(c *C) {
+	const typeSSO utils.AuthType = 2
+	ssoAuth := &testAuthenticator{user: utils.SessionUser{
+		HasTiDBAuth:  true,
+		TiDBUsername: "dashboard",
+		IsWriteable:  true,
+		SSOClaims:    map[string][]string{"email": {"foo@example.com"}},
+	}}
+	s := &AuthService{roleResolver: builtinRoleResolver{}, authenticators: map[utils.AuthType]Authenticator{}}
+	s.RegisterAuthenticator(typeSSO, ssoAuth)
+
+	// SSO users impersonating a SQL user with write privileges keep the access of previous versions.
+	u, err := s.authForm(AuthenticateForm{Type: typeSSO})
+	c.Assert(err, IsNil)
+	c.Assert(u.Roles, DeepEquals, []string{RoleOperator})
+	c.Assert(u.SSOClaims, IsNil)
+	ok, _ := s.HasPermission(u, PermProfilingStart)
+	c.Assert(ok, IsTrue)
+
+	ssoAuth.user.IsWriteable = false
+	u, err = s.authForm(AuthenticateForm{Type: typeSSO})
+	c.Assert(err, IsNil)
+	c.Assert(u.Roles, DeepEquals, []string{RoleViewer})
+
+	// Roles from bindings take precedence over the default role.
+	s.RegisterRoleResolver(testRoleResolver{roles: []string{RoleAdmin}})
+	u, err = s.authForm(AuthenticateForm{Type: typeSSO})
+	c.Assert(err, IsNil)
+	c.Assert(u.Roles, DeepEquals, []string{RoleAdmin})
+}
@@ -0,0 +1,101 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package rbac
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+
+	"github.com/pingcap/tidb-dashboard/pkg/apiserver/user"
+	"github.com/pingcap/tidb-dashboard/pkg/dbstore"
+)
+
+type PermissionList []user.Permission
+
+func (r *PermissionList) Scan(src interface{}) error {
+	return json.Unmarshal([]byte(src.(string)), r)
+}
+
+func (r PermissionList) Value() (driver.Value, error) {
+	val, err := json.Marshal(r)
+	return string(val), err
+}
+
+type RoleModel struct {
+	Name        string         `gorm:"primary_key;size:64" json:"name"`
+	Description string         `gorm:"type:text" json:"description"`
+	Permissions PermissionList `gorm:"type:text" json:"permissions"`
+	IsBuiltin   bool           `json:"is_builtin"`
+}
+
+func (RoleModel) TableName() string {
+	return "rbac_roles"
+}
+
+func (m *RoleModel) toRole() *user.Role {
+	return &user.Role{
+		Name:        m.Name,
+		Description: m.Description,
+		Permissions: m.Permissions,
+		IsBuiltin:   m.IsBuiltin,
+	}
+}
+
+type SubjectKind string
+
+const (
+	// SubjectKindSQLUser matches sessions signed in by the TiDB SQL user name.
+	SubjectKindSQLUser SubjectKind = "sql_user"
+	// SubjectKindSSOClaim matches SSO sessions whose user info claim contains the value.
+	SubjectKindSSOClaim SubjectKind = "sso_claim"
+)
+
+type RoleBindingModel struct {
+	ID          uint        `gorm:"primary_key" json:"id"`
+	SubjectKind SubjectKind `gorm:"size:32;index:subject" json:"subject_kind"`
+	// Only valid for SubjectKindSSOClaim, for example `email` or `groups`.
+	ClaimName string `gorm:"size:64" json:"claim_name"`
+	Subject   string `gorm:"size:256;index:subject" json:"subject"`
+	Role      string `gorm:"size:64;index" json:"role"`
+}
+
+func (RoleBindingModel) TableName() string {
+	return "rbac_role_bindings"
+}
+
+func autoMigrate(db *dbstore.DB) error {
+	return db.AutoMigrate(&RoleModel{}, &RoleBindingModel{})
+}
+
+// syncBuiltinRoles ensures built-in role definitions in the storage are identical to the current version.
+func syncBuiltinRoles(db *dbstore.DB) error {
+	for _, r := range user.BuiltinRoles {
+		m := RoleModel{
+			Name:        r.Name,
+			Description: r.Description,
+			Permissions: r.Permissions,
+			IsBuiltin:   true,
+		}
+		if err := db.Save(&m).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// seedRoleBindings binds the admin role to the `root` SQL user when there is no role binding at all, e.g. at the
+// first start. Otherwise nobody is able to manage roles, since users without bindings only have the default role.
+func seedRoleBindings(db *dbstore.DB) error {
+	var count int64
+	if err := db.Model(&RoleBindingModel{}).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+	return db.Create(&RoleBindingModel{
+		SubjectKind: SubjectKindSQLUser,
+		Subject:     "root",
+		Role:        user.RoleAdmin,
+	}).Error
+}
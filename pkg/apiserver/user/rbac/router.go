@@ -0,0 +1,172 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package rbac
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/pingcap/tidb-dashboard/pkg/apiserver/user"
+	"github.com/pingcap/tidb-dashboard/util/rest"
+)
+
+func registerRouter(r *gin.RouterGroup, auth *user.AuthService, s *Service) {
+	endpoint := r.Group("/user/rbac")
+	endpoint.Use(auth.MWAuthRequired())
+	endpoint.GET("/permissions", s.listPermissionsHandler)
+	endpoint.GET("/roles", s.listRolesHandler)
+	endpoint.GET("/bindings", auth.MWRequirePermission(user.PermUserRBAC), s.listBindingsHandler)
+
+	endpoint.Use(auth.MWRequirePermission(user.PermUserRBAC))
+	endpoint.PUT("/roles/:name", s.saveRoleHandler)
+	endpoint.DELETE("/roles/:name", s.deleteRoleHandler)
+	endpoint.POST("/bindings", s.createBindingHandler)
+	endpoint.DELETE("/bindings/:id", s.deleteBindingHandler)
+}
+
+// @ID userRBACListPermissions
+// @Summary List all known permissions
+// @Success 200 {array} string
+// @Router /user/rbac/permissions [get]
+// @Security JwtAuth
+// @Failure 401 {object} rest.ErrorResponse
+func (s *Service) listPermissionsHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, user.AllPermissions)
+}
+
+// @ID userRBACListRoles
+// @Summary List all roles
+// @Success 200 {array} user.Role
+// @Router /user/rbac/roles [get]
+// @Security JwtAuth
+// @Failure 401 {object} rest.ErrorResponse
+func (s *Service) listRolesHandler(c *gin.Context) {
+	s.rolesLock.RLock()
+	resp := make([]*user.Role, 0, len(s.roles))
+	for _, r := range s.roles {
+		resp = append(resp, r)
+	}
+	s.rolesLock.RUnlock()
+
+	sort.Slice(resp, func(i, j int) bool {
+		if resp[i].IsBuiltin != resp[j].IsBuiltin {
+			return resp[i].IsBuiltin
+		}
+		return resp[i].Name < resp[j].Name
+	})
+	c.JSON(http.StatusOK, resp)
+}
+
+type SaveRoleRequest struct {
+	Description string            `json:"description"`
+	Permissions []user.Permission `json:"permissions"`
+}
+
+// @ID userRBACSaveRole
+// @Summary Create or update a custom role
+// @Param name path string true "Role name"
+// @Param request body SaveRoleRequest true "Request body"
+// @Success 200 {object} user.Role
+// @Router /user/rbac/roles/{name} [put]
+// @Security JwtAuth
+// @Failure 400 {object} rest.ErrorResponse
+// @Failure 401 {object} rest.ErrorResponse
+// @Failure 403 {object} rest.ErrorResponse
+func (s *Service) saveRoleHandler(c *gin.Context) {
+	var req SaveRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		_ = c.Error(rest.ErrBadRequest.NewWithNoMessage())
+		return
+	}
+	m := &RoleModel{
+		Name:        c.Param("name"),
+		Description: req.Description,
+		Permissions: req.Permissions,
+	}
+	if err := s.saveRole(m); err != nil {
+		_ = c.Error(rest.ErrBadRequest.WrapWithNoMessage(err))
+		return
+	}
+	c.JSON(http.StatusOK, m.toRole())
+}
+
+// @ID userRBACDeleteRole
+// @Summary Delete a custom role
+// @Param name path string true "Role name"
+// @Success 200 {object} rest.EmptyResponse
+// @Router /user/rbac/roles/{name} [delete]
+// @Security JwtAuth
+// @Failure 400 {object} rest.ErrorResponse
+// @Failure 401 {object} rest.ErrorResponse
+// @Failure 403 {object} rest.ErrorResponse
+func (s *Service) deleteRoleHandler(c *gin.Context) {
+	if err := s.deleteRole(c.Param("name")); err != nil {
+		_ = c.Error(rest.ErrBadRequest.WrapWithNoMessage(err))
+		return
+	}
+	c.JSON(http.StatusOK, rest.EmptyResponse{})
+}
+
+// @ID userRBACListBindings
+// @Summary List all role bindings
+// @Success 200 {array} RoleBindingModel
+// @Router /user/rbac/bindings [get]
+// @Security JwtAuth
+// @Failure 401 {object} rest.ErrorResponse
+// @Failure 403 {object} rest.ErrorResponse
+func (s *Service) listBindingsHandler(c *gin.Context) {
+	var resp []RoleBindingModel
+	if err := s.params.LocalStore.Order("id").Find(&resp).Error; err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// @ID userRBACCreateBinding
+// @Summary Bind a role to a SQL user or a SSO claim
+// @Description The binding takes effect for sessions signed in after it is created.
+// @Param request body RoleBindingModel true "Request body"
+// @Success 200 {object} RoleBindingModel
+// @Router /user/rbac/bindings [post]
+// @Security JwtAuth
+// @Failure 400 {object} rest.ErrorResponse
+// @Failure 401 {object} rest.ErrorResponse
+// @Failure 403 {object} rest.ErrorResponse
+func (s *Service) createBindingHandler(c *gin.Context) {
+	var req RoleBindingModel
+	if err := c.ShouldBindJSON(&req); err != nil {
+		_ = c.Error(rest.ErrBadRequest.NewWithNoMessage())
+		return
+	}
+	if err := s.createBinding(&req); err != nil {
+		_ = c.Error(rest.ErrBadRequest.WrapWithNoMessage(err))
+		return
+	}
+	c.JSON(http.StatusOK, req)
+}
+
+// @ID userRBACDeleteBinding
+// @Summary Delete a role binding
+// @Param id path string true "Binding ID"
+// @Success 200 {object} rest.EmptyResponse
+// @Router /user/rbac/bindings/{id} [delete]
+// @Security JwtAuth
+// @Failure 400 {object} rest.ErrorResponse
+// @Failure 401 {object} rest.ErrorResponse
+// @Failure 403 {object} rest.ErrorResponse
+func (s *Service) deleteBindingHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		_ = c.Error(rest.ErrBadRequest.NewWithNoMessage())
+		return
+	}
+	if err := s.params.LocalStore.Where("id = ?", id).Delete(&RoleBindingModel{}).Error; err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, rest.EmptyResponse{})
+}
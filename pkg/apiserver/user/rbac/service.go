@@ -0,0 +1,194 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package rbac
+
+import (
+	"sync"
+
+	"github.com/joomcode/errorx"
+	"go.uber.org/fx"
+
+	"github.com/pingcap/tidb-dashboard/pkg/apiserver/user"
+	"github.com/pingcap/tidb-dashboard/pkg/apiserver/utils"
+	"github.com/pingcap/tidb-dashboard/pkg/dbstore"
+)
+
+var (
+	ErrNS              = errorx.NewNamespace("error.api.user.rbac")
+	ErrRoleNotFound    = ErrNS.NewType("role_not_found")
+	ErrBuiltinRole     = ErrNS.NewType("builtin_role")
+	ErrRoleInUse       = ErrNS.NewType("role_in_use")
+	ErrInvalidRoleSpec = ErrNS.NewType("invalid_role_spec")
+)
+
+type ServiceParams struct {
+	fx.In
+	LocalStore *dbstore.DB
+}
+
+type Service struct {
+	params ServiceParams
+
+	// Roles are checked for every request, so that they are cached in memory.
+	rolesLock sync.RWMutex
+	roles     map[string]*user.Role
+}
+
+func newService(p ServiceParams) (*Service, error) {
+	if err := autoMigrate(p.LocalStore); err != nil {
+		return nil, err
+	}
+	if err := syncBuiltinRoles(p.LocalStore); err != nil {
+		return nil, err
+	}
+	if err := seedRoleBindings(p.LocalStore); err != nil {
+		return nil, err
+	}
+	s := &Service{params: p}
+	if err := s.reloadRoles(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func registerRoleResolver(s *Service, authService *user.AuthService) {
+	authService.RegisterRoleResolver(s)
+}
+
+var Module = fx.Options(
+	fx.Provide(newService),
+	fx.Invoke(registerRoleResolver, registerRouter),
+)
+
+func (s *Service) reloadRoles() error {
+	var models []RoleModel
+	if err := s.params.LocalStore.Find(&models).Error; err != nil {
+		return err
+	}
+	roles := make(map[string]*user.Role, len(models))
+	for i := range models {
+		roles[models[i].Name] = models[i].toRole()
+	}
+
+	s.rolesLock.Lock()
+	defer s.rolesLock.Unlock()
+	s.roles = roles
+	return nil
+}
+
+func (s *Service) GetRole(name string) (*user.Role, error) {
+	s.rolesLock.RLock()
+	defer s.rolesLock.RUnlock()
+	return s.roles[name], nil
+}
+
+// ResolveRoles matches bindings of the SQL user, which is the impersonated SQL user for SSO sessions, and
+// bindings of SSO claims.
+func (s *Service) ResolveRoles(u *utils.SessionUser) ([]string, error) {
+	var bindings []RoleBindingModel
+	if u.HasTiDBAuth {
+		if err := s.params.LocalStore.
+			Where("subject_kind = ? AND subject = ?", SubjectKindSQLUser, u.TiDBUsername).
+			Find(&bindings).Error; err != nil {
+			return nil, err
+		}
+	}
+	if u.SSOClaims != nil {
+		var claimBindings []RoleBindingModel
+		if err := s.params.LocalStore.Where("subject_kind = ?", SubjectKindSSOClaim).Find(&claimBindings).Error; err != nil {
+			return nil, err
+		}
+		bindings = append(bindings, claimBindings...)
+	}
+
+	roles := make([]string, 0)
+	seen := map[string]struct{}{}
+	for _, b := range bindings {
+		if b.SubjectKind == SubjectKindSSOClaim && !claimMatches(u.SSOClaims[b.ClaimName], b.Subject) {
+			continue
+		}
+		if _, ok := seen[b.Role]; ok {
+			continue
+		}
+		seen[b.Role] = struct{}{}
+		roles = append(roles, b.Role)
+	}
+	return roles, nil
+}
+
+func claimMatches(values []string, subject string) bool {
+	for _, v := range values {
+		if v == subject {
+			return true
+		}
+	}
+	return false
+}
+
+func validateRole(r *RoleModel) error {
+	if len(r.Name) == 0 {
+		return ErrInvalidRoleSpec.New("role name cannot be empty")
+	}
+	for _, p := range r.Permissions {
+		if !p.IsValid() {
+			return ErrInvalidRoleSpec.New("unknown permission %s", p)
+		}
+	}
+	return nil
+}
+
+func (s *Service) saveRole(r *RoleModel) error {
+	if err := validateRole(r); err != nil {
+		return err
+	}
+	if existing, _ := s.GetRole(r.Name); existing != nil && existing.IsBuiltin {
+		return ErrBuiltinRole.New("built-in role %s cannot be modified", r.Name)
+	}
+	r.IsBuiltin = false
+	if err := s.params.LocalStore.Save(r).Error; err != nil {
+		return err
+	}
+	return s.reloadRoles()
+}
+
+func (s *Service) deleteRole(name string) error {
+	existing, _ := s.GetRole(name)
+	if existing == nil {
+		return ErrRoleNotFound.New("role %s does not exist", name)
+	}
+	if existing.IsBuiltin {
+		return ErrBuiltinRole.New("built-in role %s cannot be deleted", name)
+	}
+	var count int64
+	if err := s.params.LocalStore.Model(&RoleBindingModel{}).Where("role = ?", name).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrRoleInUse.New("role %s is still bound by %d bindings", name, count)
+	}
+	if err := s.params.LocalStore.Where("name = ?", name).Delete(&RoleModel{}).Error; err != nil {
+		return err
+	}
+	return s.reloadRoles()
+}
+
+func (s *Service) createBinding(b *RoleBindingModel) error {
+	switch b.SubjectKind {
+	case SubjectKindSQLUser:
+		b.ClaimName = ""
+	case SubjectKindSSOClaim:
+		if len(b.ClaimName) == 0 {
+			return ErrInvalidRoleSpec.New("claim name cannot be empty")
+		}
+	default:
+		return ErrInvalidRoleSpec.New("unknown subject kind %s", b.SubjectKind)
+	}
+	if len(b.Subject) == 0 {
+		return ErrInvalidRoleSpec.New("subject cannot be empty")
+	}
+	if r, _ := s.GetRole(b.Role); r == nil {
+		return ErrRoleNotFound.New("role %s does not exist", b.Role)
+	}
+	b.ID = 0
+	return s.params.LocalStore.Create(b).Error
+}
@@ -0,0 +1,44 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package rbac
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/pingcap/tidb-dashboard/pkg/apiserver/user"
+	"github.com/pingcap/tidb-dashboard/pkg/apiserver/utils"
+	"github.com/pingcap/tidb-dashboard/pkg/dbstore"
+	"github.com/pingcap/tidb-dashboard/util/testutil"
+)
+
+func TestResolveRoles(t *testing.T) {
+	s, err := newService(ServiceParams{LocalStore: &dbstore.DB{DB: testutil.OpenTestSQLiteDB(t)}})
+	require.Nil(t, err)
+	require.Nil(t, s.createBinding(&RoleBindingModel{SubjectKind: SubjectKindSQLUser, Subject: "dashboard", Role: user.RoleOperator}))
+	require.Nil(t, s.createBinding(&RoleBindingModel{SubjectKind: SubjectKindSSOClaim, ClaimName: "groups", Subject: "dba", Role: user.RoleAdmin}))
+
+	roles, err := s.ResolveRoles(&utils.SessionUser{HasTiDBAuth: true, TiDBUsername: "root"})
+	require.Nil(t, err)
+	require.Equal(t, []string{user.RoleAdmin}, roles)
+
+	roles, err = s.ResolveRoles(&utils.SessionUser{HasTiDBAuth: true, TiDBUsername: "foo"})
+	require.Nil(t, err)
+	require.Empty(t, roles)
+
+	// SSO sessions match bindings of the impersonated SQL user and bindings of claims.
+	sso := &utils.SessionUser{
+		HasTiDBAuth:  true,
+		TiDBUsername: "dashboard",
+		SSOClaims:    map[string][]string{"groups": {"dev"}},
+	}
+	roles, err = s.ResolveRoles(sso)
+	require.Nil(t, err)
+	require.Equal(t, []string{user.RoleOperator}, roles)
+
+	sso.SSOClaims["groups"] = []string{"dev", "dba"}
+	roles, err = s.ResolveRoles(sso)
+	require.Nil(t, err)
+	require.Equal(t, []string{user.RoleOperator, user.RoleAdmin}, roles)
+}
@@ -18,10 +18,10 @@ func registerRouter(r *gin.RouterGroup, auth *user.AuthService, s *Service) {
 	endpoint.GET("/auth_url", s.getAuthURLHandler)
 	endpoint.Use(auth.MWAuthRequired())
 	// TODO: Forbid modifying config when signed in as SSO.
-	endpoint.GET("/impersonations/list", s.listImpersonationHandler)
-	endpoint.POST("/impersonation", auth.MWRequireWritePriv(), s.createImpersonationHandler)
-	endpoint.GET("/config", s.getConfig)
-	endpoint.PUT("/config", auth.MWRequireWritePriv(), s.setConfig)
+	endpoint.GET("/impersonations/list", auth.MWRequirePermission(user.PermUserSSOConfig), s.listImpersonationHandler)
+	endpoint.POST("/impersonation", auth.MWRequirePermission(user.PermUserSSOConfig), s.createImpersonationHandler)
+	endpoint.GET("/config", auth.MWRequirePermission(user.PermUserSSOConfig), s.getConfig)
+	endpoint.PUT("/config", auth.MWRequirePermission(user.PermUserSSOConfig), s.setConfig)
 }
 
 type GetAuthURLRequest struct {
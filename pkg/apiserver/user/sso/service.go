@@ -6,12 +6,8 @@ import (
 	"context"
 	"crypto/sha256"
 	"encoding/base64"
-	"encoding/hex"
 	"fmt"
-	"io/ioutil"
 	"net/url"
-	"os"
-	"path"
 	"strings"
 	"sync"
 	"time"
@@ -58,21 +54,16 @@ type Service struct {
 	lifecycleCtx     context.Context
 	oauthStateSecret []byte
 
-	encKeyPath string
-	encKeyLock sync.Mutex
-
 	createImpersonationLock sync.Mutex
 }
 
-func newService(p ServiceParams, lc fx.Lifecycle, config *config.Config) (*Service, error) {
+func newService(p ServiceParams, lc fx.Lifecycle) (*Service, error) {
 	if err := autoMigrate(p.LocalStore); err != nil {
 		return nil, err
 	}
 	s := &Service{
 		params:                  p,
 		oauthStateSecret:        cryptopasta.NewHMACKey()[:],
-		encKeyPath:              path.Join(config.DataDir, "dbek.bin"),
-		encKeyLock:              sync.Mutex{},
 		createImpersonationLock: sync.Mutex{},
 	}
 	lc.Append(fx.Hook{
@@ -89,44 +80,6 @@ var Module = fx.Options(
 	fx.Invoke(registerRouter),
 )
 
-func (s *Service) getMasterEncKey() (*[32]byte, error) {
-	b, err := ioutil.ReadFile(s.encKeyPath)
-	if err != nil {
-		// Key does not exist
-		if os.IsNotExist(err) {
-			return nil, nil
-		}
-		return nil, err
-	}
-	if len(b) != 32 {
-		return nil, fmt.Errorf("encryption key is broken")
-	}
-
-	var fixedLenKey [32]byte
-	copy(fixedLenKey[:], b)
-
-	return &fixedLenKey, nil
-}
-
-// This function is thread-safe.
-func (s *Service) getOrCreateMasterEncKey() (*[32]byte, error) {
-	s.encKeyLock.Lock()
-	defer s.encKeyLock.Unlock()
-
-	key, _ := s.getMasterEncKey()
-	if key != nil {
-		return key, nil
-	}
-
-	// Try to create a key otherwise
-	key = cryptopasta.NewEncryptionKey()
-	err := ioutil.WriteFile(s.encKeyPath, key[:], 0o400) // read only for owner
-	if err != nil {
-		return nil, fmt.Errorf("persist key failed: %v", err)
-	}
-	return key, nil
-}
-
 // getAndDecryptImpersonation reads the impersonation record from local Sqlite and decrypt the record to get the
 // plain SQL password. Currently this function only reads `root` user impersonation.
 func (s *Service) getAndDecryptImpersonation() (string, string, error) {
@@ -136,22 +89,11 @@ func (s *Service) getAndDecryptImpersonation() (string, string, error) {
 	if err != nil {
 		return "", "", fmt.Errorf("bad record: %v", err)
 	}
-	key, err := s.getMasterEncKey()
-	if err != nil {
-		return "", "", fmt.Errorf("bad encryption key: %v", err)
-	}
-	if key == nil {
-		return "", "", fmt.Errorf("encryption key is missing")
-	}
-	encrypted, err := hex.DecodeString(imp.EncryptedPass)
-	if err != nil {
-		return "", "", fmt.Errorf("bad record: %v", err)
-	}
-	decryptedPass, err := cryptopasta.Decrypt(encrypted, key)
+	decryptedPass, err := s.params.LocalStore.DecryptSecret(imp.EncryptedPass)
 	if err != nil {
-		return "", "", fmt.Errorf("bad record: %v", err)
+		return "", "", err
 	}
-	return imp.SQLUser, string(decryptedPass), nil
+	return imp.SQLUser, decryptedPass, nil
 }
 
 func (s *Service) updateImpersonationStatus(user string, status ImpersonateStatus) error {
@@ -198,6 +140,7 @@ func (s *Service) newSessionFromImpersonation(userInfo *oAuthUserInfo, idToken s
 		IsShareable:  true,
 		IsWriteable:  writeable && !dc.SSO.CoreConfig.IsReadOnly,
 		OIDCIDToken:  idToken,
+		SSOClaims:    userInfo.claims(),
 	}, nil
 }
 
@@ -215,15 +158,10 @@ func (s *Service) createImpersonation(userName string, password string) (*SSOImp
 			return nil, err
 		}
 	}
-	key, err := s.getOrCreateMasterEncKey()
-	if err != nil {
-		return nil, err
-	}
-	encrypted, err := cryptopasta.Encrypt([]byte(password), key)
+	encryptedInHex, err := s.params.LocalStore.EncryptSecret(password)
 	if err != nil {
 		return nil, err
 	}
-	encryptedInHex := hex.EncodeToString(encrypted)
 
 	record := &SSOImpersonationModel{
 		SQLUser:               userName,
@@ -384,8 +322,17 @@ func (s *Service) exchangeOAuthCode(redirectURL string, code string, codeVerifie
 }
 
 type oAuthUserInfo struct {
-	Name  string `json:"name"`
-	Email string `json:"email"`
+	Name   string   `json:"name"`
+	Email  string   `json:"email"`
+	Groups []string `json:"groups"`
+}
+
+func (info *oAuthUserInfo) claims() map[string][]string {
+	return map[string][]string{
+		"name":   {info.Name},
+		"email":  {info.Email},
+		"groups": info.Groups,
+	}
 }
 
 func (s *Service) oAuthGetUserInfo(accessToken string) (*oAuthUserInfo, error) {
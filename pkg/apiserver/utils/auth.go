@@ -10,12 +10,12 @@ import (
 
 type AuthType int
 
-const SessionVersion = 2
+const SessionVersion = 3
 
 // The content of this structure will be encrypted and stored as both Session Token and Sharing Token.
 // For fields that don't need to be cloned during session sharing, mark fields as `msgpack:"-"`.
 type SessionUser struct {
-	// Must be 2. This field is used to invalidate outdated sessions after schema change.
+	// Must be 3. This field is used to invalidate outdated sessions after schema change.
 	Version int
 
 	DisplayName string
@@ -30,12 +30,18 @@ type SessionUser struct {
 	// This field only exists for SSOAuth
 	OIDCIDToken string `json:",omitempty"`
 
+	// Claims from the SSO user info, only used to resolve roles when signing in.
+	SSOClaims map[string][]string `msgpack:"-" json:"-"`
+
 	// These fields should not be updated by individual authenticators.
 	AuthFrom AuthType `msgpack:"-" json:",omitempty"`
 
-	// TODO: Make them table fields
 	IsShareable bool
 	IsWriteable bool
+
+	// Names of the roles granted to this session. Permissions are resolved from roles for each request, so that
+	// modifications to the role definition take effect immediately.
+	Roles []string
 }
 
 const (
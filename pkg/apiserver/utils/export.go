@@ -3,141 +3,266 @@
 package utils
 
 import (
-	"encoding/base64"
-	"encoding/csv"
+	"encoding/json"
 	"fmt"
 	"io"
-	"io/ioutil"
-	"os"
-	"path/filepath"
 	"reflect"
-	"strings"
 	"time"
 
-	"github.com/Xeoncross/go-aesctr-with-hmac"
-	"github.com/gin-gonic/gin"
-	"github.com/gtank/cryptopasta"
-	"github.com/oleiade/reflections"
-	"github.com/pingcap/log"
-	"go.uber.org/zap"
+	"github.com/xitongsys/parquet-go/source"
+	"github.com/xitongsys/parquet-go/writer"
+	"gorm.io/gorm"
 
-	"github.com/pingcap/tidb-dashboard/util/rest"
+	"github.com/pingcap/tidb-dashboard/util/csvutil"
+	"github.com/pingcap/tidb-dashboard/util/rest/fileswap"
 )
 
-// TODO: Better to be a streaming interface.
-func GenerateCSVFromRaw(rawData []interface{}, fields []string, timeFields []string) (data [][]string) {
-	timeFieldsMap := make(map[string]struct{})
-	for _, f := range timeFields {
-		timeFieldsMap[f] = struct{}{}
-	}
-
-	fieldsMap := make(map[string]string)
-	t := reflect.TypeOf(rawData[0])
-	fieldsNum := t.NumField()
-	allFields := make([]string, fieldsNum)
-	for i := 0; i < fieldsNum; i++ {
-		field := t.Field(i)
-		allFields[i] = strings.ToLower(field.Tag.Get("json"))
-		fieldsMap[allFields[i]] = field.Name
-	}
-	if len(fields) == 1 && fields[0] == "*" {
-		fields = allFields
-	}
-
-	data = [][]string{fields}
-	timeLayout := "01-02 15:04:05"
-	for _, overview := range rawData {
-		row := []string{}
-		for _, field := range fields {
-			fieldName := fieldsMap[field]
-			s, _ := reflections.GetField(overview, fieldName)
-			var val string
-			switch t := s.(type) {
-			case int:
-				if _, ok := timeFieldsMap[field]; ok {
-					val = time.Unix(int64(t), 0).Format(timeLayout)
-				} else {
-					val = fmt.Sprintf("%d", t)
-				}
-			case uint:
-				val = fmt.Sprintf("%d", t)
-			case float64:
-				val = fmt.Sprintf("%f", t)
-			default:
-				val = fmt.Sprintf("%s", t)
-			}
-			row = append(row, val)
-		}
-		data = append(data, row)
+type ExportFormat string
+
+const (
+	ExportFormatCSV     ExportFormat = "csv"
+	ExportFormatNDJSON  ExportFormat = "ndjson"
+	ExportFormatParquet ExportFormat = "parquet"
+)
+
+const (
+	exportDownloadExpire = 5 * time.Minute
+	// Rows are buffered in memory until a row group is full, so keep it small.
+	parquetRowGroupSize = 16 * 1024 * 1024
+)
+
+func (f ExportFormat) IsValid() bool {
+	switch f {
+	case ExportFormatCSV, ExportFormatNDJSON, ExportFormatParquet:
+		return true
+	default:
+		return false
 	}
-	return
 }
 
-// TODO: Better to be a streaming interface.
-func ExportCSV(data [][]string, filename, tokenNamespace string) (token string, err error) {
-	csvFile, err := ioutil.TempFile("", filename)
-	if err != nil {
-		return
+// RowWriter writes struct rows of the same type in a specific format.
+type RowWriter interface {
+	WriteRow(row reflect.Value) error
+	// Close flushes all buffered data. It does not close the underlying writer.
+	Close() error
+}
+
+func NewRowWriter(format ExportFormat, w io.Writer, columns []csvutil.Field, rowType reflect.Type) (RowWriter, error) {
+	switch format {
+	case ExportFormatCSV:
+		return newCSVRowWriter(w, columns, rowType)
+	case ExportFormatNDJSON:
+		return &ndjsonRowWriter{w: w, columns: columns}, nil
+	case ExportFormatParquet:
+		return newParquetRowWriter(w, columns, rowType)
+	default:
+		return nil, fmt.Errorf("unsupported export format %s", format)
 	}
-	defer csvFile.Close() // #nosec
+}
 
-	// generate encryption key
-	secretKey := *cryptopasta.NewEncryptionKey()
+// csvRowWriter writes rows by csvutil.CSVWriter, where values of fields tagged by `csv:",time"` are written as
+// formatted time.
+type csvRowWriter struct {
+	cw *csvutil.CSVWriter
+}
 
-	pr, pw := io.Pipe()
-	go func() {
-		csvwriter := csv.NewWriter(pw)
-		_ = csvwriter.WriteAll(data)
-		_ = pw.Close()
-	}()
-	err = aesctr.Encrypt(pr, csvFile, secretKey[0:16], secretKey[16:])
-	if err != nil {
-		return
+func newCSVRowWriter(w io.Writer, columns []csvutil.Field, rowType reflect.Type) (*csvRowWriter, error) {
+	rw := &csvRowWriter{cw: csvutil.NewCSVWriterWithFields(w, columns)}
+	return rw, rw.cw.WriteAsHeader(reflect.Zero(rowType).Interface())
+}
+
+func (rw *csvRowWriter) WriteRow(row reflect.Value) error {
+	return rw.cw.WriteAsRow(row.Interface())
+}
+
+func (rw *csvRowWriter) Close() error {
+	rw.cw.Flush()
+	return rw.cw.Error()
+}
+
+type ndjsonRowWriter struct {
+	w       io.Writer
+	columns []csvutil.Field
+	buf     []byte
+}
+
+func (rw *ndjsonRowWriter) WriteRow(row reflect.Value) error {
+	// Fields are written in the column order, which is not possible when marshalling a map.
+	rw.buf = append(rw.buf[:0], '{')
+	for i, col := range rw.columns {
+		if i > 0 {
+			rw.buf = append(rw.buf, ',')
+		}
+		v, err := json.Marshal(row.Field(col.Index).Interface())
+		if err != nil {
+			return err
+		}
+		rw.buf = append(rw.buf, '"')
+		rw.buf = append(rw.buf, col.Name...)
+		rw.buf = append(rw.buf, '"', ':')
+		rw.buf = append(rw.buf, v...)
 	}
+	rw.buf = append(rw.buf, '}', '\n')
+	_, err := rw.w.Write(rw.buf)
+	return err
+}
 
-	// generate token by filepath and secretKey
-	secretKeyStr := base64.StdEncoding.EncodeToString(secretKey[:])
-	token, err = NewJWTString(tokenNamespace, secretKeyStr+" "+csvFile.Name())
-	return
+func (rw *ndjsonRowWriter) Close() error {
+	return nil
 }
 
-// FIXME: Remove or refine this function, as it is not general.
-func DownloadByToken(token, tokenNamespace string, c *gin.Context) {
-	tokenPlain, err := ParseJWTString(tokenNamespace, token)
+type parquetRowWriter struct {
+	pw      *writer.CSVWriter
+	columns []csvutil.Field
+}
+
+func getParquetType(kind reflect.Kind) (string, bool) {
+	switch kind {
+	case reflect.String:
+		return "type=UTF8", true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "type=INT64", true
+	case reflect.Float32, reflect.Float64:
+		return "type=DOUBLE", true
+	case reflect.Bool:
+		return "type=BOOLEAN", true
+	default:
+		return "", false
+	}
+}
+
+func newParquetRowWriter(w io.Writer, columns []csvutil.Field, rowType reflect.Type) (*parquetRowWriter, error) {
+	md := make([]string, 0, len(columns))
+	for _, col := range columns {
+		typ, ok := getParquetType(rowType.Field(col.Index).Type.Kind())
+		if !ok {
+			return nil, fmt.Errorf("field %s is not supported in parquet", col.Name)
+		}
+		md = append(md, fmt.Sprintf("name=%s, %s, repetitiontype=REQUIRED", col.Name, typ))
+	}
+	pw, err := writer.NewCSVWriter(md, &parquetWriterFile{w}, 1)
 	if err != nil {
-		_ = c.Error(rest.ErrBadRequest.WrapWithNoMessage(err))
-		return
+		return nil, err
 	}
-	arr := strings.Fields(tokenPlain)
-	if len(arr) != 2 {
-		_ = c.Error(rest.ErrBadRequest.New("invalid token"))
-		return
+	pw.RowGroupSize = parquetRowGroupSize
+	return &parquetRowWriter{pw: pw, columns: columns}, nil
+}
+
+func (rw *parquetRowWriter) WriteRow(row reflect.Value) error {
+	rec := make([]interface{}, 0, len(rw.columns))
+	for _, col := range rw.columns {
+		fv := row.Field(col.Index)
+		switch fv.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			rec = append(rec, fv.Int())
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			rec = append(rec, int64(fv.Uint()))
+		case reflect.Float32, reflect.Float64:
+			rec = append(rec, fv.Float())
+		default:
+			rec = append(rec, fv.Interface())
+		}
 	}
-	secretKey, err := base64.StdEncoding.DecodeString(arr[0])
+	return rw.pw.Write(rec)
+}
+
+func (rw *parquetRowWriter) Close() error {
+	return rw.pw.WriteStop()
+}
+
+// parquetWriterFile is a write-only parquet file, which is enough for writing parquet in a stream.
+type parquetWriterFile struct {
+	io.Writer
+}
+
+func (f *parquetWriterFile) Create(name string) (source.ParquetFile, error) {
+	return f, nil
+}
+
+func (f *parquetWriterFile) Open(name string) (source.ParquetFile, error) {
+	return f, nil
+}
+
+func (f *parquetWriterFile) Seek(offset int64, whence int) (int64, error) {
+	return 0, nil
+}
+
+func (f *parquetWriterFile) Read(p []byte) (int, error) {
+	return 0, io.EOF
+}
+
+func (f *parquetWriterFile) Close() error {
+	return nil
+}
+
+// StreamExport runs the query and writes the result into a new file of the fileswap handler in the specified format.
+// Rows are scanned one by one from the cursor into `model`, which must be a pointer to a struct, so that the memory
+// usage does not grow with the number of rows. `fields` are JSON names of fields to export, see
+// `csvutil.SelectFields`.
+//
+// The download token of the file is returned. When there are no rows, the file is removed and an empty token is
+// returned.
+func StreamExport(
+	fSwap *fileswap.Handler,
+	tx *gorm.DB,
+	model interface{},
+	fields []string,
+	format ExportFormat,
+	fileName string,
+) (string, error) {
+	rowValue := reflect.ValueOf(model).Elem()
+	columns := csvutil.SelectFields(rowValue.Type(), fields)
+
+	rows, err := tx.Rows()
 	if err != nil {
-		_ = c.Error(rest.ErrBadRequest.WrapWithNoMessage(err))
-		return
+		return "", err
 	}
+	defer rows.Close() // #nosec
 
-	filePath := arr[1]
-	fileInfo, err := os.Stat(filePath)
+	fw, err := fSwap.NewFileWriter("export")
 	if err != nil {
-		_ = c.Error(err)
-		return
+		return "", err
 	}
-	f, err := os.Open(filepath.Clean(filePath))
+	succeeded := false
+	defer func() {
+		if !succeeded {
+			fw.Remove()
+		}
+	}()
+
+	rw, err := NewRowWriter(format, fw, columns, rowValue.Type())
 	if err != nil {
-		_ = c.Error(err)
-		return
+		return "", err
+	}
+	rowsCount := 0
+	for rows.Next() {
+		rowValue.Set(reflect.Zero(rowValue.Type()))
+		if err := tx.ScanRows(rows, model); err != nil {
+			return "", err
+		}
+		if err := rw.WriteRow(rowValue); err != nil {
+			return "", err
+		}
+		rowsCount++
+	}
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+	if rowsCount == 0 {
+		return "", nil
+	}
+	if err := rw.Close(); err != nil {
+		return "", err
+	}
+	if err := fw.Close(); err != nil {
+		return "", err
 	}
 
-	c.Writer.Header().Set("Content-type", "text/csv")
-	c.Writer.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, fileInfo.Name()))
-	err = aesctr.Decrypt(f, c.Writer, secretKey[0:16], secretKey[16:])
+	token, err := fw.GetDownloadToken(fmt.Sprintf("%s.%s", fileName, format), exportDownloadExpire)
 	if err != nil {
-		log.Error("decrypt csv failed", zap.Error(err))
+		return "", err
 	}
-	// delete it anyway
-	_ = f.Close()
-	_ = os.Remove(filePath)
+	succeeded = true
+	return token, nil
 }
@@ -0,0 +1,130 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package utils
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"reflect"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	. "github.com/pingcap/check"
+	"github.com/xitongsys/parquet-go/reader"
+	"github.com/xitongsys/parquet-go/source"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/pingcap/tidb-dashboard/util/csvutil"
+	"github.com/pingcap/tidb-dashboard/util/rest/fileswap"
+)
+
+var _ = Suite(&testExportSuite{})
+
+type testExportSuite struct{}
+
+type exportTestRow struct {
+	Digest    string  `json:"digest"`
+	ExecCount uint    `json:"exec_count"`
+	Latency   float64 `json:"latency"`
+	FirstSeen int     `json:"first_seen" csv:",time"`
+	private   string
+}
+
+func writeRows(c *C, format ExportFormat, fields []string, rows []exportTestRow) []byte {
+	rowType := reflect.TypeOf(exportTestRow{})
+	columns := csvutil.SelectFields(rowType, fields)
+	buf := bytes.Buffer{}
+	rw, err := NewRowWriter(format, &buf, columns, rowType)
+	c.Assert(err, IsNil)
+	for i := range rows {
+		c.Assert(rw.WriteRow(reflect.ValueOf(rows[i])), IsNil)
+	}
+	c.Assert(rw.Close(), IsNil)
+	return buf.Bytes()
+}
+
+var testRows = []exportTestRow{
+	{Digest: "d1", ExecCount: 3, Latency: 1.5, FirstSeen: 0, private: "x"},
+	{Digest: "d,2", ExecCount: 4, Latency: 2, FirstSeen: 60},
+}
+
+func (t *testExportSuite) Test_CSV(c *C) {
+	out := string(writeRows(c, ExportFormatCSV, []string{"digest", "exec_count", "first_seen"}, testRows))
+	expected := strings.Join([]string{
+		"digest,exec_count,first_seen",
+		"d1,3,1970-01-01 00:00:00 UTC",
+		`"d,2",4,1970-01-01 00:01:00 UTC`,
+		"",
+	}, "\n")
+	c.Assert(out, Equals, expected)
+}
+
+func (t *testExportSuite) Test_NDJSON(c *C) {
+	out := string(writeRows(c, ExportFormatNDJSON, []string{"latency", "digest"}, testRows))
+	c.Assert(out, Equals, "{\"latency\":1.5,\"digest\":\"d1\"}\n{\"latency\":2,\"digest\":\"d,2\"}\n")
+}
+
+// readOnlyParquetFile reads a parquet file in memory.
+type readOnlyParquetFile struct {
+	*bytes.Reader
+}
+
+func (f *readOnlyParquetFile) Write(p []byte) (int, error) {
+	panic("unsupported")
+}
+
+func (f *readOnlyParquetFile) Close() error {
+	return nil
+}
+
+func (f *readOnlyParquetFile) Open(name string) (source.ParquetFile, error) {
+	return &readOnlyParquetFile{bytes.NewReader(f.clone())}, nil
+}
+
+func (f *readOnlyParquetFile) Create(name string) (source.ParquetFile, error) {
+	panic("unsupported")
+}
+
+func (f *readOnlyParquetFile) clone() []byte {
+	data := make([]byte, f.Size())
+	_, _ = f.ReadAt(data, 0)
+	return data
+}
+
+func (t *testExportSuite) Test_Parquet(c *C) {
+	out := writeRows(c, ExportFormatParquet, []string{"*"}, testRows)
+	c.Assert(string(out[:4]), Equals, "PAR1")
+
+	pr, err := reader.NewParquetReader(&readOnlyParquetFile{bytes.NewReader(out)}, nil, 1)
+	c.Assert(err, IsNil)
+	c.Assert(pr.GetNumRows(), Equals, int64(2))
+	pr.ReadStop()
+}
+
+func (t *testExportSuite) Test_StreamExport(c *C) {
+	db, err := gorm.Open(sqlite.Open(path.Join(c.MkDir(), "test.sqlite.db")))
+	c.Assert(err, IsNil)
+	c.Assert(db.Exec("CREATE TABLE t (digest TEXT, exec_count INTEGER, latency REAL)").Error, IsNil)
+
+	fSwap := fileswap.New()
+	token, err := StreamExport(fSwap, db.Table("t").Select("digest, exec_count"), &exportTestRow{},
+		[]string{"digest", "exec_count"}, ExportFormatCSV, "foo")
+	c.Assert(err, IsNil)
+	c.Assert(token, Equals, "")
+
+	c.Assert(db.Exec("INSERT INTO t VALUES ('d1', 3, 1.5), ('d2', 4, 2)").Error, IsNil)
+	token, err = StreamExport(fSwap, db.Table("t").Select("digest, exec_count").Order("digest"), &exportTestRow{},
+		[]string{"digest", "exec_count"}, ExportFormatCSV, "foo")
+	c.Assert(err, IsNil)
+
+	r := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(r)
+	ctx.Request, _ = http.NewRequest(http.MethodGet, "/download?token="+token, nil)
+	fSwap.HandleDownloadRequest(ctx)
+	c.Assert(r.Code, Equals, http.StatusOK)
+	c.Assert(r.Header().Get("Content-Disposition"), Equals, `attachment; filename="foo.csv"`)
+	c.Assert(r.Body.String(), Equals, "digest,exec_count\nd1,3\nd2,4\n")
+}
@@ -15,11 +15,31 @@ const (
 	DefaultProfilingAutoCollectionDurationSecs = 30
 	MaxProfilingAutoCollectionDurationSecs     = 120
 	DefaultProfilingAutoCollectionIntervalSecs = 3600
+	MaxProfilingTriggerRules                   = 20
+
+	ProfilingTriggerMetricCPU    = "cpu"
+	ProfilingTriggerMetricMemory = "memory"
+	ProfilingTriggerMetricHeap   = "heap"
+
+	DefaultAuditRetentionDays = 30
+	MaxAuditRetentionDays     = 3650
+
+	DefaultArtifactQuotaMB       = 10 * 1024
+	DefaultArtifactMaxAgeDays    = 7
+	MaxArtifactMaxAgeDays        = 3650
+	DefaultArtifactMinFreeDiskMB = 1024
+
+	DefaultConprofProfileSecs   = 10
+	MaxConprofProfileSecs       = 60
+	DefaultConprofIntervalSecs  = 60
+	DefaultConprofRetentionSecs = 3 * 24 * 3600
 )
 
 var (
 	KeyVisualPolicies = []string{KeyVisualDBPolicy, KeyVisualKVPolicy}
 
+	ProfilingTriggerMetrics = []string{ProfilingTriggerMetricCPU, ProfilingTriggerMetricMemory, ProfilingTriggerMetricHeap}
+
 	ErrVerificationFailed = ErrorNS.NewType("verification failed")
 )
 
@@ -42,6 +62,84 @@ type ProfilingConfig struct {
 	AutoCollectionTargets      []model.RequestTargetNode `json:"auto_collection_targets"`
 	AutoCollectionDurationSecs uint                      `json:"auto_collection_duration_secs"`
 	AutoCollectionIntervalSecs uint                      `json:"auto_collection_interval_secs"`
+	TriggerRules               []ProfilingTriggerRule    `json:"trigger_rules"`
+}
+
+// ProfilingTriggerRule starts profiling an instance when a metric of the instance exceeds the threshold, e.g.
+// TiDB CPU usage > 800% for 2 minutes.
+type ProfilingTriggerRule struct {
+	Name      string         `json:"name"`
+	Component model.NodeKind `json:"component"`
+	// Predefined metric, which is one of:
+	// - cpu: CPU usage in percentage of a single core, e.g. 200 means 2 cores are fully used.
+	// - memory: resident memory in bytes.
+	// - heap: heap in use in bytes, which is not available for TiFlash.
+	// It is ignored when Query is specified.
+	Metric string `json:"metric"`
+	// A PromQL query returning a value for each instance. The `instance` label must be the status address of the
+	// instance, which is the default of Prometheus deployed by TiUP.
+	Query     string  `json:"query"`
+	Threshold float64 `json:"threshold"`
+	// Profiling is started only when the value exceeds the threshold for this duration.
+	ForSecs uint `json:"for_secs"`
+	// An instance is not profiled by the rule again within this duration.
+	CooldownSecs   uint     `json:"cooldown_secs"`
+	DurationSecs   uint     `json:"duration_secs"`
+	ProfilingTypes []string `json:"profiling_types"`
+}
+
+func (r *ProfilingTriggerRule) validate() error {
+	if r.Name == "" {
+		return ErrVerificationFailed.New("name of trigger rule cannot be empty")
+	}
+	switch r.Component {
+	case model.NodeKindTiDB, model.NodeKindTiKV, model.NodeKindPD, model.NodeKindTiFlash:
+	default:
+		return ErrVerificationFailed.New("component of trigger rule %s is not supported", r.Name)
+	}
+	if r.Query == "" {
+		valid := false
+		for _, m := range ProfilingTriggerMetrics {
+			valid = valid || m == r.Metric
+		}
+		if !valid {
+			return ErrVerificationFailed.New("metric of trigger rule %s must be in %v", r.Name, ProfilingTriggerMetrics)
+		}
+		if r.Metric == ProfilingTriggerMetricHeap && r.Component == model.NodeKindTiFlash {
+			return ErrVerificationFailed.New("metric of trigger rule %s is not supported by %s", r.Name, r.Component)
+		}
+	}
+	if r.DurationSecs == 0 {
+		return ErrVerificationFailed.New("duration_secs of trigger rule %s cannot be 0", r.Name)
+	}
+	if r.DurationSecs > MaxProfilingAutoCollectionDurationSecs {
+		return ErrVerificationFailed.New("duration_secs of trigger rule %s cannot be greater than %d", r.Name, MaxProfilingAutoCollectionDurationSecs)
+	}
+	if r.CooldownSecs < r.DurationSecs {
+		return ErrVerificationFailed.New("cooldown_secs of trigger rule %s cannot be less than duration_secs", r.Name)
+	}
+	if len(r.ProfilingTypes) == 0 {
+		return ErrVerificationFailed.New("profiling_types of trigger rule %s cannot be empty", r.Name)
+	}
+	return nil
+}
+
+func (c *ProfilingConfig) validateTriggerRules() error {
+	if len(c.TriggerRules) > MaxProfilingTriggerRules {
+		return ErrVerificationFailed.New("at most %d trigger rules are allowed", MaxProfilingTriggerRules)
+	}
+	names := make(map[string]struct{})
+	for i := range c.TriggerRules {
+		r := &c.TriggerRules[i]
+		if err := r.validate(); err != nil {
+			return err
+		}
+		if _, ok := names[r.Name]; ok {
+			return ErrVerificationFailed.New("duplicated trigger rule %s", r.Name)
+		}
+		names[r.Name] = struct{}{}
+	}
+	return nil
 }
 
 type SSOCoreConfig struct {
@@ -59,16 +157,72 @@ type SSOConfig struct {
 	SignOutURL  string        `json:"sign_out_url"`
 }
 
+type AuditConfig struct {
+	RetentionDays uint `json:"retention_days"`
+}
+
+// ArtifactConfig limits the disk usage of files produced by log searching and profiling.
+type ArtifactConfig struct {
+	// Least recently used artifacts are removed when the total size exceeds the quota.
+	QuotaMB    uint `json:"quota_mb"`
+	MaxAgeDays uint `json:"max_age_days"`
+	// New tasks are refused when the free space of the disk is less than this value.
+	MinFreeDiskMB uint `json:"min_free_disk_mb"`
+}
+
+// ConprofConfig is the config of the built-in continuous profiling, which is used when NgMonitoring is not
+// deployed. CPU and heap are profiled periodically.
+type ConprofConfig struct {
+	Enable bool `json:"enable"`
+	// Components to be profiled, all components are profiled when empty.
+	Components    []model.NodeKind `json:"components"`
+	ProfileSecs   uint             `json:"profile_secs"`
+	IntervalSecs  uint             `json:"interval_secs"`
+	RetentionSecs uint             `json:"retention_secs"`
+}
+
+func (c *ConprofConfig) validate() error {
+	for _, comp := range c.Components {
+		switch comp {
+		case model.NodeKindTiDB, model.NodeKindTiKV, model.NodeKindPD, model.NodeKindTiFlash:
+		default:
+			return ErrVerificationFailed.New("component %s is not supported", comp)
+		}
+	}
+	if c.ProfileSecs == 0 {
+		return ErrVerificationFailed.New("profile_secs cannot be 0")
+	}
+	if c.ProfileSecs > MaxConprofProfileSecs {
+		return ErrVerificationFailed.New("profile_secs cannot be greater than %d", MaxConprofProfileSecs)
+	}
+	if c.IntervalSecs < c.ProfileSecs {
+		return ErrVerificationFailed.New("interval_secs cannot be less than profile_secs")
+	}
+	if c.RetentionSecs < c.IntervalSecs {
+		return ErrVerificationFailed.New("retention_secs cannot be less than interval_secs")
+	}
+	return nil
+}
+
 type DynamicConfig struct {
 	KeyVisual KeyVisualConfig `json:"keyvisual"`
 	Profiling ProfilingConfig `json:"profiling"`
 	SSO       SSOConfig       `json:"sso"`
+	Audit     AuditConfig     `json:"audit"`
+	Artifact  ArtifactConfig  `json:"artifact"`
+	Conprof   ConprofConfig   `json:"conprof"`
 }
 
 func (c *DynamicConfig) Clone() *DynamicConfig {
 	newCfg := *c
 	newCfg.Profiling.AutoCollectionTargets = make([]model.RequestTargetNode, len(c.Profiling.AutoCollectionTargets))
 	copy(newCfg.Profiling.AutoCollectionTargets, c.Profiling.AutoCollectionTargets)
+	newCfg.Profiling.TriggerRules = make([]ProfilingTriggerRule, len(c.Profiling.TriggerRules))
+	for i, r := range c.Profiling.TriggerRules {
+		r.ProfilingTypes = append([]string(nil), r.ProfilingTypes...)
+		newCfg.Profiling.TriggerRules[i] = r
+	}
+	newCfg.Conprof.Components = append([]model.NodeKind(nil), c.Conprof.Components...)
 	return &newCfg
 }
 
@@ -98,6 +252,31 @@ func (c *DynamicConfig) Validate() error {
 		}
 	}
 
+	if err := c.Profiling.validateTriggerRules(); err != nil {
+		return err
+	}
+
+	if c.Audit.RetentionDays == 0 {
+		return ErrVerificationFailed.New("retention_days cannot be 0")
+	}
+	if c.Audit.RetentionDays > MaxAuditRetentionDays {
+		return ErrVerificationFailed.New("retention_days cannot be greater than %d", MaxAuditRetentionDays)
+	}
+
+	if c.Artifact.QuotaMB == 0 {
+		return ErrVerificationFailed.New("quota_mb cannot be 0")
+	}
+	if c.Artifact.MaxAgeDays == 0 {
+		return ErrVerificationFailed.New("max_age_days cannot be 0")
+	}
+	if c.Artifact.MaxAgeDays > MaxArtifactMaxAgeDays {
+		return ErrVerificationFailed.New("max_age_days cannot be greater than %d", MaxArtifactMaxAgeDays)
+	}
+
+	if err := c.Conprof.validate(); err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -123,4 +302,39 @@ func (c *DynamicConfig) Adjust() {
 		c.Profiling.AutoCollectionDurationSecs = 0
 		c.Profiling.AutoCollectionIntervalSecs = 0
 	}
+
+	if c.Audit.RetentionDays == 0 {
+		c.Audit.RetentionDays = DefaultAuditRetentionDays
+	}
+	if c.Audit.RetentionDays > MaxAuditRetentionDays {
+		c.Audit.RetentionDays = MaxAuditRetentionDays
+	}
+
+	// The free disk space check is allowed to be disabled by 0, so that it is only filled for the old version.
+	if c.Artifact.QuotaMB == 0 {
+		c.Artifact.QuotaMB = DefaultArtifactQuotaMB
+		c.Artifact.MinFreeDiskMB = DefaultArtifactMinFreeDiskMB
+	}
+	if c.Artifact.MaxAgeDays == 0 {
+		c.Artifact.MaxAgeDays = DefaultArtifactMaxAgeDays
+	}
+	if c.Artifact.MaxAgeDays > MaxArtifactMaxAgeDays {
+		c.Artifact.MaxAgeDays = MaxArtifactMaxAgeDays
+	}
+
+	if c.Conprof.ProfileSecs == 0 {
+		c.Conprof.ProfileSecs = DefaultConprofProfileSecs
+	}
+	if c.Conprof.ProfileSecs > MaxConprofProfileSecs {
+		c.Conprof.ProfileSecs = MaxConprofProfileSecs
+	}
+	if c.Conprof.IntervalSecs < c.Conprof.ProfileSecs {
+		c.Conprof.IntervalSecs = DefaultConprofIntervalSecs
+	}
+	if c.Conprof.RetentionSecs < c.Conprof.IntervalSecs {
+		c.Conprof.RetentionSecs = DefaultConprofRetentionSecs
+		if c.Conprof.RetentionSecs < c.Conprof.IntervalSecs {
+			c.Conprof.RetentionSecs = c.Conprof.IntervalSecs
+		}
+	}
 }
@@ -31,6 +31,10 @@ var (
 
 type DynamicConfigOption func(dc *DynamicConfig)
 
+// DynamicConfigValidator validates the parts of the dynamic config owned by other modules, e.g. profiling types of
+// trigger rules, which are checked in addition to DynamicConfig.Validate when the config is modified.
+type DynamicConfigValidator func(dc *DynamicConfig) error
+
 type DynamicConfigManager struct {
 	mu sync.RWMutex
 
@@ -40,6 +44,7 @@ type DynamicConfigManager struct {
 
 	dynamicConfig *DynamicConfig
 	pushChannels  []chan *DynamicConfig
+	validators    []DynamicConfigValidator
 }
 
 func NewDynamicConfigManager(lc fx.Lifecycle, config *Config, etcdClient *clientv3.Client) *DynamicConfigManager {
@@ -109,6 +114,12 @@ func (m *DynamicConfigManager) NewPushChannel() <-chan *DynamicConfig {
 	return ch
 }
 
+func (m *DynamicConfigManager) AddValidator(v DynamicConfigValidator) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.validators = append(m.validators, v)
+}
+
 func (m *DynamicConfigManager) Get() (*DynamicConfig, error) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
@@ -147,6 +158,14 @@ func (m *DynamicConfigManager) Modify(opts ...DynamicConfigOption) error {
 	if err := newDc.Validate(); err != nil {
 		return err
 	}
+	m.mu.RLock()
+	validators := m.validators
+	m.mu.RUnlock()
+	for _, v := range validators {
+		if err := v(newDc); err != nil {
+			return err
+		}
+	}
 
 	return m.Set(newDc)
 }
@@ -6,6 +6,7 @@ import (
 	"context"
 	"os"
 	"path"
+	"sync"
 
 	"github.com/pingcap/log"
 	"go.uber.org/fx"
@@ -20,6 +21,9 @@ import (
 
 type DB struct {
 	*gorm.DB
+
+	encKeyPath string
+	encKeyLock sync.Mutex
 }
 
 func NewDBStore(lc fx.Lifecycle, config *config.Config) (*DB, error) {
@@ -39,7 +43,9 @@ func NewDBStore(lc fx.Lifecycle, config *config.Config) (*DB, error) {
 		return nil, err
 	}
 
-	db := &DB{gormDB}
+	storageFilePath.Store(p)
+
+	db := &DB{DB: gormDB, encKeyPath: path.Join(config.DataDir, "dbek.bin")}
 
 	lc.Append(fx.Hook{
 		OnStop: func(context.Context) error {
@@ -0,0 +1,86 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package dbstore
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/gtank/cryptopasta"
+)
+
+// GetMasterEncKey reads the master key used to encrypt secrets stored in the local storage.
+// nil is returned when the key does not exist yet.
+func (db *DB) GetMasterEncKey() (*[32]byte, error) {
+	b, err := ioutil.ReadFile(db.encKeyPath)
+	if err != nil {
+		// Key does not exist
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if len(b) != 32 {
+		return nil, fmt.Errorf("encryption key is broken")
+	}
+
+	var fixedLenKey [32]byte
+	copy(fixedLenKey[:], b)
+
+	return &fixedLenKey, nil
+}
+
+// GetOrCreateMasterEncKey is similar to GetMasterEncKey, but creates the key when it does not exist.
+// This function is thread-safe.
+func (db *DB) GetOrCreateMasterEncKey() (*[32]byte, error) {
+	db.encKeyLock.Lock()
+	defer db.encKeyLock.Unlock()
+
+	key, _ := db.GetMasterEncKey()
+	if key != nil {
+		return key, nil
+	}
+
+	// Try to create a key otherwise
+	key = cryptopasta.NewEncryptionKey()
+	err := ioutil.WriteFile(db.encKeyPath, key[:], 0o400) // read only for owner
+	if err != nil {
+		return nil, fmt.Errorf("persist key failed: %v", err)
+	}
+	return key, nil
+}
+
+// EncryptSecret encrypts the secret using the master key and returns it in hex.
+func (db *DB) EncryptSecret(plain string) (string, error) {
+	key, err := db.GetOrCreateMasterEncKey()
+	if err != nil {
+		return "", err
+	}
+	encrypted, err := cryptopasta.Encrypt([]byte(plain), key)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(encrypted), nil
+}
+
+// DecryptSecret decrypts a secret produced by EncryptSecret.
+func (db *DB) DecryptSecret(encryptedInHex string) (string, error) {
+	key, err := db.GetMasterEncKey()
+	if err != nil {
+		return "", fmt.Errorf("bad encryption key: %v", err)
+	}
+	if key == nil {
+		return "", fmt.Errorf("encryption key is missing")
+	}
+	encrypted, err := hex.DecodeString(encryptedInHex)
+	if err != nil {
+		return "", fmt.Errorf("bad record: %v", err)
+	}
+	decrypted, err := cryptopasta.Decrypt(encrypted, key)
+	if err != nil {
+		return "", fmt.Errorf("bad record: %v", err)
+	}
+	return string(decrypted), nil
+}
@@ -0,0 +1,37 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package dbstore
+
+import (
+	"os"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/atomic"
+
+	"github.com/pingcap/tidb-dashboard/pkg/apiserver/metrics/selfmetrics"
+)
+
+// The path of the opened storage file. Empty if the storage is not opened.
+var storageFilePath atomic.String
+
+var storageSizeGauge = prometheus.NewGaugeFunc(
+	prometheus.GaugeOpts{
+		Namespace: "tidb_dashboard",
+		Subsystem: "dbstore",
+		Name:      "size_bytes",
+		Help:      "Size of the local storage file.",
+	}, func() float64 {
+		p := storageFilePath.Load()
+		if p == "" {
+			return 0
+		}
+		fi, err := os.Stat(p)
+		if err != nil {
+			return 0
+		}
+		return float64(fi.Size())
+	})
+
+func init() {
+	selfmetrics.Add(storageSizeGauge)
+}
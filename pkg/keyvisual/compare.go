@@ -0,0 +1,93 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package keyvisual
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/pingcap/tidb-dashboard/pkg/keyvisual/matrix"
+	"github.com/pingcap/tidb-dashboard/pkg/keyvisual/region"
+	"github.com/pingcap/tidb-dashboard/util/rest"
+)
+
+const (
+	defaultCompareTop    = 10
+	maxCompareTop        = 100
+	defaultCompareOffset = 24 * time.Hour
+)
+
+type CompareHeatmapsRequest struct {
+	StartTime int64 `json:"starttime" form:"starttime"` // default: 6 hours ago
+	EndTime   int64 `json:"endtime" form:"endtime"`     // default: now
+	// The base time window to compare with, default: the same duration one day before starttime
+	BaseStartTime int64  `json:"base_starttime" form:"base_starttime"`
+	BaseEndTime   int64  `json:"base_endtime" form:"base_endtime"`
+	Type          string `json:"type" form:"type"` // default: integration
+	Top           int    `json:"top" form:"top"`   // default: 10
+}
+
+type CompareHeatmapsResponse struct {
+	matrix.Comparison
+	StartTime     int64                `json:"start_time"`
+	EndTime       int64                `json:"end_time"`
+	BaseStartTime int64                `json:"base_start_time"`
+	BaseEndTime   int64                `json:"base_end_time"`
+	Type          string               `json:"type"`
+	TopChanges    []matrix.RangeChange `json:"top_changes"`
+}
+
+// @Summary Compare Key Visual Heatmaps
+// @Description Compare the traffic of key ranges between a base and a target time window on the same key axis. Values are the average per minute.
+// @Param q query CompareHeatmapsRequest true "Query"
+// @Success 200 {object} CompareHeatmapsResponse
+// @Router /keyvisual/heatmaps/compare [get]
+// @Security JwtAuth
+// @Failure 400 {object} rest.ErrorResponse
+// @Failure 401 {object} rest.ErrorResponse
+func (s *Service) compareHeatmaps(c *gin.Context) {
+	var req CompareHeatmapsRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		_ = c.Error(rest.ErrBadRequest.WrapWithNoMessage(err))
+		return
+	}
+	startTime, endTime, err := parseTimeRange(req.StartTime, req.EndTime)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	baseStartTime := startTime.Add(-defaultCompareOffset)
+	if req.BaseStartTime != 0 {
+		baseStartTime = time.Unix(req.BaseStartTime, 0)
+	}
+	baseEndTime := baseStartTime.Add(endTime.Sub(startTime))
+	if req.BaseEndTime != 0 {
+		baseEndTime = time.Unix(req.BaseEndTime, 0)
+	}
+	if !baseStartTime.Before(baseEndTime) {
+		_ = c.Error(rest.ErrBadRequest.New("base_starttime must be less than base_endtime"))
+		return
+	}
+	if req.Top <= 0 {
+		req.Top = defaultCompareTop
+	}
+	if req.Top > maxCompareTop {
+		req.Top = maxCompareTop
+	}
+
+	baseTag := region.IntoTag(req.Type)
+	basePlane := s.stat.Range(baseStartTime, baseEndTime, "", "", baseTag)
+	targetPlane := s.stat.Range(startTime, endTime, "", "", baseTag)
+	cmp := matrix.ComparePlanes(s.strategy, basePlane, targetPlane, heatmapsMaxDisplayY, region.GetDisplayTags(baseTag))
+	c.JSON(http.StatusOK, CompareHeatmapsResponse{
+		Comparison:    cmp,
+		StartTime:     startTime.Unix(),
+		EndTime:       endTime.Unix(),
+		BaseStartTime: baseStartTime.Unix(),
+		BaseEndTime:   baseEndTime.Unix(),
+		Type:          baseTag.String(),
+		TopChanges:    cmp.TopChanges(req.Top),
+	})
+}
@@ -30,6 +30,23 @@ type Labeler interface {
 	Label(keys []string) []LabelKey
 }
 
+// TableInfo is the table and the index which a key belongs to.
+type TableInfo struct {
+	TableID int64
+	DB      string
+	Table   string
+	// IndexID is 0 if the key belongs to the records of the table.
+	IndexID int64
+	Index   string
+}
+
+// TableLabeler is a Labeler that can also map keys to tables and indexes.
+type TableLabeler interface {
+	Labeler
+	// TableInfo returns the table and the index of the key. It returns false if the key does not belong to a table.
+	TableInfo(key string) (TableInfo, bool)
+}
+
 // NaiveLabelStrategy is one of the simplest LabelStrategy.
 func NaiveLabelStrategy() LabelStrategy {
 	return naiveLabelStrategy{}
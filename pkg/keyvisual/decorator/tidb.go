@@ -155,6 +155,41 @@ func (e *tidbLabeler) label(key string) (label LabelKey) {
 	return
 }
 
+// TableInfo parses the table and the index of the key, and uses names from TiDB when they are known.
+func (e *tidbLabeler) TableInfo(key string) (info TableInfo, ok bool) {
+	keyInfo, _ := e.Buffer.DecodeKey(region.Bytes(key))
+	isMeta, tableID := keyInfo.MetaOrTable()
+	if isMeta || tableID == 0 {
+		return
+	}
+
+	info.TableID = tableID
+	info.IndexID = keyInfo.IndexInfo()
+	var detail *tableDetail
+	if v, ok := e.TableMap.Load(tableID); ok {
+		detail = v.(*tableDetail)
+		info.DB, info.Table = detail.DB, detail.Name
+	} else {
+		info.Table = fmt.Sprintf("table_%d", tableID)
+	}
+	if info.IndexID != 0 {
+		if name, ok := detail.indexName(info.IndexID); ok {
+			info.Index = name
+		} else {
+			info.Index = fmt.Sprintf("index_%d", info.IndexID)
+		}
+	}
+	return info, true
+}
+
+func (detail *tableDetail) indexName(indexID int64) (string, bool) {
+	if detail == nil {
+		return "", false
+	}
+	name, ok := detail.Indices[indexID]
+	return name, ok
+}
+
 var globalStart = LabelKey{
 	Key:    "",
 	Labels: []string{"meta"},
@@ -4,8 +4,36 @@ package decorator
 
 import (
 	. "github.com/pingcap/check"
+
+	"github.com/pingcap/tidb-dashboard/pkg/tidb/model"
 )
 
 var _ = Suite(&testTiDBSuite{})
 
 type testTiDBSuite struct{}
+
+func (t *testTiDBSuite) TestTableInfo(c *C) {
+	s := &tidbLabelStrategy{}
+	s.TableMap.Store(int64(45), &tableDetail{
+		Name:    "orders",
+		DB:      "shop",
+		ID:      45,
+		Indices: map[int64]string{1: "idx_user"},
+	})
+	labeler := s.NewLabeler().(TableLabeler)
+	var buf model.KeyInfoBuffer
+
+	info, ok := labeler.TableInfo(string(buf.GenerateKey(45, 0)))
+	c.Assert(ok, IsTrue)
+	c.Assert(info, DeepEquals, TableInfo{TableID: 45, DB: "shop", Table: "orders"})
+
+	info, ok = labeler.TableInfo(string(buf.GenerateKey(46, 0)))
+	c.Assert(ok, IsTrue)
+	c.Assert(info, DeepEquals, TableInfo{TableID: 46, Table: "table_46"})
+
+	_, ok = labeler.TableInfo("")
+	c.Assert(ok, IsFalse)
+
+	_, ok = NaiveLabelStrategy().NewLabeler().(TableLabeler)
+	c.Assert(ok, IsFalse)
+}
@@ -0,0 +1,97 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package keyvisual
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/pingcap/tidb-dashboard/pkg/keyvisual/matrix"
+	"github.com/pingcap/tidb-dashboard/pkg/keyvisual/region"
+	"github.com/pingcap/tidb-dashboard/util/rest"
+)
+
+const (
+	defaultHotspotsTop   = 10
+	maxHotspotsTop       = 100
+	defaultHotspotsRatio = 4
+	defaultTimeRange     = 360 * time.Minute
+)
+
+type HotspotsRequest struct {
+	StartTime int64  `json:"starttime" form:"starttime"` // default: 6 hours ago
+	EndTime   int64  `json:"endtime" form:"endtime"`     // default: now
+	Type      string `json:"type" form:"type"`           // default: integration
+	Top       int    `json:"top" form:"top"`             // default: 10
+	// A range is hot when its traffic is at least ratio times of the average, default: 4
+	Ratio float64 `json:"ratio" form:"ratio"`
+}
+
+type HotspotsResponse struct {
+	StartTime int64            `json:"start_time"`
+	EndTime   int64            `json:"end_time"`
+	Type      string           `json:"type"`
+	Hotspots  []matrix.Hotspot `json:"hotspots"`
+}
+
+// parseTimeRange returns the time range of the request, which is the last 6 hours by default.
+func parseTimeRange(startTime, endTime int64) (time.Time, time.Time, error) {
+	end := time.Now()
+	if endTime != 0 {
+		end = time.Unix(endTime, 0)
+	}
+	start := end.Add(-defaultTimeRange)
+	if startTime != 0 {
+		start = time.Unix(startTime, 0)
+	}
+	if !start.Before(end) {
+		return start, end, rest.ErrBadRequest.New("starttime must be less than endtime")
+	}
+	return start, end, nil
+}
+
+// @Summary Key Visual Hotspots
+// @Description Find the top contiguous hot key ranges in a time range, with their share of the total traffic and persistence over time.
+// @Param q query HotspotsRequest true "Query"
+// @Success 200 {object} HotspotsResponse
+// @Router /keyvisual/hotspots [get]
+// @Security JwtAuth
+// @Failure 400 {object} rest.ErrorResponse
+// @Failure 401 {object} rest.ErrorResponse
+func (s *Service) hotspots(c *gin.Context) {
+	var req HotspotsRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		_ = c.Error(rest.ErrBadRequest.WrapWithNoMessage(err))
+		return
+	}
+	startTime, endTime, err := parseTimeRange(req.StartTime, req.EndTime)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	if req.Top <= 0 {
+		req.Top = defaultHotspotsTop
+	}
+	if req.Top > maxHotspotsTop {
+		req.Top = maxHotspotsTop
+	}
+	if req.Ratio <= 0 {
+		req.Ratio = defaultHotspotsRatio
+	}
+
+	baseTag := region.IntoTag(req.Type)
+	plane := s.stat.Range(startTime, endTime, "", "", baseTag)
+	mx := plane.Pixel(s.strategy, heatmapsMaxDisplayY, region.GetDisplayTags(baseTag))
+	hotspots := mx.Hotspots(s.strategy.NewLabeler(), baseTag.String(), req.Ratio)
+	if len(hotspots) > req.Top {
+		hotspots = hotspots[:req.Top]
+	}
+	c.JSON(http.StatusOK, HotspotsResponse{
+		StartTime: startTime.Unix(),
+		EndTime:   endTime.Unix(),
+		Type:      baseTag.String(),
+		Hotspots:  hotspots,
+	})
+}
@@ -0,0 +1,102 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package matrix
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/pingcap/tidb-dashboard/pkg/keyvisual/decorator"
+)
+
+// Comparison is the data of two time windows on the same key axis. Values are the average per minute, so that
+// windows with different durations are comparable.
+type Comparison struct {
+	Keys    []string             `json:"-"`
+	KeyAxis []decorator.LabelKey `json:"keyAxis" binding:"required"`
+	Base    []float64            `json:"base" binding:"required"`
+	Target  []float64            `json:"target" binding:"required"`
+	// Target - Base
+	Delta []float64 `json:"delta" binding:"required"`
+	// Target / Base, which is null when Base is 0.
+	Ratio []*float64 `json:"ratio" binding:"required"`
+}
+
+// RangeChange is the change of a key range between two time windows.
+type RangeChange struct {
+	StartKey decorator.LabelKey `json:"start_key" binding:"required"`
+	EndKey   decorator.LabelKey `json:"end_key" binding:"required"`
+	Base     float64            `json:"base" binding:"required"`
+	Target   float64            `json:"target" binding:"required"`
+	Delta    float64            `json:"delta" binding:"required"`
+	Ratio    *float64           `json:"ratio"`
+}
+
+// ComparePlanes compacts each Plane into an axis, and pixelates both axes into a number of rows close to the target
+// on the same key axis.
+func ComparePlanes(strategy *Strategy, base, target Plane, rows int, displayTags []string) Comparison {
+	axes := []Axis{base.Compact(strategy), target.Compact(strategy)}
+	baseDuration := base.Times[len(base.Times)-1].Sub(base.Times[0])
+	targetDuration := target.Times[len(target.Times)-1].Sub(target.Times[0])
+	// Times are only used to build the Plane, which are not responded.
+	times := []time.Time{base.Times[0], base.Times[0].Add(baseDuration), base.Times[0].Add(baseDuration + targetDuration)}
+	plane := CreatePlane(times, axes)
+	mx := plane.Pixel(strategy, rows, displayTags)
+
+	data := mx.DataMap[displayTags[0]]
+	bucketsLen := len(mx.Keys) - 1
+	c := Comparison{
+		Keys:    mx.Keys,
+		KeyAxis: mx.KeyAxis,
+		Base:    perMinute(data[0], baseDuration),
+		Target:  perMinute(data[1], targetDuration),
+		Delta:   make([]float64, bucketsLen),
+		Ratio:   make([]*float64, bucketsLen),
+	}
+	for i := 0; i < bucketsLen; i++ {
+		c.Delta[i] = c.Target[i] - c.Base[i]
+		if c.Base[i] != 0 {
+			ratio := c.Target[i] / c.Base[i]
+			c.Ratio[i] = &ratio
+		}
+	}
+	return c
+}
+
+func perMinute(values []uint64, duration time.Duration) []float64 {
+	minutes := math.Max(duration.Minutes(), 1)
+	result := make([]float64, len(values))
+	for i, v := range values {
+		result[i] = float64(v) / minutes
+	}
+	return result
+}
+
+// TopChanges returns at most n ranges with the biggest absolute delta.
+func (c *Comparison) TopChanges(n int) []RangeChange {
+	indexes := make([]int, 0, len(c.Delta))
+	for i, delta := range c.Delta {
+		if delta != 0 {
+			indexes = append(indexes, i)
+		}
+	}
+	sort.SliceStable(indexes, func(i, j int) bool {
+		return math.Abs(c.Delta[indexes[i]]) > math.Abs(c.Delta[indexes[j]])
+	})
+	if len(indexes) > n {
+		indexes = indexes[:n]
+	}
+	changes := make([]RangeChange, len(indexes))
+	for i, index := range indexes {
+		changes[i] = RangeChange{
+			StartKey: c.KeyAxis[index],
+			EndKey:   c.KeyAxis[index+1],
+			Base:     c.Base[index],
+			Target:   c.Target[index],
+			Delta:    c.Delta[index],
+			Ratio:    c.Ratio[index],
+		}
+	}
+	return changes
+}
@@ -0,0 +1,52 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package matrix
+
+import (
+	"time"
+
+	. "github.com/pingcap/check"
+
+	"github.com/pingcap/tidb-dashboard/pkg/keyvisual/decorator"
+)
+
+var _ = Suite(&testCompareSuite{})
+
+type testCompareSuite struct{}
+
+func (s *testCompareSuite) TestComparePlanes(c *C) {
+	var km KeyMap
+	keys := []string{"", "a", "b", "c", ""}
+	km.SaveKeys(keys)
+	strategy := &Strategy{
+		LabelStrategy: decorator.NaiveLabelStrategy(),
+		SplitStrategy: AverageSplitStrategy(),
+	}
+	now := time.Unix(1600000000, 0)
+	base := CreatePlane([]time.Time{now, now.Add(10 * time.Minute)}, []Axis{
+		CreateAxis(keys, [][]uint64{{0, 100, 200, 0}}),
+	})
+	targetStart := now.Add(24 * time.Hour)
+	target := CreatePlane([]time.Time{targetStart, targetStart.Add(10 * time.Minute), targetStart.Add(20 * time.Minute)}, []Axis{
+		CreateAxis(keys, [][]uint64{{0, 100, 100, 0}}),
+		CreateAxis(keys, [][]uint64{{0, 100, 500, 200}}),
+	})
+
+	cmp := ComparePlanes(strategy, base, target, 10, []string{"written_bytes"})
+	c.Assert(cmp.Keys, DeepEquals, keys)
+	c.Assert(cmp.Base, DeepEquals, []float64{0, 10, 20, 0})
+	c.Assert(cmp.Target, DeepEquals, []float64{0, 10, 30, 10})
+	c.Assert(cmp.Delta, DeepEquals, []float64{0, 0, 10, 10})
+	c.Assert(cmp.Ratio[0], IsNil)
+	c.Assert(*cmp.Ratio[1], Equals, 1.0)
+	c.Assert(*cmp.Ratio[2], Equals, 1.5)
+	c.Assert(cmp.Ratio[3], IsNil)
+
+	changes := cmp.TopChanges(1)
+	c.Assert(changes, HasLen, 1)
+	c.Assert(changes[0].StartKey.Key, Equals, "62")
+	c.Assert(changes[0].EndKey.Key, Equals, "63")
+	c.Assert(changes[0].Delta, Equals, 10.0)
+	c.Assert(*changes[0].Ratio, Equals, 1.5)
+	c.Assert(cmp.TopChanges(10), HasLen, 2)
+}
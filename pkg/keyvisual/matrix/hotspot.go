@@ -0,0 +1,105 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package matrix
+
+import (
+	"sort"
+
+	"github.com/pingcap/tidb-dashboard/pkg/keyvisual/decorator"
+)
+
+// Hotspot is a contiguous key range whose traffic is much higher than the average.
+type Hotspot struct {
+	StartKey decorator.LabelKey `json:"start_key" binding:"required"`
+	EndKey   decorator.LabelKey `json:"end_key" binding:"required"`
+	// Total value in the time range.
+	Value uint64 `json:"value" binding:"required"`
+	// Share of the total value of all ranges.
+	Share float64 `json:"share" binding:"required"`
+	// Fraction of the time in which the range is hot.
+	Persistence float64 `json:"persistence" binding:"required"`
+}
+
+// Hotspots finds hot ranges from the data of the tag. A bucket is hot when its value is at least ratio times of the
+// average value of buckets. Adjacent hot buckets are merged into a range unless they cross the border of logical
+// ranges, e.g. tables and indexes. Ranges are ordered by the value.
+func (mx *Matrix) Hotspots(labeler decorator.Labeler, tag string, ratio float64) []Hotspot {
+	data := mx.DataMap[tag]
+	bucketsLen := len(mx.Keys) - 1
+	totals := make([]uint64, bucketsLen)
+	var total uint64
+	for _, column := range data {
+		for i, value := range column {
+			totals[i] += value
+			total += value
+		}
+	}
+	hotspots := make([]Hotspot, 0)
+	if total == 0 {
+		return hotspots
+	}
+
+	threshold := float64(total) / float64(bucketsLen) * ratio
+	start := -1
+	generateHotspot := func(end int) {
+		if start < 0 {
+			return
+		}
+		var value uint64
+		for _, v := range totals[start:end] {
+			value += v
+		}
+		hotspots = append(hotspots, Hotspot{
+			StartKey:    mx.KeyAxis[start],
+			EndKey:      mx.KeyAxis[end],
+			Value:       value,
+			Share:       float64(value) / float64(total),
+			Persistence: mx.persistence(data, start, end, ratio),
+		})
+		start = -1
+	}
+	for i, value := range totals {
+		if value == 0 || float64(value) < threshold {
+			generateHotspot(i)
+			continue
+		}
+		if start >= 0 && labeler.CrossBorder(mx.Keys[start], mx.Keys[i]) {
+			generateHotspot(i)
+		}
+		if start < 0 {
+			start = i
+		}
+	}
+	generateHotspot(bucketsLen)
+
+	sort.SliceStable(hotspots, func(i, j int) bool {
+		return hotspots[i].Value > hotspots[j].Value
+	})
+	return hotspots
+}
+
+// persistence returns the fraction of time in which buckets [start, end) are hot, weighted by the duration of each
+// time column.
+func (mx *Matrix) persistence(data [][]uint64, start, end int, ratio float64) float64 {
+	bucketsLen := len(mx.Keys) - 1
+	var hotDuration, totalDuration int64
+	for t, column := range data {
+		duration := mx.TimeAxis[t+1] - mx.TimeAxis[t]
+		totalDuration += duration
+		var columnTotal, value uint64
+		for i, v := range column {
+			columnTotal += v
+			if i >= start && i < end {
+				value += v
+			}
+		}
+		threshold := float64(columnTotal) / float64(bucketsLen) * ratio * float64(end-start)
+		if value > 0 && float64(value) >= threshold {
+			hotDuration += duration
+		}
+	}
+	if totalDuration == 0 {
+		return 0
+	}
+	return float64(hotDuration) / float64(totalDuration)
+}
@@ -0,0 +1,51 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package matrix
+
+import (
+	"time"
+
+	. "github.com/pingcap/check"
+
+	"github.com/pingcap/tidb-dashboard/pkg/keyvisual/decorator"
+)
+
+var _ = Suite(&testHotspotSuite{})
+
+type testHotspotSuite struct{}
+
+// prefixLabeler considers keys with different first bytes as different logical ranges.
+type prefixLabeler struct {
+	decorator.Labeler
+}
+
+func (prefixLabeler) CrossBorder(startKey, endKey string) bool {
+	return startKey == "" || endKey == "" || startKey[0] != endKey[0]
+}
+
+func (s *testHotspotSuite) TestHotspots(c *C) {
+	labeler := prefixLabeler{decorator.NaiveLabelStrategy().NewLabeler()}
+	now := time.Unix(1600000000, 0)
+	times := []time.Time{now, now.Add(time.Minute), now.Add(3 * time.Minute)}
+	keys := []string{"", "a1", "a2", "b1", "b2", "c1", ""}
+	mx := CreateMatrix(labeler, times, keys, 1)
+	mx.DataMap["written_bytes"] = [][]uint64{
+		{0, 200, 200, 0, 1, 0},
+		{0, 200, 200, 300, 0, 1},
+	}
+
+	hotspots := mx.Hotspots(labeler, "written_bytes", 1.5)
+	c.Assert(hotspots, HasLen, 2)
+	c.Assert(hotspots[0].StartKey.Key, Equals, "6131")
+	c.Assert(hotspots[0].EndKey.Key, Equals, "6231")
+	c.Assert(hotspots[0].Value, Equals, uint64(800))
+	c.Assert(hotspots[0].Share, Equals, 800.0/1102)
+	c.Assert(hotspots[0].Persistence, Equals, 1.0)
+	// Not merged with the previous range, which is in another logical range
+	c.Assert(hotspots[1].StartKey.Key, Equals, "6231")
+	c.Assert(hotspots[1].EndKey.Key, Equals, "6232")
+	c.Assert(hotspots[1].Value, Equals, uint64(300))
+	c.Assert(hotspots[1].Persistence, Equals, 2.0/3)
+
+	c.Assert(mx.Hotspots(labeler, "read_bytes", 2), HasLen, 0)
+}
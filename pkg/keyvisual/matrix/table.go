@@ -0,0 +1,107 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package matrix
+
+import (
+	"sort"
+
+	"github.com/pingcap/tidb-dashboard/pkg/keyvisual/decorator"
+)
+
+// IndexTraffic is the traffic of an index, or the records of a table when IndexID is 0.
+type IndexTraffic struct {
+	IndexID int64  `json:"index_id"`
+	Index   string `json:"index"`
+	// Total value of each tag.
+	Values map[string]uint64 `json:"values" binding:"required"`
+	// Value of each tag in each time column.
+	DataMap map[string][]uint64 `json:"data" binding:"required"`
+}
+
+// TableTraffic is the traffic of a table and its indexes.
+type TableTraffic struct {
+	TableID int64               `json:"table_id"`
+	DB      string              `json:"db"`
+	Table   string              `json:"table"`
+	Values  map[string]uint64   `json:"values" binding:"required"`
+	DataMap map[string][]uint64 `json:"data" binding:"required"`
+	Indexes []IndexTraffic      `json:"indexes" binding:"required"`
+}
+
+// TableTraffics aggregates the values of buckets in each Axis by tables and indexes, which are ordered by the value of
+// the tag. A bucket belongs to the table and the index of its start key.
+func (plane *Plane) TableTraffics(labeler decorator.TableLabeler, displayTags []string, tag string) []TableTraffic {
+	axesLen := len(plane.Axes)
+	newValues := func() (map[string]uint64, map[string][]uint64) {
+		values := make(map[string]uint64, len(displayTags))
+		dataMap := make(map[string][]uint64, len(displayTags))
+		for _, t := range displayTags {
+			values[t] = 0
+			dataMap[t] = make([]uint64, axesLen)
+		}
+		return values, dataMap
+	}
+
+	tables := make(map[int64]*TableTraffic)
+	indexes := make(map[int64]map[int64]*IndexTraffic)
+	infos := make(map[string]*decorator.TableInfo)
+	for i, axis := range plane.Axes {
+		for j, key := range axis.Keys[:len(axis.Keys)-1] {
+			info, ok := infos[key]
+			if !ok {
+				if v, isTable := labeler.TableInfo(key); isTable {
+					info = &v
+				}
+				infos[key] = info
+			}
+			if info == nil {
+				continue
+			}
+
+			table, ok := tables[info.TableID]
+			if !ok {
+				table = &TableTraffic{TableID: info.TableID, DB: info.DB, Table: info.Table}
+				table.Values, table.DataMap = newValues()
+				tables[info.TableID] = table
+				indexes[info.TableID] = make(map[int64]*IndexTraffic)
+			}
+			index, ok := indexes[info.TableID][info.IndexID]
+			if !ok {
+				index = &IndexTraffic{IndexID: info.IndexID, Index: info.Index}
+				index.Values, index.DataMap = newValues()
+				indexes[info.TableID][info.IndexID] = index
+			}
+			for k, t := range displayTags {
+				value := axis.ValuesList[k][j]
+				table.Values[t] += value
+				table.DataMap[t][i] += value
+				index.Values[t] += value
+				index.DataMap[t][i] += value
+			}
+		}
+	}
+
+	traffics := make([]TableTraffic, 0, len(tables))
+	for tableID, table := range tables {
+		table.Indexes = make([]IndexTraffic, 0, len(indexes[tableID]))
+		for _, index := range indexes[tableID] {
+			table.Indexes = append(table.Indexes, *index)
+		}
+		sort.Slice(table.Indexes, func(i, j int) bool {
+			a, b := table.Indexes[i], table.Indexes[j]
+			if a.Values[tag] != b.Values[tag] {
+				return a.Values[tag] > b.Values[tag]
+			}
+			return a.IndexID < b.IndexID
+		})
+		traffics = append(traffics, *table)
+	}
+	sort.Slice(traffics, func(i, j int) bool {
+		a, b := traffics[i], traffics[j]
+		if a.Values[tag] != b.Values[tag] {
+			return a.Values[tag] > b.Values[tag]
+		}
+		return a.TableID < b.TableID
+	})
+	return traffics
+}
@@ -0,0 +1,66 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package matrix
+
+import (
+	"time"
+
+	. "github.com/pingcap/check"
+
+	"github.com/pingcap/tidb-dashboard/pkg/keyvisual/decorator"
+)
+
+var _ = Suite(&testTableSuite{})
+
+type testTableSuite struct{}
+
+// fakeTableLabeler maps keys like "t1" and "t1i2" to the table 1 and its index 2.
+type fakeTableLabeler struct {
+	decorator.Labeler
+}
+
+func (fakeTableLabeler) TableInfo(key string) (info decorator.TableInfo, ok bool) {
+	if len(key) < 2 || key[0] != 't' {
+		return
+	}
+	info.TableID = int64(key[1] - '0')
+	info.Table = key[:2]
+	if len(key) == 4 && key[2] == 'i' {
+		info.IndexID = int64(key[3] - '0')
+		info.Index = key[2:]
+	}
+	return info, true
+}
+
+func (s *testTableSuite) TestTableTraffics(c *C) {
+	labeler := fakeTableLabeler{decorator.NaiveLabelStrategy().NewLabeler()}
+	now := time.Unix(1600000000, 0)
+	plane := CreatePlane([]time.Time{now, now.Add(time.Minute), now.Add(2 * time.Minute)}, []Axis{
+		CreateAxis([]string{"", "t1", "t1i1", "t2", ""}, [][]uint64{
+			{1, 10, 20, 5},
+			{0, 1, 2, 3},
+		}),
+		CreateAxis([]string{"", "t1", "t2", "t2i1", ""}, [][]uint64{
+			{1, 30, 40, 50},
+			{0, 1, 0, 0},
+		}),
+	})
+
+	traffics := plane.TableTraffics(labeler, []string{"written_bytes", "read_bytes"}, "written_bytes")
+	c.Assert(traffics, HasLen, 2)
+	c.Assert(traffics[0].Table, Equals, "t2")
+	c.Assert(traffics[0].Values, DeepEquals, map[string]uint64{"written_bytes": 95, "read_bytes": 3})
+	c.Assert(traffics[0].DataMap["written_bytes"], DeepEquals, []uint64{5, 90})
+	c.Assert(traffics[0].Indexes, HasLen, 2)
+	c.Assert(traffics[0].Indexes[0].IndexID, Equals, int64(1))
+	c.Assert(traffics[0].Indexes[0].Values["written_bytes"], Equals, uint64(50))
+	c.Assert(traffics[0].Indexes[1].IndexID, Equals, int64(0))
+	c.Assert(traffics[0].Indexes[1].Values["written_bytes"], Equals, uint64(45))
+
+	c.Assert(traffics[1].Table, Equals, "t1")
+	c.Assert(traffics[1].Values, DeepEquals, map[string]uint64{"written_bytes": 60, "read_bytes": 4})
+	c.Assert(traffics[1].DataMap["read_bytes"], DeepEquals, []uint64{3, 1})
+	c.Assert(traffics[1].Indexes[0].IndexID, Equals, int64(0))
+	c.Assert(traffics[1].Indexes[1].Index, Equals, "i1")
+	c.Assert(traffics[1].Indexes[1].DataMap["written_bytes"], DeepEquals, []uint64{20, 0})
+}
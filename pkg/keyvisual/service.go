@@ -105,12 +105,16 @@ func NewService(
 func RegisterRouter(r *gin.RouterGroup, auth *user.AuthService, s *Service) {
 	endpoint := r.Group("/keyvisual")
 	endpoint.Use(auth.MWAuthRequired())
+	endpoint.Use(auth.MWRequirePermission(user.PermKeyVisualView))
 
 	endpoint.GET("/config", s.getDynamicConfig)
-	endpoint.PUT("/config", auth.MWRequireWritePriv(), s.setDynamicConfig)
+	endpoint.PUT("/config", auth.MWRequirePermission(user.PermKeyVisualConfig), s.setDynamicConfig)
 
 	endpoint.Use(s.status.MWHandleStopped(stoppedHandler))
 	endpoint.GET("/heatmaps", s.heatmaps)
+	endpoint.GET("/heatmaps/compare", s.compareHeatmaps)
+	endpoint.GET("/hotspots", s.hotspots)
+	endpoint.GET("/tables", s.tables)
 }
 
 func (s *Service) IsRunning() bool {
@@ -0,0 +1,32 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package storage
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/pingcap/tidb-dashboard/pkg/apiserver/metrics/selfmetrics"
+)
+
+var (
+	layerAxesGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "tidb_dashboard",
+			Subsystem: "keyvisual",
+			Name:      "stat_layer_axes",
+			Help:      "Number of axes stored in each stat layer.",
+		}, []string{"layer"})
+
+	axisAppendDuration = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Namespace: "tidb_dashboard",
+			Subsystem: "keyvisual",
+			Name:      "axis_append_duration_seconds",
+			Help:      "Bucketed histogram of the duration to insert a new axis into the stat, including persisting.",
+			Buckets:   prometheus.ExponentialBuckets(0.001, 2, 15), // 1ms ~ 16s
+		})
+)
+
+func init() {
+	selfmetrics.Add(layerAxesGauge, axisAppendDuration)
+}
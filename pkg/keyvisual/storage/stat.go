@@ -6,6 +6,7 @@ package storage
 import (
 	"context"
 	"sort"
+	"strconv"
 	"sync"
 	"time"
 
@@ -116,6 +117,17 @@ func (s *layerStat) Append(axis matrix.Axis, endTime time.Time, labeler decorato
 	s.Tail = (s.Tail + 1) % s.Len
 }
 
+// Size returns the number of axes in the layerStat.
+func (s *layerStat) Size() int {
+	if s.Empty {
+		return 0
+	}
+	if s.Head == s.Tail {
+		return s.Len
+	}
+	return (s.Tail - s.Head + s.Len) % s.Len
+}
+
 // Range gets the specify plane in the time range.
 func (s *layerStat) Range(startTime, endTime time.Time) (times []time.Time, axes []matrix.Axis) {
 	if s.Next != nil {
@@ -256,6 +268,11 @@ func (s *Stat) Append(regions region.RegionsInfo, endTime time.Time) {
 	if regions.Len() == 0 {
 		return
 	}
+	startTime := time.Now()
+	defer func() {
+		axisAppendDuration.Observe(time.Since(startTime).Seconds())
+	}()
+
 	labeler := s.strategy.NewLabeler()
 	axis := CreateStorageAxis(regions, labeler)
 
@@ -266,6 +283,14 @@ func (s *Stat) Append(regions region.RegionsInfo, endTime time.Time) {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 	s.layers[0].Append(axis, endTime, labeler)
+	s.updateLayerMetrics()
+}
+
+// updateLayerMetrics must be called with the mutex held.
+func (s *Stat) updateLayerMetrics() {
+	for i, layer := range s.layers {
+		layerAxesGauge.WithLabelValues(strconv.Itoa(i)).Set(float64(layer.Size()))
+	}
 }
 
 func (s *Stat) rangeRoot(startTime, endTime time.Time) ([]time.Time, []matrix.Axis) {
@@ -110,5 +110,6 @@ func (s *Stat) Restore() error {
 			s.layers[layerNum].RingAxes[i] = axis
 		}
 	}
+	s.updateLayerMetrics()
 	return nil
 }
@@ -15,3 +15,15 @@ func TestStat(t *testing.T) {
 var _ = Suite(&testStatSuite{})
 
 type testStatSuite struct{}
+
+func (t *testStatSuite) TestLayerStatSize(c *C) {
+	s := &layerStat{Len: 4, Empty: true}
+	c.Assert(s.Size(), Equals, 0)
+	s.Empty = false
+	s.Head, s.Tail = 1, 3
+	c.Assert(s.Size(), Equals, 2)
+	s.Head, s.Tail = 3, 1
+	c.Assert(s.Size(), Equals, 2)
+	s.Head, s.Tail = 2, 2
+	c.Assert(s.Size(), Equals, 4)
+}
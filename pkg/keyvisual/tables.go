@@ -0,0 +1,84 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package keyvisual
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/pingcap/tidb-dashboard/pkg/keyvisual/decorator"
+	"github.com/pingcap/tidb-dashboard/pkg/keyvisual/matrix"
+	"github.com/pingcap/tidb-dashboard/pkg/keyvisual/region"
+	"github.com/pingcap/tidb-dashboard/util/rest"
+)
+
+const (
+	defaultTablesTop = 20
+	maxTablesTop     = 100
+)
+
+type TablesRequest struct {
+	StartTime int64  `json:"starttime" form:"starttime"` // default: 6 hours ago
+	EndTime   int64  `json:"endtime" form:"endtime"`     // default: now
+	Type      string `json:"type" form:"type"`           // ranked by, default: integration
+	Top       int    `json:"top" form:"top"`             // default: 20
+}
+
+type TablesResponse struct {
+	StartTime int64                 `json:"start_time"`
+	EndTime   int64                 `json:"end_time"`
+	Type      string                `json:"type"`
+	TimeAxis  []int64               `json:"timeAxis"`
+	Tables    []matrix.TableTraffic `json:"tables"`
+}
+
+// @Summary Key Visual Table Traffic
+// @Description Rank tables by traffic in a time range, with the traffic of each index and the time series of all types.
+// @Param q query TablesRequest true "Query"
+// @Success 200 {object} TablesResponse
+// @Router /keyvisual/tables [get]
+// @Security JwtAuth
+// @Failure 400 {object} rest.ErrorResponse
+// @Failure 401 {object} rest.ErrorResponse
+func (s *Service) tables(c *gin.Context) {
+	var req TablesRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		_ = c.Error(rest.ErrBadRequest.WrapWithNoMessage(err))
+		return
+	}
+	startTime, endTime, err := parseTimeRange(req.StartTime, req.EndTime)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	if req.Top <= 0 {
+		req.Top = defaultTablesTop
+	}
+	if req.Top > maxTablesTop {
+		req.Top = maxTablesTop
+	}
+	labeler, ok := s.strategy.NewLabeler().(decorator.TableLabeler)
+	if !ok {
+		_ = c.Error(rest.ErrBadRequest.New("table traffic is only available under the db policy"))
+		return
+	}
+
+	baseTag := region.IntoTag(req.Type)
+	plane := s.stat.Range(startTime, endTime, "", "", baseTag)
+	tables := plane.TableTraffics(labeler, region.GetDisplayTags(baseTag), baseTag.String())
+	if len(tables) > req.Top {
+		tables = tables[:req.Top]
+	}
+	timeAxis := make([]int64, len(plane.Times))
+	for i, t := range plane.Times {
+		timeAxis[i] = t.Unix()
+	}
+	c.JSON(http.StatusOK, TablesResponse{
+		StartTime: startTime.Unix(),
+		EndTime:   endTime.Unix(),
+		Type:      baseTag.String(),
+		TimeAxis:  timeAxis,
+		Tables:    tables,
+	})
+}
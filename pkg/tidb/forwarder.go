@@ -42,10 +42,10 @@ func (f *Forwarder) Start(ctx context.Context) error {
 	f.lifecycleCtx = ctx
 
 	var err error
-	if f.sqlProxy, err = f.createProxy(); err != nil {
+	if f.sqlProxy, err = f.createProxy("sql"); err != nil {
 		return err
 	}
-	if f.statusProxy, err = f.createProxy(); err != nil {
+	if f.statusProxy, err = f.createProxy("status"); err != nil {
 		return err
 	}
 
@@ -59,12 +59,13 @@ func (f *Forwarder) Start(ctx context.Context) error {
 	return nil
 }
 
-func (f *Forwarder) createProxy() (*proxy, error) {
+func (f *Forwarder) createProxy(name string) (*proxy, error) {
 	l, err := net.Listen("tcp", "127.0.0.1:0")
 	if err != nil {
 		return nil, err
 	}
 	proxy := newProxy(l, nil, f.config.ProxyCheckInterval, f.config.ProxyTimeout)
+	proxy.name = name
 	return proxy, nil
 }
 
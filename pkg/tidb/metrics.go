@@ -0,0 +1,31 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package tidb
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/pingcap/tidb-dashboard/pkg/apiserver/metrics/selfmetrics"
+)
+
+var (
+	forwarderUpstreamsGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "tidb_dashboard",
+			Subsystem: "tidb_forwarder",
+			Name:      "upstreams",
+			Help:      "Number of TiDB upstreams known by the forwarder, by the health state.",
+		}, []string{"proxy", "state"})
+
+	forwarderConnectionsGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "tidb_dashboard",
+			Subsystem: "tidb_forwarder",
+			Name:      "connections",
+			Help:      "Number of connections being forwarded to TiDB upstreams.",
+		}, []string{"proxy"})
+)
+
+func init() {
+	selfmetrics.Add(forwarderUpstreamsGauge, forwarderConnectionsGauge)
+}
@@ -39,6 +39,7 @@ func (r *remote) checkAlive(timeout time.Duration) error {
 }
 
 type proxy struct {
+	name          string // Only used in metrics
 	listener      net.Listener
 	checkInterval time.Duration
 	dialTimeout   time.Duration
@@ -110,6 +111,9 @@ func (p *proxy) serve(in net.Conn) {
 		_ = in.Close()
 		return
 	}
+	connections := forwarderConnectionsGauge.WithLabelValues(p.name)
+	connections.Inc()
+	defer connections.Dec()
 	// bidirectional copy
 	go func() {
 		//nolint
@@ -180,6 +184,7 @@ func (p *proxy) doCheck(ctx context.Context) {
 		case <-ctx.Done():
 			return
 		case <-time.After(p.checkInterval):
+			p.updateUpstreamMetrics()
 			p.remotes.Range(func(key, value interface{}) bool {
 				rmt := value.(*remote)
 				if rmt.isActive() {
@@ -199,6 +204,20 @@ func (p *proxy) doCheck(ctx context.Context) {
 	}
 }
 
+func (p *proxy) updateUpstreamMetrics() {
+	active, inactive := 0, 0
+	p.remotes.Range(func(key, value interface{}) bool {
+		if value.(*remote).isActive() {
+			active++
+		} else {
+			inactive++
+		}
+		return true
+	})
+	forwarderUpstreamsGauge.WithLabelValues(p.name, "active").Set(float64(active))
+	forwarderUpstreamsGauge.WithLabelValues(p.name, "inactive").Set(float64(inactive))
+}
+
 func (p *proxy) run(ctx context.Context) {
 	endpoints := make([]string, 0)
 	p.remotes.Range(func(key, value interface{}) bool {
@@ -31,12 +31,16 @@ enum taskState {
   Error,
   Running,
   Success,
-  Skipped = 4,
+  PartialSuccess, // Only valid for task group
+  Skipped,
+  Interrupted,
 }
 
 enum RawDataType {
   Protobuf = 'protobuf',
   Text = 'text',
+  Trace = 'trace',
+  Jemalloc = 'jemalloc',
 }
 
 interface IRow {
@@ -71,6 +75,12 @@ function mapData(data) {
       ]
     } else if (task.raw_data_type === RawDataType.Text) {
       task.view_options = [ViewOptions.Text]
+    } else if (
+      task.raw_data_type === RawDataType.Trace ||
+      task.raw_data_type === RawDataType.Jemalloc
+    ) {
+      // Can only be viewed by go tool trace or jeprof
+      task.view_options = [ViewOptions.Download]
     } else if (task.raw_data_type === '') {
       switch (task.target.kind) {
         case 'tidb':
@@ -90,7 +100,11 @@ function mapData(data) {
 
 function isFinished(data) {
   const groupState = data?.task_group_status?.state
-  return groupState === 2 || groupState === 3
+  return (
+    groupState === taskState.Success ||
+    groupState === taskState.PartialSuccess ||
+    groupState === taskState.Interrupted
+  )
 }
 
 async function getActionToken(
@@ -213,7 +227,10 @@ export default function Page() {
         minWidth: 150,
         maxWidth: 250,
         onRender: (record) => {
-          if (record.profiling_type === 'cpu') {
+          if (
+            record.profiling_type === 'cpu' ||
+            record.profiling_type === 'trace'
+          ) {
             return `${record.profiling_type} - ${profileDuration}s`
           } else {
             return `${record.profiling_type}`
@@ -242,6 +259,17 @@ export default function Page() {
                 <Badge status="error" text={record.error} />
               </Tooltip>
             )
+          } else if (record.state === taskState.Interrupted) {
+            return (
+              <Tooltip title={record.error}>
+                <Badge
+                  status="warning"
+                  text={t(
+                    'instance_profiling.detail.table.status.interrupted'
+                  )}
+                />
+              </Tooltip>
+            )
           } else if (record.state == taskState.Skipped) {
             return (
               <Tooltip
@@ -25,7 +25,16 @@ import styles from './List.module.less'
 
 const profilingDurationsSec = [10, 30, 60, 120]
 const defaultProfilingDuration = 30
-const profilingTypeOptions = ['CPU', 'Heap', 'Goroutine', 'Mutex']
+const profilingTypeOptions = [
+  'CPU',
+  'Heap',
+  'Goroutine',
+  'Mutex',
+  'Block',
+  'Allocs',
+  'ThreadCreate',
+  'Trace',
+]
 
 export default function Page() {
   const {
@@ -165,6 +174,14 @@ export default function Page() {
                 text={t('instance_profiling.list.table.status.finished')}
               />
             )
+          } else if (rec.state === 5) {
+            // interrupted by a restart
+            return (
+              <Badge
+                status="warning"
+                text={t('instance_profiling.list.table.status.interrupted')}
+              />
+            )
           } else {
             // partial success
             return (
@@ -2,6 +2,7 @@ import {
   CheckCircleTwoTone,
   InfoCircleTwoTone,
   LoadingOutlined,
+  StopTwoTone,
 } from '@ant-design/icons'
 import React from 'react'
 
@@ -16,3 +17,7 @@ export function SuccessIcon() {
 export function FailIcon() {
   return <InfoCircleTwoTone twoToneColor="#faad14" />
 }
+
+export function InterruptedIcon() {
+  return <StopTwoTone twoToneColor="#faad14" />
+}
@@ -1,4 +1,4 @@
-import { Button, Modal, Tree } from 'antd'
+import { Badge, Button, Modal, Tooltip, Tree } from 'antd'
 import _ from 'lodash'
 import React, { useEffect, useState, useMemo, useCallback } from 'react'
 import { useTranslation } from 'react-i18next'
@@ -6,7 +6,7 @@ import { getValueFormat } from '@baurine/grafana-value-formats'
 
 import client, { LogsearchTaskModel } from '@lib/client'
 import { AnimatedSkeleton, Card } from '@lib/components'
-import { FailIcon, LoadingIcon, SuccessIcon } from './Icon'
+import { FailIcon, InterruptedIcon, LoadingIcon, SuccessIcon } from './Icon'
 import { TaskState } from '../utils'
 
 import styles from './Styles.module.less'
@@ -17,21 +17,36 @@ const taskStateIcons = {
   [TaskState.Running]: LoadingIcon,
   [TaskState.Finished]: SuccessIcon,
   [TaskState.Error]: FailIcon,
+  [TaskState.Interrupted]: InterruptedIcon,
 }
 
-function getLeafNodes(tasks: LogsearchTaskModel[]) {
+// Interrupted tasks may have partial results
+function hasResult(task: LogsearchTaskModel) {
+  return (
+    task.state === TaskState.Finished || task.state === TaskState.Interrupted
+  )
+}
+
+function getLeafNodes(tasks: LogsearchTaskModel[], interruptedText: string) {
   return tasks.map((task) => {
-    const title = (
+    let title = (
       <span>
         {task.target?.display_name ?? ''}{' '}
         <small>({getValueFormat('bytes')(task.size!, 1)})</small>
       </span>
     )
+    if (task.state === TaskState.Interrupted) {
+      title = (
+        <Tooltip title={task.error}>
+          {title} <Badge status="warning" text={interruptedText} />
+        </Tooltip>
+      )
+    }
     return {
       key: String(task.id),
       title,
       icon: taskStateIcons[task.state || TaskState.Error],
-      disableCheckbox: !task.size || task.state !== TaskState.Finished,
+      disableCheckbox: !task.size || !hasResult(task),
     }
   })
 }
@@ -46,13 +61,17 @@ function parentNodeIcon(tasks: LogsearchTaskModel[]) {
     return SuccessIcon
   }
   // Failed: no task is running, and has failed task
-  return FailIcon
+  if (tasks.some((task) => task.state === TaskState.Error)) {
+    return FailIcon
+  }
+  // Interrupted: no task is running or failed, and has interrupted task
+  return InterruptedIcon
 }
 
 function parentNodeCheckable(tasks: LogsearchTaskModel[]) {
-  // Checkable: at least one task has finished and the log must not be empty
+  // Checkable: at least one task has results and the log must not be empty
   return (
-    tasks.some((task) => task.state === TaskState.Finished) &&
+    tasks.some(hasResult) &&
     tasks.reduce((acc, task) => (acc += task.size || 0), 0) > 0
   )
 }
@@ -84,13 +103,14 @@ export default function SearchProgress({
       t('search_logs.progress.running'),
       t('search_logs.progress.success'),
       t('search_logs.progress.failed'),
+      t('search_logs.progress.interrupted'),
     ],
     [t]
   )
 
   const describeProgress = useCallback(
     (tasks: LogsearchTaskModel[]) => {
-      const arr = [0, 0, 0]
+      const arr = [0, 0, 0, 0]
       tasks.forEach((task) => {
         const state = task.state
         if (state !== undefined) {
@@ -133,11 +153,11 @@ export default function SearchProgress({
         key: ik,
         icon: parentNodeIcon(tasks),
         disableCheckbox: !parentNodeCheckable(tasks),
-        children: getLeafNodes(tasks),
+        children: getLeafNodes(tasks, t('search_logs.progress.interrupted')),
       })
     })
     return data
-  }, [tasks, describeProgress])
+  }, [tasks, describeProgress, t])
 
   async function handleDownload() {
     if (taskGroupID < 0) {
@@ -218,7 +238,11 @@ export default function SearchProgress({
                 onClick={handleRetry}
                 disabled={
                   tasks.some((task) => task.state === TaskState.Running) ||
-                  !tasks.some((task) => task.state === TaskState.Error)
+                  !tasks.some(
+                    (task) =>
+                      task.state === TaskState.Error ||
+                      task.state === TaskState.Interrupted
+                  )
                 }
               >
                 {t('search_logs.common.retry')}
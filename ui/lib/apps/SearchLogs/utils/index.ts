@@ -31,4 +31,5 @@ export enum TaskState {
   Running = 1,
   Finished,
   Error,
+  Interrupted, // Interrupted by a restart of TiDB Dashboard
 }
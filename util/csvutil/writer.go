@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"io"
 	"reflect"
+	"strings"
 	"time"
 
 	"github.com/fatih/structtag"
@@ -38,10 +39,59 @@ func isFieldTaggedAsTime(field reflect.StructField) bool {
 	return tag.HasOption("time")
 }
 
+// Field is a struct field selected to be written.
+type Field struct {
+	Index int
+	// The JSON name of the field, which is written in the header.
+	Name   string
+	IsTime bool
+}
+
+// SelectFields returns fields of the struct type in the order of `names`, which are JSON names of fields. All
+// fields having a JSON name are returned when `names` is empty or "*". Unknown names are ignored.
+func SelectFields(objType reflect.Type, names []string) []Field {
+	allFields := make([]Field, 0, objType.NumField())
+	fieldsMap := make(map[string]Field)
+	for i := 0; i < objType.NumField(); i++ {
+		f := objType.Field(i)
+		if !reflectutil.IsFieldExported(f) {
+			continue
+		}
+		name := strings.ToLower(strings.Split(f.Tag.Get("json"), ",")[0])
+		if name == "" || name == "-" {
+			continue
+		}
+		field := Field{Index: i, Name: name, IsTime: isFieldTaggedAsTime(f)}
+		allFields = append(allFields, field)
+		fieldsMap[name] = field
+	}
+	if len(names) == 0 || (len(names) == 1 && names[0] == "*") {
+		return allFields
+	}
+
+	fields := make([]Field, 0, len(names))
+	for _, name := range names {
+		if field, ok := fieldsMap[strings.TrimSpace(name)]; ok {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+func formatField(fv interface{}, isTime bool) string {
+	if isTime {
+		ts, _ := ameda.InterfaceToInt64(fv)
+		return timeutil.FormatInUTC(time.Unix(ts, 0))
+	}
+	return fmt.Sprint(fv) // ~1000ns
+}
+
 type CSVWriter struct {
 	cw *csv.Writer
 
 	rowBuf []string
+	// Only these fields are written when specified.
+	fields []Field
 
 	// The following cache is valid when the passed-in interface's type is unchanged.
 	cacheFieldIsExported []bool
@@ -58,6 +108,14 @@ func NewCSVWriter(w io.Writer) *CSVWriter {
 	}
 }
 
+// NewCSVWriterWithFields creates a CSVWriter writing only the specified fields, see SelectFields. Written structs
+// must be of the type where fields are selected from.
+func NewCSVWriterWithFields(w io.Writer, fields []Field) *CSVWriter {
+	writer := NewCSVWriter(w)
+	writer.fields = fields
+	return writer
+}
+
 // ensureCacheValid caches information about the fields of `s`.
 func (w *CSVWriter) ensureCacheValid(objType reflect.Type) {
 	typeID := ameda.RuntimeTypeID(objType)
@@ -76,6 +134,14 @@ func (w *CSVWriter) ensureCacheValid(objType reflect.Type) {
 }
 
 func (w *CSVWriter) WriteAsHeader(s interface{}) error {
+	if w.fields != nil {
+		w.rowBuf = w.rowBuf[:0]
+		for _, f := range w.fields {
+			w.rowBuf = append(w.rowBuf, f.Name)
+		}
+		return w.cw.Write(w.rowBuf)
+	}
+
 	objValue := reflect.Indirect(reflect.ValueOf(s))
 	objType := objValue.Type()
 	fieldsCount := objType.NumField()
@@ -94,6 +160,14 @@ func (w *CSVWriter) WriteAsHeader(s interface{}) error {
 
 func (w *CSVWriter) WriteAsRow(s interface{}) error {
 	objValue := reflect.Indirect(reflect.ValueOf(s))
+	if w.fields != nil {
+		w.rowBuf = w.rowBuf[:0]
+		for _, f := range w.fields {
+			w.rowBuf = append(w.rowBuf, formatField(objValue.Field(f.Index).Interface(), f.IsTime))
+		}
+		return w.cw.Write(w.rowBuf)
+	}
+
 	objType := objValue.Type()
 	fieldsCount := objType.NumField()
 	w.ensureCacheValid(objType)
@@ -104,12 +178,7 @@ func (w *CSVWriter) WriteAsRow(s interface{}) error {
 			continue
 		}
 		fv := objValue.Field(i).Interface() // ~300ns
-		if w.cacheFieldIsTime[i] {
-			ts, _ := ameda.InterfaceToInt64(fv)
-			w.rowBuf = append(w.rowBuf, timeutil.FormatInUTC(time.Unix(ts, 0)))
-			continue
-		}
-		w.rowBuf = append(w.rowBuf, fmt.Sprint(fv)) // ~1000ns
+		w.rowBuf = append(w.rowBuf, formatField(fv, w.cacheFieldIsTime[i]))
 	}
 	return w.cw.Write(w.rowBuf)
 }
@@ -117,3 +186,8 @@ func (w *CSVWriter) WriteAsRow(s interface{}) error {
 func (w *CSVWriter) Flush() {
 	w.cw.Flush()
 }
+
+// Error reports any error that has occurred during a previous write or flush.
+func (w *CSVWriter) Error() error {
+	return w.cw.Error()
+}
@@ -4,6 +4,7 @@ package csvutil
 
 import (
 	"bytes"
+	"reflect"
 	"strings"
 	"testing"
 
@@ -101,6 +102,46 @@ func TestCSVWriterWriteTimeTag(t *testing.T) {
 	assert.Equal(t, "2021-10-01 16:46:40 UTC,2021-10-01 16:46:41 UTC,2021-10-01 16:46:42 UTC\n", buf.String())
 }
 
+type jsonFoo struct {
+	Digest    string  `json:"digest"`
+	ExecCount uint    `json:"exec_count"`
+	Latency   float64 `json:"latency"`
+	FirstSeen int     `json:"first_seen" csv:",time"`
+	NoJSON    string
+	private   string
+}
+
+func TestSelectFields(t *testing.T) {
+	objType := reflect.TypeOf(jsonFoo{})
+	assert.Equal(t, []Field{
+		{Index: 0, Name: "digest"},
+		{Index: 1, Name: "exec_count"},
+		{Index: 2, Name: "latency"},
+		{Index: 3, Name: "first_seen", IsTime: true},
+	}, SelectFields(objType, []string{"*"}))
+	assert.Len(t, SelectFields(objType, nil), 4)
+	assert.Equal(t, []Field{
+		{Index: 3, Name: "first_seen", IsTime: true},
+		{Index: 0, Name: "digest"},
+	}, SelectFields(objType, []string{"first_seen", "unknown", " digest", "private"}))
+}
+
+func TestCSVWriterWithFields(t *testing.T) {
+	buf := bytes.Buffer{}
+	w := NewCSVWriterWithFields(&buf, SelectFields(reflect.TypeOf(jsonFoo{}), []string{"digest", "latency", "first_seen"}))
+	assert.Nil(t, w.WriteAsHeader(&jsonFoo{}))
+	assert.Nil(t, w.WriteAsRow(&jsonFoo{Digest: "d,1", ExecCount: 3, Latency: 1.5, FirstSeen: 1633106800}))
+	assert.Nil(t, w.WriteAsRow(jsonFoo{Digest: "d2", Latency: 2}))
+	w.Flush()
+	assert.Nil(t, w.Error())
+	expected := `
+digest,latency,first_seen
+"d,1",1.5,2021-10-01 16:46:40 UTC
+d2,2,1970-01-01 00:00:00 UTC
+`
+	assert.Equal(t, strings.TrimSpace(expected), strings.TrimSpace(buf.String()))
+}
+
 func BenchmarkCSVWriterWriteAsHeader(b *testing.B) {
 	buf := bytes.Buffer{}
 	w := NewCSVWriter(&buf)
@@ -0,0 +1,381 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package pprofutil
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/google/pprof/profile"
+)
+
+type GoroutineFrame struct {
+	Function string `json:"function"`
+	Location string `json:"location"` // file:line
+}
+
+// GoroutineGroup is goroutines with the identical stack.
+type GoroutineGroup struct {
+	Count int              `json:"count"`
+	Stack []GoroutineFrame `json:"stack"` // from the leaf to the root
+	// The function creating goroutines, empty for the main goroutine.
+	CreatedBy string `json:"created_by"`
+	// Number of goroutines in each state, e.g. "chan receive". Only available for dumps with `debug=2`.
+	States map[string]int `json:"states"`
+	// Wait durations in minutes, which are only reported by Go for goroutines blocked for more than 1 minute.
+	MinWaitMinutes int `json:"min_wait_minutes"`
+	MaxWaitMinutes int `json:"max_wait_minutes"`
+	// Number of goroutines locked to threads
+	LockedToThread int `json:"locked_to_thread"`
+
+	key string
+}
+
+// GoroutineDumpFormat is the format of a goroutine dump served by `/debug/pprof/goroutine`.
+type GoroutineDumpFormat string
+
+const (
+	GoroutineDumpFormatProtobuf GoroutineDumpFormat = "protobuf"
+	GoroutineDumpFormatDebug1   GoroutineDumpFormat = "debug1"
+	GoroutineDumpFormatDebug2   GoroutineDumpFormat = "debug2"
+)
+
+type GoroutineDump struct {
+	Format GoroutineDumpFormat `json:"format"`
+	Total  int                 `json:"total"`
+	// Whether states and wait durations are available.
+	HasStates bool             `json:"has_states"`
+	States    map[string]int   `json:"states"`
+	Groups    []GoroutineGroup `json:"groups"` // ordered by count
+}
+
+var (
+	goroutineHeaderRegexp = regexp.MustCompile(`^goroutine \d+ \[(.*)\]:$`)
+	goroutineOffsetRegexp = regexp.MustCompile(` \+0x[0-9a-f]+$`)
+	goroutineInRegexp     = regexp.MustCompile(` in goroutine \d+$`)
+)
+
+// ParseGoroutineDump parses a goroutine dump in one of the formats served by `/debug/pprof/goroutine`, i.e.
+// protobuf, text with `debug=1` and text with `debug=2`. Goroutines with the identical stack are grouped.
+func ParseGoroutineDump(data []byte) (*GoroutineDump, error) {
+	trimmed := bytes.TrimSpace(data)
+	var groups map[string]*GoroutineGroup
+	var err error
+	var format GoroutineDumpFormat
+	switch {
+	case bytes.HasPrefix(trimmed, []byte("goroutine profile:")):
+		groups, err = parseGoroutineDebug1(trimmed)
+		format = GoroutineDumpFormatDebug1
+	case bytes.HasPrefix(trimmed, []byte("goroutine ")):
+		groups, err = parseGoroutineDebug2(trimmed)
+		format = GoroutineDumpFormatDebug2
+	default:
+		var p *profile.Profile
+		p, err = profile.ParseData(data)
+		if err != nil {
+			return nil, fmt.Errorf("unknown format of goroutine dump: %v", err)
+		}
+		groups = parseGoroutineProfile(p)
+		format = GoroutineDumpFormatProtobuf
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	dump := &GoroutineDump{
+		Format:    format,
+		HasStates: format == GoroutineDumpFormatDebug2,
+		States:    map[string]int{},
+		Groups:    make([]GoroutineGroup, 0, len(groups)),
+	}
+	for _, g := range groups {
+		dump.Total += g.Count
+		for state, n := range g.States {
+			dump.States[state] += n
+		}
+		dump.Groups = append(dump.Groups, *g)
+	}
+	sort.Slice(dump.Groups, func(i, j int) bool {
+		if dump.Groups[i].Count != dump.Groups[j].Count {
+			return dump.Groups[i].Count > dump.Groups[j].Count
+		}
+		return dump.Groups[i].key < dump.Groups[j].key
+	})
+	return dump, nil
+}
+
+func goroutineGroupKey(stack []GoroutineFrame, createdBy string) string {
+	var b strings.Builder
+	for _, f := range stack {
+		b.WriteString(f.Function)
+		b.WriteByte(' ')
+		b.WriteString(f.Location)
+		b.WriteByte('\n')
+	}
+	b.WriteString(createdBy)
+	return b.String()
+}
+
+func addGoroutines(groups map[string]*GoroutineGroup, stack []GoroutineFrame, createdBy string, count int) *GoroutineGroup {
+	key := goroutineGroupKey(stack, createdBy)
+	g, ok := groups[key]
+	if !ok {
+		g = &GoroutineGroup{
+			Stack:     stack,
+			CreatedBy: createdBy,
+			States:    map[string]int{},
+			key:       key,
+		}
+		groups[key] = g
+	}
+	g.Count += count
+	return g
+}
+
+// parseGoroutineDebug1 parses the dump with `debug=1`, in which goroutines are already grouped, e.g.
+//
+//	goroutine profile: total 2
+//	2 @ 0x43a0c5 0x4067ba
+//	#	0x43a0c4	runtime.gopark+0xe4	/usr/local/go/src/runtime/proc.go:367
+func parseGoroutineDebug1(data []byte) (map[string]*GoroutineGroup, error) {
+	groups := map[string]*GoroutineGroup{}
+	count := 0
+	var stack []GoroutineFrame
+	flush := func() {
+		if count > 0 {
+			addGoroutines(groups, stack, "", count)
+		}
+		count = 0
+		stack = nil
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "goroutine profile:"):
+		case strings.HasPrefix(line, "#"):
+			fields := strings.Split(strings.TrimSpace(strings.TrimPrefix(line, "#")), "\t")
+			if len(fields) < 3 {
+				continue
+			}
+			fn := fields[1]
+			if i := strings.LastIndex(fn, "+0x"); i >= 0 {
+				fn = fn[:i]
+			}
+			stack = append(stack, GoroutineFrame{Function: fn, Location: fields[2]})
+		case strings.Contains(line, " @ "):
+			flush()
+			n, err := strconv.Atoi(strings.TrimSpace(line[:strings.Index(line, " @ ")]))
+			if err != nil {
+				return nil, fmt.Errorf("invalid goroutine record: %s", line)
+			}
+			count = n
+		}
+	}
+	flush()
+	return groups, scanner.Err()
+}
+
+type goroutineState struct {
+	state       string
+	waitMinutes int
+	hasWait     bool
+	locked      bool
+}
+
+// parseGoroutineStatus parses the status in the header, e.g. "chan receive, 5 minutes, locked to thread".
+func parseGoroutineStatus(status string) goroutineState {
+	parts := strings.Split(status, ", ")
+	s := goroutineState{state: parts[0]}
+	for _, p := range parts[1:] {
+		switch {
+		case p == "locked to thread":
+			s.locked = true
+		case strings.HasSuffix(p, " minutes"):
+			if n, err := strconv.Atoi(strings.TrimSuffix(p, " minutes")); err == nil {
+				s.waitMinutes = n
+				s.hasWait = true
+			}
+		}
+	}
+	return s
+}
+
+// stripGoroutineArgs removes arguments of the function, e.g. "net/http.(*conn).serve(0xc000114000)".
+func stripGoroutineArgs(fn string) string {
+	if strings.HasSuffix(fn, ")") {
+		if i := strings.LastIndex(fn, "("); i > 0 {
+			return fn[:i]
+		}
+	}
+	return fn
+}
+
+// parseGoroutineDebug2 parses the dump with `debug=2`, which lists each goroutine, e.g.
+//
+//	goroutine 1 [chan receive, 5 minutes]:
+//	main.main()
+//		/app/main.go:10 +0x25
+//	created by main.init
+//		/app/main.go:5 +0x1d
+func parseGoroutineDebug2(data []byte) (map[string]*GoroutineGroup, error) {
+	groups := map[string]*GoroutineGroup{}
+	var lines []string
+	flush := func() error {
+		if len(lines) == 0 {
+			return nil
+		}
+		err := addGoroutineDebug2(groups, lines)
+		lines = lines[:0]
+		return err
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" {
+			// Goroutines are separated by empty lines.
+			if err := flush(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	return groups, nil
+}
+
+// addGoroutineDebug2 adds a goroutine of the dump with `debug=2`, which starts with the header line.
+func addGoroutineDebug2(groups map[string]*GoroutineGroup, lines []string) error {
+	m := goroutineHeaderRegexp.FindStringSubmatch(lines[0])
+	if m == nil {
+		return fmt.Errorf("invalid goroutine header: %s", lines[0])
+	}
+	state := parseGoroutineStatus(m[1])
+
+	var stack []GoroutineFrame
+	createdBy := ""
+	for i := 1; i < len(lines); i++ {
+		line := lines[i]
+		if strings.HasPrefix(line, "\t") || strings.HasPrefix(line, "...") {
+			continue
+		}
+		location := ""
+		if i+1 < len(lines) && strings.HasPrefix(lines[i+1], "\t") {
+			location = goroutineOffsetRegexp.ReplaceAllString(strings.TrimSpace(lines[i+1]), "")
+		}
+		if strings.HasPrefix(line, "created by ") {
+			createdBy = goroutineInRegexp.ReplaceAllString(strings.TrimPrefix(line, "created by "), "")
+			continue
+		}
+		stack = append(stack, GoroutineFrame{Function: stripGoroutineArgs(line), Location: location})
+	}
+
+	g := addGoroutines(groups, stack, createdBy, 1)
+	g.States[state.state]++
+	if state.locked {
+		g.LockedToThread++
+	}
+	if state.hasWait {
+		if g.MaxWaitMinutes == 0 || state.waitMinutes < g.MinWaitMinutes {
+			g.MinWaitMinutes = state.waitMinutes
+		}
+		if state.waitMinutes > g.MaxWaitMinutes {
+			g.MaxWaitMinutes = state.waitMinutes
+		}
+	}
+	return nil
+}
+
+func parseGoroutineProfile(p *profile.Profile) map[string]*GoroutineGroup {
+	groups := map[string]*GoroutineGroup{}
+	for _, s := range p.Sample {
+		var stack []GoroutineFrame
+		for _, loc := range s.Location {
+			for _, line := range loc.Line {
+				frame := GoroutineFrame{Function: "<unknown>"}
+				if line.Function != nil {
+					frame.Function = line.Function.Name
+					frame.Location = fmt.Sprintf("%s:%d", line.Function.Filename, line.Line)
+				}
+				stack = append(stack, frame)
+			}
+		}
+		addGoroutines(groups, stack, "", int(s.Value[0]))
+	}
+	return groups
+}
+
+type GoroutineGroupDiff struct {
+	BaseCount   int              `json:"base_count"`
+	TargetCount int              `json:"target_count"`
+	Delta       int              `json:"delta"`
+	Stack       []GoroutineFrame `json:"stack"`
+	CreatedBy   string           `json:"created_by"`
+}
+
+type GoroutineDumpDiff struct {
+	BaseTotal   int `json:"base_total"`
+	TargetTotal int `json:"target_total"`
+	// Groups whose number of goroutines changed, ordered by the increment. Groups keeping growing are likely
+	// to be leaks.
+	Groups []GoroutineGroupDiff `json:"groups"`
+}
+
+// DiffGoroutineDumps compares the number of goroutines of each stack. Dumps must be in the same format, because
+// stacks are grouped differently, e.g. creators of goroutines are only available in dumps with `debug=2`.
+func DiffGoroutineDumps(base, target *GoroutineDump) (*GoroutineDumpDiff, error) {
+	if base.Format != target.Format {
+		return nil, fmt.Errorf("cannot compare goroutine dumps in different formats (%s and %s)", base.Format, target.Format)
+	}
+	diff := &GoroutineDumpDiff{
+		BaseTotal:   base.Total,
+		TargetTotal: target.Total,
+		Groups:      []GoroutineGroupDiff{},
+	}
+	groups := map[string]*GoroutineGroupDiff{}
+	getGroup := func(g *GoroutineGroup) *GoroutineGroupDiff {
+		d, ok := groups[g.key]
+		if !ok {
+			d = &GoroutineGroupDiff{Stack: g.Stack, CreatedBy: g.CreatedBy}
+			groups[g.key] = d
+		}
+		return d
+	}
+	for i := range base.Groups {
+		getGroup(&base.Groups[i]).BaseCount += base.Groups[i].Count
+	}
+	for i := range target.Groups {
+		getGroup(&target.Groups[i]).TargetCount += target.Groups[i].Count
+	}
+	keys := make([]string, 0, len(groups))
+	for key, d := range groups {
+		d.Delta = d.TargetCount - d.BaseCount
+		if d.Delta != 0 {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		di, dj := groups[keys[i]].Delta, groups[keys[j]].Delta
+		if di != dj {
+			return di > dj
+		}
+		return keys[i] < keys[j]
+	})
+	for _, key := range keys {
+		diff.Groups = append(diff.Groups, *groups[key])
+	}
+	return diff, nil
+}
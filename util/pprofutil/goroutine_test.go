@@ -0,0 +1,137 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package pprofutil
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testGoroutineDebug2 = `goroutine 1 [chan receive, 5 minutes]:
+main.main()
+	/app/main.go:10 +0x25
+
+goroutine 20 [select, 3 minutes, locked to thread]:
+net/http.(*conn).serve(0xc000114000, {0xc42ce0, 0xc0000a2000})
+	/usr/local/go/src/net/http/server.go:1990 +0x5ee
+created by net/http.(*Server).Serve in goroutine 1
+	/usr/local/go/src/net/http/server.go:3102 +0x4db
+
+goroutine 21 [select, 7 minutes]:
+net/http.(*conn).serve(0xc000114100, {0xc42ce0, 0xc0000a2000})
+	/usr/local/go/src/net/http/server.go:1990 +0x5ee
+created by net/http.(*Server).Serve in goroutine 1
+	/usr/local/go/src/net/http/server.go:3102 +0x4db
+
+goroutine 22 [IO wait]:
+net/http.(*conn).serve(0xc000114200, {0xc42ce0, 0xc0000a2000})
+	/usr/local/go/src/net/http/server.go:1990 +0x5ee
+created by net/http.(*Server).Serve in goroutine 1
+	/usr/local/go/src/net/http/server.go:3102 +0x4db
+`
+
+const testGoroutineDebug1 = `goroutine profile: total 5
+4 @ 0x43a0c5 0x4067ba
+#	0x6b0c4e	net/http.(*conn).serve+0x5ee	/usr/local/go/src/net/http/server.go:1990
+
+1 @ 0x43a0c5 0x406ab2
+#	0x4bcd24	main.main+0x25	/app/main.go:10
+`
+
+func TestParseGoroutineDebug2(t *testing.T) {
+	dump, err := ParseGoroutineDump([]byte(testGoroutineDebug2))
+	require.Nil(t, err)
+	require.Equal(t, 4, dump.Total)
+	require.Equal(t, GoroutineDumpFormatDebug2, dump.Format)
+	require.True(t, dump.HasStates)
+	require.Equal(t, map[string]int{"chan receive": 1, "select": 2, "IO wait": 1}, dump.States)
+	require.Len(t, dump.Groups, 2)
+
+	g := dump.Groups[0]
+	require.Equal(t, 3, g.Count)
+	require.Equal(t, []GoroutineFrame{{Function: "net/http.(*conn).serve", Location: "/usr/local/go/src/net/http/server.go:1990"}}, g.Stack)
+	require.Equal(t, "net/http.(*Server).Serve", g.CreatedBy)
+	require.Equal(t, map[string]int{"select": 2, "IO wait": 1}, g.States)
+	require.Equal(t, 3, g.MinWaitMinutes)
+	require.Equal(t, 7, g.MaxWaitMinutes)
+	require.Equal(t, 1, g.LockedToThread)
+
+	g = dump.Groups[1]
+	require.Equal(t, 1, g.Count)
+	require.Equal(t, []GoroutineFrame{{Function: "main.main", Location: "/app/main.go:10"}}, g.Stack)
+	require.Equal(t, "", g.CreatedBy)
+	require.Equal(t, 5, g.MinWaitMinutes)
+	require.Equal(t, 5, g.MaxWaitMinutes)
+}
+
+func TestParseGoroutineDebug1(t *testing.T) {
+	dump, err := ParseGoroutineDump([]byte(testGoroutineDebug1))
+	require.Nil(t, err)
+	require.Equal(t, 5, dump.Total)
+	require.Equal(t, GoroutineDumpFormatDebug1, dump.Format)
+	require.False(t, dump.HasStates)
+	require.Len(t, dump.Groups, 2)
+	require.Equal(t, 4, dump.Groups[0].Count)
+	require.Equal(t, []GoroutineFrame{{Function: "net/http.(*conn).serve", Location: "/usr/local/go/src/net/http/server.go:1990"}}, dump.Groups[0].Stack)
+	require.Equal(t, 1, dump.Groups[1].Count)
+}
+
+func TestParseGoroutineProfile(t *testing.T) {
+	p := newTestProfile([][]string{{"main", "a"}, {"main", "b"}, {"main", "a"}}, []int64{1, 1, 1})
+	var buf bytes.Buffer
+	require.Nil(t, p.Write(&buf))
+	dump, err := ParseGoroutineDump(buf.Bytes())
+	require.Nil(t, err)
+	require.Equal(t, 3, dump.Total)
+	require.Len(t, dump.Groups, 2)
+	require.Equal(t, 2, dump.Groups[0].Count)
+	require.Equal(t, "a", dump.Groups[0].Stack[0].Function)
+
+	_, err = ParseGoroutineDump([]byte("invalid"))
+	require.NotNil(t, err)
+}
+
+func TestDiffGoroutineDumps(t *testing.T) {
+	base, err := ParseGoroutineDump([]byte(testGoroutineDebug1))
+	require.Nil(t, err)
+	target, err := ParseGoroutineDump([]byte(`goroutine profile: total 11
+10 @ 0x43a0c5 0x4067ba
+#	0x6b0c4e	net/http.(*conn).serve+0x5ee	/usr/local/go/src/net/http/server.go:1990
+
+1 @ 0x43a0c5 0x406ab2
+#	0x4bcd24	main.main+0x25	/app/main.go:10
+`))
+	require.Nil(t, err)
+
+	diff, err := DiffGoroutineDumps(base, target)
+	require.Nil(t, err)
+	require.Equal(t, 5, diff.BaseTotal)
+	require.Equal(t, 11, diff.TargetTotal)
+	require.Len(t, diff.Groups, 1)
+	require.Equal(t, 4, diff.Groups[0].BaseCount)
+	require.Equal(t, 10, diff.Groups[0].TargetCount)
+	require.Equal(t, 6, diff.Groups[0].Delta)
+}
+
+func TestDiffGoroutineDumpsInDifferentFormats(t *testing.T) {
+	base, err := ParseGoroutineDump([]byte(testGoroutineDebug1))
+	require.Nil(t, err)
+	target, err := ParseGoroutineDump([]byte(testGoroutineDebug2))
+	require.Nil(t, err)
+	_, err = DiffGoroutineDumps(base, target)
+	require.NotNil(t, err)
+}
+
+func TestParseGoroutineDebug2CRLF(t *testing.T) {
+	dump, err := ParseGoroutineDump([]byte(strings.ReplaceAll(testGoroutineDebug2, "\n", "\r\n")))
+	require.Nil(t, err)
+	require.Equal(t, 4, dump.Total)
+	require.Len(t, dump.Groups, 2)
+	require.Equal(t, "/app/main.go:10", dump.Groups[1].Stack[0].Location)
+
+	_, err = ParseGoroutineDump([]byte("goroutine 1 [running]:\nmain.main()\n\nfoo"))
+	require.NotNil(t, err)
+}
@@ -0,0 +1,218 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+// Package pprofutil converts pprof profiles into JSON outputs, i.e. top tables, flame graphs and call trees, so
+// that they can be rendered without graphviz.
+package pprofutil
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/google/pprof/profile"
+)
+
+type Format string
+
+const (
+	FormatTop        Format = "top"        // TopResponse
+	FormatFlameGraph Format = "flamegraph" // FlameGraphNode, in the d3-flame-graph format
+	FormatSpeedscope Format = "speedscope" // SpeedscopeFile, in the speedscope file format
+	FormatCallTree   Format = "calltree"   // CallTreeNode
+)
+
+// IsJSONFormat returns whether the output format is supported by Convert.
+func IsJSONFormat(format string) bool {
+	switch Format(format) {
+	case FormatTop, FormatFlameGraph, FormatSpeedscope, FormatCallTree:
+		return true
+	}
+	return false
+}
+
+type SortBy string
+
+const (
+	SortByFlat SortBy = "flat"
+	SortByCum  SortBy = "cum"
+	SortByName SortBy = "name"
+)
+
+const (
+	DefaultTopLimit = 50
+	MaxTopLimit     = 1000
+)
+
+// Options of JSON outputs, which can be bound from query parameters.
+type Options struct {
+	// The type of sample values to show, e.g. alloc_space for heap profiles. The default sample type of the
+	// profile is used when empty.
+	SampleType string `json:"sample_type" form:"sample_type"`
+	// Only samples with a function matching the regexp are kept.
+	Focus string `json:"focus" form:"focus"`
+	// Samples with a function matching the regexp are dropped.
+	Ignore string `json:"ignore" form:"ignore"`
+	// Order of the top table: flat, cum or name. Default: flat.
+	Sort SortBy `json:"sort" form:"sort"`
+	// Number of functions in the top table. Default: 50.
+	Limit int `json:"limit" form:"limit"`
+}
+
+// Convert converts the profile into the JSON output of the format. The error is caused by invalid options or
+// an unsupported format.
+func Convert(p *profile.Profile, format Format, opts *Options) (interface{}, error) {
+	if opts == nil {
+		opts = &Options{}
+	}
+	v, err := newView(p, opts)
+	if err != nil {
+		return nil, err
+	}
+	switch format {
+	case FormatTop:
+		return v.top(opts.Sort, opts.Limit)
+	case FormatFlameGraph:
+		return v.flameGraph(), nil
+	case FormatSpeedscope:
+		return v.speedscope(), nil
+	case FormatCallTree:
+		return v.callTree(), nil
+	default:
+		return nil, fmt.Errorf("unsupported output format %q", format)
+	}
+}
+
+// Diff subtracts the base profile from the target profile in the same way as `pprof -diff_base`. Samples of the
+// base profile are negated and labeled with `pprof::base`, so that the total value of the base profile is used
+// when calculating percentages.
+func Diff(base, target *profile.Profile) (*profile.Profile, error) {
+	base = base.Copy()
+	base.SetLabel("pprof::base", []string{"true"})
+	base.Scale(-1)
+	return profile.Merge([]*profile.Profile{target, base})
+}
+
+// sampleIndex returns the index of the sample type. The default sample type is the same as pprof.
+func sampleIndex(p *profile.Profile, sampleType string) (int, error) {
+	if len(p.SampleType) == 0 {
+		return 0, fmt.Errorf("profile has no sample types")
+	}
+	if sampleType == "" {
+		sampleType = p.DefaultSampleType
+		if sampleType == "" {
+			return len(p.SampleType) - 1, nil
+		}
+	}
+	for i, st := range p.SampleType {
+		if st.Type == sampleType {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("sample type %q not found in the profile", sampleType)
+}
+
+// frameNames returns function names of the stack of a sample from the root to the leaf, including inlined
+// functions.
+func frameNames(s *profile.Sample) []string {
+	names := make([]string, 0, len(s.Location))
+	for i := len(s.Location) - 1; i >= 0; i-- {
+		loc := s.Location[i]
+		if len(loc.Line) == 0 {
+			names = append(names, fmt.Sprintf("0x%x", loc.Address))
+			continue
+		}
+		// Lines are ordered from the inlined function to the caller
+		for j := len(loc.Line) - 1; j >= 0; j-- {
+			name := "<unknown>"
+			if loc.Line[j].Function != nil {
+				name = loc.Line[j].Function.Name
+			}
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+type viewSample struct {
+	frames []string // from the root to the leaf
+	value  int64
+	isBase bool
+}
+
+// view is the profile reduced to stacks of function names and values of the selected sample type.
+type view struct {
+	sampleType *profile.ValueType
+	// The total value of the profile before filtering, which is the total value of the base profile for a diff
+	// profile like pprof does.
+	total   int64
+	isDiff  bool
+	samples []viewSample
+}
+
+func matchAny(re *regexp.Regexp, frames []string) bool {
+	for _, f := range frames {
+		if re.MatchString(f) {
+			return true
+		}
+	}
+	return false
+}
+
+func newView(p *profile.Profile, opts *Options) (*view, error) {
+	idx, err := sampleIndex(p, opts.SampleType)
+	if err != nil {
+		return nil, err
+	}
+	var focus, ignore *regexp.Regexp
+	if opts.Focus != "" {
+		if focus, err = regexp.Compile(opts.Focus); err != nil {
+			return nil, fmt.Errorf("invalid focus regexp: %v", err)
+		}
+	}
+	if opts.Ignore != "" {
+		if ignore, err = regexp.Compile(opts.Ignore); err != nil {
+			return nil, fmt.Errorf("invalid ignore regexp: %v", err)
+		}
+	}
+
+	v := &view{sampleType: p.SampleType[idx], samples: make([]viewSample, 0, len(p.Sample))}
+	var total, baseTotal int64
+	for _, s := range p.Sample {
+		value := s.Value[idx]
+		isBase := s.DiffBaseSample()
+		total += abs(value)
+		if isBase {
+			v.isDiff = true
+			baseTotal += abs(value)
+		}
+		frames := frameNames(s)
+		if len(frames) == 0 {
+			continue
+		}
+		if focus != nil && !matchAny(focus, frames) {
+			continue
+		}
+		if ignore != nil && matchAny(ignore, frames) {
+			continue
+		}
+		v.samples = append(v.samples, viewSample{frames: frames, value: value, isBase: isBase})
+	}
+	v.total = total
+	if baseTotal > 0 {
+		v.total = baseTotal
+	}
+	return v, nil
+}
+
+func abs(v int64) int64 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+func (v *view) percent(value int64) float64 {
+	if v.total == 0 {
+		return 0
+	}
+	return float64(value) * 100 / float64(v.total)
+}
@@ -0,0 +1,207 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package pprofutil
+
+import (
+	"testing"
+
+	"github.com/google/pprof/profile"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestProfile creates a CPU profile. Each stack is listed from the root to the leaf.
+func newTestProfile(stacks [][]string, values []int64) *profile.Profile {
+	p := &profile.Profile{
+		SampleType: []*profile.ValueType{{Type: "samples", Unit: "count"}, {Type: "cpu", Unit: "nanoseconds"}},
+		PeriodType: &profile.ValueType{Type: "cpu", Unit: "nanoseconds"},
+		Period:     1,
+	}
+	functions := map[string]*profile.Location{}
+	for i, stack := range stacks {
+		s := &profile.Sample{Value: []int64{1, values[i]}}
+		for j := len(stack) - 1; j >= 0; j-- {
+			loc, ok := functions[stack[j]]
+			if !ok {
+				fn := &profile.Function{ID: uint64(len(p.Function) + 1), Name: stack[j]}
+				loc = &profile.Location{ID: uint64(len(p.Location) + 1), Line: []profile.Line{{Function: fn}}}
+				functions[stack[j]] = loc
+				p.Function = append(p.Function, fn)
+				p.Location = append(p.Location, loc)
+			}
+			s.Location = append(s.Location, loc)
+		}
+		p.Sample = append(p.Sample, s)
+	}
+	return p
+}
+
+func convertTop(t *testing.T, p *profile.Profile, opts *Options) *TopResponse {
+	r, err := Convert(p, FormatTop, opts)
+	require.Nil(t, err)
+	return r.(*TopResponse)
+}
+
+func findTopItem(t *testing.T, top *TopResponse, name string) TopItem {
+	for _, item := range top.Items {
+		if item.Name == name {
+			return item
+		}
+	}
+	require.FailNow(t, "function not found", name)
+	return TopItem{}
+}
+
+func topNames(top *TopResponse) []string {
+	names := make([]string, 0, len(top.Items))
+	for _, item := range top.Items {
+		names = append(names, item.Name)
+	}
+	return names
+}
+
+func TestTop(t *testing.T) {
+	p := newTestProfile([][]string{
+		{"main", "a", "b"},
+		{"main", "a"},
+		{"main", "c"},
+	}, []int64{30, 10, 60})
+
+	top := convertTop(t, p, nil)
+	require.Equal(t, "cpu", top.SampleType)
+	require.Equal(t, int64(100), top.Total)
+	require.Equal(t, []string{"c", "b", "a", "main"}, topNames(top))
+	require.Equal(t, TopItem{Name: "a", Flat: 10, Cum: 40, FlatPercent: 10, CumPercent: 40}, findTopItem(t, top, "a"))
+	require.Equal(t, int64(100), findTopItem(t, top, "main").Cum)
+
+	require.Equal(t, []string{"main", "c", "a"}, topNames(convertTop(t, p, &Options{Sort: SortByCum, Limit: 3})))
+	require.Equal(t, []string{"a", "b", "c", "main"}, topNames(convertTop(t, p, &Options{Sort: SortByName})))
+
+	top = convertTop(t, p, &Options{SampleType: "samples"})
+	require.Equal(t, int64(3), top.Total)
+	require.Equal(t, int64(2), findTopItem(t, top, "a").Cum)
+
+	_, err := Convert(p, FormatTop, &Options{SampleType: "alloc_space"})
+	require.NotNil(t, err)
+	_, err = Convert(p, FormatTop, &Options{Sort: "foo"})
+	require.NotNil(t, err)
+	_, err = Convert(p, "svg", nil)
+	require.NotNil(t, err)
+}
+
+func TestFocusIgnore(t *testing.T) {
+	p := newTestProfile([][]string{
+		{"main", "a", "b"},
+		{"main", "a"},
+		{"main", "c"},
+	}, []int64{30, 10, 60})
+
+	// Percentages are still relative to the whole profile
+	top := convertTop(t, p, &Options{Focus: "^b$"})
+	require.Equal(t, int64(100), top.Total)
+	require.Equal(t, []string{"b", "a", "main"}, topNames(top))
+	require.Equal(t, int64(30), findTopItem(t, top, "main").Cum)
+
+	top = convertTop(t, p, &Options{Focus: "^a$", Ignore: "b"})
+	require.Equal(t, []string{"a", "main"}, topNames(top))
+	require.Equal(t, int64(10), findTopItem(t, top, "main").Cum)
+
+	_, err := Convert(p, FormatCallTree, &Options{Focus: "("})
+	require.NotNil(t, err)
+}
+
+func TestDiff(t *testing.T) {
+	base := newTestProfile([][]string{
+		{"main", "a"},
+		{"main", "c"},
+	}, []int64{40, 60})
+	target := newTestProfile([][]string{
+		{"main", "a"},
+		{"main", "b"},
+		{"main", "c"},
+	}, []int64{100, 20, 60})
+
+	diff, err := Diff(base, target)
+	require.Nil(t, err)
+
+	top := convertTop(t, diff, nil)
+	// Percentages are relative to the base profile
+	require.Equal(t, int64(100), top.Total)
+	require.Equal(t, int64(60), findTopItem(t, top, "a").Flat)
+	require.Equal(t, int64(20), findTopItem(t, top, "b").Flat)
+	require.Equal(t, int64(0), findTopItem(t, top, "c").Flat)
+	require.Equal(t, int64(80), findTopItem(t, top, "main").Cum)
+
+	r, err := Convert(diff, FormatFlameGraph, nil)
+	require.Nil(t, err)
+	fg := r.(*FlameGraphNode)
+	require.Equal(t, int64(180), fg.Value)
+	require.Equal(t, int64(80), fg.Delta)
+	require.Len(t, fg.Children, 1)
+	main := fg.Children[0]
+	require.Equal(t, "main", main.Name)
+	require.Equal(t, []string{"a", "b", "c"}, []string{main.Children[0].Name, main.Children[1].Name, main.Children[2].Name})
+	require.Equal(t, int64(100), main.Children[0].Value)
+	require.Equal(t, int64(60), main.Children[0].Delta)
+	require.Equal(t, int64(0), main.Children[2].Delta)
+
+	// Only the target profile is exported
+	r, err = Convert(diff, FormatSpeedscope, nil)
+	require.Nil(t, err)
+	require.Equal(t, int64(180), r.(*SpeedscopeFile).Profiles[0].EndValue)
+
+	// Base profile is not modified
+	require.Equal(t, int64(40), base.Sample[0].Value[1])
+}
+
+func TestFlameGraph(t *testing.T) {
+	p := newTestProfile([][]string{
+		{"main", "a", "b"},
+		{"main", "a"},
+	}, []int64{30, 10})
+	r, err := Convert(p, FormatFlameGraph, nil)
+	require.Nil(t, err)
+	fg := r.(*FlameGraphNode)
+	require.Equal(t, int64(40), fg.Value)
+	require.Equal(t, int64(0), fg.Delta)
+	a := fg.Children[0].Children[0]
+	require.Equal(t, "a", a.Name)
+	require.Equal(t, int64(40), a.Value)
+	require.Equal(t, int64(30), a.Children[0].Value)
+}
+
+func TestCallTree(t *testing.T) {
+	p := newTestProfile([][]string{
+		{"main", "a", "b"},
+		{"main", "a"},
+		{"main", "c"},
+	}, []int64{30, 10, 60})
+	r, err := Convert(p, FormatCallTree, nil)
+	require.Nil(t, err)
+	root := r.(*CallTreeNode)
+	require.Equal(t, int64(100), root.Cum)
+	main := root.Children[0]
+	require.Equal(t, int64(0), main.Flat)
+	require.Equal(t, []string{"c", "a"}, []string{main.Children[0].Name, main.Children[1].Name})
+	a := main.Children[1]
+	require.Equal(t, int64(10), a.Flat)
+	require.Equal(t, int64(40), a.Cum)
+	require.Equal(t, float64(40), a.CumPercent)
+	require.Equal(t, "b", a.Children[0].Name)
+	require.Empty(t, a.Children[0].Children)
+}
+
+func TestSpeedscope(t *testing.T) {
+	p := newTestProfile([][]string{
+		{"main", "a", "b"},
+		{"main", "c"},
+	}, []int64{30, 60})
+	r, err := Convert(p, FormatSpeedscope, nil)
+	require.Nil(t, err)
+	f := r.(*SpeedscopeFile)
+	require.Equal(t, []SpeedscopeFrame{{"main"}, {"a"}, {"b"}, {"c"}}, f.Shared.Frames)
+	require.Len(t, f.Profiles, 1)
+	require.Equal(t, "nanoseconds", f.Profiles[0].Unit)
+	require.Equal(t, [][]int{{0, 1, 2}, {0, 3}}, f.Profiles[0].Samples)
+	require.Equal(t, []int64{30, 60}, f.Profiles[0].Weights)
+	require.Equal(t, int64(90), f.Profiles[0].EndValue)
+}
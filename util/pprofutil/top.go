@@ -0,0 +1,90 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package pprofutil
+
+import (
+	"fmt"
+	"sort"
+)
+
+type TopItem struct {
+	Name string `json:"name"`
+	Flat int64  `json:"flat"`
+	Cum  int64  `json:"cum"`
+	// Percentages of the total value
+	FlatPercent float64 `json:"flat_percent"`
+	CumPercent  float64 `json:"cum_percent"`
+}
+
+type TopResponse struct {
+	SampleType string    `json:"sample_type"`
+	Unit       string    `json:"unit"`
+	Total      int64     `json:"total"`
+	Items      []TopItem `json:"items"`
+}
+
+// top aggregates values by function. Values of a diff profile are the differences from the base profile, and are
+// ordered by the absolute value.
+func (v *view) top(sortBy SortBy, limit int) (*TopResponse, error) {
+	if limit <= 0 {
+		limit = DefaultTopLimit
+	}
+	if limit > MaxTopLimit {
+		limit = MaxTopLimit
+	}
+	var key func(item *TopItem) int64
+	switch sortBy {
+	case SortByFlat, "":
+		key = func(item *TopItem) int64 { return abs(item.Flat) }
+	case SortByCum:
+		key = func(item *TopItem) int64 { return abs(item.Cum) }
+	case SortByName:
+		key = func(item *TopItem) int64 { return 0 }
+	default:
+		return nil, fmt.Errorf("unsupported sort order %q", sortBy)
+	}
+
+	resp := &TopResponse{
+		SampleType: v.sampleType.Type,
+		Unit:       v.sampleType.Unit,
+		Total:      v.total,
+		Items:      []TopItem{},
+	}
+	items := map[string]*TopItem{}
+	getItem := func(name string) *TopItem {
+		item, ok := items[name]
+		if !ok {
+			item = &TopItem{Name: name}
+			items[name] = item
+		}
+		return item
+	}
+	for _, s := range v.samples {
+		getItem(s.frames[len(s.frames)-1]).Flat += s.value
+		// Recursive functions are counted once
+		seen := map[string]struct{}{}
+		for _, name := range s.frames {
+			if _, ok := seen[name]; ok {
+				continue
+			}
+			seen[name] = struct{}{}
+			getItem(name).Cum += s.value
+		}
+	}
+	for _, item := range items {
+		item.FlatPercent = v.percent(item.Flat)
+		item.CumPercent = v.percent(item.Cum)
+		resp.Items = append(resp.Items, *item)
+	}
+	sort.Slice(resp.Items, func(i, j int) bool {
+		ki, kj := key(&resp.Items[i]), key(&resp.Items[j])
+		if ki != kj {
+			return ki > kj
+		}
+		return resp.Items[i].Name < resp.Items[j].Name
+	})
+	if len(resp.Items) > limit {
+		resp.Items = resp.Items[:limit]
+	}
+	return resp, nil
+}
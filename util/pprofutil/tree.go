@@ -0,0 +1,194 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package pprofutil
+
+import (
+	"sort"
+)
+
+// FlameGraphNode is a node of the flame graph in the d3-flame-graph format.
+type FlameGraphNode struct {
+	Name  string `json:"name"`
+	Value int64  `json:"value"`
+	// The difference from the base profile, only available for diff profiles.
+	Delta    int64             `json:"delta,omitempty"`
+	Children []*FlameGraphNode `json:"children,omitempty"`
+
+	childIndex map[string]*FlameGraphNode
+}
+
+func (n *FlameGraphNode) child(name string) *FlameGraphNode {
+	if c, ok := n.childIndex[name]; ok {
+		return c
+	}
+	c := &FlameGraphNode{Name: name}
+	if n.childIndex == nil {
+		n.childIndex = map[string]*FlameGraphNode{}
+	}
+	n.childIndex[name] = c
+	n.Children = append(n.Children, c)
+	return c
+}
+
+func (n *FlameGraphNode) sortChildren() {
+	sort.Slice(n.Children, func(i, j int) bool {
+		return n.Children[i].Name < n.Children[j].Name
+	})
+	for _, c := range n.Children {
+		c.sortChildren()
+	}
+}
+
+// flameGraph merges stacks of samples into a tree. For a diff profile, values are from the target profile and
+// deltas are differences from the base profile.
+func (v *view) flameGraph() *FlameGraphNode {
+	root := &FlameGraphNode{Name: "root"}
+	for _, s := range v.samples {
+		node := root
+		nodes := []*FlameGraphNode{root}
+		for _, name := range s.frames {
+			node = node.child(name)
+			nodes = append(nodes, node)
+		}
+		for _, n := range nodes {
+			if !s.isBase {
+				n.Value += s.value
+			}
+			if v.isDiff {
+				n.Delta += s.value
+			}
+		}
+	}
+	root.sortChildren()
+	return root
+}
+
+// CallTreeNode is a function in the call tree. Values of a diff profile are the differences from the base
+// profile.
+type CallTreeNode struct {
+	Name       string          `json:"name"`
+	Flat       int64           `json:"flat"`
+	Cum        int64           `json:"cum"`
+	CumPercent float64         `json:"cum_percent"`
+	Children   []*CallTreeNode `json:"children"`
+
+	childIndex map[string]*CallTreeNode
+}
+
+func (n *CallTreeNode) child(name string) *CallTreeNode {
+	if c, ok := n.childIndex[name]; ok {
+		return c
+	}
+	c := &CallTreeNode{Name: name, Children: []*CallTreeNode{}}
+	if n.childIndex == nil {
+		n.childIndex = map[string]*CallTreeNode{}
+	}
+	n.childIndex[name] = c
+	n.Children = append(n.Children, c)
+	return c
+}
+
+func (n *CallTreeNode) finish(v *view) {
+	n.CumPercent = v.percent(n.Cum)
+	sort.Slice(n.Children, func(i, j int) bool {
+		ci, cj := abs(n.Children[i].Cum), abs(n.Children[j].Cum)
+		if ci != cj {
+			return ci > cj
+		}
+		return n.Children[i].Name < n.Children[j].Name
+	})
+	for _, c := range n.Children {
+		c.finish(v)
+	}
+}
+
+// callTree merges stacks of samples into a tree from callers to callees, in which children are ordered by the
+// cumulative value.
+func (v *view) callTree() *CallTreeNode {
+	root := &CallTreeNode{Name: "root", Children: []*CallTreeNode{}}
+	for _, s := range v.samples {
+		node := root
+		node.Cum += s.value
+		for _, name := range s.frames {
+			node = node.child(name)
+			node.Cum += s.value
+		}
+		node.Flat += s.value
+	}
+	root.finish(v)
+	return root
+}
+
+type SpeedscopeFrame struct {
+	Name string `json:"name"`
+}
+
+type SpeedscopeShared struct {
+	Frames []SpeedscopeFrame `json:"frames"`
+}
+
+// SpeedscopeProfile is a profile of the "sampled" type.
+type SpeedscopeProfile struct {
+	Type       string `json:"type"`
+	Name       string `json:"name"`
+	Unit       string `json:"unit"`
+	StartValue int64  `json:"startValue"`
+	EndValue   int64  `json:"endValue"`
+	// Each sample is a stack of indexes of frames, from the root to the leaf.
+	Samples [][]int `json:"samples"`
+	Weights []int64 `json:"weights"`
+}
+
+// SpeedscopeFile is in the file format of speedscope, see https://www.speedscope.app/file-format-schema.json.
+type SpeedscopeFile struct {
+	Schema   string              `json:"$schema"`
+	Shared   SpeedscopeShared    `json:"shared"`
+	Profiles []SpeedscopeProfile `json:"profiles"`
+	Exporter string              `json:"exporter"`
+}
+
+func speedscopeUnit(unit string) string {
+	switch unit {
+	case "nanoseconds", "microseconds", "milliseconds", "seconds", "bytes":
+		return unit
+	}
+	return "none"
+}
+
+// speedscope exports samples with positive values. Speedscope does not support diffs, so only the target profile
+// is exported for a diff profile.
+func (v *view) speedscope() *SpeedscopeFile {
+	f := &SpeedscopeFile{
+		Schema:   "https://www.speedscope.app/file-format-schema.json",
+		Shared:   SpeedscopeShared{Frames: []SpeedscopeFrame{}},
+		Exporter: "tidb-dashboard",
+	}
+	p := SpeedscopeProfile{
+		Type:    "sampled",
+		Name:    v.sampleType.Type,
+		Unit:    speedscopeUnit(v.sampleType.Unit),
+		Samples: [][]int{},
+		Weights: []int64{},
+	}
+	frameIndex := map[string]int{}
+	for _, s := range v.samples {
+		if s.isBase || s.value <= 0 {
+			continue
+		}
+		stack := make([]int, 0, len(s.frames))
+		for _, name := range s.frames {
+			idx, ok := frameIndex[name]
+			if !ok {
+				idx = len(f.Shared.Frames)
+				frameIndex[name] = idx
+				f.Shared.Frames = append(f.Shared.Frames, SpeedscopeFrame{Name: name})
+			}
+			stack = append(stack, idx)
+		}
+		p.Samples = append(p.Samples, stack)
+		p.Weights = append(p.Weights, s.value)
+		p.EndValue += s.value
+	}
+	f.Profiles = []SpeedscopeProfile{p}
+	return f
+}
@@ -4,6 +4,7 @@ package testutil
 
 import (
 	"encoding/hex"
+	"path"
 	"strings"
 	"testing"
 	"time"
@@ -14,6 +15,7 @@ import (
 	"github.com/pingcap/log"
 	"github.com/stretchr/testify/require"
 	"gorm.io/driver/mysql"
+	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 	"moul.io/zapgorm2"
 )
@@ -84,6 +86,21 @@ func OpenMockDB(t *testing.T, configModifier ...func(*gorm.Config)) *TestDB {
 	}
 }
 
+// OpenTestSQLiteDB opens a SQLite database in a temporary directory of the test, which is closed and removed when
+// the test finishes.
+func OpenTestSQLiteDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open(path.Join(t.TempDir(), "test.sqlite.db")), &gorm.Config{
+		Logger: zapgorm2.New(log.L()),
+	})
+	require.Nil(t, err)
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			_ = sqlDB.Close()
+		}
+	})
+	return db
+}
+
 func (db *TestDB) MustClose() {
 	if db.isUnderlyingMocked {
 		db.mock.ExpectClose()